@@ -22,7 +22,9 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/go-logr/zapr"
 	"github.com/openshift/library-go/pkg/controller/controllercmd"
@@ -36,9 +38,13 @@ import (
 	"k8s.io/component-base/logs"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/clock"
+	"open-cluster-management.io/addon-framework/pkg/addonfactory"
 	"open-cluster-management.io/addon-framework/pkg/addonmanager"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/yaml"
 
+	policyaddon "open-cluster-management.io/governance-policy-addon-controller/pkg/addon"
 	"open-cluster-management.io/governance-policy-addon-controller/pkg/addon/configpolicy"
 	"open-cluster-management.io/governance-policy-addon-controller/pkg/addon/policyframework"
 	"open-cluster-management.io/governance-policy-addon-controller/pkg/addon/standalonetemplating"
@@ -48,7 +54,8 @@ import (
 //+kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests;certificatesigningrequests/approval,verbs=get;list;watch;create;update
 //+kubebuilder:rbac:groups=certificates.k8s.io,resources=signers,verbs=approve
 //+kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=managedclusters,verbs=get;list;watch
-//+kubebuilder:rbac:groups=addon.open-cluster-management.io,resources=clustermanagementaddons,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=placementdecisions,verbs=get;list;watch
+//+kubebuilder:rbac:groups=addon.open-cluster-management.io,resources=clustermanagementaddons,verbs=get;list;watch;create
 
 // RBAC below will need to be updated if/when new policy controllers are added.
 
@@ -71,6 +78,7 @@ import (
 //+kubebuilder:rbac:groups=addon.open-cluster-management.io,resources=managedclusteraddons/finalizers,verbs=update,resourceNames=config-policy-controller;governance-policy-framework;governance-standalone-hub-templating
 //+kubebuilder:rbac:groups=addon.open-cluster-management.io,resources=managedclusteraddons/status,verbs=update;patch,resourceNames=config-policy-controller;governance-policy-framework;governance-standalone-hub-templating
 //+kubebuilder:rbac:groups=addon.open-cluster-management.io,resources=clustermanagementaddons/status,verbs=update;patch,resourceNames=config-policy-controller;governance-policy-framework;governance-standalone-hub-templating
+//+kubebuilder:rbac:groups=addon.open-cluster-management.io,resources=clustermanagementaddons,verbs=update,resourceNames=config-policy-controller;governance-policy-framework;governance-standalone-hub-templating
 
 //+kubebuilder:rbac:groups=addon.open-cluster-management.io,resources=clustermanagementaddons/finalizers,verbs=update,resourceNames=config-policy-controller;governance-policy-framework;governance-standalone-hub-templating
 //+kubebuilder:rbac:groups=addon.open-cluster-management.io,resources=addondeploymentconfigs,verbs=get;list;watch
@@ -88,13 +96,19 @@ import (
 //+kubebuilder:rbac:groups=config.openshift.io,resources=infrastructures,verbs=get;list;watch
 
 var (
-	ctrlVersion = version.Info{}
+	ctrlVersion = version.Info{GitVersion: policyaddon.ControllerVersion()}
 	log         = ctrl.Log.WithName("setup")
 	// Set up unified log level and encoding flags
 	zflags = zaputil.FlagConfig{
 		LevelName:   "log-level",
 		EncoderName: "log-encoder",
 	}
+	tracingConfig = policyaddon.TracingConfig{}
+	agentOptions  = policyaddon.AgentOptions{}
+	// The path of the ClusterManagementAddOn configuration file
+	cmaConfigPath string
+	// The default timeout of the addon uninstall
+	uninstallTimeout time.Duration
 )
 
 const (
@@ -104,6 +118,14 @@ const (
 func main() {
 	// Bind command line flags to the various cmd/log configurations
 	zflags.Bind(flag.CommandLine)
+	tracingConfig.BindFlags(flag.CommandLine)
+	agentOptions.BindFlags(flag.CommandLine)
+	flag.CommandLine.StringVar(&cmaConfigPath, "cluster-management-addon-config", "",
+		"The path of the ClusterManagementAddOn configuration file. When it's set, the controller creates "+
+			"the ClusterManagementAddOns of the addons and keeps them as configured.")
+	flag.CommandLine.DurationVar(&uninstallTimeout, "uninstall-timeout", policyaddon.DefaultUninstallTimeout,
+		"The time to wait for the cleanup of an addon before reporting that its uninstall timed out. The "+
+			"policy-addon-uninstall-timeout annotation of the addon overrides it.")
 	klog.InitFlags(flag.CommandLine)
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
 	pflag.CommandLine.SetNormalizeFunc(utilflag.WordSepNormalizeFunc)
@@ -144,6 +166,7 @@ func main() {
 	ctrlcmd.Short = "Start the addon controller"
 
 	cmd.AddCommand(ctrlcmd)
+	cmd.AddCommand(newExportCommand())
 
 	if err := cmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
@@ -157,13 +180,31 @@ func runController(ctx context.Context, controllerContext *controllercmd.Control
 
 	log.Info("Starting "+ctrlName, "GoVersion", runtime.Version(), "GOOS", runtime.GOOS, "GOARCH", runtime.GOARCH)
 
+	shutdownTracing, err := policyaddon.SetupTracing(ctx, tracingConfig, ctrlVersion.GitVersion)
+	if err != nil {
+		log.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+
+	defer func() {
+		// Flush the remaining spans, without waiting on the canceled controller context
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			log.Error(err, "failed to flush the traces")
+		}
+	}()
+
 	mgr, err := addonmanager.New(controllerContext.KubeConfig)
 	if err != nil {
 		log.Error(err, "unable to create new addon manager")
 		os.Exit(1)
 	}
 
-	agentFuncs := []func(context.Context, addonmanager.AddonManager, *controllercmd.ControllerContext) error{
+	agentFuncs := []func(
+		context.Context, addonmanager.AddonManager, *controllercmd.ControllerContext, policyaddon.AgentOptions,
+	) error{
 		policyframework.GetAndAddAgent,
 		configpolicy.GetAndAddAgent,
 		standalonetemplating.GetAndAddAgent,
@@ -172,13 +213,60 @@ func runController(ctx context.Context, controllerContext *controllercmd.Control
 	wg := sync.WaitGroup{}
 
 	for _, f := range agentFuncs {
-		err := f(ctx, mgr, controllerContext)
+		err := f(ctx, mgr, controllerContext, agentOptions)
 		if err != nil {
 			log.Error(err, "unable to get or add agent addon")
 			os.Exit(1)
 		}
 	}
 
+	err = policyaddon.StartClusterChangeTrigger(ctx, mgr, controllerContext,
+		policyframework.AddonName,
+		configpolicy.AddonName,
+		standalonetemplating.AddonName,
+	)
+	if err != nil {
+		log.Error(err, "unable to start the ManagedCluster change trigger")
+		os.Exit(1)
+	}
+
+	err = policyaddon.StartDependencyTrigger(ctx, mgr, controllerContext,
+		slices.Concat(configpolicy.Dependencies, standalonetemplating.Dependencies)...)
+	if err != nil {
+		log.Error(err, "unable to start the addon dependency trigger")
+		os.Exit(1)
+	}
+
+	err = policyaddon.StartUninstallTracker(ctx, controllerContext, uninstallTimeout,
+		policyframework.UninstallHook,
+		configpolicy.UninstallHook,
+	)
+	if err != nil {
+		log.Error(err, "unable to start the addon uninstall tracker")
+		os.Exit(1)
+	}
+
+	err = policyaddon.StartDebugSessionController(ctx, controllerContext,
+		policyframework.AddonName,
+		configpolicy.AddonName,
+	)
+	if err != nil {
+		log.Error(err, "unable to start the addon debug session controller")
+		os.Exit(1)
+	}
+
+	err = policyaddon.StartClusterManagementAddOnController(ctx, controllerContext, cmaConfigPath,
+		map[string]addonapiv1alpha1.AddOnMeta{
+			policyframework.AddonName:      policyframework.AddOnMeta,
+			configpolicy.AddonName:         configpolicy.AddOnMeta,
+			standalonetemplating.AddonName: standalonetemplating.AddOnMeta,
+		},
+	)
+	if err != nil {
+		log.Error(err, "unable to start the ClusterManagementAddOn controller")
+		os.Exit(1)
+	}
+
 	wg.Add(1)
 
 	go func() {
@@ -224,3 +312,68 @@ func setupLogging() {
 		klog.SetLogger(zapr.NewLogger(klogZap).WithName("klog"))
 	}
 }
+
+// newExportCommand returns the command printing the hub objects that deploy the addons from an
+// AddOnTemplate, without this controller.
+func newExportCommand() *cobra.Command {
+	sources := map[string]policyaddon.TemplateSource{
+		policyframework.AddonName:      policyframework.TemplateSource,
+		configpolicy.AddonName:         configpolicy.TemplateSource,
+		standalonetemplating.AddonName: standalonetemplating.TemplateSource,
+	}
+
+	addonNames := []string{policyframework.AddonName, configpolicy.AddonName, standalonetemplating.AddonName}
+	kubeVersion := "v1.30.0"
+	valuesFile := ""
+
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Print the AddOnTemplates of the addons, rendered with the given default values",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			values := addonfactory.Values{}
+
+			if valuesFile != "" {
+				data, err := os.ReadFile(valuesFile)
+				if err != nil {
+					return fmt.Errorf("failed to read the values file: %w", err)
+				}
+
+				if err := yaml.Unmarshal(data, &values); err != nil {
+					return fmt.Errorf("failed to parse the values file %s: %w", valuesFile, err)
+				}
+			}
+
+			for _, addonName := range addonNames {
+				source, ok := sources[addonName]
+				if !ok {
+					return fmt.Errorf("unknown addon %s", addonName)
+				}
+
+				objects, err := policyaddon.ExportAddOnTemplate(source, kubeVersion, values)
+				if err != nil {
+					return fmt.Errorf("failed to export the %s addon: %w", addonName, err)
+				}
+
+				for _, obj := range objects {
+					data, err := yaml.Marshal(obj)
+					if err != nil {
+						return err
+					}
+
+					fmt.Fprintf(cmd.OutOrStdout(), "---\n%s", data)
+				}
+			}
+
+			return nil
+		},
+	}
+
+	exportCmd.Flags().StringSliceVar(&addonNames, "addon", addonNames, "The addons to export")
+	exportCmd.Flags().StringVar(&kubeVersion, "kube-version", kubeVersion,
+		"The Kubernetes version of the managed clusters, which selects some of the agent settings")
+	exportCmd.Flags().StringVar(&valuesFile, "values", "",
+		"A YAML file of chart values, used like the values of an AddOnDeploymentConfig")
+
+	return exportCmd
+}
@@ -0,0 +1,137 @@
+package addon
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterlistersv1 "open-cluster-management.io/api/client/cluster/listers/cluster/v1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+// ClusterClaims that the ClusterCapabilities are built from. The architecture, FIPS, OLM, and
+// cert-manager claims are not reported by the klusterlet by default, so they can be created as
+// ClusterClaims on the managed cluster.
+const (
+	ProductClaim      = "product.open-cluster-management.io"
+	PlatformClaim     = "platform.open-cluster-management.io"
+	KubeVersionClaim  = "kubeversion.open-cluster-management.io"
+	ArchitectureClaim = "architecture.policy.open-cluster-management.io"
+	FIPSClaim         = "fips.policy.open-cluster-management.io"
+	OLMClaim          = "olm.policy.open-cluster-management.io"
+	CertManagerClaim  = "certmanager.policy.open-cluster-management.io"
+)
+
+// ArchitectureLabel is the node label for the CPU architecture. It's used when set on the
+// ManagedCluster and the architecture claim is not reported.
+const ArchitectureLabel = "kubernetes.io/arch"
+
+// ClusterCapabilities describes a cluster that an agent runs on or manages. It is passed to the
+// charts as the `capabilities` and `hostingCapabilities` values.
+type ClusterCapabilities struct {
+	// KubeVersion is the Kubernetes version of the cluster, like v1.30.2.
+	KubeVersion string `json:"kubeVersion,omitempty"`
+	// Product is the Kubernetes distribution, like OpenShift.
+	Product string `json:"product,omitempty"`
+	// Platform is the infrastructure provider, like AWS.
+	Platform string `json:"platform,omitempty"`
+	// Architectures are the CPU architectures of the cluster nodes, like amd64.
+	Architectures []string `json:"architectures,omitempty"`
+	// FIPS is whether the cluster runs in FIPS mode.
+	FIPS bool `json:"fips,omitempty"`
+	// OLM is whether the Operator Lifecycle Manager is available on the cluster.
+	OLM bool `json:"olm,omitempty"`
+	// CertManager is whether cert-manager is available on the cluster to issue certificates.
+	CertManager bool `json:"certManager,omitempty"`
+}
+
+// GetClusterCapabilities builds the ClusterCapabilities from the ManagedCluster status version and
+// cluster claims.
+func GetClusterCapabilities(cluster *clusterv1.ManagedCluster) *ClusterCapabilities {
+	capabilities := &ClusterCapabilities{
+		KubeVersion: cluster.Status.Version.Kubernetes,
+		Product:     GetClusterVendor(cluster),
+	}
+
+	if capabilities.KubeVersion == "" {
+		capabilities.KubeVersion = getClusterClaim(cluster, KubeVersionClaim)
+	}
+
+	capabilities.Platform = getClusterClaim(cluster, PlatformClaim)
+
+	// Fall back to the node architecture label when it's copied to the ManagedCluster
+	archs := getClusterClaim(cluster, ArchitectureClaim)
+	if archs == "" {
+		archs = cluster.Labels[ArchitectureLabel]
+	}
+
+	for _, arch := range strings.Split(archs, ",") {
+		if arch = NormalizeArchitecture(arch); arch != "" && !slices.Contains(capabilities.Architectures, arch) {
+			capabilities.Architectures = append(capabilities.Architectures, arch)
+		}
+	}
+
+	capabilities.FIPS = strings.EqualFold(getClusterClaim(cluster, FIPSClaim), "true")
+
+	// OLM is part of every OpenShift 4 cluster, other clusters need to report it
+	if olm := getClusterClaim(cluster, OLMClaim); olm != "" {
+		capabilities.OLM = strings.EqualFold(olm, "true")
+	} else {
+		capabilities.OLM = cluster.Labels["openshiftVersion-major"] == "4"
+	}
+
+	capabilities.CertManager = strings.EqualFold(getClusterClaim(cluster, CertManagerClaim), "true")
+
+	return capabilities
+}
+
+// KubeVersionAtLeast returns whether the cluster Kubernetes version is at least the given version.
+// It returns false if the cluster version is unknown.
+func (c *ClusterCapabilities) KubeVersionAtLeast(version string) bool {
+	if c == nil || c.KubeVersion == "" {
+		return false
+	}
+
+	clusterVersion, err := semver.NewVersion(c.KubeVersion)
+	if err != nil {
+		return false
+	}
+
+	constraint, err := semver.NewConstraint(">= " + version + "-0")
+	if err != nil {
+		return false
+	}
+
+	return constraint.Check(clusterVersion)
+}
+
+// HasArchitecture returns whether the cluster reports nodes of the given architecture. When no
+// architecture is reported, amd64 is assumed.
+func (c *ClusterCapabilities) HasArchitecture(arch string) bool {
+	if c == nil || len(c.Architectures) == 0 {
+		return arch == "amd64"
+	}
+
+	return slices.Contains(c.Architectures, arch)
+}
+
+// GetHostingCapabilities returns the capabilities of the cluster that the addon agent runs on,
+// which is the hosting cluster in hosted mode. It returns nil if the hosting cluster can't be found.
+func GetHostingCapabilities(
+	cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1alpha1.ManagedClusterAddOn,
+	clusterClient clusterlistersv1.ManagedClusterLister,
+) *ClusterCapabilities {
+	hostingClusterName := addon.GetAnnotations()[addonapiv1alpha1.HostingClusterNameAnnotationKey]
+	if hostingClusterName == "" {
+		return GetClusterCapabilities(cluster)
+	}
+
+	hostingCluster, err := clusterClient.Get(hostingClusterName)
+	if err != nil {
+		return nil
+	}
+
+	return GetClusterCapabilities(hostingCluster)
+}
@@ -0,0 +1,203 @@
+package addon
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterlistersv1 "open-cluster-management.io/api/client/cluster/listers/cluster/v1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+func newManagedCluster(name string, labels map[string]string, claims map[string]string) *clusterv1.ManagedCluster {
+	cluster := &clusterv1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+
+	for claimName, value := range claims {
+		cluster.Status.ClusterClaims = append(cluster.Status.ClusterClaims, clusterv1.ManagedClusterClaim{
+			Name: claimName, Value: value,
+		})
+	}
+
+	return cluster
+}
+
+func TestGetClusterCapabilities(t *testing.T) {
+	tests := map[string]struct {
+		cluster  *clusterv1.ManagedCluster
+		version  string
+		expected ClusterCapabilities
+	}{
+		"no claims": {
+			cluster:  newManagedCluster("cluster1", nil, nil),
+			expected: ClusterCapabilities{},
+		},
+		"status version": {
+			cluster:  newManagedCluster("cluster1", nil, map[string]string{KubeVersionClaim: "v1.28.0"}),
+			version:  "v1.30.2",
+			expected: ClusterCapabilities{KubeVersion: "v1.30.2"},
+		},
+		"version claim": {
+			cluster:  newManagedCluster("cluster1", nil, map[string]string{KubeVersionClaim: "v1.28.0"}),
+			expected: ClusterCapabilities{KubeVersion: "v1.28.0"},
+		},
+		"OpenShift": {
+			cluster: newManagedCluster(
+				"cluster1",
+				map[string]string{"vendor": "OpenShift", "openshiftVersion-major": "4"},
+				map[string]string{PlatformClaim: "AWS"},
+			),
+			expected: ClusterCapabilities{Product: "OpenShift", Platform: "AWS", OLM: true},
+		},
+		"OLM claim overrides the OpenShift default": {
+			cluster: newManagedCluster(
+				"cluster1",
+				map[string]string{"vendor": "OpenShift", "openshiftVersion-major": "4"},
+				map[string]string{OLMClaim: "false"},
+			),
+			expected: ClusterCapabilities{Product: "OpenShift"},
+		},
+		"optional claims": {
+			cluster: newManagedCluster("cluster1", nil, map[string]string{
+				FIPSClaim: "True", OLMClaim: "true", CertManagerClaim: "true",
+			}),
+			expected: ClusterCapabilities{FIPS: true, OLM: true, CertManager: true},
+		},
+		"architecture claim": {
+			cluster: newManagedCluster(
+				"cluster1",
+				map[string]string{ArchitectureLabel: "s390x"},
+				map[string]string{ArchitectureClaim: "x86_64, arm64,amd64,"},
+			),
+			expected: ClusterCapabilities{Architectures: []string{"amd64", "arm64"}},
+		},
+		"architecture label": {
+			cluster:  newManagedCluster("cluster1", map[string]string{ArchitectureLabel: "aarch64"}, nil),
+			expected: ClusterCapabilities{Architectures: []string{"arm64"}},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			test.cluster.Status.Version.Kubernetes = test.version
+
+			capabilities := GetClusterCapabilities(test.cluster)
+
+			if !reflect.DeepEqual(*capabilities, test.expected) {
+				t.Fatalf("expected the capabilities %+v, got %+v", test.expected, *capabilities)
+			}
+		})
+	}
+}
+
+func TestKubeVersionAtLeast(t *testing.T) {
+	tests := map[string]struct {
+		kubeVersion string
+		version     string
+		expected    bool
+	}{
+		"unknown version":    {kubeVersion: "", version: "1.25", expected: false},
+		"invalid version":    {kubeVersion: "unknown", version: "1.25", expected: false},
+		"newer":              {kubeVersion: "v1.30.2", version: "1.25", expected: true},
+		"equal":              {kubeVersion: "v1.25.0", version: "1.25", expected: true},
+		"older":              {kubeVersion: "v1.24.9", version: "1.25", expected: false},
+		"distribution build": {kubeVersion: "v1.25.0+k3s1", version: "1.25", expected: true},
+		"prerelease":         {kubeVersion: "v1.25.0-rc.1", version: "1.25", expected: true},
+		"invalid constraint": {kubeVersion: "v1.25.0", version: "latest", expected: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			capabilities := &ClusterCapabilities{KubeVersion: test.kubeVersion}
+
+			if actual := capabilities.KubeVersionAtLeast(test.version); actual != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+
+	var capabilities *ClusterCapabilities
+	if capabilities.KubeVersionAtLeast("1.25") {
+		t.Fatal("expected nil capabilities to not satisfy any version")
+	}
+}
+
+func TestHasArchitecture(t *testing.T) {
+	tests := map[string]struct {
+		capabilities *ClusterCapabilities
+		arch         string
+		expected     bool
+	}{
+		"nil capabilities assume amd64":   {capabilities: nil, arch: "amd64", expected: true},
+		"no architectures assume amd64":   {capabilities: &ClusterCapabilities{}, arch: "amd64", expected: true},
+		"no architectures exclude others": {capabilities: &ClusterCapabilities{}, arch: "arm64", expected: false},
+		"reported": {
+			capabilities: &ClusterCapabilities{Architectures: []string{"amd64", "arm64"}},
+			arch:         "arm64",
+			expected:     true,
+		},
+		"not reported": {
+			capabilities: &ClusterCapabilities{Architectures: []string{"arm64"}},
+			arch:         "amd64",
+			expected:     false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if actual := test.capabilities.HasArchitecture(test.arch); actual != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestGetHostingCapabilities(t *testing.T) {
+	managed := newManagedCluster("cluster1", nil, map[string]string{ArchitectureClaim: "arm64"})
+	hosting := newManagedCluster("hosting", nil, map[string]string{ArchitectureClaim: "s390x"})
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(hosting); err != nil {
+		t.Fatal(err)
+	}
+
+	clusterLister := clusterlistersv1.NewManagedClusterLister(indexer)
+
+	tests := map[string]struct {
+		hostingCluster string
+		expected       []string
+	}{
+		"default mode":            {expected: []string{"arm64"}},
+		"hosted mode":             {hostingCluster: "hosting", expected: []string{"s390x"}},
+		"missing hosting cluster": {hostingCluster: "missing", expected: nil},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			addon := &addonapiv1alpha1.ManagedClusterAddOn{
+				ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller", Namespace: "cluster1"},
+			}
+
+			if test.hostingCluster != "" {
+				addon.Annotations = map[string]string{
+					addonapiv1alpha1.HostingClusterNameAnnotationKey: test.hostingCluster,
+				}
+			}
+
+			capabilities := GetHostingCapabilities(managed, addon, clusterLister)
+
+			if test.expected == nil {
+				if capabilities != nil {
+					t.Fatalf("expected no capabilities, got %+v", capabilities)
+				}
+
+				return
+			}
+
+			if capabilities == nil || !reflect.DeepEqual(capabilities.Architectures, test.expected) {
+				t.Fatalf("expected the architectures %v, got %+v", test.expected, capabilities)
+			}
+		})
+	}
+}
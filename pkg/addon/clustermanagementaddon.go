@@ -0,0 +1,294 @@
+package addon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/openshift/library-go/pkg/controller/controllercmd"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	addonv1alpha1client "open-cluster-management.io/api/client/addon/clientset/versioned"
+	addonlistersv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
+	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ManagedByLabel marks the ClusterManagementAddOns managed by the controller.
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	managedByValue = "governance-policy-addon-controller"
+)
+
+// ClusterManagementAddOnConfig is the configuration of the ClusterManagementAddOns managed by the
+// controller. The settings apply to every addon, unless they are overridden for the addon.
+type ClusterManagementAddOnConfig struct {
+	ClusterManagementAddOnSettings `json:",inline"`
+
+	// Addons maps addon names to the settings that override the common settings.
+	Addons map[string]ClusterManagementAddOnSettings `json:"addons,omitempty"`
+}
+
+// ClusterManagementAddOnSettings are the settings of a ClusterManagementAddOn.
+type ClusterManagementAddOnSettings struct {
+	// DefaultConfig is the AddOnDeploymentConfig of the addons that don't have another one.
+	DefaultConfig *addonapiv1alpha1.ConfigReferent `json:"defaultConfig,omitempty"`
+	// InstallStrategy is the install strategy of the addon, which defaults to Manual.
+	InstallStrategy *addonapiv1alpha1.InstallStrategy `json:"installStrategy,omitempty"`
+}
+
+// LoadClusterManagementAddOnConfig reads the ClusterManagementAddOn configuration from the YAML or
+// JSON file at path.
+func LoadClusterManagementAddOnConfig(path string) (*ClusterManagementAddOnConfig, error) {
+	content, err := os.ReadFile(path) // #nosec G304 -- the path is configured by the administrator
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the ClusterManagementAddOn configuration: %w", err)
+	}
+
+	config := &ClusterManagementAddOnConfig{}
+
+	if err := yaml.UnmarshalStrict(content, config); err != nil {
+		return nil, fmt.Errorf("failed to parse the ClusterManagementAddOn configuration %s: %w", path, err)
+	}
+
+	for addonName, settings := range config.Addons {
+		if err := settings.validate(); err != nil {
+			return nil, fmt.Errorf("invalid ClusterManagementAddOn configuration of %s: %w", addonName, err)
+		}
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid ClusterManagementAddOn configuration: %w", err)
+	}
+
+	return config, nil
+}
+
+// validate returns an error when the install strategy is not one the addon manager supports, or when
+// its placements have configs other than AddOnDeploymentConfigs.
+func (s ClusterManagementAddOnSettings) validate() error {
+	if s.InstallStrategy == nil {
+		return nil
+	}
+
+	switch s.InstallStrategy.Type {
+	case addonapiv1alpha1.AddonInstallStrategyManual:
+		if len(s.InstallStrategy.Placements) != 0 {
+			return fmt.Errorf("the %s install strategy can't have placements", s.InstallStrategy.Type)
+		}
+	case addonapiv1alpha1.AddonInstallStrategyPlacements:
+		for _, placement := range s.InstallStrategy.Placements {
+			if placement.Name == "" || placement.Namespace == "" {
+				return errors.New("the placements of the install strategy must have a name and a namespace")
+			}
+
+			// The addons only support AddOnDeploymentConfigs, which are namespaced
+			for _, config := range placement.Configs {
+				if config.ConfigGroupResource != deploymentConfigGroupResource {
+					return fmt.Errorf("the configs of the %s placement must be AddOnDeploymentConfigs", placement.Name)
+				}
+
+				if config.Name == "" || config.Namespace == "" {
+					return fmt.Errorf("the configs of the %s placement must have a name and a namespace",
+						placement.Name)
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("unknown install strategy type '%s'", s.InstallStrategy.Type)
+	}
+
+	return nil
+}
+
+// Settings returns the settings of the addon, which are the common settings overridden by the
+// settings of the addon.
+func (c *ClusterManagementAddOnConfig) Settings(addonName string) ClusterManagementAddOnSettings {
+	settings := c.ClusterManagementAddOnSettings
+
+	if override, ok := c.Addons[addonName]; ok {
+		if override.DefaultConfig != nil {
+			settings.DefaultConfig = override.DefaultConfig
+		}
+
+		if override.InstallStrategy != nil {
+			settings.InstallStrategy = override.InstallStrategy
+		}
+	}
+
+	return settings
+}
+
+// desiredSpec sets the AddOnDeploymentConfig of the supported configs and the install strategy of the
+// ClusterManagementAddOn spec from the settings. The other supported configs and fields are left as
+// they are.
+func (s ClusterManagementAddOnSettings) desiredSpec(spec *addonapiv1alpha1.ClusterManagementAddOnSpec) {
+	deploymentConfig := addonapiv1alpha1.ConfigMeta{
+		ConfigGroupResource: deploymentConfigGroupResource,
+		DefaultConfig:       s.DefaultConfig,
+	}
+
+	index := slices.IndexFunc(spec.SupportedConfigs, func(config addonapiv1alpha1.ConfigMeta) bool {
+		return config.ConfigGroupResource == deploymentConfigGroupResource
+	})
+	if index == -1 {
+		spec.SupportedConfigs = append(spec.SupportedConfigs, deploymentConfig)
+	} else {
+		spec.SupportedConfigs[index] = deploymentConfig
+	}
+
+	spec.InstallStrategy = addonapiv1alpha1.InstallStrategy{Type: addonapiv1alpha1.AddonInstallStrategyManual}
+
+	if s.InstallStrategy != nil {
+		spec.InstallStrategy = *s.InstallStrategy
+	}
+}
+
+// ClusterManagementAddOnController creates the ClusterManagementAddOns of the addons and reverts the
+// changes to their AddOnDeploymentConfig and install strategy.
+type ClusterManagementAddOnController struct {
+	addonClient addonv1alpha1client.Interface
+	cmaLister   addonlistersv1alpha1.ClusterManagementAddOnLister
+	config      *ClusterManagementAddOnConfig
+	// addons maps the names of the managed addons to the metadata set on their created
+	// ClusterManagementAddOns.
+	addons map[string]addonapiv1alpha1.AddOnMeta
+}
+
+func (c *ClusterManagementAddOnController) sync(ctx context.Context, _ factory.SyncContext, name string) error {
+	cma, err := c.cmaLister.Get(name)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+
+	settings := c.config.Settings(name)
+
+	if cma == nil {
+		cma = &addonapiv1alpha1.ClusterManagementAddOn{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{ManagedByLabel: managedByValue}},
+			Spec:       addonapiv1alpha1.ClusterManagementAddOnSpec{AddOnMeta: c.addons[name]},
+		}
+		settings.desiredSpec(&cma.Spec)
+
+		_, err := c.addonClient.AddonV1alpha1().ClusterManagementAddOns().Create(ctx, cma, metav1.CreateOptions{})
+		if err != nil {
+			return err
+		}
+
+		log.Info("Created the ClusterManagementAddOn", "addon", name)
+
+		return nil
+	}
+
+	updated := cma.DeepCopy()
+	settings.desiredSpec(&updated.Spec)
+
+	inSync := updated.Labels[ManagedByLabel] == managedByValue &&
+		equality.Semantic.DeepEqual(updated.Spec.SupportedConfigs, cma.Spec.SupportedConfigs) &&
+		// The API server sets the defaults of the placements, like their rollout strategy
+		equality.Semantic.DeepDerivative(updated.Spec.InstallStrategy, cma.Spec.InstallStrategy)
+	if inSync {
+		return nil
+	}
+
+	if updated.Labels == nil {
+		updated.Labels = map[string]string{}
+	}
+
+	updated.Labels[ManagedByLabel] = managedByValue
+
+	_, err = c.addonClient.AddonV1alpha1().ClusterManagementAddOns().Update(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+
+	log.Info("Updated the ClusterManagementAddOn", "addon", name)
+
+	return nil
+}
+
+// StartClusterManagementAddOnController starts a controller managing the ClusterManagementAddOns of
+// the given addons, with the metadata they are created with, when the path of the
+// ClusterManagementAddOn configuration file is set. The controller creates the ClusterManagementAddOns
+// right away, recreates them when they are deleted, and keeps their AddOnDeploymentConfig and install
+// strategy as configured. When the path is not set, the ClusterManagementAddOns are left as they are,
+// including the ones created by the controller before.
+func StartClusterManagementAddOnController(
+	ctx context.Context,
+	controllerContext *controllercmd.ControllerContext,
+	path string,
+	addons map[string]addonapiv1alpha1.AddOnMeta,
+) error {
+	if path == "" {
+		return nil
+	}
+
+	config, err := LoadClusterManagementAddOnConfig(path)
+	if err != nil {
+		return err
+	}
+
+	addonClient, err := addonv1alpha1client.NewForConfig(controllerContext.KubeConfig)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve addon client: %w", err)
+	}
+
+	hubInformers, err := GetHubInformers(controllerContext)
+	if err != nil {
+		return err
+	}
+
+	cmaInformer := hubInformers.Addon.Addon().V1alpha1().ClusterManagementAddOns()
+
+	cmaController := &ClusterManagementAddOnController{
+		addonClient: addonClient,
+		cmaLister:   cmaInformer.Lister(),
+		config:      config,
+		addons:      addons,
+	}
+
+	controller := factory.New().
+		WithFilteredEventsInformersQueueKeysFunc(
+			func(obj runtime.Object) []string {
+				key, _ := cache.MetaNamespaceKeyFunc(obj)
+
+				return []string{key}
+			},
+			func(obj interface{}) bool {
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+
+				accessor, err := meta.Accessor(obj)
+
+				if err != nil {
+					return false
+				}
+
+				_, managed := addons[accessor.GetName()]
+
+				return managed
+			},
+			cmaInformer.Informer(),
+		).
+		WithSync(cmaController.sync).
+		ToController("policy-addon-cluster-management-addon")
+
+	// The missing ClusterManagementAddOns don't have events
+	for addonName := range addons {
+		controller.SyncContext().Queue().Add(addonName)
+	}
+
+	hubInformers.Start(ctx)
+
+	go controller.Run(ctx, 1)
+
+	return nil
+}
@@ -0,0 +1,430 @@
+package addon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+	addonlistersv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
+	clusterv1alpha1 "open-cluster-management.io/api/cluster/v1alpha1"
+)
+
+func TestLoadClusterManagementAddOnConfig(t *testing.T) {
+	tests := map[string]struct {
+		content  string
+		expected *ClusterManagementAddOnConfig
+	}{
+		"common settings and an override": {
+			content: `
+defaultConfig:
+  name: policy-addon-defaults
+  namespace: open-cluster-management
+installStrategy:
+  type: Placements
+  placements:
+  - name: global
+    namespace: open-cluster-management-global-set
+    configs:
+    - group: addon.open-cluster-management.io
+      resource: addondeploymentconfigs
+      name: global-config
+      namespace: open-cluster-management-global-set
+addons:
+  governance-standalone-hub-templating:
+    installStrategy:
+      type: Manual
+`,
+			expected: &ClusterManagementAddOnConfig{
+				ClusterManagementAddOnSettings: ClusterManagementAddOnSettings{
+					DefaultConfig: &addonapiv1alpha1.ConfigReferent{
+						Name: "policy-addon-defaults", Namespace: "open-cluster-management",
+					},
+					InstallStrategy: &addonapiv1alpha1.InstallStrategy{
+						Type: addonapiv1alpha1.AddonInstallStrategyPlacements,
+						Placements: []addonapiv1alpha1.PlacementStrategy{{
+							PlacementRef: addonapiv1alpha1.PlacementRef{
+								Name: "global", Namespace: "open-cluster-management-global-set",
+							},
+							Configs: []addonapiv1alpha1.AddOnConfig{{
+								ConfigGroupResource: deploymentConfigGroupResource,
+								ConfigReferent: addonapiv1alpha1.ConfigReferent{
+									Name: "global-config", Namespace: "open-cluster-management-global-set",
+								},
+							}},
+						}},
+					},
+				},
+				Addons: map[string]ClusterManagementAddOnSettings{
+					"governance-standalone-hub-templating": {
+						InstallStrategy: &addonapiv1alpha1.InstallStrategy{
+							Type: addonapiv1alpha1.AddonInstallStrategyManual,
+						},
+					},
+				},
+			},
+		},
+		"empty": {
+			content:  "{}",
+			expected: &ClusterManagementAddOnConfig{},
+		},
+		"unknown field": {
+			content: `
+defaultConfigs:
+  name: policy-addon-defaults
+`,
+		},
+		"manual install strategy with placements": {
+			content: `
+installStrategy:
+  type: Manual
+  placements:
+  - name: global
+    namespace: open-cluster-management-global-set
+`,
+		},
+		"placement without a namespace": {
+			content: `
+installStrategy:
+  type: Placements
+  placements:
+  - name: global
+`,
+		},
+		"placement config that is not an AddOnDeploymentConfig": {
+			content: `
+installStrategy:
+  type: Placements
+  placements:
+  - name: global
+    namespace: open-cluster-management-global-set
+    configs:
+    - group: addon.open-cluster-management.io
+      resource: addontemplates
+      name: template
+`,
+		},
+		"placement config without a namespace": {
+			content: `
+installStrategy:
+  type: Placements
+  placements:
+  - name: global
+    namespace: open-cluster-management-global-set
+    configs:
+    - group: addon.open-cluster-management.io
+      resource: addondeploymentconfigs
+      name: global-config
+`,
+		},
+		"unknown install strategy": {
+			content: `
+installStrategy:
+  type: Automatic
+`,
+		},
+		"invalid addon override": {
+			content: `
+addons:
+  config-policy-controller:
+    installStrategy:
+      type: Automatic
+`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cma.yaml")
+
+			if err := os.WriteFile(path, []byte(test.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			config, err := LoadClusterManagementAddOnConfig(path)
+
+			if test.expected == nil {
+				if err == nil {
+					t.Fatalf("expected the configuration to be invalid, got %+v", config)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(config, test.expected) {
+				t.Fatalf("expected the configuration %+v, got %+v", test.expected, config)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := LoadClusterManagementAddOnConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+			t.Fatal("expected an error for a missing file")
+		}
+	})
+}
+
+func TestClusterManagementAddOnConfigSettings(t *testing.T) {
+	commonConfig := &addonapiv1alpha1.ConfigReferent{Name: "defaults", Namespace: "open-cluster-management"}
+	addonConfig := &addonapiv1alpha1.ConfigReferent{Name: "config-policy", Namespace: "open-cluster-management"}
+	placements := &addonapiv1alpha1.InstallStrategy{Type: addonapiv1alpha1.AddonInstallStrategyPlacements}
+	manual := &addonapiv1alpha1.InstallStrategy{Type: addonapiv1alpha1.AddonInstallStrategyManual}
+
+	config := &ClusterManagementAddOnConfig{
+		ClusterManagementAddOnSettings: ClusterManagementAddOnSettings{
+			DefaultConfig:   commonConfig,
+			InstallStrategy: placements,
+		},
+		Addons: map[string]ClusterManagementAddOnSettings{
+			"config-policy-controller":             {DefaultConfig: addonConfig},
+			"governance-standalone-hub-templating": {InstallStrategy: manual},
+		},
+	}
+
+	tests := map[string]ClusterManagementAddOnSettings{
+		"governance-policy-framework": {DefaultConfig: commonConfig, InstallStrategy: placements},
+		"config-policy-controller":    {DefaultConfig: addonConfig, InstallStrategy: placements},
+		"governance-standalone-hub-templating": {
+			DefaultConfig: commonConfig, InstallStrategy: manual,
+		},
+	}
+
+	for addonName, expected := range tests {
+		t.Run(addonName, func(t *testing.T) {
+			if settings := config.Settings(addonName); !reflect.DeepEqual(settings, expected) {
+				t.Fatalf("expected the settings %+v, got %+v", expected, settings)
+			}
+		})
+	}
+}
+
+func TestClusterManagementAddOnDesiredSpec(t *testing.T) {
+	defaultConfig := &addonapiv1alpha1.ConfigReferent{Name: "defaults", Namespace: "open-cluster-management"}
+	templateConfig := addonapiv1alpha1.ConfigMeta{
+		ConfigGroupResource: addonapiv1alpha1.ConfigGroupResource{
+			Group: "addon.open-cluster-management.io", Resource: "addontemplates",
+		},
+	}
+	placements := &addonapiv1alpha1.InstallStrategy{
+		Type: addonapiv1alpha1.AddonInstallStrategyPlacements,
+		Placements: []addonapiv1alpha1.PlacementStrategy{{
+			PlacementRef: addonapiv1alpha1.PlacementRef{
+				Name: "global", Namespace: "open-cluster-management-global-set",
+			},
+		}},
+	}
+
+	tests := map[string]struct {
+		settings ClusterManagementAddOnSettings
+		current  addonapiv1alpha1.ClusterManagementAddOnSpec
+		expected addonapiv1alpha1.ClusterManagementAddOnSpec
+	}{
+		"new ClusterManagementAddOn": {
+			expected: addonapiv1alpha1.ClusterManagementAddOnSpec{
+				SupportedConfigs: []addonapiv1alpha1.ConfigMeta{{ConfigGroupResource: deploymentConfigGroupResource}},
+				InstallStrategy:  *manualInstallStrategy(),
+			},
+		},
+		"AddOnDeploymentConfig replaced": {
+			settings: ClusterManagementAddOnSettings{DefaultConfig: defaultConfig, InstallStrategy: placements},
+			current: addonapiv1alpha1.ClusterManagementAddOnSpec{
+				SupportedConfigs: []addonapiv1alpha1.ConfigMeta{{
+					ConfigGroupResource: deploymentConfigGroupResource,
+					DefaultConfig:       &addonapiv1alpha1.ConfigReferent{Name: "other", Namespace: "other"},
+				}},
+				InstallStrategy: *manualInstallStrategy(),
+			},
+			expected: addonapiv1alpha1.ClusterManagementAddOnSpec{
+				SupportedConfigs: []addonapiv1alpha1.ConfigMeta{{
+					ConfigGroupResource: deploymentConfigGroupResource,
+					DefaultConfig:       defaultConfig,
+				}},
+				InstallStrategy: *placements,
+			},
+		},
+		"other supported configs and fields kept": {
+			settings: ClusterManagementAddOnSettings{DefaultConfig: defaultConfig},
+			current: addonapiv1alpha1.ClusterManagementAddOnSpec{
+				AddOnMeta:        addonapiv1alpha1.AddOnMeta{DisplayName: "Config Policy Controller"},
+				SupportedConfigs: []addonapiv1alpha1.ConfigMeta{templateConfig},
+				InstallStrategy:  *placements,
+			},
+			expected: addonapiv1alpha1.ClusterManagementAddOnSpec{
+				AddOnMeta: addonapiv1alpha1.AddOnMeta{DisplayName: "Config Policy Controller"},
+				SupportedConfigs: []addonapiv1alpha1.ConfigMeta{templateConfig, {
+					ConfigGroupResource: deploymentConfigGroupResource,
+					DefaultConfig:       defaultConfig,
+				}},
+				InstallStrategy: *manualInstallStrategy(),
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			spec := test.current
+			test.settings.desiredSpec(&spec)
+
+			if !reflect.DeepEqual(spec, test.expected) {
+				t.Fatalf("expected the spec %+v, got %+v", test.expected, spec)
+			}
+		})
+	}
+}
+
+// manualInstallStrategy returns the Manual install strategy.
+func manualInstallStrategy() *addonapiv1alpha1.InstallStrategy {
+	return &addonapiv1alpha1.InstallStrategy{Type: addonapiv1alpha1.AddonInstallStrategyManual}
+}
+
+func TestClusterManagementAddOnControllerSync(t *testing.T) {
+	addonMeta := addonapiv1alpha1.AddOnMeta{DisplayName: "Config Policy Controller", Description: "Policies"}
+	managedLabels := map[string]string{ManagedByLabel: managedByValue}
+	defaultConfig := &addonapiv1alpha1.ConfigReferent{Name: "defaults", Namespace: "open-cluster-management"}
+	config := &ClusterManagementAddOnConfig{
+		ClusterManagementAddOnSettings: ClusterManagementAddOnSettings{
+			DefaultConfig: defaultConfig,
+			InstallStrategy: &addonapiv1alpha1.InstallStrategy{
+				Type: addonapiv1alpha1.AddonInstallStrategyPlacements,
+				Placements: []addonapiv1alpha1.PlacementStrategy{{
+					PlacementRef: addonapiv1alpha1.PlacementRef{
+						Name: "global", Namespace: "open-cluster-management-global-set",
+					},
+				}},
+			},
+		},
+	}
+
+	desiredSpec := addonapiv1alpha1.ClusterManagementAddOnSpec{
+		SupportedConfigs: []addonapiv1alpha1.ConfigMeta{{
+			ConfigGroupResource: deploymentConfigGroupResource,
+			DefaultConfig:       defaultConfig,
+		}},
+		InstallStrategy: *config.InstallStrategy,
+	}
+
+	// The API server sets the default rollout strategy of the placements
+	defaultedSpec := *desiredSpec.DeepCopy()
+	defaultedSpec.InstallStrategy.Placements[0].RolloutStrategy = clusterv1alpha1.RolloutStrategy{
+		Type: clusterv1alpha1.All,
+	}
+
+	driftedSpec := *desiredSpec.DeepCopy()
+	driftedSpec.InstallStrategy = *manualInstallStrategy()
+	driftedSpec.SupportedConfigs[0].DefaultConfig = &addonapiv1alpha1.ConfigReferent{Name: "other", Namespace: "other"}
+
+	tests := map[string]struct {
+		existing *addonapiv1alpha1.ClusterManagementAddOn
+		// action is the expected client action, or empty when the ClusterManagementAddOn is in sync
+		action   string
+		expected *addonapiv1alpha1.ClusterManagementAddOn
+	}{
+		"missing ClusterManagementAddOn": {
+			action: "create",
+			expected: &addonapiv1alpha1.ClusterManagementAddOn{
+				ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller", Labels: managedLabels},
+				Spec: addonapiv1alpha1.ClusterManagementAddOnSpec{
+					AddOnMeta:        addonMeta,
+					SupportedConfigs: desiredSpec.SupportedConfigs,
+					InstallStrategy:  desiredSpec.InstallStrategy,
+				},
+			},
+		},
+		"drift reverted": {
+			existing: &addonapiv1alpha1.ClusterManagementAddOn{
+				ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller", Labels: managedLabels},
+				Spec:       driftedSpec,
+			},
+			action: "update",
+			expected: &addonapiv1alpha1.ClusterManagementAddOn{
+				ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller", Labels: managedLabels},
+				Spec:       desiredSpec,
+			},
+		},
+		"server defaults kept": {
+			existing: &addonapiv1alpha1.ClusterManagementAddOn{
+				ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller", Labels: managedLabels},
+				Spec:       defaultedSpec,
+			},
+		},
+		"existing ClusterManagementAddOn taken over": {
+			existing: &addonapiv1alpha1.ClusterManagementAddOn{
+				ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller"},
+				Spec: addonapiv1alpha1.ClusterManagementAddOnSpec{
+					AddOnMeta:       addonapiv1alpha1.AddOnMeta{DisplayName: "Custom"},
+					InstallStrategy: defaultedSpec.InstallStrategy,
+				},
+			},
+			action: "update",
+			expected: &addonapiv1alpha1.ClusterManagementAddOn{
+				ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller", Labels: managedLabels},
+				Spec: addonapiv1alpha1.ClusterManagementAddOnSpec{
+					AddOnMeta:        addonapiv1alpha1.AddOnMeta{DisplayName: "Custom"},
+					SupportedConfigs: desiredSpec.SupportedConfigs,
+					InstallStrategy:  desiredSpec.InstallStrategy,
+				},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			addonClient := fakeaddon.NewSimpleClientset()
+
+			if test.existing != nil {
+				if err := indexer.Add(test.existing); err != nil {
+					t.Fatal(err)
+				}
+
+				addonClient = fakeaddon.NewSimpleClientset(test.existing)
+			}
+
+			controller := &ClusterManagementAddOnController{
+				addonClient: addonClient,
+				cmaLister:   addonlistersv1alpha1.NewClusterManagementAddOnLister(indexer),
+				config:      config,
+				addons:      map[string]addonapiv1alpha1.AddOnMeta{"config-policy-controller": addonMeta},
+			}
+
+			if err := controller.sync(context.TODO(), nil, "config-policy-controller"); err != nil {
+				t.Fatal(err)
+			}
+
+			actions := addonClient.Actions()
+
+			if test.action == "" {
+				if len(actions) != 0 {
+					t.Fatalf("expected no changes, got the actions %v", actions)
+				}
+
+				return
+			}
+
+			if len(actions) != 1 || actions[0].GetVerb() != test.action {
+				t.Fatalf("expected a %s action, got %v", test.action, actions)
+			}
+
+			cma, err := addonClient.AddonV1alpha1().ClusterManagementAddOns().Get(
+				context.TODO(), "config-policy-controller", metav1.GetOptions{},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(cma.Labels, test.expected.Labels) ||
+				!reflect.DeepEqual(cma.Spec, test.expected.Spec) {
+				t.Fatalf("expected the ClusterManagementAddOn %+v, got %+v", test.expected, cma)
+			}
+		})
+	}
+}
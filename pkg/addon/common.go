@@ -4,6 +4,7 @@ import (
 	"context"
 	"embed"
 	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"strconv"
@@ -14,6 +15,7 @@ import (
 	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
 	prometheusv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -32,6 +34,7 @@ var log = ctrl.Log.WithName("common")
 const (
 	PolicyAddonPauseAnnotation      = "policy-addon-pause"
 	PolicyLogLevelAnnotation        = "log-level"
+	PolicyPkgLogLevelAnnotation     = "pkg-log-level"
 	EvaluationConcurrencyAnnotation = "policy-evaluation-concurrency"
 	ClientQPSAnnotation             = "client-qps"
 	ClientBurstAnnotation           = "client-burst"
@@ -43,18 +46,25 @@ const (
 
 // CommonValues contains common values for the addon chart.
 type CommonValues struct {
-	BaseValues `json:",inline"`
-	UserArgs   `json:",inline"`
-
-	KubernetesDistribution        string `json:"kubernetesDistribution,omitempty"`
-	HostingKubernetesDistribution string `json:"hostingKubernetesDistribution,omitempty"`
+	BaseValues       `json:",inline"`
+	UserArgs         `json:",inline"`
+	SchedulingValues `json:",inline"`
+
+	KubernetesDistribution        string               `json:"kubernetesDistribution,omitempty"`
+	HostingKubernetesDistribution string               `json:"hostingKubernetesDistribution,omitempty"`
+	Capabilities                  *ClusterCapabilities `json:"capabilities,omitempty"`
+	HostingCapabilities           *ClusterCapabilities `json:"hostingCapabilities,omitempty"`
+	Probes                        *ProbesConfig        `json:"probes,omitempty"`
+	TerminationGracePeriodSeconds *int32               `json:"terminationGracePeriodSeconds,omitempty"`
+	Tracing                       *TracingValues       `json:"tracing,omitempty"`
+	LoggingConfigMap              *bool                `json:"loggingConfigMap,omitempty"`
 }
 
 // UserArgs contains common controller flags for the addon chart.
 type UserArgs struct {
 	LogEncoder            string `json:"logEncoder,omitempty"`
 	LogLevel              int8   `json:"logLevel,omitempty"`
-	PkgLogLevel           int8   `json:"pkgLogLevel,omitempty"`
+	PkgLogLevel           *int8  `json:"pkgLogLevel,omitempty"`
 	EvaluationConcurrency uint8  `json:"evaluationConcurrency,omitempty"`
 	ClientQPS             uint8  `json:"clientQPS,omitempty"` //nolint:tagliatelle
 	ClientBurst           uint8  `json:"clientBurst,omitempty"`
@@ -66,6 +76,9 @@ type GlobalValues struct {
 	ImagePullSecret string            `json:"imagePullSecret,omitempty"`
 	ImageOverrides  map[string]string `json:"imageOverrides,omitempty"`
 	ProxyConfig     *ProxyConfig      `json:"proxyConfig,omitempty"`
+	NodeSelector    map[string]string `json:"nodeSelector,omitempty"`
+
+	ResourceRequirements []ResourceRequirement `json:"resourceRequirements,omitempty"`
 }
 
 // ProxyConfig contains proxy configuration values for the addon chart.
@@ -86,15 +99,20 @@ type BaseValues struct {
 	PrometheusConfig              *PrometheusConfig `json:"prometheus,omitempty"`
 }
 
-// Prometheus contains Prometheus metrics configuration values for the addon chart.
+// Prometheus contains Prometheus metrics configuration values for the addon chart. The fields are
+// omitted when they're not set so that each setting only overrides its own chart value.
 type PrometheusConfig struct {
-	Enabled        bool            `json:"enabled,omitempty"`
-	ServiceMonitor *ServiceMonitor `json:"serviceMonitor,omitempty"`
+	Enabled        *bool             `json:"enabled,omitempty"`
+	ServiceMonitor *ServiceMonitor   `json:"serviceMonitor,omitempty"`
+	TLS            *MetricsTLSConfig `json:"tls,omitempty"`
 }
 
 // ServiceMonitor contains Prometheus ServiceMonitor configuration values for the addon chart.
 type ServiceMonitor struct {
-	Namespace *string `json:"namespace,omitempty"`
+	Namespace   *string                      `json:"namespace,omitempty"`
+	Interval    prometheusv1.Duration        `json:"interval,omitempty"`
+	Labels      map[string]string            `json:"labels,omitempty"`
+	Relabelings []prometheusv1.RelabelConfig `json:"relabelings,omitempty"`
 }
 
 var Scheme = runtime.NewScheme()
@@ -111,6 +129,11 @@ func init() {
 		log.Error(err, "Failed to add the Prometheus scheme to scheme")
 		os.Exit(1)
 	}
+
+	// The cert-manager resources of the metrics certificate are rendered as unstructured objects
+	for _, kind := range []string{"Certificate", "Issuer"} {
+		Scheme.AddKnownTypeWithName(certManagerGroupVersion.WithKind(kind), &unstructured.Unstructured{})
+	}
 }
 
 // NewRegistrationOption creates a new registration option for the addon.
@@ -121,9 +144,11 @@ func NewRegistrationOption(
 	filesystem embed.FS,
 	useClusterRole bool,
 ) *agent.RegistrationOption {
-	applyManifestFromFile := func(file, clusterName string,
+	applyManifestFromFile := func(ctx context.Context, file, clusterName string,
 		kubeclient *kubernetes.Clientset, recorder events.Recorder,
 	) error {
+		ctx, span := startSpan(ctx, "ApplyPermissions/"+file, clusterName, nil)
+
 		groupIdx := 0 // 0 is a cluster-specific group
 
 		if useClusterRole {
@@ -139,7 +164,7 @@ func NewRegistrationOption(
 			Group:       groups[groupIdx],
 		}
 
-		results := resourceapply.ApplyDirectly(context.Background(),
+		results := resourceapply.ApplyDirectly(ctx,
 			resourceapply.NewKubeClientHolder(kubeclient),
 			recorder,
 			resourceapply.NewResourceCache(),
@@ -156,32 +181,46 @@ func NewRegistrationOption(
 
 		for _, result := range results {
 			if result.Error != nil {
+				endSpan(span, result.Error)
+
 				return result.Error
 			}
 		}
 
+		endSpan(span, nil)
+
 		return nil
 	}
 
 	kubeConfig := controllerContext.KubeConfig
 	recorder := controllerContext.EventRecorder
 
+	applyPermissions := func(ctx context.Context, clusterName string) error {
+		kubeclient, err := kubernetes.NewForConfig(kubeConfig)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range agentPermissionFiles {
+			if err := applyManifestFromFile(ctx, file, clusterName, kubeclient, recorder); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
 	return &agent.RegistrationOption{
 		CSRConfigurations: agent.KubeClientSignerConfigurations(addonName, addonName),
 		CSRApproveCheck:   utils.DefaultCSRApprover(addonName),
-		PermissionConfig: func(cluster *clusterv1.ManagedCluster, _ *addonapiv1alpha1.ManagedClusterAddOn) error {
-			kubeclient, err := kubernetes.NewForConfig(kubeConfig)
-			if err != nil {
-				return err
-			}
+		PermissionConfig: func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+			ctx, span := startSpan(context.Background(), "PermissionConfig", cluster.Name, addon)
 
-			for _, file := range agentPermissionFiles {
-				if err := applyManifestFromFile(file, cluster.Name, kubeclient, recorder); err != nil {
-					return err
-				}
-			}
+			err := applyPermissions(ctx, cluster.Name)
+
+			endSpan(span, err)
 
-			return nil
+			return err
 		},
 	}
 }
@@ -206,20 +245,72 @@ func GetClusterVendor(cluster *clusterv1.ManagedCluster) string {
 	return vendor
 }
 
+// AgentOptions are the settings of the addon agents that are set with command line flags of the
+// controller.
+type AgentOptions struct {
+	// ImageTrustPolicyPath is the path of the image trust policy file. When it's set, the agent images
+	// are pinned by digest and verified before deploying.
+	ImageTrustPolicyPath string
+	// AutoSizingConfigPath is the path of the auto-sizing configuration file. When it's set, the agent
+	// resources and evaluation concurrency are picked from the tier matching the number of policies
+	// of each cluster.
+	AutoSizingConfigPath string
+}
+
+// BindFlags adds the agent flags to the flag set.
+func (o *AgentOptions) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.ImageTrustPolicyPath, "image-trust-policy", "",
+		"The path of the image trust policy file. When it's set, the agent images are pinned by digest "+
+			"and verified against the policy before deploying.")
+	fs.StringVar(&o.AutoSizingConfigPath, "auto-sizing-config", "",
+		"The path of the auto-sizing configuration file. When it's set, the agent resources and evaluation "+
+			"concurrency are picked from the tier matching the number of policies of each cluster.")
+}
+
 // GetAndAddAgent adds the agent to the manager.
 func GetAndAddAgent(
 	ctx context.Context,
 	mgr addonmanager.AddonManager,
 	addonName string,
 	controllerContext *controllercmd.ControllerContext,
+	options AgentOptions,
 	getAgent func(context.Context, *controllercmd.ControllerContext) (agent.AgentAddon, error),
+	uninstallHook *UninstallHook,
 ) error {
 	agentAddon, err := getAgent(ctx, controllerContext)
 	if err != nil {
 		return fmt.Errorf("failed getting the %v agent addon: %w", addonName, err)
 	}
 
-	agentAddon = &PolicyAgentAddon{agentAddon}
+	statusUpdater, err := NewAddonStatusUpdater(controllerContext.KubeConfig)
+	if err != nil {
+		return fmt.Errorf("failed getting the %v addon status updater: %w", addonName, err)
+	}
+
+	imageVerifier, err := LoadImageVerifier(options.ImageTrustPolicyPath)
+	if err != nil {
+		return fmt.Errorf("failed getting the %v addon image verifier: %w", addonName, err)
+	}
+
+	namespaceChecker, err := NewHostedNamespaceChecker(ctx, mgr, controllerContext, agentAddon)
+	if err != nil {
+		return fmt.Errorf("failed getting the %v addon hosted namespace checker: %w", addonName, err)
+	}
+
+	migrator, err := NewNamespaceMigrator(ctx, mgr, controllerContext, addonName)
+	if err != nil {
+		return fmt.Errorf("failed getting the %v addon namespace migrator: %w", addonName, err)
+	}
+
+	agentAddon = &PolicyAgentAddon{
+		AgentAddon:    agentAddon,
+		statusUpdater: statusUpdater,
+		imageVerifier: imageVerifier,
+		uninstallHook: uninstallHook,
+
+		namespaceChecker: namespaceChecker,
+		migrator:         migrator,
+	}
 
 	err = mgr.AddAgent(agentAddon)
 	if err != nil {
@@ -232,13 +323,41 @@ func GetAndAddAgent(
 // PolicyAgentAddon wraps the AgentAddon created from the addonfactory to override some behavior
 type PolicyAgentAddon struct {
 	agent.AgentAddon
+	statusUpdater *AddonStatusUpdater
+	// imageVerifier pins and verifies the agent images, when an image trust policy is configured
+	imageVerifier *ImageVerifier
+	// uninstallHook renders the pre-delete cleanup Job, when the addon needs one
+	uninstallHook *UninstallHook
+	// namespaceChecker refuses hosted addons whose install namespace is used by another cluster
+	namespaceChecker *HostedNamespaceChecker
+	// migrator keeps the previous agent while the agent moves to a new install namespace
+	migrator *NamespaceMigrator
 }
 
 // Manifests overrides the AgentAddon.Manifests method to return an error when
-// the policy addon is paused.
+// the policy addon is paused or its hosted install namespace is invalid or
+// already used, to check the rendered agent images against the
+// CompatibilityMatrix, to add the pre-delete cleanup Job, to pin and verify the
+// images when an image trust policy is configured, and to keep the previous
+// agent until the agent in a new install namespace is healthy.
 func (pa *PolicyAgentAddon) Manifests(
 	cluster *clusterv1.ManagedCluster,
 	addon *addonapiv1alpha1.ManagedClusterAddOn,
+) ([]runtime.Object, error) {
+	ctx, span := startSpan(context.Background(), "Manifests", cluster.Name, addon)
+
+	objects, err := pa.manifests(ctx, cluster, addon)
+
+	endSpan(span, err)
+
+	return objects, err
+}
+
+// manifests renders and adjusts the manifests of the addon for Manifests.
+func (pa *PolicyAgentAddon) manifests(
+	ctx context.Context,
+	cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1alpha1.ManagedClusterAddOn,
 ) ([]runtime.Object, error) {
 	// Return error when pause annotation is set to short-circuit automatic addon updates
 	pauseAnnotation := addon.GetAnnotations()[PolicyAddonPauseAnnotation]
@@ -246,7 +365,93 @@ func (pa *PolicyAgentAddon) Manifests(
 		return nil, errors.New("the Policy Addon controller is paused due to the policy-addon-pause annotation")
 	}
 
-	return pa.AgentAddon.Manifests(cluster, addon)
+	// The conditions are patched on the status at once, also when the addon isn't deployed
+	conditions := &AddonConditions{}
+
+	defer func() {
+		if pa.statusUpdater == nil {
+			return
+		}
+
+		if err := pa.statusUpdater.UpdateConditions(ctx, addon, conditions); err != nil {
+			log.Error(err, "Failed to report the addon conditions", "cluster", cluster.Name, "addon", addon.Name)
+		}
+	}()
+
+	if pa.namespaceChecker != nil {
+		condition, err := pa.namespaceChecker.Check(addon)
+
+		if condition != nil {
+			conditions.Set(*condition)
+		} else if err == nil {
+			conditions.Remove(HostedNamespaceAvailableCondition)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The render span includes the values functions and the Helm rendering
+	renderCtx, renderSpan := startSpan(ctx, "Render", cluster.Name, addon)
+
+	renderContexts.Store(renderKey(addon), renderCtx)
+
+	objects, err := pa.AgentAddon.Manifests(cluster, addon)
+
+	renderContexts.Delete(renderKey(addon))
+	endSpan(renderSpan, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	objects, condition, err := ApplyAgentCompatibility(objects)
+
+	conditions.Set(condition)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The cleanup Job is built from the agent arguments after they are adjusted for the agent version
+	if pa.uninstallHook != nil {
+		if job := pa.uninstallHook.BuildUninstallJob(cluster, addon, objects); job != nil {
+			objects = append(objects, job)
+		}
+	}
+
+	// The images are pinned after the compatibility check, which relies on the image tags
+	if pa.imageVerifier == nil {
+		conditions.Remove(ImageVerifiedCondition)
+	} else {
+		trustCtx, trustSpan := startSpan(ctx, "ApplyImageTrust", cluster.Name, addon)
+
+		condition, err := pa.imageVerifier.ApplyImageTrust(trustCtx, objects)
+
+		endSpan(trustSpan, err)
+		conditions.Set(condition)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The previous agent is added last since its manifests were already adjusted when it was deployed
+	if pa.migrator == nil {
+		return objects, nil
+	}
+
+	objects, migration, err := pa.migrator.Migrate(addon, objects)
+	if err != nil {
+		return nil, err
+	}
+
+	if migration != nil {
+		conditions.Set(*migration)
+	}
+
+	return objects, nil
 }
 
 // CommonAgentInstallNamespaceFromDeploymentConfigFunc returns a function that
@@ -301,16 +506,44 @@ func GetLogLevel(level string) (int8, error) {
 	return int8(logLevel), nil
 }
 
-// SetLogLevel sets the log level for the addon, setting the package log level
-// to 2 less than the user log level.
+// GetPkgLogLevel verifies the user-provided package log level, which is the klog verbosity of the
+// libraries used by the addon, returning an error if it isn't a non-negative integer.
+func GetPkgLogLevel(level string) (int8, error) {
+	pkgLogLevel, err := strconv.ParseInt(level, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse package log level value '%s': %w", level, err)
+	}
+
+	if pkgLogLevel < 0 {
+		return 0, fmt.Errorf("failed to parse package log level value '%s': it must not be negative", level)
+	}
+
+	// This is safe because we specified the int8 in ParseInt
+	return int8(pkgLogLevel), nil
+}
+
+// SetLogLevel sets the log level for the addon. Unless the package log level is set explicitly, the
+// charts set it to 2 less than the log level, so that it follows the log level of every layer of
+// values.
 func (cv *CommonValues) SetLogLevel(value string) error {
 	logLevel, err := GetLogLevel(value)
 	cv.UserArgs.LogLevel = logLevel
-	cv.UserArgs.PkgLogLevel = logLevel - 2
 
 	return err
 }
 
+// SetPkgLogLevel sets the package log level for the addon, independently of the log level.
+func (cv *CommonValues) SetPkgLogLevel(value string) error {
+	pkgLogLevel, err := GetPkgLogLevel(value)
+	if err != nil {
+		return fmt.Errorf("%w (falling back to the value derived from the log level)", err)
+	}
+
+	cv.UserArgs.PkgLogLevel = &pkgLogLevel
+
+	return nil
+}
+
 // SetEvaluationConcurrency sets the evaluation concurrency for the addon.
 func (cv *CommonValues) SetEvaluationConcurrency(value string) error {
 	evaluationConcurrency, err := strconv.ParseUint(value, 10, 8)
@@ -370,9 +603,7 @@ func (cv *CommonValues) SetPrometheusEnabled(value string) error {
 			value, false, err)
 	}
 
-	cv.PrometheusConfig = &PrometheusConfig{
-		Enabled: prometheusEnabled,
-	}
+	cv.prometheus().Enabled = &prometheusEnabled
 
 	return nil
 }
@@ -389,25 +620,36 @@ func (cv *CommonValues) SetCommonValues(
 	clusterClient clusterlistersv1.ManagedClusterLister,
 ) error {
 	var err error
-	// Set the Kubernetes distribution for the current cluster
+	// Set the Kubernetes distribution and capabilities for the current cluster
 	cv.KubernetesDistribution = GetClusterVendor(cluster)
+	cv.Capabilities = GetClusterCapabilities(cluster)
 
-	// Set the Kubernetes distribution for the hosting cluster
+	// Set the Kubernetes distribution and capabilities for the hosting cluster
 	hostingClusterName := addon.GetAnnotations()[addonapiv1alpha1.HostingClusterNameAnnotationKey]
 	if hostingClusterName != "" {
 		hostingCluster, err := clusterClient.Get(hostingClusterName)
 		if err == nil {
 			cv.HostingKubernetesDistribution = GetClusterVendor(hostingCluster)
+			cv.HostingCapabilities = GetClusterCapabilities(hostingCluster)
 		}
 	} else {
 		cv.HostingKubernetesDistribution = cv.KubernetesDistribution
+		cv.HostingCapabilities = cv.Capabilities
 	}
 
 	// Enable Prometheus metrics by default on OpenShift
+	prometheusEnabled := cv.HostingKubernetesDistribution == "OpenShift"
+
 	cv.PrometheusConfig = &PrometheusConfig{
-		Enabled: cv.HostingKubernetesDistribution == "OpenShift",
+		Enabled: &prometheusEnabled,
+		TLS: &MetricsTLSConfig{
+			Mode: defaultMetricsTLSMode(cv.HostingKubernetesDistribution, cv.HostingCapabilities),
+		},
 	}
 
+	// Pass the tracing settings of the controller down to the agents
+	cv.Tracing = getTracingValues()
+
 	return err
 }
 
@@ -423,16 +665,35 @@ func (cv *CommonValues) SetCommonValuesFromCustomizedVariables(
 
 	//nolint:nlreturn,unparam
 	variableToFuncMap := map[string]func(string) error{
-		"logLevel":              cv.SetLogLevel,
-		"logEncoder":            func(value string) error { cv.UserArgs.LogEncoder = value; return nil },
-		"evaluationConcurrency": cv.SetEvaluationConcurrency,
-		"clientQPS":             cv.SetClientQPS,
-		"clientBurst":           cv.SetClientBurst,
-		"prometheusEnabled":     cv.SetPrometheusEnabled,
+		"logLevel":                      cv.SetLogLevel,
+		"pkgLogLevel":                   cv.SetPkgLogLevel,
+		"logEncoder":                    func(value string) error { cv.UserArgs.LogEncoder = value; return nil },
+		"loggingConfigMap":              cv.SetLoggingConfigMap,
+		"evaluationConcurrency":         cv.SetEvaluationConcurrency,
+		"clientQPS":                     cv.SetClientQPS,
+		"clientBurst":                   cv.SetClientBurst,
+		"prometheusEnabled":             cv.SetPrometheusEnabled,
+		"metricsTLSMode":                cv.SetMetricsTLSMode,
+		"metricsCertIssuer":             cv.SetMetricsCertIssuer,
+		"serviceMonitorNamespace":       cv.SetServiceMonitorNamespace,
+		"scrapeInterval":                cv.SetScrapeInterval,
+		"serviceMonitorLabels":          cv.SetServiceMonitorLabels,
+		"relabelings":                   cv.SetRelabelings,
+		"livenessProbe":                 cv.SetLivenessProbe,
+		"readinessProbe":                cv.SetReadinessProbe,
+		"startupProbe":                  cv.SetStartupProbe,
+		"probeInitialDelaySeconds":      cv.SetProbeInitialDelay,
+		"terminationGracePeriodSeconds": cv.SetTerminationGracePeriod,
+		"affinity":                      cv.SetAffinity,
+		"topologySpreadConstraints":     cv.SetTopologySpreadConstraints,
 	}
 
+	tolerationsMode := ""
+
 	for _, variable := range config.Spec.CustomizedVariables {
-		if fn, ok := variableToFuncMap[variable.Name]; ok {
+		if variable.Name == "tolerationsMode" {
+			tolerationsMode = variable.Value
+		} else if fn, ok := variableToFuncMap[variable.Name]; ok {
 			if err := fn(variable.Value); err != nil {
 				aggregateErr = errors.Join(aggregateErr, err)
 			}
@@ -442,6 +703,12 @@ func (cv *CommonValues) SetCommonValuesFromCustomizedVariables(
 		}
 	}
 
+	// The node placement is set here rather than with addonfactory.ToAddOnNodePlacementValues so
+	// that the tolerations can be appended to the chart defaults
+	if err := cv.setNodePlacement(config.Spec.NodePlacement, tolerationsMode); err != nil {
+		aggregateErr = errors.Join(aggregateErr, err)
+	}
+
 	cv.SetClientBurstFromEvaluationConcurrency()
 
 	return values, aggregateErr
@@ -456,11 +723,24 @@ func (cv *CommonValues) SetCommonValuesFromAnnotations(addon *addonapiv1alpha1.M
 	var aggregateErr error
 
 	annotationToFuncMap := map[string]func(string) error{
-		PolicyLogLevelAnnotation:        cv.SetLogLevel,
-		EvaluationConcurrencyAnnotation: cv.SetEvaluationConcurrency,
-		ClientQPSAnnotation:             cv.SetClientQPS,
-		ClientBurstAnnotation:           cv.SetClientBurst,
-		PrometheusEnabledAnnotation:     cv.SetPrometheusEnabled,
+		PolicyLogLevelAnnotation:          cv.SetLogLevel,
+		PolicyPkgLogLevelAnnotation:       cv.SetPkgLogLevel,
+		LoggingConfigMapAnnotation:        cv.SetLoggingConfigMap,
+		EvaluationConcurrencyAnnotation:   cv.SetEvaluationConcurrency,
+		ClientQPSAnnotation:               cv.SetClientQPS,
+		ClientBurstAnnotation:             cv.SetClientBurst,
+		PrometheusEnabledAnnotation:       cv.SetPrometheusEnabled,
+		MetricsTLSModeAnnotation:          cv.SetMetricsTLSMode,
+		MetricsCertIssuerAnnotation:       cv.SetMetricsCertIssuer,
+		ServiceMonitorNamespaceAnnotation: cv.SetServiceMonitorNamespace,
+		ScrapeIntervalAnnotation:          cv.SetScrapeInterval,
+		ServiceMonitorLabelsAnnotation:    cv.SetServiceMonitorLabels,
+		RelabelingsAnnotation:             cv.SetRelabelings,
+		LivenessProbeAnnotation:           cv.SetLivenessProbe,
+		ReadinessProbeAnnotation:          cv.SetReadinessProbe,
+		StartupProbeAnnotation:            cv.SetStartupProbe,
+		ProbeInitialDelayAnnotation:       cv.SetProbeInitialDelay,
+		TerminationGracePeriodAnnotation:  cv.SetTerminationGracePeriod,
 	}
 
 	for annotation, fn := range annotationToFuncMap {
@@ -490,5 +770,10 @@ func MandateValues(
 		values["uninstallationAnnotation"] = "true"
 	}
 
+	// A debug session overrides the log levels from the annotations and the AddOnDeploymentConfig
+	for key, value := range debugSessionValues(mcao) {
+		values[key] = value
+	}
+
 	return values, nil
 }
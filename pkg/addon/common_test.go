@@ -0,0 +1,162 @@
+package addon
+
+import (
+	"fmt"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"open-cluster-management.io/addon-framework/pkg/addonfactory"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+)
+
+func TestLogLevelLayering(t *testing.T) {
+	tests := map[string]struct {
+		annotations map[string]string
+		variables   map[string]string
+		logLevel    string
+		pkgLogLevel string
+	}{
+		"no settings": {},
+		"log level annotation": {
+			annotations: map[string]string{PolicyLogLevelAnnotation: "4"},
+			logLevel:    "4",
+		},
+		"package log level annotation kept with the log level variable": {
+			annotations: map[string]string{PolicyLogLevelAnnotation: "4", PolicyPkgLogLevelAnnotation: "5"},
+			variables:   map[string]string{"logLevel": "8"},
+			logLevel:    "8",
+			pkgLogLevel: "5",
+		},
+		"package log level variable": {
+			annotations: map[string]string{PolicyLogLevelAnnotation: "4", PolicyPkgLogLevelAnnotation: "5"},
+			variables:   map[string]string{"pkgLogLevel": "1"},
+			logLevel:    "4",
+			pkgLogLevel: "1",
+		},
+		"log level variable only": {
+			variables: map[string]string{"logLevel": "8"},
+			logLevel:  "8",
+		},
+		"invalid package log level": {
+			annotations: map[string]string{PolicyLogLevelAnnotation: "4", PolicyPkgLogLevelAnnotation: "-1"},
+			logLevel:    "4",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			annotationValues := &CommonValues{}
+
+			// Invalid settings are reported and ignored
+			_ = annotationValues.SetCommonValuesFromAnnotations(&addonapiv1alpha1.ManagedClusterAddOn{
+				ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller", Annotations: test.annotations},
+			})
+
+			config := addonapiv1alpha1.AddOnDeploymentConfig{}
+			for variable, value := range test.variables {
+				config.Spec.CustomizedVariables = append(config.Spec.CustomizedVariables,
+					addonapiv1alpha1.CustomizedVariable{Name: variable, Value: value})
+			}
+
+			variableValues := &CommonValues{}
+			_, _ = variableValues.SetCommonValuesFromCustomizedVariables(config)
+
+			fromAnnotations, err := addonfactory.JsonStructToValues(annotationValues)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fromVariables, err := addonfactory.JsonStructToValues(variableValues)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The AddOnDeploymentConfig values are merged over the annotation values
+			values := addonfactory.MergeValues(fromAnnotations, fromVariables)
+
+			for key, expected := range map[string]string{"logLevel": test.logLevel, "pkgLogLevel": test.pkgLogLevel} {
+				actual := ""
+				if value, ok := values[key]; ok {
+					actual = fmt.Sprint(value)
+				}
+
+				if actual != expected {
+					t.Fatalf("expected %s to be %q, got %q", key, expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestAgentInstallNamespace(t *testing.T) {
+	config := &addonapiv1alpha1.AddOnDeploymentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "install-ns", Namespace: "open-cluster-management"},
+		Spec:       addonapiv1alpha1.AddOnDeploymentConfigSpec{AgentInstallNamespace: "config-ns"},
+	}
+	getNamespace := CommonAgentInstallNamespaceFromDeploymentConfigFunc(
+		utils.NewAddOnDeploymentConfigGetter(fakeaddon.NewSimpleClientset(config)),
+	)
+
+	hosted := map[string]string{addonapiv1alpha1.HostingClusterNameAnnotationKey: "hosting"}
+	configReferences := []addonapiv1alpha1.ConfigReference{{
+		ConfigGroupResource: addonapiv1alpha1.ConfigGroupResource{
+			Group: "addon.open-cluster-management.io", Resource: "addondeploymentconfigs",
+		},
+		DesiredConfig: &addonapiv1alpha1.ConfigSpecHash{
+			ConfigReferent: addonapiv1alpha1.ConfigReferent{Name: config.Name, Namespace: config.Namespace},
+			SpecHash:       "hash",
+		},
+	}}
+
+	tests := map[string]struct {
+		annotations      map[string]string
+		installNamespace string
+		configReferences []addonapiv1alpha1.ConfigReference
+		expected         string
+	}{
+		"hosted addon with the install namespace in the spec": {
+			annotations:      hosted,
+			installNamespace: "addon-ns",
+			configReferences: configReferences,
+			expected:         "addon-ns",
+		},
+		"hosted addon with the install namespace from the AddOnDeploymentConfig": {
+			annotations:      hosted,
+			configReferences: configReferences,
+			expected:         "config-ns",
+		},
+		"addon in the default mode ignores the install namespace in the spec": {
+			installNamespace: "addon-ns",
+			configReferences: configReferences,
+			expected:         "config-ns",
+		},
+		"addon without an AddOnDeploymentConfig": {
+			expected: "",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			addon := &addonapiv1alpha1.ManagedClusterAddOn{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "config-policy-controller", Namespace: "c1", Annotations: test.annotations,
+				},
+				Spec: addonapiv1alpha1.ManagedClusterAddOnSpec{InstallNamespace: test.installNamespace},
+				Status: addonapiv1alpha1.ManagedClusterAddOnStatus{
+					ConfigReferences: test.configReferences,
+				},
+			}
+
+			namespace, err := getNamespace(addon)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if namespace != test.expected {
+				t.Fatalf("expected the install namespace %s, got %s", test.expected, namespace)
+			}
+		})
+	}
+}
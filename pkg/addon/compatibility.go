@@ -0,0 +1,295 @@
+package addon
+
+import (
+	"fmt"
+	"runtime/debug"
+	"slices"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// AgentVersionSkewCondition is the ManagedClusterAddOn condition reporting whether the agent
+	// image is older than what the rendered manifests require.
+	AgentVersionSkewCondition = "AgentVersionSkew"
+
+	skewReasonCompatible  = "Compatible"
+	skewReasonUnsupported = "UnsupportedAgentVersion"
+	skewReasonDegraded    = "FeaturesDisabled"
+)
+
+// AgentFeature is an agent capability enabled by command line flags.
+type AgentFeature struct {
+	// Name is a human readable name used when reporting the feature as disabled.
+	Name string
+	// Flags are the argument prefixes that enable the feature on the agent.
+	Flags []string
+	// MinVersion is the first agent version that accepts the flags.
+	MinVersion string
+	// Applies, when set, limits the feature to the containers it returns true for, when older agents
+	// accept the flags in other setups.
+	Applies func(container *corev1.Container) bool
+	// Fallback, when set, adjusts the container of an older agent before the flags are removed, so
+	// the settings of the feature still apply without it. It returns the objects to render.
+	Fallback func(container *corev1.Container, podSpec *corev1.PodSpec, objects []runtime.Object) []runtime.Object
+}
+
+// AgentCompatibility describes which versions of an agent the controller supports.
+type AgentCompatibility struct {
+	// MinVersion is the oldest agent version that can be deployed at all.
+	MinVersion string
+	// Flags are the argument prefixes that all the supported agent versions accept.
+	Flags []string
+	// Features are the flags that require a newer agent than MinVersion.
+	Features []AgentFeature
+	// Digests maps known image digests to their agent version, for images pinned by digest.
+	Digests map[string]string
+}
+
+// CompatibilityMatrix lists the agents that this build of the addon controller supports, keyed by
+// the agent container command. It is changed along with the charts that set the agent flags, so it
+// always describes the running controller: each flag of the charts is either supported by all the
+// agent versions or enabled by a feature.
+var CompatibilityMatrix = map[string]AgentCompatibility{
+	"config-policy-controller": {
+		MinVersion: "0.12.0",
+		Flags: []string{
+			"--enable-lease", "--cluster-name", "--leader-elect", "--log-encoder", "--log-level", "--v",
+			"--evaluation-concurrency", "--client-max-qps", "--client-burst", "--health-probe-bind-address",
+			"--secure-metrics", "--metrics-bind-address", "--target-kubeconfig-path",
+		},
+		Features: []AgentFeature{
+			{
+				Name:       "OperatorPolicy",
+				Flags:      []string{"--enable-operator-policy", "--operator-policy-default-namespace"},
+				MinVersion: "0.13.0",
+			},
+			{
+				Name:       "StandaloneHubTemplates",
+				Flags:      []string{"--standalone-hub-templates-kubeconfig-path"},
+				MinVersion: "0.16.0",
+			},
+			{
+				Name:       "LogConfig",
+				Flags:      []string{LogConfigDirFlag},
+				MinVersion: "0.17.0",
+				Fallback:   logConfigFallback,
+			},
+			{
+				Name:       "SelfSignedMetrics",
+				Flags:      []string{"--secure-metrics"},
+				MinVersion: "0.17.0",
+				Applies:    selfSignedMetrics,
+				Fallback:   selfSignedMetricsFallback,
+			},
+		},
+	},
+	"governance-policy-framework-addon": {
+		MinVersion: "0.12.0",
+		Flags: []string{
+			"--enable-lease", "--hub-cluster-configfile", "--leader-elect", "--log-encoder", "--log-level", "--v",
+			"--evaluation-concurrency", "--client-max-qps", "--client-burst", "--on-multicluster-hub",
+			"--disable-gatekeeper-sync", "--cluster-namespace", "--cluster-namespace-on-hub", "--secure-metrics",
+			"--metrics-bind-address",
+		},
+		Features: []AgentFeature{
+			{
+				Name:       "LogConfig",
+				Flags:      []string{LogConfigDirFlag},
+				MinVersion: "0.17.0",
+				Fallback:   logConfigFallback,
+			},
+			{
+				Name:       "SelfSignedMetrics",
+				Flags:      []string{"--secure-metrics"},
+				MinVersion: "0.17.0",
+				Applies:    selfSignedMetrics,
+				Fallback:   selfSignedMetricsFallback,
+			},
+		},
+	},
+}
+
+// ControllerVersion returns the version of the addon controller from its build information, or an
+// empty string when it wasn't built from a tagged version.
+func ControllerVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "(devel)" {
+		return ""
+	}
+
+	return info.Main.Version
+}
+
+// AgentImageVersion returns the agent version of the image reference, using the digest table for
+// images pinned by digest. It returns nil when the version can't be determined, for example for
+// the "latest" tag.
+func AgentImageVersion(image string, digests map[string]string) *semver.Version {
+	if name, digest, found := strings.Cut(image, "@"); found {
+		if version, ok := digests[digest]; ok {
+			parsed, err := semver.NewVersion(version)
+			if err == nil {
+				return parsed
+			}
+		}
+
+		image = name
+	}
+
+	// The tag follows the last colon, as long as it's not part of the registry host
+	lastColon := strings.LastIndex(image, ":")
+	if lastColon == -1 || lastColon < strings.LastIndex(image, "/") {
+		return nil
+	}
+
+	version, err := semver.NewVersion(image[lastColon+1:])
+	if err != nil {
+		return nil
+	}
+
+	return version
+}
+
+// versionSkew is the result of checking one agent container against the CompatibilityMatrix.
+type versionSkew struct {
+	container   string
+	image       string
+	unsupported bool
+	disabled    []string
+}
+
+// checkContainer removes the arguments of features that the container image doesn't support, and
+// returns the skew that was found with the objects to render. A nil skew means the container is
+// compatible or unknown.
+func checkContainer(
+	container *corev1.Container,
+	podSpec *corev1.PodSpec,
+	objects []runtime.Object,
+	matrix map[string]AgentCompatibility,
+) (*versionSkew, []runtime.Object) {
+	if len(container.Command) == 0 {
+		return nil, objects
+	}
+
+	compat, ok := matrix[container.Command[0]]
+	if !ok {
+		return nil, objects
+	}
+
+	version := AgentImageVersion(container.Image, compat.Digests)
+	if version == nil {
+		return nil, objects
+	}
+
+	skew := &versionSkew{container: container.Name, image: container.Image}
+
+	if minVersion, err := semver.NewVersion(compat.MinVersion); err == nil && version.LessThan(minVersion) {
+		skew.unsupported = true
+
+		return skew, objects
+	}
+
+	for _, feature := range compat.Features {
+		minVersion, err := semver.NewVersion(feature.MinVersion)
+		if err != nil || !version.LessThan(minVersion) {
+			continue
+		}
+
+		if feature.Applies != nil && !feature.Applies(container) {
+			continue
+		}
+
+		isFeatureArg := func(arg string) bool {
+			return slices.ContainsFunc(feature.Flags, func(flag string) bool {
+				return arg == flag || strings.HasPrefix(arg, flag+"=")
+			})
+		}
+
+		if !slices.ContainsFunc(container.Args, isFeatureArg) {
+			continue
+		}
+
+		if feature.Fallback != nil {
+			objects = feature.Fallback(container, podSpec, objects)
+		}
+
+		container.Args = slices.DeleteFunc(slices.Clone(container.Args), isFeatureArg)
+		skew.disabled = append(skew.disabled, feature.Name)
+	}
+
+	if len(skew.disabled) == 0 {
+		return nil, objects
+	}
+
+	return skew, objects
+}
+
+// ApplyAgentCompatibility checks the agent images in the rendered objects against the
+// CompatibilityMatrix. Flags of features that a pinned agent image doesn't support are removed from
+// the objects, after the fallback of the feature is applied. It returns the objects to render, the
+// condition to report on the addon, and an error when an agent image is older than the minimum
+// supported version.
+func ApplyAgentCompatibility(objects []runtime.Object) ([]runtime.Object, metav1.Condition, error) {
+	skews := []*versionSkew{}
+	result := objects
+
+	for _, obj := range objects {
+		podSpec := podSpecOf(obj)
+		if podSpec == nil {
+			continue
+		}
+
+		for i := range podSpec.Containers {
+			var skew *versionSkew
+
+			skew, result = checkContainer(&podSpec.Containers[i], podSpec, result, CompatibilityMatrix)
+			if skew != nil {
+				skews = append(skews, skew)
+			}
+		}
+	}
+
+	condition := metav1.Condition{
+		Type:    AgentVersionSkewCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  skewReasonCompatible,
+		Message: "The agent images are supported by the addon controller",
+	}
+
+	if version := ControllerVersion(); version != "" {
+		condition.Message += " version " + version
+	}
+
+	if len(skews) == 0 {
+		return result, condition, nil
+	}
+
+	condition.Status = metav1.ConditionTrue
+	condition.Reason = skewReasonDegraded
+	messages := make([]string, 0, len(skews))
+
+	for _, skew := range skews {
+		if skew.unsupported {
+			condition.Reason = skewReasonUnsupported
+			messages = append(messages, fmt.Sprintf("container %s image %s is older than the minimum supported version",
+				skew.container, skew.image))
+
+			continue
+		}
+
+		messages = append(messages, fmt.Sprintf("container %s image %s does not support %s, so it was disabled",
+			skew.container, skew.image, strings.Join(skew.disabled, ", ")))
+	}
+
+	condition.Message = strings.Join(slices.Compact(messages), "; ")
+
+	if condition.Reason == skewReasonUnsupported {
+		return result, condition, fmt.Errorf("refusing to deploy the agent: %s", condition.Message)
+	}
+
+	return result, condition, nil
+}
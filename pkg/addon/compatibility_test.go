@@ -0,0 +1,316 @@
+package addon
+
+import (
+	"os"
+	"regexp"
+	"slices"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestAgentImageVersion(t *testing.T) {
+	digests := map[string]string{"sha256:0123": "0.15.2"}
+
+	tests := map[string]struct {
+		image    string
+		expected string
+	}{
+		"tag":                   {image: "quay.io/policy/config-policy-controller:v0.13.1", expected: "0.13.1"},
+		"registry port":         {image: "registry:5000/config-policy-controller:0.14.0", expected: "0.14.0"},
+		"registry port, no tag": {image: "registry:5000/config-policy-controller", expected: ""},
+		"latest":                {image: "quay.io/policy/config-policy-controller:latest", expected: ""},
+		"known digest":          {image: "quay.io/policy/config-policy-controller@sha256:0123", expected: "0.15.2"},
+		"unknown digest":        {image: "quay.io/policy/config-policy-controller@sha256:4567", expected: ""},
+		"tag and unknown digest": {
+			image: "quay.io/policy/config-policy-controller:v0.16.0@sha256:4567", expected: "0.16.0",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			version := AgentImageVersion(test.image, digests)
+
+			if test.expected == "" {
+				if version != nil {
+					t.Fatalf("expected no version, got %s", version)
+				}
+
+				return
+			}
+
+			if version == nil || version.String() != test.expected {
+				t.Fatalf("expected the version %s, got %v", test.expected, version)
+			}
+		})
+	}
+}
+
+func TestApplyAgentCompatibility(t *testing.T) {
+	operatorPolicyArgs := []string{"--enable-operator-policy=true", "--operator-policy-default-namespace=operators"}
+
+	tests := map[string]struct {
+		image          string
+		expectedStatus metav1.ConditionStatus
+		expectedReason string
+		expectedErr    bool
+		expectedArgs   []string
+	}{
+		"supported version": {
+			image:          "quay.io/policy/config-policy-controller:v0.16.0",
+			expectedStatus: metav1.ConditionFalse,
+			expectedReason: skewReasonCompatible,
+			expectedArgs:   append([]string{"--cluster-name=cluster1"}, operatorPolicyArgs...),
+		},
+		"unknown version": {
+			image:          "quay.io/policy/config-policy-controller:latest",
+			expectedStatus: metav1.ConditionFalse,
+			expectedReason: skewReasonCompatible,
+			expectedArgs:   append([]string{"--cluster-name=cluster1"}, operatorPolicyArgs...),
+		},
+		"features disabled": {
+			image:          "quay.io/policy/config-policy-controller:v0.12.3",
+			expectedStatus: metav1.ConditionTrue,
+			expectedReason: skewReasonDegraded,
+			expectedArgs:   []string{"--cluster-name=cluster1"},
+		},
+		"unsupported version": {
+			image:          "quay.io/policy/config-policy-controller:v0.11.0",
+			expectedStatus: metav1.ConditionTrue,
+			expectedReason: skewReasonUnsupported,
+			expectedErr:    true,
+			expectedArgs:   append([]string{"--cluster-name=cluster1"}, operatorPolicyArgs...),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			deployment := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller"},
+				Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:    "config-policy-controller",
+						Image:   test.image,
+						Command: []string{"config-policy-controller"},
+						Args:    append([]string{"--cluster-name=cluster1"}, operatorPolicyArgs...),
+					}},
+				}}},
+			}
+
+			_, condition, err := ApplyAgentCompatibility([]runtime.Object{deployment})
+			if (err != nil) != test.expectedErr {
+				t.Fatalf("expected an error to be %v, got %v", test.expectedErr, err)
+			}
+
+			if condition.Type != AgentVersionSkewCondition || condition.Status != test.expectedStatus ||
+				condition.Reason != test.expectedReason {
+				t.Fatalf("unexpected condition: %+v", condition)
+			}
+
+			args := deployment.Spec.Template.Spec.Containers[0].Args
+			if !slices.Equal(args, test.expectedArgs) {
+				t.Fatalf("expected the arguments %v, got %v", test.expectedArgs, args)
+			}
+		})
+	}
+}
+
+func TestApplyAgentCompatibilityLogConfig(t *testing.T) {
+	logConfigArgs := []string{"--cluster-name=cluster1", "--log-config-dir=/var/run/logging-config"}
+
+	tests := map[string]struct {
+		image             string
+		expectedReason    string
+		expectedArgs      []string
+		expectedConfigMap bool
+	}{
+		"agent supporting the logging ConfigMap": {
+			image:             "quay.io/policy/governance-policy-framework-addon:v0.17.0",
+			expectedReason:    skewReasonCompatible,
+			expectedArgs:      logConfigArgs,
+			expectedConfigMap: true,
+		},
+		"agent of an unknown version": {
+			image:             "quay.io/policy/governance-policy-framework-addon:latest",
+			expectedReason:    skewReasonCompatible,
+			expectedArgs:      logConfigArgs,
+			expectedConfigMap: true,
+		},
+		"agent older than the logging ConfigMap": {
+			image:          "quay.io/policy/governance-policy-framework-addon:v0.16.2",
+			expectedReason: skewReasonDegraded,
+			expectedArgs: []string{
+				"--cluster-name=cluster1", "--log-encoder=console", "--log-level=2", "--v=0",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			configMap := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "governance-policy-framework-logging"},
+				Data:       map[string]string{"log-level": "2", "v": "0", "log-encoder": "console"},
+			}
+			deployment := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "governance-policy-framework"},
+				Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:    "governance-policy-framework-addon",
+						Image:   test.image,
+						Command: []string{"governance-policy-framework-addon"},
+						Args:    slices.Clone(logConfigArgs),
+						VolumeMounts: []corev1.VolumeMount{
+							{Name: "klusterlet-config", MountPath: "/var/run/klusterlet"},
+							{Name: "logging-config", MountPath: "/var/run/logging-config"},
+						},
+					}},
+					Volumes: []corev1.Volume{
+						{Name: "klusterlet-config"},
+						{Name: "logging-config", VolumeSource: corev1.VolumeSource{
+							ConfigMap: &corev1.ConfigMapVolumeSource{
+								LocalObjectReference: corev1.LocalObjectReference{Name: configMap.Name},
+							},
+						}},
+					},
+				}}},
+			}
+
+			objects, condition, err := ApplyAgentCompatibility([]runtime.Object{configMap, deployment})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if condition.Reason != test.expectedReason {
+				t.Fatalf("expected the condition reason %s, got %+v", test.expectedReason, condition)
+			}
+
+			podSpec := deployment.Spec.Template.Spec
+			if !slices.Equal(podSpec.Containers[0].Args, test.expectedArgs) {
+				t.Fatalf("expected the arguments %v, got %v", test.expectedArgs, podSpec.Containers[0].Args)
+			}
+
+			hasConfigMap := slices.Contains(objects, runtime.Object(configMap))
+			if hasConfigMap != test.expectedConfigMap {
+				t.Fatalf("expected the logging ConfigMap to be rendered: %v, got %v", test.expectedConfigMap, objects)
+			}
+
+			expectedVolumes := 1
+			if test.expectedConfigMap {
+				expectedVolumes = 2
+			}
+
+			if len(podSpec.Volumes) != expectedVolumes || len(podSpec.Containers[0].VolumeMounts) != expectedVolumes {
+				t.Fatalf("expected %d volumes, got %v", expectedVolumes, podSpec.Volumes)
+			}
+		})
+	}
+}
+
+// TestCompatibilityMatrixChartFlags checks that each flag that the charts pass to the agents has an
+// entry in the CompatibilityMatrix, so a new flag can't reach older agents unnoticed.
+func TestCompatibilityMatrixChartFlags(t *testing.T) {
+	commandRegexp := regexp.MustCompile(`command: \["([^"]+)"\]`)
+	flagRegexp := regexp.MustCompile(`(?m)^\s*- ['"]?(--[a-z0-9-]+)`)
+
+	for _, chart := range []string{"configpolicy", "policyframework"} {
+		t.Run(chart, func(t *testing.T) {
+			deployment, err := os.ReadFile(chart + "/manifests/managedclusterchart/templates/deployment.yaml")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			command := commandRegexp.FindSubmatch(deployment)
+			if command == nil {
+				t.Fatal("expected the chart to set the agent command")
+			}
+
+			compat, ok := CompatibilityMatrix[string(command[1])]
+			if !ok {
+				t.Fatalf("expected the agent %s to be in the compatibility matrix", command[1])
+			}
+
+			flags := slices.Clone(compat.Flags)
+			for _, feature := range compat.Features {
+				flags = append(flags, feature.Flags...)
+			}
+
+			chartFlags := flagRegexp.FindAllSubmatch(deployment, -1)
+			if len(chartFlags) == 0 {
+				t.Fatal("expected the chart to set agent flags")
+			}
+
+			for _, flag := range chartFlags {
+				if !slices.Contains(flags, string(flag[1])) {
+					t.Errorf("expected the flag %s of the chart to be in the compatibility matrix", flag[1])
+				}
+			}
+		})
+	}
+}
+
+func TestApplyAgentCompatibilitySelfSignedMetrics(t *testing.T) {
+	metricsArgs := []string{"--secure-metrics=true", "--metrics-bind-address=0.0.0.0:8443"}
+
+	tests := map[string]struct {
+		image          string
+		certMounted    bool
+		expectedReason string
+		expectedArgs   []string
+	}{
+		"agent generating its certificate": {
+			image:          "quay.io/policy/config-policy-controller:v0.17.0",
+			expectedReason: skewReasonCompatible,
+			expectedArgs:   metricsArgs,
+		},
+		"older agent with a mounted certificate": {
+			image:          "quay.io/policy/config-policy-controller:v0.16.0",
+			certMounted:    true,
+			expectedReason: skewReasonCompatible,
+			expectedArgs:   metricsArgs,
+		},
+		"older agent without a mounted certificate": {
+			image:          "quay.io/policy/config-policy-controller:v0.16.0",
+			expectedReason: skewReasonDegraded,
+			expectedArgs:   []string{},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			container := corev1.Container{
+				Name:    "config-policy-controller",
+				Image:   test.image,
+				Command: []string{"config-policy-controller"},
+				Args:    slices.Clone(metricsArgs),
+			}
+
+			if test.certMounted {
+				container.VolumeMounts = []corev1.VolumeMount{{Name: "metrics-cert", MountPath: metricsCertDir}}
+			}
+
+			deployment := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller"},
+				Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					Containers: []corev1.Container{container},
+				}}},
+			}
+
+			_, condition, err := ApplyAgentCompatibility([]runtime.Object{deployment})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if condition.Reason != test.expectedReason {
+				t.Fatalf("expected the condition reason %s, got %+v", test.expectedReason, condition)
+			}
+
+			args := deployment.Spec.Template.Spec.Containers[0].Args
+			if !slices.Equal(args, test.expectedArgs) {
+				t.Fatalf("expected the arguments %v, got %v", test.expectedArgs, args)
+			}
+		})
+	}
+}
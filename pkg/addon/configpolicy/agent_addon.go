@@ -5,23 +5,19 @@ import (
 	"embed"
 	"errors"
 	"fmt"
-	"os"
 	"strconv"
-	"time"
 
 	"github.com/openshift/library-go/pkg/controller/controllercmd"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
-	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"open-cluster-management.io/addon-framework/pkg/addonfactory"
 	"open-cluster-management.io/addon-framework/pkg/addonmanager"
 	"open-cluster-management.io/addon-framework/pkg/agent"
 	"open-cluster-management.io/addon-framework/pkg/utils"
 	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	addonv1alpha1client "open-cluster-management.io/api/client/addon/clientset/versioned"
-	addoninformers "open-cluster-management.io/api/client/addon/informers/externalversions"
 	addonlistersv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
 	clusterv1client "open-cluster-management.io/api/client/cluster/clientset/versioned"
-	clusterv1informers "open-cluster-management.io/api/client/cluster/informers/externalversions"
 	clusterlistersv1 "open-cluster-management.io/api/client/cluster/listers/cluster/v1"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -30,9 +26,11 @@ import (
 )
 
 const (
-	addonName                        = "config-policy-controller"
+	AddonName                        = "config-policy-controller"
 	operatorPolicyDisabledAnnotation = "operator-policy-disabled"
 	standaloneTemplatingAddonName    = "governance-standalone-hub-templating"
+	// imageKey is the key of the agent image in the imageOverrides values
+	imageKey = "config_policy_controller"
 )
 
 type configPolicyUserValues struct {
@@ -58,22 +56,70 @@ var (
 
 	log = ctrl.Log.WithName("configpolicy")
 
+	// AddOnMeta describes the addon in the ClusterManagementAddOn created by the controller.
+	AddOnMeta = addonapiv1alpha1.AddOnMeta{
+		DisplayName: "Config Policy Controller",
+		Description: "Audits and remediates the configuration of the cluster with configuration policies.",
+	}
+
+	// Dependencies are the addons whose outputs are used in the config-policy-controller values.
+	Dependencies = []policyaddon.AddonDependency{{
+		Consumer: AddonName,
+		Producer: standaloneTemplatingAddonName,
+		Changed:  policyaddon.PlacementChanged,
+	}}
+
+	// UninstallHook clears the config-policy-controller policies from the cluster before the addon
+	// is removed.
+	UninstallHook = &policyaddon.UninstallHook{
+		AddonName: AddonName,
+		Container: AddonName,
+		Namespaces: func(
+			cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn, agent *appsv1.Deployment,
+		) []string {
+			if addon.GetAnnotations()[addonapiv1alpha1.HostingClusterNameAnnotationKey] != "" {
+				return []string{agent.Namespace}
+			}
+
+			return []string{cluster.Name, "open-cluster-management-policies"}
+		},
+		Finalizers: []string{"policy.open-cluster-management.io/delete-related-objects"},
+		LogFlags:   []string{"v"},
+	}
+
 	agentPermissionFiles = []string{
 		// role with RBAC rules to access resources on hub
 		"manifests/hubpermissions/role.yaml",
 		// rolebinding to bind the above role to a certain user group
 		"manifests/hubpermissions/rolebinding.yaml",
 	}
+
+	// TemplateSource exports the config-policy-controller as an AddOnTemplate.
+	TemplateSource = policyaddon.TemplateSource{
+		AddonName:       AddonName,
+		FS:              FS,
+		PermissionFiles: agentPermissionFiles,
+		UninstallHook:   UninstallHook,
+		GetValuesFuncs: func(
+			clusterLister clusterlistersv1.ManagedClusterLister,
+			addonLister addonlistersv1alpha1.ManagedClusterAddOnLister,
+			deploymentConfigValues addonfactory.GetValuesFunc,
+		) []addonfactory.GetValuesFunc {
+			return getValuesFuncs(nil, clusterLister, addonLister, deploymentConfigValues)
+		},
+	}
 )
 
-func getSkeletonValues() configPolicyUserValues {
+// getSkeletonValues returns the default values for the chart. The agent image is selected based on
+// the capabilities of the cluster the agent runs on, which may be nil when they are unknown.
+func getSkeletonValues(hostingCapabilities *policyaddon.ClusterCapabilities) configPolicyUserValues {
 	return configPolicyUserValues{
 		CommonValues: policyaddon.CommonValues{
 			BaseValues: policyaddon.BaseValues{
 				GlobalValues: &policyaddon.GlobalValues{
 					ImagePullPolicy: corev1.PullIfNotPresent,
 					ImageOverrides: map[string]string{
-						"config_policy_controller": os.Getenv("CONFIG_POLICY_CONTROLLER_IMAGE"),
+						imageKey: policyaddon.GetAgentImage("CONFIG_POLICY_CONTROLLER_IMAGE", hostingCapabilities),
 					},
 				},
 			},
@@ -102,28 +148,31 @@ func getValuesFromAnnotations(
 	return func(
 		cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn,
 	) (addonfactory.Values, error) {
-		userValues := getSkeletonValues()
+		userValues := getSkeletonValues(policyaddon.GetHostingCapabilities(cluster, addon, clusterClient))
 
 		err := userValues.CommonValues.SetCommonValues(cluster, addon, clusterClient)
 		if err != nil {
 			return nil, err
 		}
 
-		// Set the standalone hub templating secret if enabled
-		_, err = addonClient.ManagedClusterAddOns(addon.Namespace).Get(standaloneTemplatingAddonName)
-		if !k8serrors.IsNotFound(err) {
-			if err != nil {
-				return nil, err
-			}
+		// Set the standalone hub templating secret if enabled. Its hub kubeconfig Secret is only
+		// available when its agent runs on the same cluster, for example when both are hosted.
+		standaloneEnabled, err := policyaddon.DependencyColocated(
+			addonClient, addon, standaloneTemplatingAddonName,
+		)
+		if err != nil {
+			return nil, err
+		}
 
-			userValues.StandaloneHubTemplatingSecret = standaloneTemplatingAddonName + "-hub-kubeconfig"
+		if standaloneEnabled {
+			userValues.StandaloneHubTemplatingSecret = policyaddon.HubKubeConfigSecret(standaloneTemplatingAddonName)
 		}
 
-		// Configure OperatorPolicy based on the cluster's OpenShift version
-		if cluster.Labels["openshiftVersion-major"] == "4" {
-			userValues.OperatorPolicy.DefaultNamespace = "openshift-operators"
-		} else {
+		// Configure OperatorPolicy based on whether OLM is available on the cluster
+		if !userValues.Capabilities.OLM {
 			userValues.OperatorPolicy.Disabled = true
+		} else if cluster.Labels["openshiftVersion-major"] == "4" {
+			userValues.OperatorPolicy.DefaultNamespace = "openshift-operators"
 		}
 
 		if err := userValues.CommonValues.SetCommonValuesFromAnnotations(addon); err != nil {
@@ -135,7 +184,7 @@ func getValuesFromAnnotations(
 			if err != nil {
 				log.Error(err, fmt.Sprintf(
 					policyaddon.AnnotationParseErrorFmt,
-					operatorPolicyDisabledAnnotation, val, addonName, false),
+					operatorPolicyDisabledAnnotation, val, AddonName, false),
 				)
 			}
 		}
@@ -145,7 +194,10 @@ func getValuesFromAnnotations(
 }
 
 func getValuesFromCustomizedVariableValues(config addonapiv1alpha1.AddOnDeploymentConfig) (addonfactory.Values, error) {
-	userValues := getSkeletonValues()
+	userValues := getSkeletonValues(nil)
+	// The image is selected for the cluster in getValuesFromAnnotations, so only override it with
+	// the image variables
+	userValues.GlobalValues.ImageOverrides = nil
 
 	userValuesMap, err := userValues.CommonValues.SetCommonValuesFromCustomizedVariables(config)
 	if err != nil {
@@ -168,7 +220,7 @@ func getValuesFromCustomizedVariableValues(config addonapiv1alpha1.AddOnDeployme
 			if err != nil {
 				log.Error(err, "error setting customized variable", "variable", key, "value", value)
 			}
-		} else {
+		} else if !userValues.SetImageOverride(imageKey, key, value) {
 			log.Error(errors.New("unknown customized variable"),
 				"variable is not supported",
 				"variable", key,
@@ -179,10 +231,37 @@ func getValuesFromCustomizedVariableValues(config addonapiv1alpha1.AddOnDeployme
 	return addonfactory.JsonStructToValues(userValues)
 }
 
-func GetAgentAddon(ctx context.Context, controllerContext *controllercmd.ControllerContext) (agent.AgentAddon, error) {
+// deploymentConfigToValuesFuncs convert the AddOnDeploymentConfig of the addon to values.
+var deploymentConfigToValuesFuncs = []addonfactory.AddOnDeploymentConfigToValuesFunc{
+	addonfactory.ToAddOnResourceRequirementsValues,
+	getValuesFromCustomizedVariableValues,
+}
+
+// getValuesFuncs returns the values functions of the addon in order of precedence, with the
+// AddOnDeploymentConfig values from deploymentConfigValues. The agent is sized with the sizer when
+// it's not nil.
+func getValuesFuncs(
+	sizer *policyaddon.AgentSizer,
+	clusterLister clusterlistersv1.ManagedClusterLister,
+	addonLister addonlistersv1alpha1.ManagedClusterAddOnLister,
+	deploymentConfigValues addonfactory.GetValuesFunc,
+) []addonfactory.GetValuesFunc {
+	return []addonfactory.GetValuesFunc{
+		policyaddon.TraceValuesFunc("AgentSizing", sizer.GetValues),
+		policyaddon.TraceValuesFunc("Annotations", getValuesFromAnnotations(clusterLister, addonLister)),
+		policyaddon.TraceValuesFunc("ValuesAnnotation", addonfactory.GetValuesFromAddonAnnotation),
+		policyaddon.TraceValuesFunc("AddOnDeploymentConfig", deploymentConfigValues),
+		policyaddon.TraceValuesFunc("Mandate", policyaddon.MandateValues),
+	}
+}
+
+// GetAgentAddon returns the agent addon, which is sized with the sizer when it's not nil.
+func GetAgentAddon(
+	ctx context.Context, controllerContext *controllercmd.ControllerContext, sizer *policyaddon.AgentSizer,
+) (agent.AgentAddon, error) {
 	registrationOption := policyaddon.NewRegistrationOption(
 		controllerContext,
-		addonName,
+		AddonName,
 		agentPermissionFiles,
 		FS,
 		false)
@@ -192,37 +271,39 @@ func GetAgentAddon(ctx context.Context, controllerContext *controllercmd.Control
 		return nil, fmt.Errorf("failed to retrieve addon client: %w", err)
 	}
 
-	addonInformer := addoninformers.NewSharedInformerFactory(addonClient, 10*time.Minute).
-		Addon().V1alpha1().ManagedClusterAddOns()
-	go addonInformer.Informer().Run(ctx.Done())
-
 	clusterClient, err := clusterv1client.NewForConfig(controllerContext.KubeConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize a managed cluster client: %w", err)
 	}
 
-	clusterInformer := clusterv1informers.NewSharedInformerFactory(clusterClient, 10*time.Minute).
-		Cluster().V1().ManagedClusters()
-	go clusterInformer.Informer().Run(ctx.Done())
+	hubInformers, err := policyaddon.GetHubInformers(controllerContext)
+	if err != nil {
+		return nil, err
+	}
+
+	// The dependency trigger uses the same informer, so the values see the changes it triggers on
+	addonInformer := hubInformers.Addon.Addon().V1alpha1().ManagedClusterAddOns()
+	clusterInformer := hubInformers.Cluster.Cluster().V1().ManagedClusters()
+
+	hubInformers.Start(ctx)
+
+	resolver, err := policyaddon.StartDeploymentConfigResolver(ctx, controllerContext)
+	if err != nil {
+		return nil, err
+	}
+
+	adcGetter := utils.NewAddOnDeploymentConfigGetter(addonClient)
 
-	return addonfactory.NewAgentAddonFactory(addonName, FS, "manifests/managedclusterchart").
+	return addonfactory.NewAgentAddonFactory(AddonName, FS, "manifests/managedclusterchart").
 		WithConfigGVRs(utils.AddOnDeploymentConfigGVR).
-		WithGetValuesFuncs(
-			getValuesFromAnnotations(clusterInformer.Lister(), addonInformer.Lister()),
-			addonfactory.GetValuesFromAddonAnnotation,
-			addonfactory.GetAddOnDeploymentConfigValues(
-				utils.NewAddOnDeploymentConfigGetter(addonClient),
-				addonfactory.ToAddOnNodePlacementValues,
-				addonfactory.ToAddOnResourceRequirementsValues,
-				getValuesFromCustomizedVariableValues,
-			),
-			policyaddon.MandateValues,
-		).
+		WithGetValuesFuncs(getValuesFuncs(sizer, clusterInformer.Lister(), addonInformer.Lister(),
+			resolver.GetValues(adcGetter, deploymentConfigToValuesFuncs...),
+		)...).
 		WithManagedClusterClient(clusterClient).
 		WithAgentRegistrationOption(registrationOption).
 		WithAgentInstallNamespace(
-			policyaddon.
-				CommonAgentInstallNamespaceFromDeploymentConfigFunc(utils.NewAddOnDeploymentConfigGetter(addonClient)),
+			resolver.AgentInstallNamespace(adcGetter,
+				policyaddon.CommonAgentInstallNamespaceFromDeploymentConfigFunc(adcGetter)),
 		).
 		WithScheme(policyaddon.Scheme).
 		WithAgentHostedModeEnabledOption().
@@ -230,7 +311,20 @@ func GetAgentAddon(ctx context.Context, controllerContext *controllercmd.Control
 }
 
 func GetAndAddAgent(
-	ctx context.Context, mgr addonmanager.AddonManager, controllerContext *controllercmd.ControllerContext,
+	ctx context.Context,
+	mgr addonmanager.AddonManager,
+	controllerContext *controllercmd.ControllerContext,
+	options policyaddon.AgentOptions,
 ) error {
-	return policyaddon.GetAndAddAgent(ctx, mgr, addonName, controllerContext, GetAgentAddon)
+	sizer, err := policyaddon.NewAgentSizer(ctx, mgr, controllerContext, AddonName, options.AutoSizingConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed getting the %v agent sizer: %w", AddonName, err)
+	}
+
+	return policyaddon.GetAndAddAgent(ctx, mgr, AddonName, controllerContext, options,
+		func(ctx context.Context, controllerContext *controllercmd.ControllerContext) (agent.AgentAddon, error) {
+			return GetAgentAddon(ctx, controllerContext, sizer)
+		},
+		UninstallHook,
+	)
 }
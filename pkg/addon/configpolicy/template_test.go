@@ -0,0 +1,494 @@
+package configpolicy
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	prometheusv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"open-cluster-management.io/addon-framework/pkg/addonfactory"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+
+	policyaddon "open-cluster-management.io/governance-policy-addon-controller/pkg/addon"
+)
+
+func TestExportAddOnTemplate(t *testing.T) {
+	objects, err := policyaddon.ExportAddOnTemplate(
+		TemplateSource, "v1.30.0", addonfactory.Values{"evaluationConcurrency": 7},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var template *addonapiv1alpha1.AddOnTemplate
+
+	for _, obj := range objects {
+		if addonTemplate, ok := obj.(*addonapiv1alpha1.AddOnTemplate); ok {
+			template = addonTemplate
+		}
+	}
+
+	if template == nil {
+		t.Fatal("expected an AddOnTemplate to be exported")
+	}
+
+	hubPermissions := template.Spec.Registration[0].KubeClient.HubPermissions
+	if len(hubPermissions) != 1 ||
+		hubPermissions[0].CurrentCluster.ClusterRoleName != "open-cluster-management:config-policy-controller-hub" {
+		t.Fatalf("unexpected hub permissions: %+v", hubPermissions)
+	}
+
+	var deployment *appsv1.Deployment
+
+	var job *batchv1.Job
+
+	for _, manifest := range template.Spec.AgentSpec.Workload.Manifests {
+		typeMeta := &metav1.TypeMeta{}
+		if err := json.Unmarshal(manifest.Raw, typeMeta); err != nil {
+			t.Fatal(err)
+		}
+
+		switch typeMeta.Kind {
+		case "Deployment":
+			deployment = &appsv1.Deployment{}
+			if err := json.Unmarshal(manifest.Raw, deployment); err != nil {
+				t.Fatal(err)
+			}
+		case "Job":
+			job = &batchv1.Job{}
+			if err := json.Unmarshal(manifest.Raw, job); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if deployment == nil {
+		t.Fatal("expected the AddOnTemplate to deploy the agent")
+	}
+
+	if deployment.Namespace != "{{INSTALL_NAMESPACE}}" {
+		t.Fatalf("expected the agent in the install namespace variable, got %s", deployment.Namespace)
+	}
+
+	args := deployment.Spec.Template.Spec.Containers[0].Args
+
+	for _, arg := range []string{"--cluster-name={{CLUSTER_NAME}}", "--evaluation-concurrency=7"} {
+		if !slices.Contains(args, arg) {
+			t.Fatalf("expected the agent argument %s, got %v", arg, args)
+		}
+	}
+
+	if job == nil {
+		t.Fatal("expected the AddOnTemplate to include the uninstall Job")
+	}
+
+	if _, ok := job.Annotations[addonapiv1alpha1.AddonPreDeleteHookAnnotationKey]; !ok {
+		t.Fatalf("expected the uninstall Job to be a pre-delete hook, got the annotations %v", job.Annotations)
+	}
+
+	expectedJobArgs := []string{
+		"trigger-uninstall",
+		"--deployment-name=config-policy-controller",
+		"--deployment-namespace={{INSTALL_NAMESPACE}}",
+		"--policy-namespace={{CLUSTER_NAME}}",
+		"--additional-namespace=open-cluster-management-policies",
+		"--v=0",
+	}
+
+	if jobArgs := job.Spec.Template.Spec.Containers[0].Args; !reflect.DeepEqual(jobArgs, expectedJobArgs) {
+		t.Fatalf("expected the uninstall Job arguments %v, got %v", expectedJobArgs, jobArgs)
+	}
+}
+
+func TestAgentImageArchitecture(t *testing.T) {
+	imageOverrides := map[string]interface{}{
+		"config_policy_controller":       "quay.io/policy/config-policy-controller:latest",
+		"config_policy_controller_arm64": "quay.io/policy/config-policy-controller:latest-arm64",
+	}
+
+	tests := map[string]struct {
+		architectures []interface{}
+		expected      string
+	}{
+		"unknown architecture": {
+			architectures: nil,
+			expected:      "quay.io/policy/config-policy-controller:latest",
+		},
+		"single architecture": {
+			architectures: []interface{}{"arm64"},
+			expected:      "quay.io/policy/config-policy-controller:latest-arm64",
+		},
+		"single architecture without an override": {
+			architectures: []interface{}{"s390x"},
+			expected:      "quay.io/policy/config-policy-controller:latest",
+		},
+		"mixed architectures": {
+			architectures: []interface{}{"amd64", "arm64"},
+			expected:      "quay.io/policy/config-policy-controller:latest",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			objects, err := policyaddon.ExportAddOnTemplate(TemplateSource, "v1.30.0", addonfactory.Values{
+				"global":              map[string]interface{}{"imageOverrides": imageOverrides},
+				"hostingCapabilities": map[string]interface{}{"architectures": test.architectures},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			image := ""
+
+			for _, obj := range objects {
+				template, ok := obj.(*addonapiv1alpha1.AddOnTemplate)
+				if !ok {
+					continue
+				}
+
+				for _, manifest := range template.Spec.AgentSpec.Workload.Manifests {
+					deployment := &appsv1.Deployment{}
+					if err := json.Unmarshal(manifest.Raw, deployment); err != nil {
+						t.Fatal(err)
+					}
+
+					if deployment.Kind == "Deployment" {
+						image = deployment.Spec.Template.Spec.Containers[0].Image
+					}
+				}
+			}
+
+			if image != test.expected {
+				t.Fatalf("expected the image %s, got %s", test.expected, image)
+			}
+		})
+	}
+}
+
+// renderManifests renders the chart with the values and returns the agent manifests by kind.
+func renderManifests(values addonfactory.Values) (map[string][]json.RawMessage, error) {
+	objects, err := policyaddon.ExportAddOnTemplate(TemplateSource, "v1.30.0", values)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := map[string][]json.RawMessage{}
+
+	for _, obj := range objects {
+		template, ok := obj.(*addonapiv1alpha1.AddOnTemplate)
+		if !ok {
+			continue
+		}
+
+		for _, manifest := range template.Spec.AgentSpec.Workload.Manifests {
+			typeMeta := &metav1.TypeMeta{}
+			if err := json.Unmarshal(manifest.Raw, typeMeta); err != nil {
+				return nil, err
+			}
+
+			manifests[typeMeta.Kind] = append(manifests[typeMeta.Kind], manifest.Raw)
+		}
+	}
+
+	return manifests, nil
+}
+
+// renderAgent renders the chart with the values and returns the agent Deployment and the logging
+// ConfigMap, when it's rendered.
+func renderAgent(t *testing.T, values addonfactory.Values) (*appsv1.Deployment, *corev1.ConfigMap) {
+	t.Helper()
+
+	manifests, err := renderManifests(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(manifests["Deployment"]) != 1 {
+		t.Fatal("expected the agent Deployment to be rendered")
+	}
+
+	deployment := &appsv1.Deployment{}
+	if err := json.Unmarshal(manifests["Deployment"][0], deployment); err != nil {
+		t.Fatal(err)
+	}
+
+	var configMap *corev1.ConfigMap
+
+	if len(manifests["ConfigMap"]) != 0 {
+		configMap = &corev1.ConfigMap{}
+		if err := json.Unmarshal(manifests["ConfigMap"][0], configMap); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return deployment, configMap
+}
+
+func TestMetricsTLS(t *testing.T) {
+	serverName := ptr.To("config-policy-controller-metrics.{{INSTALL_NAMESPACE}}.svc")
+
+	insecureTLSConfig := &prometheusv1.TLSConfig{
+		SafeTLSConfig: prometheusv1.SafeTLSConfig{InsecureSkipVerify: ptr.To(true)},
+	}
+
+	tests := map[string]struct {
+		mode                    string
+		serviceMonitorNamespace string
+		invalid                 bool
+		secureMetrics           bool
+		certVolume              bool
+		certificate             bool
+		tlsConfig               *prometheusv1.TLSConfig
+	}{
+		"OpenShift": {
+			mode:          "OpenShift",
+			secureMetrics: true,
+			certVolume:    true,
+			tlsConfig: &prometheusv1.TLSConfig{
+				SafeTLSConfig: prometheusv1.SafeTLSConfig{ServerName: serverName},
+				TLSFilesConfig: prometheusv1.TLSFilesConfig{
+					CAFile: "/etc/prometheus/configmaps/serving-certs-ca-bundle/service-ca.crt",
+				},
+			},
+		},
+		"CertManager": {
+			mode:          "CertManager",
+			secureMetrics: true,
+			certVolume:    true,
+			certificate:   true,
+			tlsConfig: &prometheusv1.TLSConfig{SafeTLSConfig: prometheusv1.SafeTLSConfig{
+				CA: prometheusv1.SecretOrConfigMap{Secret: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "config-policy-controller-metrics"},
+					Key:                  "ca.crt",
+				}},
+				ServerName: serverName,
+			}},
+		},
+		"CertManager with the ServiceMonitor in another namespace": {
+			mode:                    "CertManager",
+			serviceMonitorNamespace: "monitoring",
+			invalid:                 true,
+		},
+		"SelfSigned": {
+			mode:          "SelfSigned",
+			secureMetrics: true,
+			tlsConfig:     insecureTLSConfig,
+		},
+		"SelfSigned with the ServiceMonitor in another namespace": {
+			mode:                    "SelfSigned",
+			serviceMonitorNamespace: "monitoring",
+			secureMetrics:           true,
+			tlsConfig:               insecureTLSConfig,
+		},
+		"None": {
+			mode: "None",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			prometheus := map[string]interface{}{
+				"enabled": true,
+				"tls":     map[string]interface{}{"mode": test.mode},
+			}
+
+			if test.serviceMonitorNamespace != "" {
+				prometheus["serviceMonitor"] = map[string]interface{}{"namespace": test.serviceMonitorNamespace}
+			}
+
+			manifests, err := renderManifests(addonfactory.Values{"prometheus": prometheus})
+
+			if test.invalid {
+				if err == nil {
+					t.Fatal("expected the chart to fail to render")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			deployment := &appsv1.Deployment{}
+			if err := json.Unmarshal(manifests["Deployment"][0], deployment); err != nil {
+				t.Fatal(err)
+			}
+
+			args := deployment.Spec.Template.Spec.Containers[0].Args
+			if slices.Contains(args, "--secure-metrics=true") != test.secureMetrics {
+				t.Fatalf("expected secure metrics: %v, got the arguments %v", test.secureMetrics, args)
+			}
+
+			volumes := deployment.Spec.Template.Spec.Volumes
+
+			certVolume := slices.ContainsFunc(volumes, func(volume corev1.Volume) bool {
+				return volume.Name == "metrics-cert"
+			})
+			if certVolume != test.certVolume {
+				t.Fatalf("expected the metrics certificate volume: %v, got %v", test.certVolume, certVolume)
+			}
+
+			if (len(manifests["Certificate"]) != 0) != test.certificate {
+				t.Fatalf("expected a Certificate: %v, got %d", test.certificate, len(manifests["Certificate"]))
+			}
+
+			// The private key of the agent is never rendered
+			if len(manifests["Secret"]) != 0 {
+				t.Fatalf("expected no metrics Secret to be rendered, got %s", manifests["Secret"][0])
+			}
+
+			serviceMonitor := &prometheusv1.ServiceMonitor{}
+			if err := json.Unmarshal(manifests["ServiceMonitor"][0], serviceMonitor); err != nil {
+				t.Fatal(err)
+			}
+
+			endpoint := serviceMonitor.Spec.Endpoints[0]
+
+			expectedScheme := "http"
+			if test.secureMetrics {
+				expectedScheme = "https"
+			}
+
+			if endpoint.Scheme == nil || string(*endpoint.Scheme) != expectedScheme {
+				t.Fatalf("expected the %s scheme, got %v", expectedScheme, endpoint.Scheme)
+			}
+
+			if !reflect.DeepEqual(endpoint.TLSConfig, test.tlsConfig) {
+				t.Fatalf("expected the TLS configuration %v, got %v", test.tlsConfig, endpoint.TLSConfig)
+			}
+		})
+	}
+}
+
+func TestLoggingConfigMap(t *testing.T) {
+	tests := map[string]struct {
+		loggingConfigMap bool
+		args             []string
+		removedArgs      []string
+	}{
+		"arguments by default": {
+			args:        []string{"--log-encoder=console", "--log-level=4", "--v=2"},
+			removedArgs: []string{"--log-config-dir=/var/run/logging-config"},
+		},
+		"ConfigMap when enabled": {
+			loggingConfigMap: true,
+			args:             []string{"--log-config-dir=/var/run/logging-config"},
+			removedArgs:      []string{"--log-encoder=console", "--log-level=4", "--v=2"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			deployment, configMap := renderAgent(t, addonfactory.Values{
+				"logLevel": 4, "pkgLogLevel": 2, "loggingConfigMap": test.loggingConfigMap,
+			})
+
+			args := deployment.Spec.Template.Spec.Containers[0].Args
+
+			for _, arg := range test.args {
+				if !slices.Contains(args, arg) {
+					t.Fatalf("expected the agent argument %s, got %v", arg, args)
+				}
+			}
+
+			for _, arg := range test.removedArgs {
+				if slices.Contains(args, arg) {
+					t.Fatalf("expected no agent argument %s, got %v", arg, args)
+				}
+			}
+
+			mounted := slices.ContainsFunc(deployment.Spec.Template.Spec.Volumes, func(volume corev1.Volume) bool {
+				return volume.Name == "logging-config"
+			})
+
+			if mounted != test.loggingConfigMap || (configMap != nil) != test.loggingConfigMap {
+				t.Fatalf("expected the logging ConfigMap to be rendered and mounted: %v, got the ConfigMap %v "+
+					"and mounted %v", test.loggingConfigMap, configMap, mounted)
+			}
+
+			if configMap != nil && configMap.Data["v"] != "2" {
+				t.Fatalf("expected the logging ConfigMap to set the package log level, got %v", configMap.Data)
+			}
+		})
+	}
+}
+
+func TestPkgLogLevel(t *testing.T) {
+	tests := map[string]struct {
+		values   addonfactory.Values
+		expected string
+	}{
+		"defaults":               {values: addonfactory.Values{}, expected: "--v=0"},
+		"derived from logLevel":  {values: addonfactory.Values{"logLevel": 8}, expected: "--v=6"},
+		"at least 0":             {values: addonfactory.Values{"logLevel": 1}, expected: "--v=0"},
+		"error logLevel":         {values: addonfactory.Values{"logLevel": -1}, expected: "--v=0"},
+		"set explicitly":         {values: addonfactory.Values{"logLevel": 8, "pkgLogLevel": 3}, expected: "--v=3"},
+		"set explicitly to zero": {values: addonfactory.Values{"logLevel": 8, "pkgLogLevel": 0}, expected: "--v=0"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			deployment, _ := renderAgent(t, test.values)
+
+			args := deployment.Spec.Template.Spec.Containers[0].Args
+			if !slices.Contains(args, test.expected) {
+				t.Fatalf("expected the agent argument %s, got %v", test.expected, args)
+			}
+		})
+	}
+}
+
+func TestTracingEnv(t *testing.T) {
+	tests := map[string]struct {
+		tracing  map[string]interface{}
+		expected map[string]string
+	}{
+		"disabled": {},
+		"enabled": {
+			tracing: map[string]interface{}{"endpoint": "http://otel-collector:4317", "samplingRatio": "0.5"},
+			expected: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT": "http://otel-collector:4317",
+				"OTEL_SERVICE_NAME":           "config-policy-controller",
+				"OTEL_TRACES_SAMPLER":         "parentbased_traceidratio",
+				"OTEL_TRACES_SAMPLER_ARG":     "0.5",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			values := addonfactory.Values{}
+			if test.tracing != nil {
+				values["tracing"] = test.tracing
+			}
+
+			deployment, _ := renderAgent(t, values)
+
+			env := map[string]string{}
+
+			for _, envVar := range deployment.Spec.Template.Spec.Containers[0].Env {
+				if strings.HasPrefix(envVar.Name, "OTEL_") {
+					env[envVar.Name] = envVar.Value
+				}
+			}
+
+			if len(env) != len(test.expected) {
+				t.Fatalf("expected the OTEL environment variables %v, got %v", test.expected, env)
+			}
+
+			for name, value := range test.expected {
+				if env[name] != value {
+					t.Fatalf("expected %s to be %q, got %q", name, value, env[name])
+				}
+			}
+		})
+	}
+}
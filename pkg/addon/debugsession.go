@@ -0,0 +1,365 @@
+package addon
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/openshift/library-go/pkg/controller/controllercmd"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	addonv1alpha1client "open-cluster-management.io/api/client/addon/clientset/versioned"
+	addonscheme "open-cluster-management.io/api/client/addon/clientset/versioned/scheme"
+	addonlistersv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
+	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
+)
+
+const (
+	// DebugSessionAnnotation starts a debug session on the addon, which raises the log level for a
+	// limited time, for example "level=4,duration=30m". An optional "pkgLevel" sets the log level of
+	// the libraries, which defaults to 2 less than the level.
+	DebugSessionAnnotation = "policy-addon-debug-session"
+	// DebugSessionStartAnnotation records when the controller started the debug session, in RFC 3339.
+	DebugSessionStartAnnotation = "policy-addon-debug-session-start"
+
+	// Reasons of the Events recorded on the ManagedClusterAddOn for debug sessions
+	DebugSessionStartedReason = "DebugSessionStarted"
+	DebugSessionEndedReason   = "DebugSessionEnded"
+	DebugSessionInvalidReason = "DebugSessionInvalid"
+)
+
+// DebugSession is a log level that applies to an addon for a limited time.
+type DebugSession struct {
+	LogLevel    int8
+	PkgLogLevel int8
+	Duration    time.Duration
+}
+
+// ParseDebugSession parses the value of the DebugSessionAnnotation.
+func ParseDebugSession(value string) (*DebugSession, error) {
+	session := &DebugSession{}
+
+	var levelSet, pkgLevelSet bool
+
+	for _, field := range strings.Split(value, ",") {
+		key, fieldValue, found := strings.Cut(strings.TrimSpace(field), "=")
+		if !found {
+			return nil, fmt.Errorf("invalid debug session field '%s', expected a key=value pair", field)
+		}
+
+		var err error
+
+		switch key {
+		case "level":
+			session.LogLevel, err = GetLogLevel(fieldValue)
+			levelSet = true
+		case "pkgLevel":
+			session.PkgLogLevel, err = GetPkgLogLevel(fieldValue)
+			pkgLevelSet = true
+		case "duration":
+			session.Duration, err = time.ParseDuration(fieldValue)
+			if err == nil && session.Duration <= 0 {
+				err = fmt.Errorf("the duration must be positive, got '%s'", fieldValue)
+			}
+		default:
+			err = fmt.Errorf("unknown debug session field '%s'", key)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !levelSet || session.Duration == 0 {
+		return nil, fmt.Errorf("invalid debug session '%s', the level and duration are required", value)
+	}
+
+	// The package log level is a klog verbosity, which can't be negative
+	if !pkgLevelSet {
+		session.PkgLogLevel = max(session.LogLevel-2, 0)
+	}
+
+	return session, nil
+}
+
+// activeDebugSession returns the debug session of the addon, or nil when there is no session in
+// progress at the given time.
+func activeDebugSession(addon *addonapiv1alpha1.ManagedClusterAddOn, now time.Time) *DebugSession {
+	value, ok := addon.GetAnnotations()[DebugSessionAnnotation]
+	if !ok {
+		return nil
+	}
+
+	start, err := time.Parse(time.RFC3339, addon.GetAnnotations()[DebugSessionStartAnnotation])
+	if err != nil {
+		return nil
+	}
+
+	session, err := ParseDebugSession(value)
+	if err != nil {
+		return nil
+	}
+
+	if !now.Before(start.Add(session.Duration)) {
+		return nil
+	}
+
+	return session
+}
+
+// debugSessionValues returns the chart values raising the log level while a debug session of the
+// addon is in progress.
+func debugSessionValues(addon *addonapiv1alpha1.ManagedClusterAddOn) map[string]interface{} {
+	session := activeDebugSession(addon, time.Now())
+	if session == nil {
+		return nil
+	}
+
+	return map[string]interface{}{
+		"logLevel":    session.LogLevel,
+		"pkgLogLevel": session.PkgLogLevel,
+	}
+}
+
+// DebugSessionController starts and ends the debug sessions of policy addons. It records the start
+// of a session on the ManagedClusterAddOn so that MandateValues raises the log level, and removes the
+// session annotations when it ends so that the previous log level settings apply again.
+type DebugSessionController struct {
+	addonClient addonv1alpha1client.Interface
+	addonLister addonlistersv1alpha1.ManagedClusterAddOnLister
+	recorder    record.EventRecorder
+	now         func() time.Time
+	// invalidSessions are the invalid DebugSessionAnnotation values already reported by addon key, so
+	// that the Warning Event is only recorded once for each value. The controller runs a single
+	// worker, so it's not locked.
+	invalidSessions map[string]string
+}
+
+// sync starts, schedules the end of, or ends the debug session of the addon key.
+func (c *DebugSessionController) sync(ctx context.Context, syncCtx factory.SyncContext, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil
+	}
+
+	addon, err := c.addonLister.ManagedClusterAddOns(namespace).Get(name)
+	if k8serrors.IsNotFound(err) {
+		delete(c.invalidSessions, key)
+
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	value, hasSession := addon.GetAnnotations()[DebugSessionAnnotation]
+	startValue, hasStart := addon.GetAnnotations()[DebugSessionStartAnnotation]
+
+	if !hasSession {
+		delete(c.invalidSessions, key)
+
+		if !hasStart {
+			return nil
+		}
+
+		// The session annotation was removed before the session ended
+		return c.endSession(ctx, addon, "The debug session was stopped, the previous log level settings apply again")
+	}
+
+	session, err := ParseDebugSession(value)
+	if err != nil {
+		if reported, ok := c.invalidSessions[key]; !ok || reported != value {
+			c.recorder.Eventf(addon, corev1.EventTypeWarning, DebugSessionInvalidReason,
+				"Ignoring the %s annotation: %v", DebugSessionAnnotation, err)
+
+			c.invalidSessions[key] = value
+		}
+
+		if !hasStart {
+			return nil
+		}
+
+		return c.updateAnnotations(ctx, addon, func(annotations map[string]string) {
+			delete(annotations, DebugSessionStartAnnotation)
+		})
+	}
+
+	delete(c.invalidSessions, key)
+
+	if !hasStart {
+		return c.startSession(ctx, syncCtx, addon, session)
+	}
+
+	start, err := time.Parse(time.RFC3339, startValue)
+	if err != nil {
+		// Restart the session when the start time was tampered with
+		return c.startSession(ctx, syncCtx, addon, session)
+	}
+
+	remaining := start.Add(session.Duration).Sub(c.now())
+	if remaining > 0 {
+		syncCtx.Queue().AddAfter(key, remaining)
+
+		return nil
+	}
+
+	return c.endSession(ctx, addon, fmt.Sprintf(
+		"The debug session ended after %s, the previous log level settings apply again", session.Duration,
+	))
+}
+
+// startSession records the start of the debug session on the addon.
+func (c *DebugSessionController) startSession(
+	ctx context.Context,
+	syncCtx factory.SyncContext,
+	addon *addonapiv1alpha1.ManagedClusterAddOn,
+	session *DebugSession,
+) error {
+	start := c.now()
+
+	err := c.updateAnnotations(ctx, addon, func(annotations map[string]string) {
+		annotations[DebugSessionStartAnnotation] = start.UTC().Format(time.RFC3339)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Info("Started a policy addon debug session", "cluster", addon.Namespace, "addon", addon.Name,
+		"logLevel", session.LogLevel, "duration", session.Duration)
+
+	c.recorder.Eventf(addon, corev1.EventTypeNormal, DebugSessionStartedReason,
+		"Started a debug session with log level %d and package log level %d until %s",
+		session.LogLevel, session.PkgLogLevel, start.Add(session.Duration).UTC().Format(time.RFC3339))
+
+	key, _ := cache.MetaNamespaceKeyFunc(addon)
+	syncCtx.Queue().AddAfter(key, session.Duration)
+
+	return nil
+}
+
+// endSession removes the debug session annotations from the addon and records an Event with the
+// message.
+func (c *DebugSessionController) endSession(
+	ctx context.Context, addon *addonapiv1alpha1.ManagedClusterAddOn, message string,
+) error {
+	err := c.updateAnnotations(ctx, addon, func(annotations map[string]string) {
+		delete(annotations, DebugSessionAnnotation)
+		delete(annotations, DebugSessionStartAnnotation)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Info("Ended a policy addon debug session", "cluster", addon.Namespace, "addon", addon.Name)
+
+	c.recorder.Event(addon, corev1.EventTypeNormal, DebugSessionEndedReason, message)
+
+	return nil
+}
+
+// updateAnnotations updates the annotations of the latest version of the addon.
+func (c *DebugSessionController) updateAnnotations(
+	ctx context.Context, addon *addonapiv1alpha1.ManagedClusterAddOn, mutate func(map[string]string),
+) error {
+	updated, err := c.addonClient.AddonV1alpha1().ManagedClusterAddOns(addon.Namespace).Get(
+		ctx, addon.Name, metav1.GetOptions{},
+	)
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+
+	if updated.Annotations == nil {
+		updated.Annotations = map[string]string{}
+	}
+
+	mutate(updated.Annotations)
+
+	_, err = c.addonClient.AddonV1alpha1().ManagedClusterAddOns(addon.Namespace).Update(
+		ctx, updated, metav1.UpdateOptions{},
+	)
+
+	return ignoreNotFound(err)
+}
+
+// StartDebugSessionController starts a controller managing the debug sessions of the given addons,
+// using an informer on the ManagedClusterAddOns.
+func StartDebugSessionController(
+	ctx context.Context,
+	controllerContext *controllercmd.ControllerContext,
+	addonNames ...string,
+) error {
+	addonClient, err := addonv1alpha1client.NewForConfig(controllerContext.KubeConfig)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve addon client: %w", err)
+	}
+
+	kubeClient, err := kubernetes.NewForConfig(controllerContext.KubeConfig)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve kube client: %w", err)
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+
+	go func() {
+		<-ctx.Done()
+		broadcaster.Shutdown()
+	}()
+
+	hubInformers, err := GetHubInformers(controllerContext)
+	if err != nil {
+		return err
+	}
+
+	addonInformer := hubInformers.Addon.Addon().V1alpha1().ManagedClusterAddOns()
+
+	sessionController := &DebugSessionController{
+		addonClient: addonClient,
+		addonLister: addonInformer.Lister(),
+		recorder: broadcaster.NewRecorder(addonscheme.Scheme, corev1.EventSource{
+			Component: "governance-policy-addon-controller",
+		}),
+		now:             time.Now,
+		invalidSessions: map[string]string{},
+	}
+
+	controller := factory.New().
+		WithFilteredEventsInformersQueueKeysFunc(
+			func(obj runtime.Object) []string {
+				key, _ := cache.MetaNamespaceKeyFunc(obj)
+
+				return []string{key}
+			},
+			func(obj interface{}) bool {
+				accessor, err := meta.Accessor(obj)
+				if err != nil || !slices.Contains(addonNames, accessor.GetName()) {
+					return false
+				}
+
+				_, hasSession := accessor.GetAnnotations()[DebugSessionAnnotation]
+				_, hasStart := accessor.GetAnnotations()[DebugSessionStartAnnotation]
+
+				return hasSession || hasStart
+			},
+			addonInformer.Informer(),
+		).
+		WithSync(sessionController.sync).
+		ToController("policy-addon-debug-session")
+
+	hubInformers.Start(ctx)
+
+	go controller.Run(ctx, 1)
+
+	return nil
+}
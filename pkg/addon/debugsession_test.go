@@ -0,0 +1,232 @@
+package addon
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+	addonlistersv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
+	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
+)
+
+func TestParseDebugSession(t *testing.T) {
+	tests := map[string]struct {
+		value    string
+		expected *DebugSession
+	}{
+		"level and duration": {
+			value:    "level=4,duration=30m",
+			expected: &DebugSession{LogLevel: 4, PkgLogLevel: 2, Duration: 30 * time.Minute},
+		},
+		"package level": {
+			value:    "level=4, pkgLevel=6, duration=1h",
+			expected: &DebugSession{LogLevel: 4, PkgLogLevel: 6, Duration: time.Hour},
+		},
+		"derived package level is not negative": {
+			value:    "level=1,duration=10m",
+			expected: &DebugSession{LogLevel: 1, PkgLogLevel: 0, Duration: 10 * time.Minute},
+		},
+		"error level": {
+			value:    "level=error,duration=10m",
+			expected: &DebugSession{LogLevel: -1, PkgLogLevel: 0, Duration: 10 * time.Minute},
+		},
+		"missing duration":       {value: "level=4"},
+		"missing level":          {value: "duration=30m"},
+		"negative duration":      {value: "level=4,duration=-5m"},
+		"negative package level": {value: "level=4,pkgLevel=-1,duration=30m"},
+		"invalid level":          {value: "level=verbose,duration=30m"},
+		"unknown field":          {value: "level=4,duration=30m,color=blue"},
+		"not a key=value pair":   {value: "level=4,30m"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			session, err := ParseDebugSession(test.value)
+
+			if test.expected == nil {
+				if err == nil {
+					t.Fatalf("expected %s to be invalid, got %+v", test.value, session)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(session, test.expected) {
+				t.Fatalf("expected the session %+v, got %+v", test.expected, session)
+			}
+		})
+	}
+}
+
+func TestDebugSessionController(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		annotations map[string]string
+		expected    map[string]string
+		events      int
+	}{
+		"start": {
+			annotations: map[string]string{DebugSessionAnnotation: "level=4,duration=30m"},
+			expected: map[string]string{
+				DebugSessionAnnotation:      "level=4,duration=30m",
+				DebugSessionStartAnnotation: "2026-10-19T12:00:00Z",
+			},
+			events: 1,
+		},
+		"in progress": {
+			annotations: map[string]string{
+				DebugSessionAnnotation:      "level=4,duration=30m",
+				DebugSessionStartAnnotation: "2026-10-19T11:45:00Z",
+			},
+			expected: map[string]string{
+				DebugSessionAnnotation:      "level=4,duration=30m",
+				DebugSessionStartAnnotation: "2026-10-19T11:45:00Z",
+			},
+		},
+		"ended": {
+			annotations: map[string]string{
+				DebugSessionAnnotation:      "level=4,duration=30m",
+				DebugSessionStartAnnotation: "2026-10-19T11:00:00Z",
+			},
+			expected: map[string]string{},
+			events:   1,
+		},
+		"stopped": {
+			annotations: map[string]string{DebugSessionStartAnnotation: "2026-10-19T11:45:00Z"},
+			expected:    map[string]string{},
+			events:      1,
+		},
+		"invalid": {
+			annotations: map[string]string{
+				DebugSessionAnnotation:      "level=4",
+				DebugSessionStartAnnotation: "2026-10-19T11:45:00Z",
+			},
+			expected: map[string]string{DebugSessionAnnotation: "level=4"},
+			events:   1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			addon := &addonapiv1alpha1.ManagedClusterAddOn{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "config-policy-controller", Namespace: "cluster1", Annotations: test.annotations,
+				},
+			}
+
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+				cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+			})
+			if err := indexer.Add(addon); err != nil {
+				t.Fatal(err)
+			}
+
+			addonClient := fakeaddon.NewSimpleClientset(addon)
+			recorder := record.NewFakeRecorder(10)
+
+			controller := &DebugSessionController{
+				addonClient:     addonClient,
+				addonLister:     addonlistersv1alpha1.NewManagedClusterAddOnLister(indexer),
+				recorder:        recorder,
+				now:             func() time.Time { return now },
+				invalidSessions: map[string]string{},
+			}
+
+			err := controller.sync(context.TODO(), factory.NewSyncContext("test"), "cluster1/config-policy-controller")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			updated, err := addonClient.AddonV1alpha1().ManagedClusterAddOns("cluster1").Get(
+				context.TODO(), addon.Name, metav1.GetOptions{},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			annotations := updated.Annotations
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+
+			if !reflect.DeepEqual(annotations, test.expected) {
+				t.Fatalf("expected the annotations %v, got %v", test.expected, annotations)
+			}
+
+			if len(recorder.Events) != test.events {
+				t.Fatalf("expected %d events, got %d", test.events, len(recorder.Events))
+			}
+		})
+	}
+}
+
+func TestDebugSessionControllerInvalidEvents(t *testing.T) {
+	addon := &addonapiv1alpha1.ManagedClusterAddOn{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "config-policy-controller",
+			Namespace:   "cluster1",
+			Annotations: map[string]string{DebugSessionAnnotation: "level=4"},
+		},
+	}
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+	})
+	if err := indexer.Add(addon); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := record.NewFakeRecorder(10)
+
+	controller := &DebugSessionController{
+		addonClient:     fakeaddon.NewSimpleClientset(addon),
+		addonLister:     addonlistersv1alpha1.NewManagedClusterAddOnLister(indexer),
+		recorder:        recorder,
+		now:             time.Now,
+		invalidSessions: map[string]string{},
+	}
+
+	sync := func() {
+		t.Helper()
+
+		err := controller.sync(context.TODO(), factory.NewSyncContext("test"), "cluster1/config-policy-controller")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Resyncs of the same invalid session only record one Warning
+	sync()
+	sync()
+
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected a single event for the invalid session, got %d", len(recorder.Events))
+	}
+
+	<-recorder.Events
+
+	// Another invalid value is reported again
+	addon = addon.DeepCopy()
+	addon.Annotations[DebugSessionAnnotation] = "duration=30m"
+
+	if err := indexer.Update(addon); err != nil {
+		t.Fatal(err)
+	}
+
+	sync()
+
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected an event for the new invalid session, got %d", len(recorder.Events))
+	}
+}
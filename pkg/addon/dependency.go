@@ -0,0 +1,181 @@
+package addon
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openshift/library-go/pkg/controller/controllercmd"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/cache"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	addonlistersv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
+)
+
+// AddonDependency declares that the values of the Consumer addon are built from the outputs (for
+// example a Secret or a feature flag) of the Producer addon on the same managed cluster.
+type AddonDependency struct {
+	// Consumer is the name of the addon that uses the outputs of the producer.
+	Consumer string
+	// Producer is the name of the addon that provides the outputs.
+	Producer string
+	// Changed optionally reports whether an update to the producer ManagedClusterAddOn is relevant
+	// to the consumer. Creating the producer, starting its deletion, and removing it are always
+	// relevant. When nil, no other updates are relevant.
+	Changed func(oldAddon, newAddon *addonapiv1alpha1.ManagedClusterAddOn) bool
+}
+
+// HubKubeConfigSecret returns the name of the hub kubeconfig Secret that the addon framework
+// provides for the addon in its install namespace.
+func HubKubeConfigSecret(addonName string) string {
+	return addonName + "-hub-kubeconfig"
+}
+
+// DependencyColocated returns whether the producer addon is installed and its agent runs on the
+// same cluster as the agent of the consumer addon, meaning both are deployed in the default mode or
+// are hosted on the same hosting cluster. Only then can the consumer mount the Secrets that the
+// producer provides in its install namespace.
+func DependencyColocated(
+	addonLister addonlistersv1alpha1.ManagedClusterAddOnLister,
+	consumer *addonapiv1alpha1.ManagedClusterAddOn,
+	producer string,
+) (bool, error) {
+	addon, err := addonLister.ManagedClusterAddOns(consumer.Namespace).Get(producer)
+	if k8serrors.IsNotFound(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if !addon.DeletionTimestamp.IsZero() {
+		return false, nil
+	}
+
+	hostingClusterKey := addonapiv1alpha1.HostingClusterNameAnnotationKey
+
+	return addon.GetAnnotations()[hostingClusterKey] == consumer.GetAnnotations()[hostingClusterKey], nil
+}
+
+// PlacementChanged reports whether the hosting cluster or the install namespace of the addon
+// changed, which moves its agent and the Secrets it provides.
+func PlacementChanged(oldAddon, newAddon *addonapiv1alpha1.ManagedClusterAddOn) bool {
+	hostingClusterKey := addonapiv1alpha1.HostingClusterNameAnnotationKey
+
+	//nolint:staticcheck
+	return oldAddon.GetAnnotations()[hostingClusterKey] != newAddon.GetAnnotations()[hostingClusterKey] ||
+		oldAddon.Spec.InstallNamespace != newAddon.Spec.InstallNamespace ||
+		oldAddon.Status.Namespace != newAddon.Status.Namespace
+}
+
+// DependencyTrigger re-renders consumer addons when the producer addons they depend on are
+// created, changed in a relevant way, or deleted.
+type DependencyTrigger struct {
+	manager      addonmanager.AddonManager
+	dependencies []AddonDependency
+}
+
+// NewDependencyTrigger creates a trigger for the given dependencies.
+func NewDependencyTrigger(manager addonmanager.AddonManager, dependencies ...AddonDependency) *DependencyTrigger {
+	return &DependencyTrigger{
+		manager:      manager,
+		dependencies: dependencies,
+	}
+}
+
+// OnAdd triggers the consumers of a newly created producer. The initial list is skipped since all
+// addons are rendered when the manager starts.
+func (t *DependencyTrigger) OnAdd(obj interface{}, isInInitialList bool) {
+	if isInInitialList {
+		return
+	}
+
+	if addon, ok := obj.(*addonapiv1alpha1.ManagedClusterAddOn); ok {
+		t.triggerConsumers(addon, nil)
+	}
+}
+
+// OnUpdate triggers the consumers of a producer when its deletion starts or when the dependency
+// considers the change relevant.
+func (t *DependencyTrigger) OnUpdate(oldObj, newObj interface{}) {
+	oldAddon, ok := oldObj.(*addonapiv1alpha1.ManagedClusterAddOn)
+	if !ok {
+		return
+	}
+
+	newAddon, ok := newObj.(*addonapiv1alpha1.ManagedClusterAddOn)
+	if !ok {
+		return
+	}
+
+	if oldAddon.ResourceVersion == newAddon.ResourceVersion {
+		// Periodic resync, nothing changed
+		return
+	}
+
+	deletionStarted := oldAddon.DeletionTimestamp.IsZero() && !newAddon.DeletionTimestamp.IsZero()
+
+	t.triggerConsumers(newAddon, func(dep AddonDependency) bool {
+		return deletionStarted || (dep.Changed != nil && dep.Changed(oldAddon, newAddon))
+	})
+}
+
+// OnDelete triggers the consumers of a removed producer.
+func (t *DependencyTrigger) OnDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	if addon, ok := obj.(*addonapiv1alpha1.ManagedClusterAddOn); ok {
+		t.triggerConsumers(addon, nil)
+	}
+}
+
+// triggerConsumers triggers every consumer of the producer addon on its cluster. When relevant is
+// set, only the dependencies it accepts are triggered.
+func (t *DependencyTrigger) triggerConsumers(
+	producer *addonapiv1alpha1.ManagedClusterAddOn, relevant func(AddonDependency) bool,
+) {
+	for _, dep := range t.dependencies {
+		if dep.Producer != producer.Name {
+			continue
+		}
+
+		if relevant != nil && !relevant(dep) {
+			continue
+		}
+
+		log.V(2).Info("Triggering addon after a change to an addon it depends on",
+			"cluster", producer.Namespace, "addon", dep.Consumer, "dependency", dep.Producer)
+
+		t.manager.Trigger(producer.Namespace, dep.Consumer)
+	}
+}
+
+// StartDependencyTrigger registers a DependencyTrigger for the given dependencies on the manager,
+// on the shared ManagedClusterAddOn informer. The consumers read the producers from the lister of
+// that informer, which is updated before its event handlers are called, so a triggered consumer
+// always sees the change it was triggered for.
+func StartDependencyTrigger(
+	ctx context.Context,
+	mgr addonmanager.AddonManager,
+	controllerContext *controllercmd.ControllerContext,
+	dependencies ...AddonDependency,
+) error {
+	hubInformers, err := GetHubInformers(controllerContext)
+	if err != nil {
+		return err
+	}
+
+	addonInformer := hubInformers.Addon.Addon().V1alpha1().ManagedClusterAddOns()
+
+	_, err = addonInformer.Informer().AddEventHandler(NewDependencyTrigger(mgr, dependencies...))
+	if err != nil {
+		return fmt.Errorf("failed to add the ManagedClusterAddOn event handler: %w", err)
+	}
+
+	hubInformers.Start(ctx)
+
+	return nil
+}
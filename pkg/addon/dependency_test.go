@@ -0,0 +1,240 @@
+package addon
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+	addonlistersv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
+)
+
+// fakeListWatch disables the watch-list semantics, which the fake clientsets don't support.
+type fakeListWatch struct {
+	*cache.ListWatch
+}
+
+func (fakeListWatch) IsWatchListSemanticsUnSupported() bool {
+	return true
+}
+
+// newFakeAddonInformer returns a ManagedClusterAddOn informer on the fake clientset.
+func newFakeAddonInformer(addonClient *fakeaddon.Clientset) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		fakeListWatch{&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return addonClient.AddonV1alpha1().ManagedClusterAddOns("").List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return addonClient.AddonV1alpha1().ManagedClusterAddOns("").Watch(context.TODO(), options)
+			},
+		}},
+		&addonapiv1alpha1.ManagedClusterAddOn{},
+		0,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+	)
+}
+
+func TestDependencyTrigger(t *testing.T) {
+	dependency := AddonDependency{Consumer: "consumer", Producer: "producer", Changed: PlacementChanged}
+
+	producer := func(resourceVersion string, annotations map[string]string) *addonapiv1alpha1.ManagedClusterAddOn {
+		return &addonapiv1alpha1.ManagedClusterAddOn{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "producer",
+				Namespace:       "cluster1",
+				ResourceVersion: resourceVersion,
+				Annotations:     annotations,
+			},
+		}
+	}
+
+	deleting := producer("2", nil)
+	deleting.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+
+	hosted := map[string]string{addonapiv1alpha1.HostingClusterNameAnnotationKey: "hosting"}
+
+	tests := map[string]struct {
+		event    func(trigger *DependencyTrigger)
+		expected []string
+	}{
+		"initial list": {
+			event:    func(trigger *DependencyTrigger) { trigger.OnAdd(producer("1", nil), true) },
+			expected: nil,
+		},
+		"producer created": {
+			event:    func(trigger *DependencyTrigger) { trigger.OnAdd(producer("1", nil), false) },
+			expected: []string{"cluster1/consumer"},
+		},
+		"other addon created": {
+			event: func(trigger *DependencyTrigger) {
+				other := producer("1", nil)
+				other.Name = "other"
+				trigger.OnAdd(other, false)
+			},
+			expected: nil,
+		},
+		"resync": {
+			event:    func(trigger *DependencyTrigger) { trigger.OnUpdate(producer("1", nil), producer("1", hosted)) },
+			expected: nil,
+		},
+		"irrelevant update": {
+			event: func(trigger *DependencyTrigger) {
+				trigger.OnUpdate(producer("1", nil), producer("2", map[string]string{"other": "value"}))
+			},
+			expected: nil,
+		},
+		"placement changed": {
+			event:    func(trigger *DependencyTrigger) { trigger.OnUpdate(producer("1", nil), producer("2", hosted)) },
+			expected: []string{"cluster1/consumer"},
+		},
+		"deletion started": {
+			event:    func(trigger *DependencyTrigger) { trigger.OnUpdate(producer("1", nil), deleting) },
+			expected: []string{"cluster1/consumer"},
+		},
+		"producer deleted": {
+			event: func(trigger *DependencyTrigger) {
+				trigger.OnDelete(cache.DeletedFinalStateUnknown{Key: "cluster1/producer", Obj: producer("1", nil)})
+			},
+			expected: []string{"cluster1/consumer"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			manager := &fakeManager{}
+
+			test.event(NewDependencyTrigger(manager, dependency))
+
+			if !slices.Equal(manager.getTriggered(), test.expected) {
+				t.Fatalf("expected the triggered addons %v, got %v", test.expected, manager.getTriggered())
+			}
+		})
+	}
+}
+
+func TestDependencyTriggerSharedLister(t *testing.T) {
+	producer := &addonapiv1alpha1.ManagedClusterAddOn{
+		ObjectMeta: metav1.ObjectMeta{Name: "producer", Namespace: "cluster1"},
+	}
+	consumer := &addonapiv1alpha1.ManagedClusterAddOn{
+		ObjectMeta: metav1.ObjectMeta{Name: "consumer", Namespace: "cluster1"},
+	}
+
+	addonClient := fakeaddon.NewSimpleClientset(producer, consumer)
+	addonInformer := newFakeAddonInformer(addonClient)
+	addonLister := addonlistersv1alpha1.NewManagedClusterAddOnLister(addonInformer.GetIndexer())
+
+	colocatedOnTrigger := make(chan bool, 1)
+
+	manager := &fakeManager{onTrigger: func(string, string) {
+		// This is what the values of the consumer see when it is rendered after the trigger
+		colocated, err := DependencyColocated(addonLister, consumer, "producer")
+		if err != nil {
+			t.Error(err)
+		}
+
+		colocatedOnTrigger <- colocated
+	}}
+
+	_, err := addonInformer.AddEventHandler(
+		NewDependencyTrigger(manager, AddonDependency{Consumer: "consumer", Producer: "producer"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	go addonInformer.Run(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(), addonInformer.HasSynced) {
+		t.Fatal("the ManagedClusterAddOn informer didn't sync")
+	}
+
+	err = addonClient.AddonV1alpha1().ManagedClusterAddOns("cluster1").Delete(ctx, "producer", metav1.DeleteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case colocated := <-colocatedOnTrigger:
+		if colocated {
+			t.Fatal("expected the deleted producer to not be colocated when the consumer is triggered")
+		}
+	case <-ctx.Done():
+		t.Fatal("expected the consumer to be triggered after the producer was deleted")
+	}
+}
+
+func TestDependencyColocated(t *testing.T) {
+	hosted := map[string]string{addonapiv1alpha1.HostingClusterNameAnnotationKey: "hosting"}
+
+	tests := map[string]struct {
+		producer  *addonapiv1alpha1.ManagedClusterAddOn
+		consumer  map[string]string
+		colocated bool
+	}{
+		"missing producer": {
+			consumer:  nil,
+			colocated: false,
+		},
+		"both in default mode": {
+			producer:  &addonapiv1alpha1.ManagedClusterAddOn{},
+			colocated: true,
+		},
+		"both hosted on the same cluster": {
+			producer:  &addonapiv1alpha1.ManagedClusterAddOn{ObjectMeta: metav1.ObjectMeta{Annotations: hosted}},
+			consumer:  hosted,
+			colocated: true,
+		},
+		"only the consumer hosted": {
+			producer:  &addonapiv1alpha1.ManagedClusterAddOn{},
+			consumer:  hosted,
+			colocated: false,
+		},
+		"producer deleting": {
+			producer: &addonapiv1alpha1.ManagedClusterAddOn{ObjectMeta: metav1.ObjectMeta{
+				DeletionTimestamp: &metav1.Time{Time: time.Now()},
+			}},
+			colocated: false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+
+			if test.producer != nil {
+				test.producer.Name = "producer"
+				test.producer.Namespace = "cluster1"
+
+				if err := indexer.Add(test.producer); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			consumer := &addonapiv1alpha1.ManagedClusterAddOn{
+				ObjectMeta: metav1.ObjectMeta{Name: "consumer", Namespace: "cluster1", Annotations: test.consumer},
+			}
+
+			colocated, err := DependencyColocated(
+				addonlistersv1alpha1.NewManagedClusterAddOnLister(indexer), consumer, "producer",
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if colocated != test.colocated {
+				t.Fatalf("expected colocated to be %v, got %v", test.colocated, colocated)
+			}
+		})
+	}
+}
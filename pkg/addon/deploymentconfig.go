@@ -0,0 +1,218 @@
+package addon
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openshift/library-go/pkg/controller/controllercmd"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"open-cluster-management.io/addon-framework/pkg/addonfactory"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	addonlistersv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
+	clusterlistersv1beta1 "open-cluster-management.io/api/client/cluster/listers/cluster/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	clusterv1beta1 "open-cluster-management.io/api/cluster/v1beta1"
+)
+
+// DeploymentConfigResolver resolves the AddOnDeploymentConfig of the addons that the addon manager
+// on the hub didn't set in their status yet, so that the agent isn't deployed without it first. It
+// follows the precedence of the addon manager: the configs of the ManagedClusterAddOn, then the
+// configs of the last install strategy placement selecting the cluster, then the default config of
+// the ClusterManagementAddOn. Unlike the addon manager, it ignores the rollout strategy of the
+// placements, so a new addon may get the config of its placement before the rollout reaches it.
+type DeploymentConfigResolver struct {
+	cmaLister      addonlistersv1alpha1.ClusterManagementAddOnLister
+	decisionLister clusterlistersv1beta1.PlacementDecisionLister
+}
+
+// NewDeploymentConfigResolver returns a resolver using the listers.
+func NewDeploymentConfigResolver(
+	cmaLister addonlistersv1alpha1.ClusterManagementAddOnLister,
+	decisionLister clusterlistersv1beta1.PlacementDecisionLister,
+) *DeploymentConfigResolver {
+	return &DeploymentConfigResolver{cmaLister: cmaLister, decisionLister: decisionLister}
+}
+
+// StartDeploymentConfigResolver starts the shared informers of the ClusterManagementAddOns and
+// PlacementDecisions, and returns a resolver using them.
+func StartDeploymentConfigResolver(
+	ctx context.Context, controllerContext *controllercmd.ControllerContext,
+) (*DeploymentConfigResolver, error) {
+	hubInformers, err := GetHubInformers(controllerContext)
+	if err != nil {
+		return nil, err
+	}
+
+	cmaInformer := hubInformers.Addon.Addon().V1alpha1().ClusterManagementAddOns()
+	decisionInformer := hubInformers.Cluster.Cluster().V1beta1().PlacementDecisions()
+
+	resolver := NewDeploymentConfigResolver(cmaInformer.Lister(), decisionInformer.Lister())
+
+	hubInformers.Start(ctx)
+
+	return resolver, nil
+}
+
+// GetValues returns the values of the AddOnDeploymentConfig of the addon, like
+// addonfactory.GetAddOnDeploymentConfigValues, which it uses once the config is resolved.
+func (r *DeploymentConfigResolver) GetValues(
+	getter utils.AddOnDeploymentConfigGetter, toValuesFuncs ...addonfactory.AddOnDeploymentConfigToValuesFunc,
+) addonfactory.GetValuesFunc {
+	getValues := addonfactory.GetAddOnDeploymentConfigValues(getter, toValuesFuncs...)
+
+	return func(
+		cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn,
+	) (addonfactory.Values, error) {
+		resolved, err := r.resolve(addon, getter)
+		if err != nil {
+			return nil, err
+		}
+
+		return getValues(cluster, resolved)
+	}
+}
+
+// AgentInstallNamespace wraps the function returning the agent install namespace of the addon, so
+// that it's given the addon with the resolved AddOnDeploymentConfig.
+func (r *DeploymentConfigResolver) AgentInstallNamespace(
+	getter utils.AddOnDeploymentConfigGetter,
+	getNamespace func(*addonapiv1alpha1.ManagedClusterAddOn) (string, error),
+) func(*addonapiv1alpha1.ManagedClusterAddOn) (string, error) {
+	return func(addon *addonapiv1alpha1.ManagedClusterAddOn) (string, error) {
+		resolved, err := r.resolve(addon, getter)
+		if err != nil {
+			return "", err
+		}
+
+		return getNamespace(resolved)
+	}
+}
+
+// resolve returns the addon with the desired AddOnDeploymentConfig in its status. The addon is
+// returned as is when the addon manager already set it, or when the addon has none.
+func (r *DeploymentConfigResolver) resolve(
+	addon *addonapiv1alpha1.ManagedClusterAddOn, getter utils.AddOnDeploymentConfigGetter,
+) (*addonapiv1alpha1.ManagedClusterAddOn, error) {
+	if r == nil || addon == nil {
+		return addon, nil
+	}
+
+	ok, _ := utils.GetAddOnConfigRef(addon.Status.ConfigReferences,
+		utils.AddOnDeploymentConfigGVR.Group, utils.AddOnDeploymentConfigGVR.Resource)
+	if ok {
+		return addon, nil
+	}
+
+	referent, err := r.configReferent(addon)
+	if err != nil || referent == nil {
+		return addon, err
+	}
+
+	config, err := getter.Get(context.TODO(), referent.Namespace, referent.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the AddOnDeploymentConfig %s/%s of the %s addon: %w",
+			referent.Namespace, referent.Name, addon.Name, err)
+	}
+
+	specHash, err := utils.GetAddOnDeploymentConfigSpecHash(config)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := addon.DeepCopy()
+	resolved.Status.ConfigReferences = append(resolved.Status.ConfigReferences, addonapiv1alpha1.ConfigReference{
+		ConfigGroupResource: deploymentConfigGroupResource,
+		ConfigReferent:      *referent,
+		DesiredConfig:       &addonapiv1alpha1.ConfigSpecHash{ConfigReferent: *referent, SpecHash: specHash},
+	})
+
+	return resolved, nil
+}
+
+// configReferent returns the AddOnDeploymentConfig of the addon with the precedence of the addon
+// manager, or nil when it has none.
+func (r *DeploymentConfigResolver) configReferent(
+	addon *addonapiv1alpha1.ManagedClusterAddOn,
+) (*addonapiv1alpha1.ConfigReferent, error) {
+	if referent := deploymentConfigReferent(addon.Spec.Configs); referent != nil {
+		return referent, nil
+	}
+
+	cma, err := r.cmaLister.Get(addon.Name)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if cma.Spec.InstallStrategy.Type == addonapiv1alpha1.AddonInstallStrategyPlacements {
+		placements := cma.Spec.InstallStrategy.Placements
+
+		// When the cluster is selected by several placements, the last one applies
+		for i := len(placements) - 1; i >= 0; i-- {
+			selected, err := r.selects(placements[i].PlacementRef, addon.Namespace)
+			if err != nil {
+				return nil, err
+			}
+
+			if !selected {
+				continue
+			}
+
+			if referent := deploymentConfigReferent(placements[i].Configs); referent != nil {
+				return referent, nil
+			}
+
+			break
+		}
+	}
+
+	for _, config := range cma.Spec.SupportedConfigs {
+		if config.ConfigGroupResource == deploymentConfigGroupResource && config.DefaultConfig != nil {
+			return config.DefaultConfig.DeepCopy(), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// selects returns whether the decisions of the placement select the cluster.
+func (r *DeploymentConfigResolver) selects(placement addonapiv1alpha1.PlacementRef, clusterName string) (bool, error) {
+	decisions, err := r.decisionLister.PlacementDecisions(placement.Namespace).List(
+		labels.SelectorFromSet(labels.Set{clusterv1beta1.PlacementLabel: placement.Name}),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	for _, decision := range decisions {
+		for _, clusterDecision := range decision.Status.Decisions {
+			if clusterDecision.ClusterName == clusterName {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+var deploymentConfigGroupResource = addonapiv1alpha1.ConfigGroupResource{
+	Group:    utils.AddOnDeploymentConfigGVR.Group,
+	Resource: utils.AddOnDeploymentConfigGVR.Resource,
+}
+
+// deploymentConfigReferent returns the AddOnDeploymentConfig in the configs, or nil when there is
+// none.
+func deploymentConfigReferent(configs []addonapiv1alpha1.AddOnConfig) *addonapiv1alpha1.ConfigReferent {
+	for _, config := range configs {
+		if config.ConfigGroupResource == deploymentConfigGroupResource {
+			return config.ConfigReferent.DeepCopy()
+		}
+	}
+
+	return nil
+}
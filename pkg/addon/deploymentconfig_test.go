@@ -0,0 +1,277 @@
+package addon
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/cache"
+	"open-cluster-management.io/addon-framework/pkg/addonfactory"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+	addonlistersv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
+	clusterlistersv1beta1 "open-cluster-management.io/api/client/cluster/listers/cluster/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	clusterv1alpha1 "open-cluster-management.io/api/cluster/v1alpha1"
+	clusterv1beta1 "open-cluster-management.io/api/cluster/v1beta1"
+)
+
+// newTestPlacement returns the placement of the install strategy with the AddOnDeploymentConfig
+// when it's not empty.
+func newTestPlacement(name, configName string) addonapiv1alpha1.PlacementStrategy {
+	placement := addonapiv1alpha1.PlacementStrategy{
+		PlacementRef: addonapiv1alpha1.PlacementRef{Name: name, Namespace: "policies"},
+	}
+
+	if configName != "" {
+		placement.Configs = []addonapiv1alpha1.AddOnConfig{{
+			ConfigGroupResource: deploymentConfigGroupResource,
+			ConfigReferent: addonapiv1alpha1.ConfigReferent{
+				Name: configName, Namespace: "open-cluster-management",
+			},
+		}}
+	}
+
+	return placement
+}
+
+// newTestResolver returns a DeploymentConfigResolver listing the ClusterManagementAddOn of the
+// config-policy-controller with the default config and placements, when they are set. The
+// production placement selects the production-cluster, and the edge placement selects the
+// production-cluster and the edge-cluster.
+func newTestResolver(
+	t *testing.T, defaultConfig string, placements ...addonapiv1alpha1.PlacementStrategy,
+) *DeploymentConfigResolver {
+	t.Helper()
+
+	cmaIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	decisionIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+	})
+
+	if defaultConfig != "" || len(placements) != 0 {
+		cma := &addonapiv1alpha1.ClusterManagementAddOn{
+			ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller"},
+			Spec: addonapiv1alpha1.ClusterManagementAddOnSpec{
+				InstallStrategy: addonapiv1alpha1.InstallStrategy{Type: addonapiv1alpha1.AddonInstallStrategyManual},
+			},
+		}
+
+		if defaultConfig != "" {
+			cma.Spec.SupportedConfigs = []addonapiv1alpha1.ConfigMeta{{
+				ConfigGroupResource: deploymentConfigGroupResource,
+				DefaultConfig: &addonapiv1alpha1.ConfigReferent{
+					Name: defaultConfig, Namespace: "open-cluster-management",
+				},
+			}}
+		}
+
+		if len(placements) != 0 {
+			cma.Spec.InstallStrategy = addonapiv1alpha1.InstallStrategy{
+				Type:       addonapiv1alpha1.AddonInstallStrategyPlacements,
+				Placements: placements,
+			}
+		}
+
+		if err := cmaIndexer.Add(cma); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for placement, clusters := range map[string][]string{
+		"production": {"production-cluster"},
+		"edge":       {"production-cluster", "edge-cluster"},
+	} {
+		decision := &clusterv1beta1.PlacementDecision{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      placement + "-decision-1",
+				Namespace: "policies",
+				Labels:    map[string]string{clusterv1beta1.PlacementLabel: placement},
+			},
+		}
+
+		for _, cluster := range clusters {
+			decision.Status.Decisions = append(decision.Status.Decisions,
+				clusterv1beta1.ClusterDecision{ClusterName: cluster})
+		}
+
+		if err := decisionIndexer.Add(decision); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return NewDeploymentConfigResolver(
+		addonlistersv1alpha1.NewClusterManagementAddOnLister(cmaIndexer),
+		clusterlistersv1beta1.NewPlacementDecisionLister(decisionIndexer),
+	)
+}
+
+// newTestConfigGetter returns an AddOnDeploymentConfig getter with the configs, each setting its name
+// as the log level and install namespace.
+func newTestConfigGetter(t *testing.T, names ...string) utils.AddOnDeploymentConfigGetter {
+	t.Helper()
+
+	addonClient := fakeaddon.NewSimpleClientset()
+
+	for _, name := range names {
+		err := addonClient.Tracker().Add(&addonapiv1alpha1.AddOnDeploymentConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "open-cluster-management"},
+			Spec: addonapiv1alpha1.AddOnDeploymentConfigSpec{
+				AgentInstallNamespace: name,
+				CustomizedVariables:   []addonapiv1alpha1.CustomizedVariable{{Name: "logLevel", Value: name}},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return utils.NewAddOnDeploymentConfigGetter(addonClient)
+}
+
+// TestDeploymentConfigResolver checks that the AddOnDeploymentConfig is resolved with the precedence
+// of the addon manager, and records where they disagree.
+func TestDeploymentConfigResolver(t *testing.T) {
+	getter := newTestConfigGetter(t, "default", "production", "edge", "addon", "manager")
+
+	addonConfig := addonapiv1alpha1.AddOnConfig{
+		ConfigGroupResource: deploymentConfigGroupResource,
+		ConfigReferent:      addonapiv1alpha1.ConfigReferent{Name: "addon", Namespace: "open-cluster-management"},
+	}
+	managerReference := addonapiv1alpha1.ConfigReference{
+		ConfigGroupResource: deploymentConfigGroupResource,
+		DesiredConfig: &addonapiv1alpha1.ConfigSpecHash{
+			ConfigReferent: addonapiv1alpha1.ConfigReferent{Name: "manager", Namespace: "open-cluster-management"},
+			SpecHash:       "hash",
+		},
+	}
+	progressive := newTestPlacement("production", "production")
+	progressive.RolloutStrategy = clusterv1alpha1.RolloutStrategy{
+		Type:        clusterv1alpha1.Progressive,
+		Progressive: &clusterv1alpha1.RolloutProgressive{MaxConcurrency: intstr.FromInt32(1)},
+	}
+
+	tests := map[string]struct {
+		resolver         *DeploymentConfigResolver
+		clusterName      string
+		configs          []addonapiv1alpha1.AddOnConfig
+		configReferences []addonapiv1alpha1.ConfigReference
+		// expected is the resolved AddOnDeploymentConfig, or empty when the addon has none
+		expected string
+	}{
+		"no resolver": {
+			clusterName: "production-cluster",
+			configs:     []addonapiv1alpha1.AddOnConfig{addonConfig},
+		},
+		"no ClusterManagementAddOn": {
+			resolver:    newTestResolver(t, ""),
+			clusterName: "production-cluster",
+		},
+		"no config": {
+			resolver:    newTestResolver(t, "", newTestPlacement("production", "")),
+			clusterName: "production-cluster",
+		},
+		"default config": {
+			resolver:    newTestResolver(t, "default"),
+			clusterName: "production-cluster",
+			expected:    "default",
+		},
+		"cluster not selected by the placement": {
+			resolver:    newTestResolver(t, "default", newTestPlacement("production", "production")),
+			clusterName: "staging-cluster",
+			expected:    "default",
+		},
+		"placement config": {
+			resolver:    newTestResolver(t, "default", newTestPlacement("production", "production")),
+			clusterName: "production-cluster",
+			expected:    "production",
+		},
+		"last placement selecting the cluster": {
+			resolver: newTestResolver(t, "default",
+				newTestPlacement("production", "production"), newTestPlacement("edge", "edge")),
+			clusterName: "production-cluster",
+			expected:    "edge",
+		},
+		"last placement selecting the cluster without a config": {
+			resolver: newTestResolver(t, "default",
+				newTestPlacement("production", "production"), newTestPlacement("edge", "")),
+			clusterName: "production-cluster",
+			expected:    "default",
+		},
+		"per-addon config": {
+			resolver:    newTestResolver(t, "default", newTestPlacement("production", "production")),
+			clusterName: "production-cluster",
+			configs:     []addonapiv1alpha1.AddOnConfig{addonConfig},
+			expected:    "addon",
+		},
+		"config set by the addon manager": {
+			resolver:         newTestResolver(t, "default", newTestPlacement("production", "production")),
+			clusterName:      "production-cluster",
+			configs:          []addonapiv1alpha1.AddOnConfig{addonConfig},
+			configReferences: []addonapiv1alpha1.ConfigReference{managerReference},
+			expected:         "manager",
+		},
+		// The addon manager would keep the addon without the config until the rollout reaches it
+		"rollout strategy ignored": {
+			resolver:    newTestResolver(t, "default", progressive),
+			clusterName: "production-cluster",
+			expected:    "production",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			addon := &addonapiv1alpha1.ManagedClusterAddOn{
+				ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller", Namespace: test.clusterName},
+				Spec:       addonapiv1alpha1.ManagedClusterAddOnSpec{Configs: test.configs},
+				Status:     addonapiv1alpha1.ManagedClusterAddOnStatus{ConfigReferences: test.configReferences},
+			}
+
+			namespace, err := test.resolver.AgentInstallNamespace(getter,
+				func(addon *addonapiv1alpha1.ManagedClusterAddOn) (string, error) {
+					config, err := utils.GetDesiredAddOnDeploymentConfig(addon, getter)
+					if err != nil || config == nil {
+						return "", err
+					}
+
+					return config.Spec.AgentInstallNamespace, nil
+				},
+			)(addon)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if namespace != test.expected {
+				t.Fatalf("expected the AddOnDeploymentConfig '%s', got '%s'", test.expected, namespace)
+			}
+
+			values, err := test.resolver.GetValues(getter, addonfactory.ToAddOnCustomizedVariableValues)(
+				&clusterv1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: test.clusterName}}, addon,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if logLevel, _ := values["logLevel"].(string); logLevel != test.expected {
+				t.Fatalf("expected the values of the AddOnDeploymentConfig '%s', got %v", test.expected, values)
+			}
+
+			if len(addon.Status.ConfigReferences) != len(test.configReferences) {
+				t.Fatal("expected the addon not to be modified")
+			}
+		})
+	}
+}
+
+func TestDeploymentConfigResolverMissingConfig(t *testing.T) {
+	addon := &addonapiv1alpha1.ManagedClusterAddOn{
+		ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller", Namespace: "production-cluster"},
+	}
+
+	getValues := newTestResolver(t, "default").GetValues(newTestConfigGetter(t))
+
+	if _, err := getValues(&clusterv1.ManagedCluster{}, addon); err == nil {
+		t.Fatal("expected an error when the AddOnDeploymentConfig doesn't exist")
+	}
+}
@@ -0,0 +1,346 @@
+package addon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/openshift/library-go/pkg/controller/controllercmd"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/cache"
+	"open-cluster-management.io/addon-framework/pkg/addonfactory"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	addonlistersv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
+)
+
+const (
+	// HostedNamespaceAvailableCondition is the ManagedClusterAddOn condition reporting whether the
+	// install namespace of a hosted addon can be used on its hosting cluster, meaning it is valid and
+	// not used by the same addon of another managed cluster hosted on the same cluster.
+	HostedNamespaceAvailableCondition = "HostedNamespaceAvailable"
+
+	namespaceReasonAvailable = "NamespaceAvailable"
+	namespaceReasonContended = "NamespaceContended"
+	namespaceReasonConflict  = "NamespaceConflict"
+	namespaceReasonInvalid   = "InvalidNamespace"
+)
+
+// HostedNamespaceChecker refuses to deploy hosted addons of different managed clusters in the same
+// namespace of their hosting cluster, where their Deployments and leases would collide. The addon
+// created first keeps the namespace.
+type HostedNamespaceChecker struct {
+	addonName        string
+	addonLister      addonlistersv1alpha1.ManagedClusterAddOnLister
+	addonSynced      cache.InformerSynced
+	installNamespace agent.AgentInstallNamespaceFunc
+	lock             sync.Mutex
+	// placements are the placements of the other addons, by namespace/name, cached since the install
+	// namespace function may get the AddOnDeploymentConfig of each addon from the API server.
+	placements map[string]cachedPlacement
+}
+
+// hostedPlacement is the hosting cluster and install namespace of a hosted addon.
+type hostedPlacement struct {
+	hostingCluster string
+	namespace      string
+}
+
+// cachedPlacement is the placement of an addon at a resource version. A change to the
+// AddOnDeploymentConfig of the addon updates its config references, and so its resource version.
+type cachedPlacement struct {
+	resourceVersion string
+	placement       hostedPlacement
+}
+
+// NewHostedNamespaceChecker creates a HostedNamespaceChecker for the addon, using the install
+// namespace function of its registration option. It starts an informer on the ManagedClusterAddOns
+// that re-renders the hosted addons sharing a namespace when one of them is added, moved, or removed,
+// so that the conflict is reported on all of them.
+func NewHostedNamespaceChecker(
+	ctx context.Context,
+	mgr addonmanager.AddonManager,
+	controllerContext *controllercmd.ControllerContext,
+	agentAddon agent.AgentAddon,
+) (*HostedNamespaceChecker, error) {
+	hubInformers, err := GetHubInformers(controllerContext)
+	if err != nil {
+		return nil, err
+	}
+
+	addonInformer := hubInformers.Addon.Addon().V1alpha1().ManagedClusterAddOns()
+
+	options := agentAddon.GetAgentAddonOptions()
+
+	checker := &HostedNamespaceChecker{
+		addonName:   options.AddonName,
+		addonLister: addonInformer.Lister(),
+		addonSynced: addonInformer.Informer().HasSynced,
+	}
+
+	if options.Registration != nil {
+		checker.installNamespace = options.Registration.AgentInstallNamespace
+	}
+
+	_, err = addonInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			checker.triggerPeers(mgr, obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldAddon, ok := oldObj.(*addonapiv1alpha1.ManagedClusterAddOn)
+			if !ok {
+				return
+			}
+
+			newAddon, ok := newObj.(*addonapiv1alpha1.ManagedClusterAddOn)
+			if !ok || oldAddon.ResourceVersion == newAddon.ResourceVersion {
+				return
+			}
+
+			deletionStarted := oldAddon.DeletionTimestamp.IsZero() && !newAddon.DeletionTimestamp.IsZero()
+
+			if deletionStarted || PlacementChanged(oldAddon, newAddon) {
+				checker.triggerPeers(mgr, oldAddon)
+				checker.triggerPeers(mgr, newAddon)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+
+			checker.triggerPeers(mgr, obj)
+			checker.forget(obj)
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add the ManagedClusterAddOn event handler: %w", err)
+	}
+
+	hubInformers.Start(ctx)
+
+	return checker, nil
+}
+
+// placement returns the hosting cluster and install namespace of the addon, with an empty hosting
+// cluster when the addon is not hosted.
+func (c *HostedNamespaceChecker) placement(addon *addonapiv1alpha1.ManagedClusterAddOn) (hostedPlacement, error) {
+	hostingCluster := addon.GetAnnotations()[addonapiv1alpha1.HostingClusterNameAnnotationKey]
+	if hostingCluster == "" {
+		return hostedPlacement{}, nil
+	}
+
+	// This is the same defaulting as the addon framework
+	//nolint:staticcheck
+	namespace := addon.Spec.InstallNamespace
+	if namespace == "" {
+		namespace = addonfactory.AddonDefaultInstallNamespace
+	}
+
+	if c.installNamespace != nil {
+		configured, err := c.installNamespace(addon)
+		if err != nil {
+			return hostedPlacement{}, err
+		}
+
+		if configured != "" {
+			namespace = configured
+		}
+	}
+
+	return hostedPlacement{hostingCluster: hostingCluster, namespace: namespace}, nil
+}
+
+// cachedPlacement returns the placement of the addon, from the cache when the addon didn't change
+// since it was cached.
+func (c *HostedNamespaceChecker) cachedPlacement(addon *addonapiv1alpha1.ManagedClusterAddOn) (hostedPlacement, error) {
+	key := addon.Namespace + "/" + addon.Name
+
+	c.lock.Lock()
+	cached, ok := c.placements[key]
+	c.lock.Unlock()
+
+	if ok && cached.resourceVersion == addon.ResourceVersion {
+		return cached.placement, nil
+	}
+
+	placement, err := c.placement(addon)
+	if err != nil {
+		return hostedPlacement{}, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.placements == nil {
+		c.placements = map[string]cachedPlacement{}
+	}
+
+	c.placements[key] = cachedPlacement{resourceVersion: addon.ResourceVersion, placement: placement}
+
+	return placement, nil
+}
+
+// forget removes the cached placement of the deleted addon.
+func (c *HostedNamespaceChecker) forget(obj interface{}) {
+	addon, ok := obj.(*addonapiv1alpha1.ManagedClusterAddOn)
+	if !ok {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.placements, addon.Namespace+"/"+addon.Name)
+}
+
+// peers returns the other addons that are hosted in the same namespace of the same hosting cluster,
+// excluding the addons being deleted.
+func (c *HostedNamespaceChecker) peers(
+	addon *addonapiv1alpha1.ManagedClusterAddOn, placement hostedPlacement,
+) ([]*addonapiv1alpha1.ManagedClusterAddOn, error) {
+	addons, err := c.addonLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	peers := []*addonapiv1alpha1.ManagedClusterAddOn{}
+
+	for _, other := range addons {
+		if other.Name != addon.Name || other.Namespace == addon.Namespace || !other.DeletionTimestamp.IsZero() {
+			continue
+		}
+
+		otherPlacement, err := c.cachedPlacement(other)
+		if err != nil {
+			log.Error(err, "Failed to get the install namespace of the hosted addon",
+				"cluster", other.Namespace, "addon", other.Name)
+
+			continue
+		}
+
+		if otherPlacement == placement {
+			peers = append(peers, other)
+		}
+	}
+
+	return peers, nil
+}
+
+// Check returns the HostedNamespaceAvailable condition of the addon, or nil when the addon is not
+// hosted, along with an error when the addon must not be deployed because its install namespace is
+// invalid or is kept by the same addon of another managed cluster.
+func (c *HostedNamespaceChecker) Check(addon *addonapiv1alpha1.ManagedClusterAddOn) (*metav1.Condition, error) {
+	placement, err := c.placement(addon)
+	if err != nil {
+		return nil, err
+	}
+
+	if placement.hostingCluster == "" {
+		return nil, nil
+	}
+
+	// Don't deploy the agent while the addons are still being listed, since the namespace might be
+	// kept by an addon that isn't listed yet
+	if !c.addonSynced() {
+		return nil, errors.New("the addons are not synced yet to check the hosted install namespace")
+	}
+
+	if errs := validation.IsDNS1123Label(placement.namespace); len(errs) != 0 {
+		condition := &metav1.Condition{
+			Type:   HostedNamespaceAvailableCondition,
+			Status: metav1.ConditionFalse,
+			Reason: namespaceReasonInvalid,
+			Message: fmt.Sprintf("invalid install namespace '%s' for the hosted addon: %s",
+				placement.namespace, strings.Join(errs, ", ")),
+		}
+
+		return condition, fmt.Errorf("refusing to deploy the agent: %s", condition.Message)
+	}
+
+	peers, err := c.peers(addon, placement)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(peers) == 0 {
+		return &metav1.Condition{
+			Type:   HostedNamespaceAvailableCondition,
+			Status: metav1.ConditionTrue,
+			Reason: namespaceReasonAvailable,
+			Message: fmt.Sprintf("The install namespace %s on the hosting cluster %s is only used by this addon",
+				placement.namespace, placement.hostingCluster),
+		}, nil
+	}
+
+	// The addon created first keeps the namespace, with the cluster name breaking ties
+	owner := slices.MinFunc(append(peers, addon), func(a, b *addonapiv1alpha1.ManagedClusterAddOn) int {
+		if order := a.CreationTimestamp.Compare(b.CreationTimestamp.Time); order != 0 {
+			return order
+		}
+
+		return strings.Compare(a.Namespace, b.Namespace)
+	})
+
+	if owner != addon {
+		condition := &metav1.Condition{
+			Type:   HostedNamespaceAvailableCondition,
+			Status: metav1.ConditionFalse,
+			Reason: namespaceReasonConflict,
+			Message: fmt.Sprintf("the install namespace %s on the hosting cluster %s is already used by the %s "+
+				"addon of the cluster %s", placement.namespace, placement.hostingCluster, addon.Name, owner.Namespace),
+		}
+
+		return condition, fmt.Errorf("refusing to deploy the agent: %s", condition.Message)
+	}
+
+	peerClusters := make([]string, 0, len(peers))
+	for _, peer := range peers {
+		peerClusters = append(peerClusters, peer.Namespace)
+	}
+
+	slices.Sort(peerClusters)
+
+	return &metav1.Condition{
+		Type:   HostedNamespaceAvailableCondition,
+		Status: metav1.ConditionTrue,
+		Reason: namespaceReasonContended,
+		Message: fmt.Sprintf("The install namespace %s on the hosting cluster %s is also requested by the addon "+
+			"of other clusters, which are not deployed: %s", placement.namespace, placement.hostingCluster,
+			strings.Join(peerClusters, ", ")),
+	}, nil
+}
+
+// triggerPeers re-renders the addons hosted in the same namespace as the addon.
+func (c *HostedNamespaceChecker) triggerPeers(mgr addonmanager.AddonManager, obj interface{}) {
+	addon, ok := obj.(*addonapiv1alpha1.ManagedClusterAddOn)
+	if !ok || addon.Name != c.addonName {
+		return
+	}
+
+	placement, err := c.cachedPlacement(addon)
+	if err != nil || placement.hostingCluster == "" {
+		return
+	}
+
+	peers, err := c.peers(addon, placement)
+	if err != nil {
+		log.Error(err, "Failed to list the addons hosted in the same namespace",
+			"cluster", addon.Namespace, "addon", addon.Name)
+
+		return
+	}
+
+	for _, peer := range peers {
+		log.V(2).Info("Triggering hosted addon after a change to an addon in the same namespace",
+			"cluster", peer.Namespace, "addon", peer.Name, "changedCluster", addon.Namespace)
+
+		mgr.Trigger(peer.Namespace, peer.Name)
+	}
+}
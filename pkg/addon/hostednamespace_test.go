@@ -0,0 +1,294 @@
+package addon
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	addonlistersv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
+)
+
+// newHostedAddon returns a config-policy-controller addon of the cluster, created at the given
+// minute, hosted on the hosting cluster in the install namespace when they are set.
+func newHostedAddon(cluster, hostingCluster, namespace string, minute int) *addonapiv1alpha1.ManagedClusterAddOn {
+	addon := &addonapiv1alpha1.ManagedClusterAddOn{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "config-policy-controller",
+			Namespace:         cluster,
+			CreationTimestamp: metav1.NewTime(time.Date(2026, 10, 19, 12, minute, 0, 0, time.UTC)),
+		},
+	}
+
+	if hostingCluster != "" {
+		addon.Annotations = map[string]string{addonapiv1alpha1.HostingClusterNameAnnotationKey: hostingCluster}
+	}
+
+	//nolint:staticcheck
+	addon.Spec.InstallNamespace = namespace
+
+	return addon
+}
+
+func TestHostedNamespaceCheck(t *testing.T) {
+	deleting := newHostedAddon("cluster0", "hosting1", "klusterlet-agent", 0)
+	deleting.DeletionTimestamp = &metav1.Time{Time: time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC)}
+	deleting.Finalizers = []string{"test"}
+
+	otherAddon := newHostedAddon("cluster0", "hosting1", "klusterlet-agent", 0)
+	otherAddon.Name = "governance-policy-framework"
+
+	tests := map[string]struct {
+		addon    *addonapiv1alpha1.ManagedClusterAddOn
+		peers    []*addonapiv1alpha1.ManagedClusterAddOn
+		notSync  bool
+		reason   string
+		conflict bool
+		message  string
+	}{
+		"not hosted": {
+			addon: newHostedAddon("cluster1", "", "", 10),
+			peers: []*addonapiv1alpha1.ManagedClusterAddOn{newHostedAddon("cluster0", "", "", 0)},
+		},
+		"not synced": {
+			addon:   newHostedAddon("cluster1", "hosting1", "klusterlet-agent", 10),
+			notSync: true,
+		},
+		"invalid namespace": {
+			addon:    newHostedAddon("cluster1", "hosting1", "Klusterlet_Agent", 10),
+			reason:   namespaceReasonInvalid,
+			conflict: true,
+		},
+		"only addon": {
+			addon:  newHostedAddon("cluster1", "hosting1", "klusterlet-agent", 10),
+			reason: namespaceReasonAvailable,
+		},
+		"other namespaces, hosting clusters, and addons": {
+			addon: newHostedAddon("cluster1", "hosting1", "klusterlet-agent", 10),
+			peers: []*addonapiv1alpha1.ManagedClusterAddOn{
+				newHostedAddon("cluster0", "hosting1", "klusterlet-cluster0", 0),
+				newHostedAddon("cluster2", "hosting2", "klusterlet-agent", 0),
+				newHostedAddon("cluster3", "", "klusterlet-agent", 0),
+				otherAddon,
+			},
+			reason: namespaceReasonAvailable,
+		},
+		"deleting peer": {
+			addon:  newHostedAddon("cluster1", "hosting1", "klusterlet-agent", 10),
+			peers:  []*addonapiv1alpha1.ManagedClusterAddOn{deleting},
+			reason: namespaceReasonAvailable,
+		},
+		"created first": {
+			addon: newHostedAddon("cluster1", "hosting1", "klusterlet-agent", 10),
+			peers: []*addonapiv1alpha1.ManagedClusterAddOn{
+				newHostedAddon("cluster3", "hosting1", "klusterlet-agent", 20),
+				newHostedAddon("cluster2", "hosting1", "klusterlet-agent", 30),
+			},
+			reason:  namespaceReasonContended,
+			message: "cluster2, cluster3",
+		},
+		"created later": {
+			addon: newHostedAddon("cluster1", "hosting1", "klusterlet-agent", 10),
+			peers: []*addonapiv1alpha1.ManagedClusterAddOn{
+				newHostedAddon("cluster3", "hosting1", "klusterlet-agent", 20),
+				newHostedAddon("cluster2", "hosting1", "klusterlet-agent", 5),
+			},
+			reason:   namespaceReasonConflict,
+			conflict: true,
+			message:  "addon of the cluster cluster2",
+		},
+		"created at the same time as a cluster sorted after": {
+			addon: newHostedAddon("cluster1", "hosting1", "klusterlet-agent", 10),
+			peers: []*addonapiv1alpha1.ManagedClusterAddOn{
+				newHostedAddon("cluster2", "hosting1", "klusterlet-agent", 10),
+			},
+			reason:  namespaceReasonContended,
+			message: "cluster2",
+		},
+		"created at the same time as a cluster sorted before": {
+			addon: newHostedAddon("cluster2", "hosting1", "klusterlet-agent", 10),
+			peers: []*addonapiv1alpha1.ManagedClusterAddOn{
+				newHostedAddon("cluster1", "hosting1", "klusterlet-agent", 10),
+			},
+			reason:   namespaceReasonConflict,
+			conflict: true,
+			message:  "addon of the cluster cluster1",
+		},
+		"default namespace": {
+			addon:    newHostedAddon("cluster1", "hosting1", "", 10),
+			peers:    []*addonapiv1alpha1.ManagedClusterAddOn{newHostedAddon("cluster0", "hosting1", "", 0)},
+			reason:   namespaceReasonConflict,
+			conflict: true,
+			message:  "open-cluster-management-agent-addon",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+				cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+			})
+
+			for _, addon := range append(test.peers, test.addon) {
+				if err := indexer.Add(addon); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			checker := &HostedNamespaceChecker{
+				addonName:   "config-policy-controller",
+				addonLister: addonlistersv1alpha1.NewManagedClusterAddOnLister(indexer),
+				addonSynced: func() bool { return !test.notSync },
+			}
+
+			// The addon is given by the addon framework, which isn't the object of the lister
+			condition, err := checker.Check(test.addon.DeepCopy())
+
+			if test.notSync {
+				if err == nil {
+					t.Fatal("expected an error while the addons are not synced")
+				}
+
+				return
+			}
+
+			if (err != nil) != test.conflict {
+				t.Fatalf("expected an error: %v, got %v", test.conflict, err)
+			}
+
+			if test.reason == "" {
+				if condition != nil {
+					t.Fatalf("expected no condition, got %+v", condition)
+				}
+
+				return
+			}
+
+			if condition == nil || condition.Reason != test.reason {
+				t.Fatalf("expected the %s reason, got %+v", test.reason, condition)
+			}
+
+			expectedStatus := metav1.ConditionTrue
+			if test.conflict {
+				expectedStatus = metav1.ConditionFalse
+			}
+
+			if condition.Status != expectedStatus {
+				t.Fatalf("expected the %s status, got %s", expectedStatus, condition.Status)
+			}
+
+			if !strings.Contains(condition.Message, test.message) {
+				t.Fatalf("expected the message to contain %q, got %q", test.message, condition.Message)
+			}
+		})
+	}
+}
+
+func TestHostedNamespacePlacement(t *testing.T) {
+	checker := &HostedNamespaceChecker{
+		installNamespace: func(addon *addonapiv1alpha1.ManagedClusterAddOn) (string, error) {
+			if addon.Namespace == "cluster2" {
+				return "configured", nil
+			}
+
+			return "", nil
+		},
+	}
+
+	tests := map[string]struct {
+		addon    *addonapiv1alpha1.ManagedClusterAddOn
+		expected hostedPlacement
+	}{
+		"not hosted": {
+			addon: newHostedAddon("cluster2", "", "", 0),
+		},
+		"addon namespace": {
+			addon:    newHostedAddon("cluster1", "hosting1", "klusterlet-cluster1", 0),
+			expected: hostedPlacement{hostingCluster: "hosting1", namespace: "klusterlet-cluster1"},
+		},
+		"default namespace": {
+			addon:    newHostedAddon("cluster1", "hosting1", "", 0),
+			expected: hostedPlacement{hostingCluster: "hosting1", namespace: "open-cluster-management-agent-addon"},
+		},
+		"configured namespace": {
+			addon:    newHostedAddon("cluster2", "hosting1", "klusterlet-cluster2", 0),
+			expected: hostedPlacement{hostingCluster: "hosting1", namespace: "configured"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			placement, err := checker.placement(test.addon)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if placement != test.expected {
+				t.Fatalf("expected the placement %+v, got %+v", test.expected, placement)
+			}
+		})
+	}
+}
+
+func TestHostedNamespacePlacementCache(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+	})
+
+	addon := newHostedAddon("cluster1", "hosting1", "klusterlet-agent", 10)
+	peer := newHostedAddon("cluster2", "hosting1", "klusterlet-agent", 20)
+	peer.ResourceVersion = "1"
+
+	for _, obj := range []*addonapiv1alpha1.ManagedClusterAddOn{addon, peer} {
+		if err := indexer.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	calls := map[string]int{}
+	checker := &HostedNamespaceChecker{
+		addonName:   "config-policy-controller",
+		addonLister: addonlistersv1alpha1.NewManagedClusterAddOnLister(indexer),
+		addonSynced: func() bool { return true },
+		installNamespace: func(addon *addonapiv1alpha1.ManagedClusterAddOn) (string, error) {
+			calls[addon.Namespace]++
+
+			return "", nil
+		},
+	}
+
+	check := func(expectedReason string, expectedCalls map[string]int) {
+		t.Helper()
+
+		condition, _ := checker.Check(addon.DeepCopy())
+		if condition == nil || condition.Reason != expectedReason {
+			t.Fatalf("expected the %s reason, got %+v", expectedReason, condition)
+		}
+
+		if calls["cluster1"] != expectedCalls["cluster1"] || calls["cluster2"] != expectedCalls["cluster2"] {
+			t.Fatalf("expected the install namespace calls %v, got %v", expectedCalls, calls)
+		}
+	}
+
+	check(namespaceReasonContended, map[string]int{"cluster1": 1, "cluster2": 1})
+
+	// The peer placement is cached while the peer doesn't change
+	check(namespaceReasonContended, map[string]int{"cluster1": 2, "cluster2": 1})
+
+	moved := newHostedAddon("cluster2", "hosting1", "klusterlet-cluster2", 20)
+	moved.ResourceVersion = "2"
+
+	if err := indexer.Update(moved); err != nil {
+		t.Fatal(err)
+	}
+
+	check(namespaceReasonAvailable, map[string]int{"cluster1": 3, "cluster2": 2})
+
+	checker.forget(moved)
+
+	if len(checker.placements) != 0 {
+		t.Fatalf("expected the placement of the deleted addon to be forgotten, got %v", checker.placements)
+	}
+}
@@ -0,0 +1,82 @@
+package addon
+
+import (
+	"os"
+	"strings"
+)
+
+// archAliases maps the architecture names reported by some tools to the Go/Kubernetes names.
+var archAliases = map[string]string{
+	"x86_64":  "amd64",
+	"aarch64": "arm64",
+	"ppc64el": "ppc64le",
+}
+
+// NormalizeArchitecture returns the Kubernetes name of the CPU architecture, for example amd64
+// for x86_64.
+func NormalizeArchitecture(arch string) string {
+	arch = strings.ToLower(strings.TrimSpace(arch))
+
+	if alias, ok := archAliases[arch]; ok {
+		return alias
+	}
+
+	return arch
+}
+
+// GetAgentImage returns the agent image to deploy on a cluster with the given capabilities. The
+// image is read from the envVar environment variable, unless all nodes of the cluster are of a
+// single architecture and an architecture specific variable is set, for example
+// CONFIG_POLICY_CONTROLLER_IMAGE_ARM64. Clusters with mixed architectures use the default image,
+// which is expected to be a multi-architecture manifest list.
+func GetAgentImage(envVar string, capabilities *ClusterCapabilities) string {
+	if capabilities != nil && len(capabilities.Architectures) == 1 {
+		arch := NormalizeArchitecture(capabilities.Architectures[0])
+
+		if image := os.Getenv(envVar + "_" + strings.ToUpper(arch)); image != "" {
+			return image
+		}
+	}
+
+	return os.Getenv(envVar)
+}
+
+// ImageVariable is the customized variable of an AddOnDeploymentConfig that overrides the agent
+// image. It can be suffixed with an architecture, like image_arm64, to only apply to clusters of
+// that single architecture.
+const ImageVariable = "image"
+
+// ArchImageKey returns the key of the image override for clusters of the given architecture, for
+// example config_policy_controller_arm64. The charts use it instead of the imageKey override when
+// all nodes of the cluster the agent runs on are of that architecture.
+func ArchImageKey(imageKey, arch string) string {
+	return imageKey + "_" + NormalizeArchitecture(arch)
+}
+
+// SetImageOverride sets the imageKey image override from the image customized variable, or from an
+// architecture specific one like image_arm64. It returns false when the variable is not an image
+// variable.
+func (cv *CommonValues) SetImageOverride(imageKey, variable, value string) bool {
+	key := imageKey
+
+	if variable != ImageVariable {
+		arch, found := strings.CutPrefix(variable, ImageVariable+"_")
+		if !found || arch == "" {
+			return false
+		}
+
+		key = ArchImageKey(imageKey, arch)
+	}
+
+	if cv.GlobalValues == nil {
+		cv.GlobalValues = &GlobalValues{}
+	}
+
+	if cv.GlobalValues.ImageOverrides == nil {
+		cv.GlobalValues.ImageOverrides = map[string]string{}
+	}
+
+	cv.GlobalValues.ImageOverrides[key] = value
+
+	return true
+}
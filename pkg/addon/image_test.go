@@ -0,0 +1,121 @@
+package addon
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestNormalizeArchitecture(t *testing.T) {
+	tests := map[string]struct {
+		arch     string
+		expected string
+	}{
+		"kubernetes name": {arch: "arm64", expected: "arm64"},
+		"alias":           {arch: "x86_64", expected: "amd64"},
+		"upper case":      {arch: " AARCH64 ", expected: "arm64"},
+		"unknown":         {arch: "riscv64", expected: "riscv64"},
+		"empty":           {arch: "", expected: ""},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if actual := NormalizeArchitecture(test.arch); actual != test.expected {
+				t.Fatalf("expected %s, got %s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestGetAgentImage(t *testing.T) {
+	t.Setenv("AGENT_IMAGE", "quay.io/policy/agent:latest")
+	t.Setenv("AGENT_IMAGE_ARM64", "quay.io/policy/agent:latest-arm64")
+
+	tests := map[string]struct {
+		capabilities *ClusterCapabilities
+		expected     string
+	}{
+		"unknown capabilities": {
+			capabilities: nil,
+			expected:     "quay.io/policy/agent:latest",
+		},
+		"no architectures": {
+			capabilities: &ClusterCapabilities{},
+			expected:     "quay.io/policy/agent:latest",
+		},
+		"single architecture": {
+			capabilities: &ClusterCapabilities{Architectures: []string{"arm64"}},
+			expected:     "quay.io/policy/agent:latest-arm64",
+		},
+		"single architecture alias": {
+			capabilities: &ClusterCapabilities{Architectures: []string{"aarch64"}},
+			expected:     "quay.io/policy/agent:latest-arm64",
+		},
+		"single architecture without an image": {
+			capabilities: &ClusterCapabilities{Architectures: []string{"s390x"}},
+			expected:     "quay.io/policy/agent:latest",
+		},
+		"mixed architectures": {
+			capabilities: &ClusterCapabilities{Architectures: []string{"amd64", "arm64"}},
+			expected:     "quay.io/policy/agent:latest",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if actual := GetAgentImage("AGENT_IMAGE", test.capabilities); actual != test.expected {
+				t.Fatalf("expected the image %s, got %s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSetImageOverride(t *testing.T) {
+	tests := map[string]struct {
+		variable string
+		set      bool
+		expected map[string]string
+	}{
+		"image": {
+			variable: "image",
+			set:      true,
+			expected: map[string]string{"agent": "quay.io/policy/agent:v1"},
+		},
+		"architecture image": {
+			variable: "image_arm64",
+			set:      true,
+			expected: map[string]string{"agent_arm64": "quay.io/policy/agent:v1"},
+		},
+		"architecture alias": {
+			variable: "image_X86_64",
+			set:      true,
+			expected: map[string]string{"agent_amd64": "quay.io/policy/agent:v1"},
+		},
+		"missing architecture": {
+			variable: "image_",
+			set:      false,
+		},
+		"other variable": {
+			variable: "imagePullPolicy",
+			set:      false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			values := &CommonValues{}
+
+			if set := values.SetImageOverride("agent", test.variable, "quay.io/policy/agent:v1"); set != test.set {
+				t.Fatalf("expected the variable to be set to be %v, got %v", test.set, set)
+			}
+
+			var overrides map[string]string
+			if values.GlobalValues != nil {
+				overrides = values.GlobalValues.ImageOverrides
+			}
+
+			if !maps.Equal(overrides, test.expected) {
+				t.Fatalf("expected the image overrides %v, got %v", test.expected, overrides)
+			}
+		})
+	}
+}
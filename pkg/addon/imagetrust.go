@@ -0,0 +1,493 @@
+package addon
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/payload"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ImageVerifiedCondition is the ManagedClusterAddOn condition reporting whether the agent
+	// images were pinned and verified against the image trust policy.
+	ImageVerifiedCondition = "AgentImageVerified"
+
+	imageReasonVerified    = "Verified"
+	imageReasonUntrusted   = "UntrustedImage"
+	imageReasonUnavailable = "RegistryUnavailable"
+	imageResolveCacheTTL   = 10 * time.Minute
+	imageRetryCacheTTL     = time.Minute
+	cosignSignatureAnno    = "dev.cosignproject.cosign/signature"
+	cosignSimpleSigning    = "application/vnd.dev.cosign.simplesigning.v1+json"
+	defaultRegistry        = "docker.io"
+
+	// imageTrustTimeout bounds the registry requests of the verification of the images of an addon,
+	// so an unresponsive registry doesn't block the addon rendering.
+	imageTrustTimeout = 30 * time.Second
+)
+
+// ImageTrustPolicy lists the image repositories that agents may be deployed from, and how their
+// images are verified.
+type ImageTrustPolicy struct {
+	// Images are the trusted image repositories. Images from other repositories are refused.
+	Images []TrustedRepository `json:"images"`
+	// InsecureRegistries are registry hosts that are accessed over plain HTTP.
+	InsecureRegistries []string `json:"insecureRegistries,omitempty"`
+}
+
+// TrustedRepository describes how images from a repository are verified. An image is trusted when
+// its digest is in the allowlist, or when it has a cosign signature made by one of the public keys.
+type TrustedRepository struct {
+	// Repository is the image repository, like quay.io/open-cluster-management/config-policy-controller.
+	// A trailing "/*" matches every repository under the prefix.
+	Repository string `json:"repository"`
+	// Digests are the allowed image digests, like sha256:<hex>.
+	Digests []string `json:"digests,omitempty"`
+	// PublicKeys are PEM encoded public keys of the cosign signers.
+	PublicKeys []string `json:"publicKeys,omitempty"`
+}
+
+// LoadImageTrustPolicy reads the image trust policy from the YAML or JSON file at path.
+func LoadImageTrustPolicy(path string) (*ImageTrustPolicy, error) {
+	content, err := os.ReadFile(path) // #nosec G304 -- the path is configured by the administrator
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the image trust policy: %w", err)
+	}
+
+	policy := &ImageTrustPolicy{}
+
+	if err := yaml.UnmarshalStrict(content, policy); err != nil {
+		return nil, fmt.Errorf("failed to parse the image trust policy %s: %w", path, err)
+	}
+
+	for _, repo := range policy.Images {
+		for _, key := range repo.PublicKeys {
+			if _, err := loadVerifier(key); err != nil {
+				return nil, fmt.Errorf("invalid public key for repository %s: %w", repo.Repository, err)
+			}
+		}
+	}
+
+	return policy, nil
+}
+
+// repository returns the trust policy entry that matches the image repository, or nil.
+func (p *ImageTrustPolicy) repository(repository string) *TrustedRepository {
+	for i, repo := range p.Images {
+		if prefix, found := strings.CutSuffix(repo.Repository, "/*"); found {
+			if strings.HasPrefix(repository, prefix+"/") {
+				return &p.Images[i]
+			}
+		} else if repo.Repository == repository {
+			return &p.Images[i]
+		}
+	}
+
+	return nil
+}
+
+// parseImageReference parses the image reference, accessing the registry over plain HTTP when it
+// is an insecure registry of the policy.
+func (p *ImageTrustPolicy) parseImageReference(image string) (name.Reference, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return nil, err
+	}
+
+	if slices.Contains(p.InsecureRegistries, ref.Context().RegistryStr()) {
+		return name.ParseReference(image, name.Insecure)
+	}
+
+	return ref, nil
+}
+
+// repositoryName returns the repository including the registry host, as matched by the trust
+// policy. Docker Hub repositories are matched as docker.io/<repository>.
+func repositoryName(repo name.Repository) string {
+	if repo.RegistryStr() == name.DefaultRegistry {
+		return defaultRegistry + "/" + repo.RepositoryStr()
+	}
+
+	return repo.Name()
+}
+
+// ImageVerifier pins agent images by digest and verifies them against an ImageTrustPolicy.
+type ImageVerifier struct {
+	policy    *ImageTrustPolicy
+	transport http.RoundTripper
+	keychain  authn.Keychain
+	timeout   time.Duration
+
+	lock sync.Mutex
+	// digests caches the digests that the image tags resolve to, since tags can be moved
+	digests map[string]cachedResult
+	// verified caches the verification results by pinned image, since the content of a digest
+	// doesn't change. Failures are retried since they may be caused by the registry being
+	// unavailable.
+	verified map[string]cachedResult
+	// lastVerified keeps the image pinned by digest that each image was last verified as, which is
+	// deployed when the registry doesn't answer in time.
+	lastVerified map[string]string
+}
+
+// cachedResult is a cached digest or verification result. A zero expiry never expires.
+type cachedResult struct {
+	digest  string
+	err     error
+	expires time.Time
+}
+
+func (c cachedResult) valid() bool {
+	return c.expires.IsZero() || time.Now().Before(c.expires)
+}
+
+// NewImageVerifier creates an ImageVerifier for the trust policy. The registries are accessed with
+// the credentials of the keychain, which defaults to the Docker configuration of the controller, so
+// a pull secret can be mounted as $DOCKER_CONFIG/config.json. The transport defaults to the
+// go-containerregistry default transport.
+func NewImageVerifier(
+	policy *ImageTrustPolicy, transport http.RoundTripper, keychain authn.Keychain,
+) *ImageVerifier {
+	if transport == nil {
+		transport = remote.DefaultTransport
+	}
+
+	if keychain == nil {
+		keychain = authn.DefaultKeychain
+	}
+
+	return &ImageVerifier{
+		policy:       policy,
+		transport:    transport,
+		keychain:     keychain,
+		timeout:      imageTrustTimeout,
+		digests:      map[string]cachedResult{},
+		verified:     map[string]cachedResult{},
+		lastVerified: map[string]string{},
+	}
+}
+
+// LoadImageVerifier creates an ImageVerifier from the trust policy file at path, which is set with
+// the image-trust-policy flag. It returns nil when the path is empty.
+func LoadImageVerifier(path string) (*ImageVerifier, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	policy, err := LoadImageTrustPolicy(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewImageVerifier(policy, nil, nil), nil
+}
+
+// remoteOptions returns the options to access the registries with the context.
+func (v *ImageVerifier) remoteOptions(ctx context.Context) []remote.Option {
+	return []remote.Option{
+		remote.WithContext(ctx),
+		remote.WithTransport(v.transport),
+		remote.WithAuthFromKeychain(v.keychain),
+	}
+}
+
+// Verify returns the image pinned by digest once it is verified against the trust policy. Tags are
+// resolved again after a few minutes, and the verification of each digest is cached, so the
+// registry is only queried when a tag is resolved or a new digest is deployed.
+func (v *ImageVerifier) Verify(ctx context.Context, image string) (string, error) {
+	ref, err := v.policy.parseImageReference(image)
+	if err != nil {
+		return "", fmt.Errorf("invalid image reference %s: %w", image, err)
+	}
+
+	repoName := repositoryName(ref.Context())
+
+	trusted := v.policy.repository(repoName)
+	if trusted == nil {
+		return "", fmt.Errorf("image %s is not from a repository in the image trust policy", image)
+	}
+
+	digest, err := v.resolve(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the digest of image %s: %w", image, err)
+	}
+
+	pinned := repoName + "@" + digest
+
+	if slices.Contains(trusted.Digests, digest) {
+		return pinned, nil
+	}
+
+	if len(trusted.PublicKeys) == 0 {
+		return "", fmt.Errorf("image %s digest %s is not in the image trust policy allowlist", image, digest)
+	}
+
+	v.lock.Lock()
+	cached, ok := v.verified[pinned]
+	v.lock.Unlock()
+
+	if !ok || !cached.valid() {
+		cached = cachedResult{err: v.verifySignature(ctx, ref.Context().Digest(digest), trusted.PublicKeys)}
+		if cached.err != nil {
+			cached.expires = time.Now().Add(imageRetryCacheTTL)
+		}
+
+		// A request that timed out is retried with the next rendering instead of being cached
+		if ctx.Err() == nil {
+			v.lock.Lock()
+			v.verified[pinned] = cached
+			v.lock.Unlock()
+		}
+	}
+
+	if cached.err != nil {
+		return "", fmt.Errorf("image %s failed signature verification: %w", image, cached.err)
+	}
+
+	return pinned, nil
+}
+
+// resolve returns the digest of the image reference, resolving tags in the registry. Multi-arch
+// indexes are preferred so the pinned digest works on every node architecture.
+func (v *ImageVerifier) resolve(ctx context.Context, ref name.Reference) (string, error) {
+	if digest, ok := ref.(name.Digest); ok {
+		return digest.DigestStr(), nil
+	}
+
+	key := ref.Name()
+
+	v.lock.Lock()
+	cached, ok := v.digests[key]
+	v.lock.Unlock()
+
+	if ok && cached.valid() {
+		return cached.digest, cached.err
+	}
+
+	cached = cachedResult{expires: time.Now().Add(imageResolveCacheTTL)}
+
+	descriptor, err := remote.Head(ref, v.remoteOptions(ctx)...)
+	if err != nil {
+		cached.err = err
+		cached.expires = time.Now().Add(imageRetryCacheTTL)
+	} else {
+		cached.digest = descriptor.Digest.String()
+	}
+
+	if ctx.Err() == nil {
+		v.lock.Lock()
+		v.digests[key] = cached
+		v.lock.Unlock()
+	}
+
+	return cached.digest, cached.err
+}
+
+// ApplyImageTrust pins the agent images in the rendered objects by digest after verifying them. The
+// registry requests are bounded by the timeout of the verifier, and an image that can't be verified
+// in time is pinned to the digest it was last verified as. It returns the condition to report on
+// the addon, and an error when an image is not trusted or couldn't be verified in time, in which
+// case the rendering is retried.
+func (v *ImageVerifier) ApplyImageTrust(ctx context.Context, objects []runtime.Object) (metav1.Condition, error) {
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+
+	failures := []string{}
+	timedOut := false
+
+	for _, obj := range objects {
+		podSpec := podSpecOf(obj)
+		if podSpec == nil {
+			continue
+		}
+
+		for _, containers := range [][]corev1.Container{podSpec.InitContainers, podSpec.Containers} {
+			for i := range containers {
+				pinned, err := v.verifyWithFallback(ctx, containers[i].Image)
+				if err != nil {
+					failures = append(failures, err.Error())
+					timedOut = timedOut || ctx.Err() != nil
+
+					continue
+				}
+
+				containers[i].Image = pinned
+			}
+		}
+	}
+
+	if len(failures) == 0 {
+		return metav1.Condition{
+			Type:    ImageVerifiedCondition,
+			Status:  metav1.ConditionTrue,
+			Reason:  imageReasonVerified,
+			Message: "The agent images are pinned by digest and verified against the image trust policy",
+		}, nil
+	}
+
+	message := strings.Join(slices.Compact(failures), "; ")
+	condition := metav1.Condition{
+		Type:    ImageVerifiedCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  imageReasonUntrusted,
+		Message: message,
+	}
+
+	if timedOut {
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = imageReasonUnavailable
+	}
+
+	return condition, fmt.Errorf("refusing to deploy the agent: %s", message)
+}
+
+// verifyWithFallback verifies the image, and returns the image pinned to the digest it was last
+// verified as when the context expires before the registry answers.
+func (v *ImageVerifier) verifyWithFallback(ctx context.Context, image string) (string, error) {
+	pinned, err := v.Verify(ctx, image)
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if err == nil {
+		v.lastVerified[image] = pinned
+
+		return pinned, nil
+	}
+
+	if ctx.Err() == nil {
+		return "", err
+	}
+
+	if last, ok := v.lastVerified[image]; ok {
+		log.Info("Timed out verifying the agent image, keeping the digest it was last verified as",
+			"image", image, "pinned", last)
+
+		return last, nil
+	}
+
+	return "", fmt.Errorf("timed out verifying the image %s, it will be retried: %w", image, err)
+}
+
+// verifySignature checks for a cosign signature of the image digest made by one of the public keys,
+// for the repository of the image. The signatures are stored by cosign in the sha256-<hex>.sig tag
+// of the repository.
+func (v *ImageVerifier) verifySignature(ctx context.Context, digest name.Digest, publicKeys []string) error {
+	verifiers := make([]signature.Verifier, 0, len(publicKeys))
+
+	for _, key := range publicKeys {
+		verifier, err := loadVerifier(key)
+		if err != nil {
+			return err
+		}
+
+		verifiers = append(verifiers, verifier)
+	}
+
+	sigTag := digest.Context().Tag(strings.Replace(digest.DigestStr(), ":", "-", 1) + ".sig")
+
+	sigImage, err := remote.Image(sigTag, v.remoteOptions(ctx)...)
+	if err != nil {
+		return fmt.Errorf("no signature found: %w", err)
+	}
+
+	manifest, err := sigImage.Manifest()
+	if err != nil {
+		return fmt.Errorf("invalid signature manifest: %w", err)
+	}
+
+	for _, layer := range manifest.Layers {
+		sig, err := base64.StdEncoding.DecodeString(layer.Annotations[cosignSignatureAnno])
+		if string(layer.MediaType) != cosignSimpleSigning || err != nil || len(sig) == 0 {
+			continue
+		}
+
+		signed, err := readSignedPayload(sigImage, layer.Digest)
+		if err != nil {
+			continue
+		}
+
+		if !slices.ContainsFunc(verifiers, func(verifier signature.Verifier) bool {
+			return verifier.VerifySignature(bytes.NewReader(sig), bytes.NewReader(signed)) == nil
+		}) {
+			continue
+		}
+
+		if signedFor(signed, digest) {
+			return nil
+		}
+	}
+
+	return errors.New("no valid signature from a trusted key for the image repository")
+}
+
+// readSignedPayload reads the cosign simple signing payload layer of the signature image, which
+// go-containerregistry checks against its digest.
+func readSignedPayload(sigImage v1.Image, digest v1.Hash) ([]byte, error) {
+	layer, err := sigImage.LayerByDigest(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return io.ReadAll(io.LimitReader(reader, 1<<20))
+}
+
+// signedFor returns whether the cosign simple signing payload is for the image digest, and for the
+// repository of the image through its docker-reference identity, so that a signature copied from
+// another repository signed by the same key is not accepted.
+func signedFor(signed []byte, digest name.Digest) bool {
+	simpleSigning := payload.SimpleContainerImage{}
+
+	if err := json.Unmarshal(signed, &simpleSigning); err != nil {
+		return false
+	}
+
+	if simpleSigning.Critical.Image.DockerManifestDigest != digest.DigestStr() {
+		return false
+	}
+
+	identity, err := name.NewRepository(simpleSigning.Critical.Identity.DockerReference)
+	if err != nil {
+		return false
+	}
+
+	return identity.Name() == digest.Context().Name()
+}
+
+// loadVerifier returns the signature verifier of the PEM encoded public key.
+func loadVerifier(key string) (signature.Verifier, error) {
+	publicKey, err := cryptoutils.UnmarshalPEMToPublicKey([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+
+	return signature.LoadVerifier(publicKey, crypto.SHA256)
+}
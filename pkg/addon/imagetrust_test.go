@@ -0,0 +1,430 @@
+package addon
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// testRegistry is an in-memory registry that requires the basic auth credentials and counts the
+// requests it serves. A blocked registry doesn't answer until the client gives up.
+type testRegistry struct {
+	handler  http.Handler
+	requests atomic.Int32
+	blocked  atomic.Bool
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.requests.Add(1)
+
+	if r.blocked.Load() {
+		<-req.Context().Done()
+
+		return
+	}
+
+	if user, password, ok := req.BasicAuth(); !ok || user != "puller" || password != "secret" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+		w.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	r.handler.ServeHTTP(w, req)
+}
+
+// pushImage pushes a random image to the tag and returns its digest.
+func pushImage(t *testing.T, tag string) string {
+	t.Helper()
+
+	image, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := name.ParseReference(tag, name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := remote.Write(ref, image, remote.WithAuthFromKeychain(authn.DefaultKeychain)); err != nil {
+		t.Fatal(err)
+	}
+
+	digest, err := image.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return digest.String()
+}
+
+// sign pushes a cosign style signature of the digest to the repository, claiming the identity as
+// the docker-reference.
+func sign(t *testing.T, key *ecdsa.PrivateKey, repository, identity, digest string) {
+	t.Helper()
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"critical": map[string]interface{}{
+			"identity": map[string]string{"docker-reference": identity},
+			"image":    map[string]string{"docker-manifest-digest": digest},
+			"type":     "cosign container image signature",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := sha256.Sum256(payload)
+
+	signature, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sigImage, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer: static.NewLayer(payload, types.MediaType(cosignSimpleSigning)),
+		Annotations: map[string]string{
+			cosignSignatureAnno: base64.StdEncoding.EncodeToString(signature),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sigTag, err := name.NewTag(repository+":"+strings.Replace(digest, ":", "-", 1)+".sig", name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := remote.Write(sigTag, sigImage, remote.WithAuthFromKeychain(authn.DefaultKeychain)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func publicKeyPEM(t *testing.T, key *ecdsa.PrivateKey) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// setupPullSecret writes a Docker configuration with the credentials of the registry host, like a
+// mounted pull secret, and points the default keychain to it.
+func setupPullSecret(t *testing.T, host string) {
+	t.Helper()
+
+	config, err := json.Marshal(map[string]interface{}{
+		"auths": map[string]interface{}{
+			host: map[string]string{"auth": base64.StdEncoding.EncodeToString([]byte("puller:secret"))},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), config, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("DOCKER_CONFIG", dir)
+}
+
+func TestApplyImageTrust(t *testing.T) {
+	reg := &testRegistry{handler: registry.New()}
+	server := httptest.NewServer(reg)
+
+	t.Cleanup(server.Close)
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	setupPullSecret(t, host)
+
+	signedDigest := pushImage(t, host+"/policy/signed:v0.16.0")
+	allowedDigest := pushImage(t, host+"/policy/allowed:v0.16.0")
+	unsignedDigest := pushImage(t, host+"/policy/signed:unsigned")
+	copiedDigest := pushImage(t, host+"/policy/signed:copied")
+
+	trustedKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign(t, trustedKey, host+"/policy/signed", host+"/policy/signed", signedDigest)
+	sign(t, otherKey, host+"/policy/signed", host+"/policy/signed", unsignedDigest)
+	// A signature of the trusted key for another repository must not be accepted
+	sign(t, trustedKey, host+"/policy/signed", host+"/policy/other", copiedDigest)
+
+	policy := &ImageTrustPolicy{
+		Images: []TrustedRepository{
+			{Repository: host + "/policy/signed", PublicKeys: []string{publicKeyPEM(t, trustedKey)}},
+			{Repository: host + "/policy/allowed", Digests: []string{allowedDigest}},
+		},
+		InsecureRegistries: []string{host},
+	}
+
+	tests := map[string]struct {
+		image    string
+		keychain authn.Keychain
+		expected string
+		trusted  bool
+	}{
+		"signed by a trusted key": {
+			image:    host + "/policy/signed:v0.16.0",
+			expected: host + "/policy/signed@" + signedDigest,
+			trusted:  true,
+		},
+		"digest in the allowlist": {
+			image:    host + "/policy/allowed:v0.16.0",
+			expected: host + "/policy/allowed@" + allowedDigest,
+			trusted:  true,
+		},
+		"already pinned by digest": {
+			image:    host + "/policy/allowed@" + allowedDigest,
+			expected: host + "/policy/allowed@" + allowedDigest,
+			trusted:  true,
+		},
+		"signed by an untrusted key": {
+			image: host + "/policy/signed:unsigned",
+		},
+		"signed for another repository": {
+			image: host + "/policy/signed:copied",
+		},
+		"digest not in the allowlist": {
+			image: host + "/policy/allowed@sha256:" + strings.Repeat("0", 64),
+		},
+		"repository not in the policy": {
+			image: host + "/other/image:v0.16.0",
+		},
+		"tag not in the registry": {
+			image: host + "/policy/signed:missing",
+		},
+		"registry credentials missing": {
+			image:    host + "/policy/allowed:v0.16.0",
+			keychain: authn.NewMultiKeychain(),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			deployment := &appsv1.Deployment{}
+			deployment.Spec.Template.Spec.Containers = []corev1.Container{{Name: "agent", Image: test.image}}
+			pod := &corev1.Pod{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "cleanup", Image: test.image}},
+			}}
+
+			verifier := NewImageVerifier(policy, server.Client().Transport, test.keychain)
+
+			condition, err := verifier.ApplyImageTrust(context.TODO(), []runtime.Object{deployment, pod})
+
+			if !test.trusted {
+				if err == nil {
+					t.Fatalf("expected image %s to be refused", test.image)
+				}
+
+				if condition.Status != metav1.ConditionFalse || condition.Reason != imageReasonUntrusted {
+					t.Fatalf("unexpected condition for an untrusted image: %+v", condition)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected image %s to be trusted: %v", test.image, err)
+			}
+
+			if condition.Status != metav1.ConditionTrue {
+				t.Fatalf("unexpected condition for a trusted image: %+v", condition)
+			}
+
+			for _, image := range []string{
+				deployment.Spec.Template.Spec.Containers[0].Image, pod.Spec.Containers[0].Image,
+			} {
+				if image != test.expected {
+					t.Fatalf("expected the image to be pinned to %s, got %s", test.expected, image)
+				}
+			}
+		})
+	}
+}
+
+func TestImageVerifierCache(t *testing.T) {
+	reg := &testRegistry{handler: registry.New()}
+	server := httptest.NewServer(reg)
+
+	t.Cleanup(server.Close)
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	setupPullSecret(t, host)
+
+	digest := pushImage(t, host+"/policy/signed:v0.16.0")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign(t, key, host+"/policy/signed", host+"/policy/signed", digest)
+
+	policy := &ImageTrustPolicy{
+		Images: []TrustedRepository{
+			{Repository: host + "/policy/signed", PublicKeys: []string{publicKeyPEM(t, key)}},
+		},
+		InsecureRegistries: []string{host},
+	}
+
+	verifier := NewImageVerifier(policy, server.Client().Transport, nil)
+
+	if _, err := verifier.Verify(context.TODO(), host+"/policy/signed:v0.16.0"); err != nil {
+		t.Fatal(err)
+	}
+
+	reg.requests.Store(0)
+
+	// The tag resolution and the signature of the digest are cached
+	if _, err := verifier.Verify(context.TODO(), host+"/policy/signed:v0.16.0"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The image pinned by digest reuses the verification of the digest
+	if _, err := verifier.Verify(context.TODO(), host+"/policy/signed@"+digest); err != nil {
+		t.Fatal(err)
+	}
+
+	if requests := reg.requests.Load(); requests != 0 {
+		t.Fatalf("expected the verification to be cached, got %d registry requests", requests)
+	}
+}
+
+func TestApplyImageTrustTimeout(t *testing.T) {
+	reg := &testRegistry{handler: registry.New()}
+	server := httptest.NewServer(reg)
+
+	t.Cleanup(server.Close)
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	setupPullSecret(t, host)
+
+	digest := pushImage(t, host+"/policy/allowed:v0.16.0")
+	newDigest := pushImage(t, host+"/policy/allowed:v0.17.0")
+
+	policy := &ImageTrustPolicy{
+		Images: []TrustedRepository{
+			{Repository: host + "/policy/allowed", Digests: []string{digest, newDigest}},
+		},
+		InsecureRegistries: []string{host},
+	}
+
+	verifier := NewImageVerifier(policy, server.Client().Transport, nil)
+	verifier.timeout = 100 * time.Millisecond
+
+	applyImageTrust := func(image string) (string, metav1.Condition, error) {
+		deployment := &appsv1.Deployment{
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "agent", Image: image}},
+			}}},
+		}
+
+		condition, err := verifier.ApplyImageTrust(context.TODO(), []runtime.Object{deployment})
+
+		return deployment.Spec.Template.Spec.Containers[0].Image, condition, err
+	}
+
+	if _, _, err := applyImageTrust(host + "/policy/allowed:v0.16.0"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The tag is resolved again once the registry is unavailable
+	verifier.digests = map[string]cachedResult{}
+	reg.blocked.Store(true)
+
+	image, condition, err := applyImageTrust(host + "/policy/allowed:v0.16.0")
+	if err != nil {
+		t.Fatalf("expected the image verified last to be kept, got %v", err)
+	}
+
+	if image != host+"/policy/allowed@"+digest || condition.Status != metav1.ConditionTrue {
+		t.Fatalf("expected the image to be pinned to the digest verified last, got %s and %+v", image, condition)
+	}
+
+	_, condition, err = applyImageTrust(host + "/policy/allowed:v0.17.0")
+	if err == nil || !strings.Contains(err.Error(), "it will be retried") {
+		t.Fatalf("expected a retryable error for an image that was never verified, got %v", err)
+	}
+
+	if condition.Status != metav1.ConditionUnknown || condition.Reason != imageReasonUnavailable {
+		t.Fatalf("expected the registry to be reported unavailable, got %+v", condition)
+	}
+
+	// The timeout isn't cached, so the image is verified as soon as the registry answers
+	reg.blocked.Store(false)
+
+	image, _, err = applyImageTrust(host + "/policy/allowed:v0.17.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if image != host+"/policy/allowed@"+newDigest {
+		t.Fatalf("expected the image to be pinned to %s, got %s", newDigest, image)
+	}
+}
+
+func TestRepositoryName(t *testing.T) {
+	tests := map[string]string{
+		"nginx":                          "docker.io/library/nginx",
+		"docker.io/policy/cpc:v1.0":      "docker.io/policy/cpc",
+		"localhost:5000/policy/cpc:v1.0": "localhost:5000/policy/cpc",
+		"quay.io/ocm/cpc@sha256:" + strings.Repeat("a", 64): "quay.io/ocm/cpc",
+	}
+
+	for image, expected := range tests {
+		t.Run(image, func(t *testing.T) {
+			ref, err := (&ImageTrustPolicy{}).parseImageReference(image)
+			if err != nil {
+				t.Fatalf("failed to parse %s: %v", image, err)
+			}
+
+			if actual := repositoryName(ref.Context()); actual != expected {
+				t.Fatalf("expected %s to be matched as %s, got %s", image, expected, actual)
+			}
+		})
+	}
+}
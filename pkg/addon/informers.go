@@ -0,0 +1,77 @@
+package addon
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/openshift/library-go/pkg/controller/controllercmd"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/rest"
+	addonv1alpha1client "open-cluster-management.io/api/client/addon/clientset/versioned"
+	addoninformers "open-cluster-management.io/api/client/addon/informers/externalversions"
+	clusterv1client "open-cluster-management.io/api/client/cluster/clientset/versioned"
+	clusterv1informers "open-cluster-management.io/api/client/cluster/informers/externalversions"
+)
+
+// HubInformers are the informer factories of the addon and cluster APIs on the hub, shared by the
+// addons and the controllers of this package. Each kind is then only listed and watched once, and
+// the event handlers that trigger an addon run after the listers its values are built from were
+// updated. The other kinds, like the policies, are watched with the Dynamic factory.
+type HubInformers struct {
+	Addon   addoninformers.SharedInformerFactory
+	Cluster clusterv1informers.SharedInformerFactory
+	Dynamic dynamicinformer.DynamicSharedInformerFactory
+}
+
+var (
+	hubInformersLock sync.Mutex
+	// hubInformers are the HubInformers created for each hub kubeconfig.
+	hubInformers = map[*rest.Config]*HubInformers{}
+)
+
+// GetHubInformers returns the HubInformers of the hub of the controller context, creating them on
+// the first call. The informers requested from the factories run once Start is called.
+func GetHubInformers(controllerContext *controllercmd.ControllerContext) (*HubInformers, error) {
+	hubInformersLock.Lock()
+	defer hubInformersLock.Unlock()
+
+	if informers, ok := hubInformers[controllerContext.KubeConfig]; ok {
+		return informers, nil
+	}
+
+	addonClient, err := addonv1alpha1client.NewForConfig(controllerContext.KubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve addon client: %w", err)
+	}
+
+	clusterClient, err := clusterv1client.NewForConfig(controllerContext.KubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize a managed cluster client: %w", err)
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(controllerContext.KubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve dynamic client: %w", err)
+	}
+
+	informers := &HubInformers{
+		Addon:   addoninformers.NewSharedInformerFactory(addonClient, 10*time.Minute),
+		Cluster: clusterv1informers.NewSharedInformerFactory(clusterClient, 10*time.Minute),
+		Dynamic: dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 10*time.Minute),
+	}
+
+	hubInformers[controllerContext.KubeConfig] = informers
+
+	return informers, nil
+}
+
+// Start runs the informers requested from the factories that are not running yet. It is called
+// after requesting informers, and may be called any number of times.
+func (i *HubInformers) Start(ctx context.Context) {
+	i.Addon.Start(ctx.Done())
+	i.Cluster.Start(ctx.Done())
+	i.Dynamic.Start(ctx.Done())
+}
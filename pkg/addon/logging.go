@@ -0,0 +1,129 @@
+package addon
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// LoggingConfigMapAnnotation set to "true" renders the logging settings of the agent in a mounted
+// ConfigMap instead of arguments. The agent reloads them when the ConfigMap changes, so the settings
+// can change without restarting the agent pod. Agents that don't support the LogConfigDirFlag get
+// the arguments instead, see the LogConfig feature of the CompatibilityMatrix.
+const LoggingConfigMapAnnotation = "policy-addon-logging-configmap"
+
+// LogConfigDirFlag is the agent flag for the directory of the mounted logging ConfigMap.
+const LogConfigDirFlag = "--log-config-dir"
+
+// SetLoggingConfigMap sets whether the logging settings are rendered in a ConfigMap.
+func (cv *CommonValues) SetLoggingConfigMap(value string) error {
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("failed to parse logging ConfigMap boolean '%s' (falling back to default value %t): %w",
+			value, false, err)
+	}
+
+	cv.LoggingConfigMap = &enabled
+
+	return nil
+}
+
+// loggingConfigArgs returns the logging ConfigMap entries mounted in the container as arguments,
+// where each key is the name of the flag.
+func loggingConfigArgs(container *corev1.Container, podSpec *corev1.PodSpec, objects []runtime.Object) []string {
+	configMap := findLoggingConfigMap(container, podSpec, objects)
+	if configMap == nil {
+		return nil
+	}
+
+	keys := make([]string, 0, len(configMap.Data))
+	for key := range configMap.Data {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	args := make([]string, 0, len(keys))
+	for _, key := range keys {
+		args = append(args, "--"+key+"="+configMap.Data[key])
+	}
+
+	return args
+}
+
+// logConfigFallback passes the settings of the logging ConfigMap mounted in the container as
+// arguments, for agents that don't support the LogConfigDirFlag. The ConfigMap and its volume are
+// removed from the returned objects.
+func logConfigFallback(
+	container *corev1.Container, podSpec *corev1.PodSpec, objects []runtime.Object,
+) []runtime.Object {
+	configMap := findLoggingConfigMap(container, podSpec, objects)
+	if configMap == nil {
+		return objects
+	}
+
+	container.Args = append(container.Args, loggingConfigArgs(container, podSpec, objects)...)
+
+	volumeName := loggingConfigVolume(container)
+
+	container.VolumeMounts = slices.DeleteFunc(container.VolumeMounts, func(mount corev1.VolumeMount) bool {
+		return mount.Name == volumeName
+	})
+	podSpec.Volumes = slices.DeleteFunc(podSpec.Volumes, func(volume corev1.Volume) bool {
+		return volume.Name == volumeName
+	})
+
+	return slices.DeleteFunc(slices.Clone(objects), func(obj runtime.Object) bool {
+		return obj == runtime.Object(configMap)
+	})
+}
+
+// loggingConfigVolume returns the name of the volume mounted at the LogConfigDirFlag path of the
+// container, or an empty string.
+func loggingConfigVolume(container *corev1.Container) string {
+	var dir string
+
+	for _, arg := range container.Args {
+		if value, found := strings.CutPrefix(arg, LogConfigDirFlag+"="); found {
+			dir = value
+		}
+	}
+
+	var volumeName string
+
+	for _, mount := range container.VolumeMounts {
+		if dir != "" && mount.MountPath == dir {
+			volumeName = mount.Name
+		}
+	}
+
+	return volumeName
+}
+
+// findLoggingConfigMap returns the rendered ConfigMap that is mounted at the LogConfigDirFlag path
+// of the container, or nil.
+func findLoggingConfigMap(
+	container *corev1.Container, podSpec *corev1.PodSpec, objects []runtime.Object,
+) *corev1.ConfigMap {
+	volumeName := loggingConfigVolume(container)
+
+	var configMapName string
+
+	for _, volume := range podSpec.Volumes {
+		if volumeName != "" && volume.Name == volumeName && volume.ConfigMap != nil {
+			configMapName = volume.ConfigMap.Name
+		}
+	}
+
+	for _, obj := range objects {
+		if configMap, ok := obj.(*corev1.ConfigMap); ok && configMapName != "" && configMap.Name == configMapName {
+			return configMap
+		}
+	}
+
+	return nil
+}
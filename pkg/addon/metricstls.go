@@ -0,0 +1,141 @@
+package addon
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	MetricsTLSModeAnnotation    = "metrics-tls-mode"
+	MetricsCertIssuerAnnotation = "metrics-cert-issuer"
+)
+
+// TLS modes of the agent metrics endpoint
+const (
+	// MetricsTLSModeOpenShift uses an OpenShift service serving certificate.
+	MetricsTLSModeOpenShift = "OpenShift"
+	// MetricsTLSModeCertManager uses a certificate issued by cert-manager.
+	MetricsTLSModeCertManager = "CertManager"
+	// MetricsTLSModeSelfSigned uses a self-signed certificate that the agent generates in memory when
+	// it starts, so the private key never leaves the agent pod. Prometheus can't verify it, so the
+	// connection is encrypted but the agent isn't authenticated.
+	MetricsTLSModeSelfSigned = "SelfSigned"
+	// MetricsTLSModeNone serves the metrics over plain HTTP.
+	MetricsTLSModeNone = "None"
+)
+
+// metricsCertDir is where the charts mount the metrics certificate Secret in the agent pod.
+const metricsCertDir = "/var/run/metrics-cert"
+
+var certManagerGroupVersion = schema.GroupVersion{Group: "cert-manager.io", Version: "v1"}
+
+// MetricsTLSConfig contains the TLS configuration values of the metrics endpoint for the addon chart.
+type MetricsTLSConfig struct {
+	Mode string `json:"mode,omitempty"`
+	// Issuer is the cert-manager issuer of the metrics certificate in the CertManager mode. The chart
+	// renders a self-signed Issuer when it's not set.
+	Issuer *CertManagerIssuer `json:"issuer,omitempty"`
+}
+
+// CertManagerIssuer references a cert-manager Issuer or ClusterIssuer.
+type CertManagerIssuer struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// defaultMetricsTLSMode returns the TLS mode of the metrics endpoint for the hosting cluster:
+// service serving certificates on OpenShift, cert-manager when the cluster reports it, and plain
+// HTTP otherwise.
+func defaultMetricsTLSMode(distribution string, capabilities *ClusterCapabilities) string {
+	switch {
+	case distribution == "OpenShift":
+		return MetricsTLSModeOpenShift
+	case capabilities != nil && capabilities.CertManager:
+		return MetricsTLSModeCertManager
+	default:
+		return MetricsTLSModeNone
+	}
+}
+
+// selfSignedMetrics returns whether the agent serves secure metrics without a mounted certificate,
+// which requires an agent that generates its self-signed certificate.
+func selfSignedMetrics(container *corev1.Container) bool {
+	return !slices.ContainsFunc(container.VolumeMounts, func(mount corev1.VolumeMount) bool {
+		return mount.MountPath == metricsCertDir
+	})
+}
+
+// selfSignedMetricsFallback removes the metrics address of an agent that can't generate its
+// self-signed certificate, so the metrics keep the default address of the agent instead of being
+// exposed over plain HTTP on the secure metrics port.
+func selfSignedMetricsFallback(
+	container *corev1.Container, _ *corev1.PodSpec, objects []runtime.Object,
+) []runtime.Object {
+	container.Args = slices.DeleteFunc(container.Args, func(arg string) bool {
+		return strings.HasPrefix(arg, "--metrics-bind-address=")
+	})
+
+	return objects
+}
+
+// prometheus returns the Prometheus values, initializing them if needed.
+func (cv *CommonValues) prometheus() *PrometheusConfig {
+	if cv.PrometheusConfig == nil {
+		cv.PrometheusConfig = &PrometheusConfig{}
+	}
+
+	return cv.PrometheusConfig
+}
+
+// metricsTLS returns the metrics TLS values, initializing them if needed.
+func (cv *CommonValues) metricsTLS() *MetricsTLSConfig {
+	if cv.prometheus().TLS == nil {
+		cv.prometheus().TLS = &MetricsTLSConfig{}
+	}
+
+	return cv.prometheus().TLS
+}
+
+// SetMetricsTLSMode sets the TLS mode of the metrics endpoint for the addon.
+func (cv *CommonValues) SetMetricsTLSMode(value string) error {
+	modes := []string{
+		MetricsTLSModeOpenShift, MetricsTLSModeCertManager, MetricsTLSModeSelfSigned, MetricsTLSModeNone,
+	}
+
+	if !slices.Contains(modes, value) {
+		return fmt.Errorf("invalid metrics TLS mode '%s' (falling back to the default mode), expected one of %s",
+			value, strings.Join(modes, ", "))
+	}
+
+	cv.metricsTLS().Mode = value
+
+	return nil
+}
+
+// SetMetricsCertIssuer sets the cert-manager issuer of the metrics certificate for the addon, like
+// "ClusterIssuer/my-ca". A name without a kind refers to an Issuer in the addon namespace.
+func (cv *CommonValues) SetMetricsCertIssuer(value string) error {
+	kind, name, found := strings.Cut(value, "/")
+	if !found {
+		kind, name = "Issuer", value
+	}
+
+	if kind != "Issuer" && kind != "ClusterIssuer" {
+		return fmt.Errorf("invalid metrics certificate issuer kind '%s' (falling back to a self-signed Issuer), "+
+			"expected Issuer or ClusterIssuer", kind)
+	}
+
+	if name == "" {
+		return fmt.Errorf("invalid metrics certificate issuer '%s' (falling back to a self-signed Issuer), "+
+			"the name is required", value)
+	}
+
+	cv.metricsTLS().Issuer = &CertManagerIssuer{Kind: kind, Name: name}
+
+	return nil
+}
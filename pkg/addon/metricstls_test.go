@@ -0,0 +1,98 @@
+package addon
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDefaultMetricsTLSMode(t *testing.T) {
+	tests := map[string]struct {
+		distribution string
+		capabilities *ClusterCapabilities
+		expected     string
+	}{
+		"OpenShift": {
+			distribution: "OpenShift",
+			capabilities: &ClusterCapabilities{CertManager: true},
+			expected:     MetricsTLSModeOpenShift,
+		},
+		"cert-manager": {
+			capabilities: &ClusterCapabilities{CertManager: true},
+			expected:     MetricsTLSModeCertManager,
+		},
+		"without cert-manager": {capabilities: &ClusterCapabilities{}, expected: MetricsTLSModeNone},
+		"unknown capabilities": {expected: MetricsTLSModeNone},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if mode := defaultMetricsTLSMode(test.distribution, test.capabilities); mode != test.expected {
+				t.Fatalf("expected the %s mode, got %s", test.expected, mode)
+			}
+		})
+	}
+}
+
+func TestSetMetricsTLSMode(t *testing.T) {
+	for _, mode := range []string{
+		MetricsTLSModeOpenShift, MetricsTLSModeCertManager, MetricsTLSModeSelfSigned, MetricsTLSModeNone,
+	} {
+		values := &CommonValues{}
+
+		if err := values.SetMetricsTLSMode(mode); err != nil {
+			t.Fatal(err)
+		}
+
+		if values.PrometheusConfig.TLS.Mode != mode {
+			t.Fatalf("expected the %s mode, got %s", mode, values.PrometheusConfig.TLS.Mode)
+		}
+	}
+
+	values := &CommonValues{}
+
+	if err := values.SetMetricsTLSMode("selfsigned"); err == nil || values.PrometheusConfig != nil {
+		t.Fatalf("expected the mode to be invalid, got %+v", values.PrometheusConfig)
+	}
+}
+
+func TestSetMetricsCertIssuer(t *testing.T) {
+	tests := map[string]struct {
+		value    string
+		expected *CertManagerIssuer
+	}{
+		"Issuer name": {value: "my-issuer", expected: &CertManagerIssuer{Kind: "Issuer", Name: "my-issuer"}},
+		"Issuer":      {value: "Issuer/my-issuer", expected: &CertManagerIssuer{Kind: "Issuer", Name: "my-issuer"}},
+		"ClusterIssuer": {
+			value:    "ClusterIssuer/my-ca",
+			expected: &CertManagerIssuer{Kind: "ClusterIssuer", Name: "my-ca"},
+		},
+		"unknown kind":   {value: "Certificate/my-ca"},
+		"missing name":   {value: "ClusterIssuer/"},
+		"empty":          {value: ""},
+		"lowercase kind": {value: "clusterissuer/my-ca"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			values := &CommonValues{}
+
+			err := values.SetMetricsCertIssuer(test.value)
+
+			if test.expected == nil {
+				if err == nil {
+					t.Fatalf("expected %q to be invalid, got %+v", test.value, values.PrometheusConfig.TLS.Issuer)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(values.PrometheusConfig.TLS.Issuer, test.expected) {
+				t.Fatalf("expected the issuer %+v, got %+v", test.expected, values.PrometheusConfig.TLS.Issuer)
+			}
+		})
+	}
+}
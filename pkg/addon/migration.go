@@ -0,0 +1,373 @@
+package addon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openshift/library-go/pkg/controller/controllercmd"
+	appsv1 "k8s.io/api/apps/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	workv1client "open-cluster-management.io/api/client/work/clientset/versioned"
+	workinformers "open-cluster-management.io/api/client/work/informers/externalversions"
+	worklistersv1 "open-cluster-management.io/api/client/work/listers/work/v1"
+	workv1 "open-cluster-management.io/api/work/v1"
+)
+
+const (
+	// InstallNamespaceMigrationCondition is the ManagedClusterAddOn condition reporting the progress
+	// of moving the agent to a new install namespace.
+	InstallNamespaceMigrationCondition = "InstallNamespaceMigration"
+
+	migrationReasonInProgress = "MigrationInProgress"
+	migrationReasonCompleted  = "MigrationCompleted"
+
+	// migrationSoakPeriod is how long the agent in the new namespace must hold the addon lease before
+	// the previous agent is removed. It is longer than the interval at which the lease of the agent is
+	// checked, so that the agent kept updating the lease.
+	migrationSoakPeriod = 2 * time.Minute
+)
+
+// NamespaceMigrator moves the agent to a new install namespace without a gap in enforcement. The
+// previous agent, as deployed in the ManifestWork, is kept until the agent in the new namespace is
+// applied, holds the addon lease, and ran for the soak period. It is scaled down once the new agent
+// holds the lease, so that both agents don't enforce the policies during the soak period.
+type NamespaceMigrator struct {
+	workLister worklistersv1.ManifestWorkLister
+	workSynced cache.InformerSynced
+	trigger    func(clusterName, addonName string)
+	now        func() time.Time
+
+	// soakTimers re-render the addons at the end of their soak period, keyed by cluster and addon name
+	soakTimers map[string]*time.Timer
+	timersLock sync.Mutex
+}
+
+// objectKey identifies a manifest by its kind, namespace, and name.
+type objectKey struct {
+	gvk       schema.GroupVersionKind
+	namespace string
+	name      string
+}
+
+// NewNamespaceMigrator creates a NamespaceMigrator for the addon, starting an informer on its
+// ManifestWorks.
+func NewNamespaceMigrator(
+	ctx context.Context,
+	mgr addonmanager.AddonManager,
+	controllerContext *controllercmd.ControllerContext,
+	addonName string,
+) (*NamespaceMigrator, error) {
+	workClient, err := workv1client.NewForConfig(controllerContext.KubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve work client: %w", err)
+	}
+
+	workInformer := workinformers.NewSharedInformerFactoryWithOptions(workClient, 10*time.Minute,
+		workinformers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = labels.Set{addonapiv1alpha1.AddonLabelKey: addonName}.String()
+		}),
+	).Work().V1().ManifestWorks()
+
+	go workInformer.Informer().Run(ctx.Done())
+
+	return &NamespaceMigrator{
+		workLister: workInformer.Lister(),
+		workSynced: workInformer.Informer().HasSynced,
+		trigger:    mgr.Trigger,
+		now:        time.Now,
+		soakTimers: map[string]*time.Timer{},
+	}, nil
+}
+
+// deployedManifests returns the manifests of the deploy ManifestWorks of the addon, along with the
+// ManifestWorks themselves.
+func (m *NamespaceMigrator) deployedManifests(
+	addon *addonapiv1alpha1.ManagedClusterAddOn,
+) ([]*unstructured.Unstructured, []*workv1.ManifestWork, error) {
+	works, err := m.workLister.ManifestWorks(addon.Namespace).List(labels.Everything())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	manifests := []*unstructured.Unstructured{}
+	deployWorks := []*workv1.ManifestWork{}
+
+	for _, work := range works {
+		if !strings.HasPrefix(work.Name, constants.DeployWorkNamePrefix(addon.Name)) {
+			continue
+		}
+
+		deployWorks = append(deployWorks, work)
+
+		for _, manifest := range work.Spec.Workload.Manifests {
+			obj := &unstructured.Unstructured{}
+			if err := json.Unmarshal(manifest.Raw, &obj.Object); err != nil {
+				return nil, nil, fmt.Errorf("failed to decode a manifest of the ManifestWork %s: %w", work.Name, err)
+			}
+
+			manifests = append(manifests, obj)
+		}
+	}
+
+	return manifests, deployWorks, nil
+}
+
+// agentApplied returns when the Deployment was applied by the ManifestWork, or nil if it wasn't.
+func agentApplied(works []*workv1.ManifestWork, deployment *appsv1.Deployment) *metav1.Time {
+	for _, work := range works {
+		for _, manifest := range work.Status.ResourceStatus.Manifests {
+			resource := manifest.ResourceMeta
+			if resource.Kind != "Deployment" || resource.Namespace != deployment.Namespace ||
+				resource.Name != deployment.Name {
+				continue
+			}
+
+			applied := meta.FindStatusCondition(manifest.Conditions, workv1.ManifestApplied)
+			if applied != nil && applied.Status == metav1.ConditionTrue {
+				return &applied.LastTransitionTime
+			}
+		}
+	}
+
+	return nil
+}
+
+// leaseHeld returns since when the addon lease is reported as updated by the agent in the namespace,
+// or nil if it isn't. The registration agent checks the lease in the namespace of the addon status,
+// which is set from the configuration before the agent in that namespace is even applied, so the
+// Available condition only reflects the lease in the namespace once it changed after the agent was
+// applied. Until then, it may still report the lease of the previous agent.
+func leaseHeld(addon *addonapiv1alpha1.ManagedClusterAddOn, namespace string, applied metav1.Time) *metav1.Time {
+	if addon.Status.Namespace != namespace {
+		return nil
+	}
+
+	available := meta.FindStatusCondition(
+		addon.Status.Conditions, addonapiv1alpha1.ManagedClusterAddOnConditionAvailable,
+	)
+	if available == nil || available.Status != metav1.ConditionTrue ||
+		available.Reason != addonapiv1alpha1.AddonAvailableReasonLeaseLeaseUpdated ||
+		available.LastTransitionTime.Before(&applied) {
+		return nil
+	}
+
+	return &available.LastTransitionTime
+}
+
+// scheduleTrigger re-renders the addon after the duration, replacing the previously scheduled
+// re-render of the addon.
+func (m *NamespaceMigrator) scheduleTrigger(addon *addonapiv1alpha1.ManagedClusterAddOn, after time.Duration) {
+	key := addon.Namespace + "/" + addon.Name
+
+	m.timersLock.Lock()
+	defer m.timersLock.Unlock()
+
+	if timer, ok := m.soakTimers[key]; ok {
+		timer.Reset(after)
+
+		return
+	}
+
+	m.soakTimers[key] = time.AfterFunc(after, func() {
+		m.trigger(addon.Namespace, addon.Name)
+	})
+}
+
+// cancelTrigger cancels the scheduled re-render of the addon, if any.
+func (m *NamespaceMigrator) cancelTrigger(addon *addonapiv1alpha1.ManagedClusterAddOn) {
+	key := addon.Namespace + "/" + addon.Name
+
+	m.timersLock.Lock()
+	defer m.timersLock.Unlock()
+
+	if timer, ok := m.soakTimers[key]; ok {
+		timer.Stop()
+		delete(m.soakTimers, key)
+	}
+}
+
+// Migrate returns the objects to deploy for the addon, which include the previous agent while the
+// agent is moved to a new install namespace, along with the InstallNamespaceMigration condition. The
+// condition is nil when no migration is in progress. Hosted addons are not migrated.
+func (m *NamespaceMigrator) Migrate(
+	addon *addonapiv1alpha1.ManagedClusterAddOn, objects []runtime.Object,
+) ([]runtime.Object, *metav1.Condition, error) {
+	if addon.GetAnnotations()[addonapiv1alpha1.HostingClusterNameAnnotationKey] != "" {
+		return objects, nil, nil
+	}
+
+	var agent *appsv1.Deployment
+
+	for _, obj := range objects {
+		if deployment, ok := obj.(*appsv1.Deployment); ok {
+			agent = deployment
+
+			break
+		}
+	}
+
+	if agent == nil {
+		return objects, nil, nil
+	}
+
+	// Without all the ManifestWorks, the previous agent would be removed before the migration is done
+	if !m.workSynced() {
+		return nil, nil, errors.New("the ManifestWorks are not synced yet to migrate the install namespace")
+	}
+
+	deployed, works, err := m.deployedManifests(addon)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	oldNamespaces := []string{}
+
+	for _, obj := range deployed {
+		if obj.GetKind() == "Deployment" && obj.GetName() == agent.Name && obj.GetNamespace() != agent.Namespace &&
+			!slices.Contains(oldNamespaces, obj.GetNamespace()) {
+			oldNamespaces = append(oldNamespaces, obj.GetNamespace())
+		}
+	}
+
+	if len(oldNamespaces) == 0 {
+		m.cancelTrigger(addon)
+
+		return objects, nil, nil
+	}
+
+	slices.Sort(oldNamespaces)
+
+	from := strings.Join(oldNamespaces, ", ")
+
+	var waitingFor string
+
+	// The previous agent is only stopped once the new agent holds the lease, and is started again if
+	// the new agent stops holding it during the soak period
+	stopPrevious := false
+
+	applied := agentApplied(works, agent)
+
+	var leaseSince *metav1.Time
+	if applied != nil {
+		leaseSince = leaseHeld(addon, agent.Namespace, *applied)
+	}
+
+	switch {
+	case applied == nil:
+		waitingFor = "to be applied"
+	case leaseSince == nil:
+		waitingFor = "to hold the addon lease"
+	default:
+		remaining := migrationSoakPeriod - m.now().Sub(leaseSince.Time)
+		if remaining <= 0 {
+			m.cancelTrigger(addon)
+
+			return objects, &metav1.Condition{
+				Type:    InstallNamespaceMigrationCondition,
+				Status:  metav1.ConditionFalse,
+				Reason:  migrationReasonCompleted,
+				Message: fmt.Sprintf("The agent was migrated from the namespace %s to %s", from, agent.Namespace),
+			}, nil
+		}
+
+		waitingFor = "to run for " + migrationSoakPeriod.String() + ", the previous agent is stopped"
+		stopPrevious = true
+
+		// Nothing else triggers the addon once the soak period is over
+		m.scheduleTrigger(addon, remaining)
+	}
+
+	objects, err = retainPreviousAgent(objects, deployed, oldNamespaces, stopPrevious)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return objects, &metav1.Condition{
+		Type:   InstallNamespaceMigrationCondition,
+		Status: metav1.ConditionTrue,
+		Reason: migrationReasonInProgress,
+		Message: fmt.Sprintf("Migrating the agent from the namespace %s to %s: waiting for the new agent %s",
+			from, agent.Namespace, waitingFor),
+	}, nil
+}
+
+// retainPreviousAgent adds the deployed objects that are not rendered anymore to the objects, so
+// that they are only removed once the migration is complete. The rendered role bindings keep the
+// subjects in the previous namespaces, so the previous agent keeps its permissions. When stop is set,
+// the Deployments of the previous agent are scaled to zero replicas.
+func retainPreviousAgent(
+	objects []runtime.Object, deployed []*unstructured.Unstructured, oldNamespaces []string, stop bool,
+) ([]runtime.Object, error) {
+	rendered := make(map[objectKey]runtime.Object, len(objects))
+
+	for _, obj := range objects {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		key := objectKey{obj.GetObjectKind().GroupVersionKind(), accessor.GetNamespace(), accessor.GetName()}
+		rendered[key] = obj
+	}
+
+	for _, obj := range deployed {
+		key := objectKey{obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName()}
+
+		renderedObj, found := rendered[key]
+		if !found {
+			if stop && obj.GetKind() == "Deployment" && slices.Contains(oldNamespaces, obj.GetNamespace()) {
+				obj = obj.DeepCopy()
+
+				if err := unstructured.SetNestedField(obj.Object, int64(0), "spec", "replicas"); err != nil {
+					return nil, fmt.Errorf("failed to scale down the previous agent %s: %w", obj.GetName(), err)
+				}
+			}
+
+			objects = append(objects, obj)
+
+			continue
+		}
+
+		var subjects *[]rbacv1.Subject
+
+		switch binding := renderedObj.(type) {
+		case *rbacv1.ClusterRoleBinding:
+			subjects = &binding.Subjects
+		case *rbacv1.RoleBinding:
+			subjects = &binding.Subjects
+		default:
+			continue
+		}
+
+		deployedBinding := &rbacv1.RoleBinding{}
+
+		err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, deployedBinding)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode the deployed %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+
+		for _, subject := range deployedBinding.Subjects {
+			if slices.Contains(oldNamespaces, subject.Namespace) && !slices.Contains(*subjects, subject) {
+				*subjects = append(*subjects, subject)
+			}
+		}
+	}
+
+	return objects, nil
+}
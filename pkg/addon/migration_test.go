@@ -0,0 +1,482 @@
+package addon
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	worklistersv1 "open-cluster-management.io/api/client/work/listers/work/v1"
+	workv1 "open-cluster-management.io/api/work/v1"
+)
+
+var migrationTestStart = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// newTestDeployment returns the agent Deployment in the namespace.
+func newTestDeployment(namespace string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller", Namespace: namespace},
+	}
+}
+
+// newTestRoleBinding returns a RoleBinding of the agent service account in the namespaces.
+func newTestRoleBinding(namespaces ...string) *rbacv1.RoleBinding {
+	binding := &rbacv1.RoleBinding{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"},
+		ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller", Namespace: "kube-system"},
+	}
+
+	for _, namespace := range namespaces {
+		binding.Subjects = append(binding.Subjects, rbacv1.Subject{
+			Kind: "ServiceAccount", Name: "config-policy-controller", Namespace: namespace,
+		})
+	}
+
+	return binding
+}
+
+// newTestWork returns the deploy ManifestWork of the addon on cluster1 with the objects, reporting
+// the Deployments as applied at the time when it's not nil.
+func newTestWork(t *testing.T, applied *time.Time, objects ...runtime.Object) *workv1.ManifestWork {
+	t.Helper()
+
+	work := &workv1.ManifestWork{
+		ObjectMeta: metav1.ObjectMeta{Name: "addon-config-policy-controller-deploy-0", Namespace: "cluster1"},
+	}
+
+	for _, obj := range objects {
+		raw, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		work.Spec.Workload.Manifests = append(work.Spec.Workload.Manifests,
+			workv1.Manifest{RawExtension: runtime.RawExtension{Raw: raw}})
+
+		deployment, ok := obj.(*appsv1.Deployment)
+		if !ok || applied == nil {
+			continue
+		}
+
+		work.Status.ResourceStatus.Manifests = append(work.Status.ResourceStatus.Manifests, workv1.ManifestCondition{
+			ResourceMeta: workv1.ManifestResourceMeta{
+				Kind: "Deployment", Namespace: deployment.Namespace, Name: deployment.Name,
+			},
+			Conditions: []metav1.Condition{{
+				Type:               workv1.ManifestApplied,
+				Status:             metav1.ConditionTrue,
+				LastTransitionTime: metav1.NewTime(*applied),
+			}},
+		})
+	}
+
+	return work
+}
+
+// newTestMigrator returns a NamespaceMigrator listing the ManifestWorks, with the time set to now.
+func newTestMigrator(
+	t *testing.T, synced bool, now time.Time, trigger func(string, string), works ...*workv1.ManifestWork,
+) *NamespaceMigrator {
+	t.Helper()
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+	})
+
+	for _, work := range works {
+		if err := indexer.Add(work); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if trigger == nil {
+		trigger = func(string, string) {}
+	}
+
+	return &NamespaceMigrator{
+		workLister: worklistersv1.NewManifestWorkLister(indexer),
+		workSynced: func() bool { return synced },
+		trigger:    trigger,
+		now:        func() time.Time { return now },
+		soakTimers: map[string]*time.Timer{},
+	}
+}
+
+// newMigratingAddon returns the addon on cluster1 with the status namespace, and the Available
+// condition reporting the lease as updated since the time when it's not nil.
+func newMigratingAddon(namespace string, leaseSince *time.Time) *addonapiv1alpha1.ManagedClusterAddOn {
+	addon := &addonapiv1alpha1.ManagedClusterAddOn{
+		ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller", Namespace: "cluster1"},
+	}
+	addon.Status.Namespace = namespace
+
+	if leaseSince != nil {
+		addon.Status.Conditions = []metav1.Condition{{
+			Type:               addonapiv1alpha1.ManagedClusterAddOnConditionAvailable,
+			Status:             metav1.ConditionTrue,
+			Reason:             addonapiv1alpha1.AddonAvailableReasonLeaseLeaseUpdated,
+			LastTransitionTime: metav1.NewTime(*leaseSince),
+		}}
+	}
+
+	return addon
+}
+
+func TestNamespaceMigratorMigrate(t *testing.T) {
+	applied := migrationTestStart
+	beforeApplied := applied.Add(-time.Hour)
+	leaseSince := applied.Add(30 * time.Second)
+	soaking := leaseSince.Add(time.Minute)
+	soaked := leaseSince.Add(migrationSoakPeriod)
+
+	tests := map[string]struct {
+		addon   *addonapiv1alpha1.ManagedClusterAddOn
+		works   []*workv1.ManifestWork
+		now     time.Time
+		reason  string
+		message string
+		// retained is whether the previous agent is added to the objects, and stopped whether it is
+		// scaled down
+		retained bool
+		stopped  bool
+	}{
+		"no previous agent": {
+			addon: newMigratingAddon("open-cluster-management-agent-addon", &leaseSince),
+			works: []*workv1.ManifestWork{
+				newTestWork(t, &applied, newTestDeployment("open-cluster-management-agent-addon")),
+			},
+			now: soaking,
+		},
+		"new agent not applied": {
+			addon:    newMigratingAddon("open-cluster-management-agent-addon", nil),
+			works:    []*workv1.ManifestWork{newTestWork(t, nil, newTestDeployment("old-namespace"))},
+			now:      soaking,
+			reason:   migrationReasonInProgress,
+			message:  "waiting for the new agent to be applied",
+			retained: true,
+		},
+		"lease not updated": {
+			addon: newMigratingAddon("open-cluster-management-agent-addon", nil),
+			works: []*workv1.ManifestWork{newTestWork(t, &applied,
+				newTestDeployment("old-namespace"), newTestDeployment("open-cluster-management-agent-addon"))},
+			now:      soaking,
+			reason:   migrationReasonInProgress,
+			message:  "waiting for the new agent to hold the addon lease",
+			retained: true,
+		},
+		"lease in another namespace": {
+			addon: newMigratingAddon("old-namespace", &leaseSince),
+			works: []*workv1.ManifestWork{newTestWork(t, &applied,
+				newTestDeployment("old-namespace"), newTestDeployment("open-cluster-management-agent-addon"))},
+			now:      soaking,
+			reason:   migrationReasonInProgress,
+			message:  "waiting for the new agent to hold the addon lease",
+			retained: true,
+		},
+		"lease updated before the new agent was applied": {
+			addon: newMigratingAddon("open-cluster-management-agent-addon", &beforeApplied),
+			works: []*workv1.ManifestWork{newTestWork(t, &applied,
+				newTestDeployment("old-namespace"), newTestDeployment("open-cluster-management-agent-addon"))},
+			now:      soaked,
+			reason:   migrationReasonInProgress,
+			message:  "waiting for the new agent to hold the addon lease",
+			retained: true,
+		},
+		"soaking": {
+			addon: newMigratingAddon("open-cluster-management-agent-addon", &leaseSince),
+			works: []*workv1.ManifestWork{newTestWork(t, &applied,
+				newTestDeployment("old-namespace"), newTestDeployment("open-cluster-management-agent-addon"))},
+			now:      soaking,
+			reason:   migrationReasonInProgress,
+			message:  "waiting for the new agent to run for 2m0s, the previous agent is stopped",
+			retained: true,
+			stopped:  true,
+		},
+		"completed": {
+			addon: newMigratingAddon("open-cluster-management-agent-addon", &leaseSince),
+			works: []*workv1.ManifestWork{newTestWork(t, &applied,
+				newTestDeployment("old-namespace"), newTestDeployment("open-cluster-management-agent-addon"))},
+			now:     soaked,
+			reason:  migrationReasonCompleted,
+			message: "The agent was migrated from the namespace old-namespace to open-cluster-management-agent-addon",
+		},
+		"several previous namespaces": {
+			addon: newMigratingAddon("open-cluster-management-agent-addon", nil),
+			works: []*workv1.ManifestWork{newTestWork(t, &applied, newTestDeployment("old-namespace2"),
+				newTestDeployment("old-namespace1"), newTestDeployment("open-cluster-management-agent-addon"))},
+			now:      soaking,
+			reason:   migrationReasonInProgress,
+			message:  "from the namespace old-namespace1, old-namespace2 to open-cluster-management-agent-addon",
+			retained: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			migrator := newTestMigrator(t, true, test.now, nil, test.works...)
+			t.Cleanup(func() { migrator.cancelTrigger(test.addon) })
+
+			objects := []runtime.Object{newTestDeployment("open-cluster-management-agent-addon")}
+
+			migrated, condition, err := migrator.Migrate(test.addon, objects)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.reason == "" {
+				if condition != nil {
+					t.Fatalf("expected no migration, got %+v", condition)
+				}
+			} else if condition == nil || condition.Reason != test.reason ||
+				!strings.Contains(condition.Message, test.message) {
+				t.Fatalf("expected the reason %s with the message %q, got %+v", test.reason, test.message, condition)
+			}
+
+			if retained := len(migrated) > len(objects); retained != test.retained {
+				t.Fatalf("expected the previous agent to be retained: %v, got %d objects", test.retained, len(migrated))
+			}
+
+			for _, obj := range migrated[len(objects):] {
+				previous, ok := obj.(*unstructured.Unstructured)
+				if !ok || previous.GetKind() != "Deployment" {
+					continue
+				}
+
+				replicas, found, _ := unstructured.NestedInt64(previous.Object, "spec", "replicas")
+				if stopped := found && replicas == 0; stopped != test.stopped {
+					t.Fatalf("expected the previous agent to be stopped: %v, got the spec %v",
+						test.stopped, previous.Object["spec"])
+				}
+			}
+		})
+	}
+}
+
+func TestNamespaceMigratorMigrateSkipped(t *testing.T) {
+	applied := migrationTestStart
+	works := newTestWork(t, &applied,
+		newTestDeployment("old-namespace"), newTestDeployment("open-cluster-management-agent-addon"))
+	objects := []runtime.Object{newTestDeployment("open-cluster-management-agent-addon")}
+
+	t.Run("hosted", func(t *testing.T) {
+		addon := newMigratingAddon("open-cluster-management-agent-addon", nil)
+		addon.SetAnnotations(map[string]string{addonapiv1alpha1.HostingClusterNameAnnotationKey: "hosting"})
+
+		migrated, condition, err := newTestMigrator(t, true, applied, nil, works).Migrate(addon, objects)
+		if err != nil || condition != nil || len(migrated) != len(objects) {
+			t.Fatalf("expected hosted addons not to be migrated, got %v, %+v, %v", migrated, condition, err)
+		}
+	})
+
+	t.Run("no agent", func(t *testing.T) {
+		addon := newMigratingAddon("open-cluster-management-agent-addon", nil)
+
+		migrated, condition, err := newTestMigrator(t, true, applied, nil, works).Migrate(addon, nil)
+		if err != nil || condition != nil || len(migrated) != 0 {
+			t.Fatalf("expected no migration without an agent, got %v, %+v, %v", migrated, condition, err)
+		}
+	})
+
+	t.Run("not synced", func(t *testing.T) {
+		addon := newMigratingAddon("open-cluster-management-agent-addon", nil)
+
+		if _, _, err := newTestMigrator(t, false, applied, nil, works).Migrate(addon, objects); err == nil {
+			t.Fatal("expected an error while the ManifestWorks are not synced")
+		}
+	})
+}
+
+func TestNamespaceMigratorSoakTrigger(t *testing.T) {
+	applied := migrationTestStart
+	leaseSince := applied.Add(30 * time.Second)
+	// The soak period ends shortly after the addon is rendered
+	now := leaseSince.Add(migrationSoakPeriod - 50*time.Millisecond)
+
+	var triggered atomic.Int32
+
+	migrator := newTestMigrator(t, true, now, func(clusterName, addonName string) {
+		if clusterName != "cluster1" || addonName != "config-policy-controller" {
+			t.Errorf("unexpected trigger of the addon %s/%s", clusterName, addonName)
+		}
+
+		triggered.Add(1)
+	}, newTestWork(t, &applied,
+		newTestDeployment("old-namespace"), newTestDeployment("open-cluster-management-agent-addon")))
+
+	addon := newMigratingAddon("open-cluster-management-agent-addon", &leaseSince)
+	objects := []runtime.Object{newTestDeployment("open-cluster-management-agent-addon")}
+
+	// Rendering the addon several times during the soak period keeps a single timer
+	for range 3 {
+		if _, _, err := migrator.Migrate(addon, objects); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(migrator.soakTimers) != 1 {
+		t.Fatalf("expected a single soak timer, got %d", len(migrator.soakTimers))
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	if count := triggered.Load(); count != 1 {
+		t.Fatalf("expected the addon to be triggered once at the end of the soak period, got %d", count)
+	}
+
+	// The timer is removed once the migration is complete
+	migrator.now = func() time.Time { return leaseSince.Add(migrationSoakPeriod) }
+
+	if _, _, err := migrator.Migrate(addon, objects); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrator.soakTimers) != 0 {
+		t.Fatalf("expected no soak timer after the migration, got %d", len(migrator.soakTimers))
+	}
+}
+
+// toUnstructured converts the object to the unstructured object of a deployed manifest.
+func toUnstructured(t *testing.T, obj runtime.Object) *unstructured.Unstructured {
+	t.Helper()
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &unstructured.Unstructured{Object: content}
+}
+
+func TestRetainPreviousAgent(t *testing.T) {
+	clusterBinding := &rbacv1.ClusterRoleBinding{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"},
+		ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller"},
+		Subjects: []rbacv1.Subject{
+			{Kind: "ServiceAccount", Name: "config-policy-controller", Namespace: "new-namespace"},
+		},
+	}
+
+	previousClusterBinding := clusterBinding.DeepCopy()
+	previousClusterBinding.Subjects[0].Namespace = "old-namespace"
+
+	serviceAccount := &corev1.ServiceAccount{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+		ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller", Namespace: "old-namespace"},
+	}
+
+	tests := map[string]struct {
+		rendered []runtime.Object
+		deployed []runtime.Object
+		stop     bool
+		// added is the number of deployed objects added to the rendered objects
+		added    int
+		subjects map[string][]string
+		// stopped are the namespaces of the added Deployments that are scaled down
+		stopped []string
+	}{
+		"objects not rendered anymore": {
+			rendered: []runtime.Object{newTestDeployment("new-namespace")},
+			deployed: []runtime.Object{newTestDeployment("old-namespace"), serviceAccount},
+			added:    2,
+		},
+		"previous agent stopped": {
+			rendered: []runtime.Object{newTestDeployment("new-namespace")},
+			deployed: []runtime.Object{newTestDeployment("old-namespace"), newTestDeployment("other-namespace")},
+			stop:     true,
+			added:    2,
+			stopped:  []string{"old-namespace"},
+		},
+		"objects still rendered": {
+			rendered: []runtime.Object{newTestDeployment("new-namespace")},
+			deployed: []runtime.Object{newTestDeployment("new-namespace")},
+		},
+		"role binding subjects of the previous namespace": {
+			rendered: []runtime.Object{newTestRoleBinding("new-namespace")},
+			deployed: []runtime.Object{newTestRoleBinding("old-namespace", "other-namespace")},
+			subjects: map[string][]string{"RoleBinding": {"new-namespace", "old-namespace"}},
+		},
+		"subjects already rendered": {
+			rendered: []runtime.Object{newTestRoleBinding("new-namespace", "old-namespace")},
+			deployed: []runtime.Object{newTestRoleBinding("old-namespace")},
+			subjects: map[string][]string{"RoleBinding": {"new-namespace", "old-namespace"}},
+		},
+		"cluster role binding subjects of the previous namespace": {
+			rendered: []runtime.Object{clusterBinding.DeepCopy()},
+			deployed: []runtime.Object{previousClusterBinding},
+			subjects: map[string][]string{"ClusterRoleBinding": {"new-namespace", "old-namespace"}},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			deployed := make([]*unstructured.Unstructured, 0, len(test.deployed))
+			for _, obj := range test.deployed {
+				deployed = append(deployed, toUnstructured(t, obj))
+			}
+
+			objects, err := retainPreviousAgent(test.rendered, deployed, []string{"old-namespace"}, test.stop)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if added := len(objects) - len(test.rendered); added != test.added {
+				t.Fatalf("expected %d deployed objects to be added, got %d", test.added, added)
+			}
+
+			var stopped []string
+
+			for _, obj := range objects[len(test.rendered):] {
+				previous := obj.(*unstructured.Unstructured)
+
+				replicas, found, _ := unstructured.NestedInt64(previous.Object, "spec", "replicas")
+				if found && replicas == 0 {
+					stopped = append(stopped, previous.GetNamespace())
+				}
+			}
+
+			if !reflect.DeepEqual(stopped, test.stopped) {
+				t.Fatalf("expected the Deployments in %v to be stopped, got %v", test.stopped, stopped)
+			}
+
+			for _, obj := range deployed {
+				if _, found, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "replicas"); found {
+					t.Fatalf("expected the deployed manifests not to be modified, got %v", obj.Object)
+				}
+			}
+
+			for _, obj := range objects {
+				var subjects []rbacv1.Subject
+
+				switch binding := obj.(type) {
+				case *rbacv1.RoleBinding:
+					subjects = binding.Subjects
+				case *rbacv1.ClusterRoleBinding:
+					subjects = binding.Subjects
+				default:
+					continue
+				}
+
+				namespaces := []string{}
+				for _, subject := range subjects {
+					namespaces = append(namespaces, subject.Namespace)
+				}
+
+				expected := test.subjects[obj.GetObjectKind().GroupVersionKind().Kind]
+				if !reflect.DeepEqual(namespaces, expected) {
+					t.Fatalf("expected the subjects in the namespaces %v, got %v", expected, namespaces)
+				}
+			}
+		})
+	}
+}
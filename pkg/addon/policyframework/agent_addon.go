@@ -4,11 +4,11 @@ import (
 	"context"
 	"embed"
 	"fmt"
-	"os"
+	"slices"
 	"strings"
-	"time"
 
 	"github.com/openshift/library-go/pkg/controller/controllercmd"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"open-cluster-management.io/addon-framework/pkg/addonfactory"
 	"open-cluster-management.io/addon-framework/pkg/addonmanager"
@@ -16,8 +16,8 @@ import (
 	"open-cluster-management.io/addon-framework/pkg/utils"
 	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	addonv1alpha1client "open-cluster-management.io/api/client/addon/clientset/versioned"
+	addonlistersv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
 	clusterv1client "open-cluster-management.io/api/client/cluster/clientset/versioned"
-	clusterv1informers "open-cluster-management.io/api/client/cluster/informers/externalversions"
 	clusterlistersv1 "open-cluster-management.io/api/client/cluster/listers/cluster/v1"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -26,10 +26,12 @@ import (
 )
 
 const (
-	addonName                   = "governance-policy-framework"
+	AddonName                   = "governance-policy-framework"
 	onMulticlusterHubAnnotation = "addon.open-cluster-management.io/on-multicluster-hub"
 	// Should only be set when the hub cluster is imported in a global hub
 	syncPoliciesOnMulticlusterHubAnnotation = "policy.open-cluster-management.io/sync-policies-on-multicluster-hub"
+	// imageKey is the key of the agent image in the imageOverrides values
+	imageKey = "governance_policy_framework_addon"
 )
 
 type policyFrameworkUserValues struct {
@@ -49,22 +51,71 @@ var (
 
 	log = ctrl.Log.WithName("policyframework")
 
+	// AddOnMeta describes the addon in the ClusterManagementAddOn created by the controller.
+	AddOnMeta = addonapiv1alpha1.AddOnMeta{
+		DisplayName: "Governance Policy Framework",
+		Description: "Syncs the policies of the cluster from the hub and reports their status back to the hub.",
+	}
+
+	// UninstallHook clears the policies synced by the governance-policy-framework from the cluster
+	// before the addon is removed. There is nothing to clear when it doesn't sync policies on the hub.
+	UninstallHook = &policyaddon.UninstallHook{
+		AddonName: AddonName,
+		Container: "governance-policy-framework-addon",
+		Namespaces: func(
+			cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn, agent *appsv1.Deployment,
+		) []string {
+			if slices.ContainsFunc(agent.Spec.Template.Spec.Containers, func(c corev1.Container) bool {
+				return slices.Contains(c.Args, "--on-multicluster-hub=true")
+			}) {
+				return nil
+			}
+
+			if addon.GetAnnotations()[addonapiv1alpha1.HostingClusterNameAnnotationKey] != "" {
+				return []string{agent.Namespace}
+			}
+
+			return []string{cluster.Name}
+		},
+		Finalizers: []string{"policy.open-cluster-management.io/template-cleanup"},
+		InheritEnv: []string{"OPERATOR_NAME"},
+	}
+
 	agentPermissionFiles = []string{
 		// role with RBAC rules to access resources on hub
 		"manifests/hubpermissions/role.yaml",
 		// rolebinding to bind the above role to a certain user group
 		"manifests/hubpermissions/rolebinding.yaml",
 	}
+
+	// TemplateSource exports the governance-policy-framework as an AddOnTemplate.
+	TemplateSource = policyaddon.TemplateSource{
+		AddonName:       AddonName,
+		FS:              FS,
+		PermissionFiles: agentPermissionFiles,
+		UninstallHook:   UninstallHook,
+		GetValuesFuncs: func(
+			clusterLister clusterlistersv1.ManagedClusterLister,
+			_ addonlistersv1alpha1.ManagedClusterAddOnLister,
+			deploymentConfigValues addonfactory.GetValuesFunc,
+		) []addonfactory.GetValuesFunc {
+			return getValuesFuncs(nil, clusterLister, deploymentConfigValues)
+		},
+	}
 )
 
-func getSkeletonValues() policyFrameworkUserValues {
+// getSkeletonValues returns the default values for the chart. The agent image is selected based on
+// the capabilities of the cluster the agent runs on, which may be nil when they are unknown.
+func getSkeletonValues(hostingCapabilities *policyaddon.ClusterCapabilities) policyFrameworkUserValues {
 	return policyFrameworkUserValues{
 		CommonValues: policyaddon.CommonValues{
 			BaseValues: policyaddon.BaseValues{
 				GlobalValues: &policyaddon.GlobalValues{
 					ImagePullPolicy: corev1.PullIfNotPresent,
 					ImageOverrides: map[string]string{
-						"governance_policy_framework_addon": os.Getenv("GOVERNANCE_POLICY_FRAMEWORK_ADDON_IMAGE"),
+						imageKey: policyaddon.GetAgentImage(
+							"GOVERNANCE_POLICY_FRAMEWORK_ADDON_IMAGE", hostingCapabilities,
+						),
 					},
 				},
 			},
@@ -78,7 +129,7 @@ func getValuesFromAnnotations(clusterClient clusterlistersv1.ManagedClusterListe
 	return func(
 		cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn,
 	) (addonfactory.Values, error) {
-		userValues := getSkeletonValues()
+		userValues := getSkeletonValues(policyaddon.GetHostingCapabilities(cluster, addon, clusterClient))
 
 		err := userValues.CommonValues.SetCommonValues(cluster, addon, clusterClient)
 		if err != nil {
@@ -125,7 +176,10 @@ func getValuesFromAnnotations(clusterClient clusterlistersv1.ManagedClusterListe
 }
 
 func getValuesFromCustomizedVariableValues(config addonapiv1alpha1.AddOnDeploymentConfig) (addonfactory.Values, error) {
-	userValues := getSkeletonValues()
+	userValues := getSkeletonValues(nil)
+	// The image is selected for the cluster in getValuesFromAnnotations, so only override it with
+	// the image variables
+	userValues.GlobalValues.ImageOverrides = nil
 
 	userValuesMap, err := userValues.CommonValues.SetCommonValuesFromCustomizedVariables(config)
 	if err != nil {
@@ -137,7 +191,7 @@ func getValuesFromCustomizedVariableValues(config addonapiv1alpha1.AddOnDeployme
 	for key, value := range userValuesMap {
 		if fn, ok := variableToFuncMap[key]; ok {
 			fn(&userValues, value)
-		} else {
+		} else if !userValues.SetImageOverride(imageKey, key, value) {
 			log.Error(fmt.Errorf("unknown customized variable: %s", key), "unknown customized variable")
 		}
 	}
@@ -145,10 +199,36 @@ func getValuesFromCustomizedVariableValues(config addonapiv1alpha1.AddOnDeployme
 	return addonfactory.JsonStructToValues(userValues)
 }
 
-func GetAgentAddon(ctx context.Context, controllerContext *controllercmd.ControllerContext) (agent.AgentAddon, error) {
+// deploymentConfigToValuesFuncs convert the AddOnDeploymentConfig of the addon to values.
+var deploymentConfigToValuesFuncs = []addonfactory.AddOnDeploymentConfigToValuesFunc{
+	addonfactory.ToAddOnResourceRequirementsValues,
+	getValuesFromCustomizedVariableValues,
+}
+
+// getValuesFuncs returns the values functions of the addon in order of precedence, with the
+// AddOnDeploymentConfig values from deploymentConfigValues. The agent is sized with the sizer when
+// it's not nil.
+func getValuesFuncs(
+	sizer *policyaddon.AgentSizer,
+	clusterLister clusterlistersv1.ManagedClusterLister,
+	deploymentConfigValues addonfactory.GetValuesFunc,
+) []addonfactory.GetValuesFunc {
+	return []addonfactory.GetValuesFunc{
+		policyaddon.TraceValuesFunc("AgentSizing", sizer.GetValues),
+		policyaddon.TraceValuesFunc("Annotations", getValuesFromAnnotations(clusterLister)),
+		policyaddon.TraceValuesFunc("ValuesAnnotation", addonfactory.GetValuesFromAddonAnnotation),
+		policyaddon.TraceValuesFunc("AddOnDeploymentConfig", deploymentConfigValues),
+		policyaddon.TraceValuesFunc("Mandate", policyaddon.MandateValues),
+	}
+}
+
+// GetAgentAddon returns the agent addon, which is sized with the sizer when it's not nil.
+func GetAgentAddon(
+	ctx context.Context, controllerContext *controllercmd.ControllerContext, sizer *policyaddon.AgentSizer,
+) (agent.AgentAddon, error) {
 	registrationOption := policyaddon.NewRegistrationOption(
 		controllerContext,
-		addonName,
+		AddonName,
 		agentPermissionFiles,
 		FS,
 		false)
@@ -163,28 +243,32 @@ func GetAgentAddon(ctx context.Context, controllerContext *controllercmd.Control
 		return nil, fmt.Errorf("failed to initialize a managed cluster client: %w", err)
 	}
 
-	clusterInformer := clusterv1informers.NewSharedInformerFactory(clusterClient, 10*time.Minute).
-		Cluster().V1().ManagedClusters()
-	go clusterInformer.Informer().Run(ctx.Done())
+	hubInformers, err := policyaddon.GetHubInformers(controllerContext)
+	if err != nil {
+		return nil, err
+	}
+
+	clusterInformer := hubInformers.Cluster.Cluster().V1().ManagedClusters()
+
+	hubInformers.Start(ctx)
 
-	return addonfactory.NewAgentAddonFactory(addonName, FS, "manifests/managedclusterchart").
+	resolver, err := policyaddon.StartDeploymentConfigResolver(ctx, controllerContext)
+	if err != nil {
+		return nil, err
+	}
+
+	adcGetter := utils.NewAddOnDeploymentConfigGetter(addonClient)
+
+	return addonfactory.NewAgentAddonFactory(AddonName, FS, "manifests/managedclusterchart").
 		WithConfigGVRs(utils.AddOnDeploymentConfigGVR).
-		WithGetValuesFuncs(
-			getValuesFromAnnotations(clusterInformer.Lister()),
-			addonfactory.GetValuesFromAddonAnnotation,
-			addonfactory.GetAddOnDeploymentConfigValues(
-				utils.NewAddOnDeploymentConfigGetter(addonClient),
-				addonfactory.ToAddOnNodePlacementValues,
-				addonfactory.ToAddOnResourceRequirementsValues,
-				getValuesFromCustomizedVariableValues,
-			),
-			policyaddon.MandateValues,
-		).
+		WithGetValuesFuncs(getValuesFuncs(sizer, clusterInformer.Lister(),
+			resolver.GetValues(adcGetter, deploymentConfigToValuesFuncs...),
+		)...).
 		WithManagedClusterClient(clusterClient).
 		WithAgentRegistrationOption(registrationOption).
 		WithAgentInstallNamespace(
-			policyaddon.
-				CommonAgentInstallNamespaceFromDeploymentConfigFunc(utils.NewAddOnDeploymentConfigGetter(addonClient)),
+			resolver.AgentInstallNamespace(adcGetter,
+				policyaddon.CommonAgentInstallNamespaceFromDeploymentConfigFunc(adcGetter)),
 		).
 		WithScheme(policyaddon.Scheme).
 		WithAgentHostedModeEnabledOption().
@@ -192,7 +276,20 @@ func GetAgentAddon(ctx context.Context, controllerContext *controllercmd.Control
 }
 
 func GetAndAddAgent(
-	ctx context.Context, mgr addonmanager.AddonManager, controllerContext *controllercmd.ControllerContext,
+	ctx context.Context,
+	mgr addonmanager.AddonManager,
+	controllerContext *controllercmd.ControllerContext,
+	options policyaddon.AgentOptions,
 ) error {
-	return policyaddon.GetAndAddAgent(ctx, mgr, addonName, controllerContext, GetAgentAddon)
+	sizer, err := policyaddon.NewAgentSizer(ctx, mgr, controllerContext, AddonName, options.AutoSizingConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed getting the %v agent sizer: %w", AddonName, err)
+	}
+
+	return policyaddon.GetAndAddAgent(ctx, mgr, AddonName, controllerContext, options,
+		func(ctx context.Context, controllerContext *controllercmd.ControllerContext) (agent.AgentAddon, error) {
+			return GetAgentAddon(ctx, controllerContext, sizer)
+		},
+		UninstallHook,
+	)
 }
@@ -51,3 +51,57 @@ Create the name of the service account to use
 {{- define "controller.serviceAccountName" -}}
     {{- template "controller.fullname" . -}}-sa
 {{- end -}}
+
+{{/*
+Get the Kubernetes version of the cluster the agent runs on, preferring the capabilities
+computed by the addon controller
+*/}}
+{{- define "controller.hostingKubeVersion" -}}
+    {{- .Values.hostingCapabilities.kubeVersion | default .Values.hostingClusterCapabilities.KubeVersion.Version | default .Capabilities.KubeVersion.Version -}}
+{{- end -}}
+
+{{/*
+Get the TLS mode of the metrics endpoint, which is set by the addon controller. It defaults to the
+OpenShift service serving certificates on OpenShift and to plain HTTP otherwise.
+*/}}
+{{- define "controller.metricsTLSMode" -}}
+    {{- .Values.prometheus.tls.mode | default (ternary "OpenShift" "None" (eq .Values.hostingKubernetesDistribution "OpenShift")) -}}
+{{- end -}}
+
+{{/*
+Get whether the metrics certificate is in a Secret mounted in the agent pod, which is not the case in
+the SelfSigned mode since the agent generates its certificate in memory.
+*/}}
+{{- define "controller.metricsCertSecret" -}}
+    {{- if has (include "controller.metricsTLSMode" .) (list "OpenShift" "CertManager") -}}
+        true
+    {{- end -}}
+{{- end -}}
+
+{{/*
+Get the image of the agent from the imageOverrides key passed as the second argument. The
+override for the architecture, like <key>_arm64, is used when all the nodes of the cluster the
+agent runs on are of that architecture.
+*/}}
+{{- define "controller.image" -}}
+    {{- $values := (index . 0).Values -}}
+    {{- $key := index . 1 -}}
+    {{- $image := index $values.global.imageOverrides $key -}}
+    {{- $archs := $values.hostingCapabilities.architectures | default list -}}
+    {{- if eq (len $archs) 1 -}}
+        {{- $image = index $values.global.imageOverrides (printf "%s_%s" $key (first $archs)) | default $image -}}
+    {{- end -}}
+    {{- $image -}}
+{{- end -}}
+
+{{/*
+Get the log level of the libraries used by the agent, the klog verbosity. Unless it's set, it's 2
+less than the log level, and at least 0.
+*/}}
+{{- define "controller.pkgLogLevel" -}}
+    {{- if kindIs "invalid" .Values.pkgLogLevel -}}
+        {{- max (sub (int .Values.logLevel) 2) 0 -}}
+    {{- else -}}
+        {{- .Values.pkgLogLevel -}}
+    {{- end -}}
+{{- end -}}
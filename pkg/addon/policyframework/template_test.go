@@ -0,0 +1,117 @@
+package policyframework
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"open-cluster-management.io/addon-framework/pkg/addonfactory"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+
+	policyaddon "open-cluster-management.io/governance-policy-addon-controller/pkg/addon"
+)
+
+func TestExportAddOnTemplate(t *testing.T) {
+	tests := map[string]struct {
+		values addonfactory.Values
+		// jobArgs are the arguments of the uninstall Job, or nil when no Job is expected
+		jobArgs []string
+	}{
+		"managed cluster": {
+			values: addonfactory.Values{},
+			jobArgs: []string{
+				"trigger-uninstall",
+				"--deployment-name=governance-policy-framework",
+				"--deployment-namespace={{INSTALL_NAMESPACE}}",
+				"--policy-namespace={{CLUSTER_NAME}}",
+			},
+		},
+		"on the hub without syncing the policies": {
+			values: addonfactory.Values{"onMulticlusterHub": "true"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			objects, err := policyaddon.ExportAddOnTemplate(TemplateSource, "v1.30.0", test.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var template *addonapiv1alpha1.AddOnTemplate
+
+			for _, obj := range objects {
+				if addonTemplate, ok := obj.(*addonapiv1alpha1.AddOnTemplate); ok {
+					template = addonTemplate
+				}
+			}
+
+			if template == nil {
+				t.Fatal("expected an AddOnTemplate to be exported")
+			}
+
+			hubPermissions := template.Spec.Registration[0].KubeClient.HubPermissions
+			if len(hubPermissions) != 1 ||
+				hubPermissions[0].CurrentCluster.ClusterRoleName != "open-cluster-management:policy-framework-hub" {
+				t.Fatalf("unexpected hub permissions: %+v", hubPermissions)
+			}
+
+			var deployment *appsv1.Deployment
+
+			var job *batchv1.Job
+
+			for _, manifest := range template.Spec.AgentSpec.Workload.Manifests {
+				typeMeta := &metav1.TypeMeta{}
+				if err := json.Unmarshal(manifest.Raw, typeMeta); err != nil {
+					t.Fatal(err)
+				}
+
+				switch typeMeta.Kind {
+				case "Deployment":
+					deployment = &appsv1.Deployment{}
+					if err := json.Unmarshal(manifest.Raw, deployment); err != nil {
+						t.Fatal(err)
+					}
+				case "Job":
+					job = &batchv1.Job{}
+					if err := json.Unmarshal(manifest.Raw, job); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			if deployment == nil || deployment.Namespace != "{{INSTALL_NAMESPACE}}" {
+				t.Fatalf("expected the agent in the install namespace variable, got %v", deployment)
+			}
+
+			args := deployment.Spec.Template.Spec.Containers[0].Args
+			if !slices.Contains(args, "--cluster-namespace={{CLUSTER_NAME}}") {
+				t.Fatalf("expected the agent to sync the policies of the cluster namespace, got %v", args)
+			}
+
+			if test.jobArgs == nil {
+				if job != nil {
+					t.Fatalf("expected no uninstall Job, got %+v", job)
+				}
+
+				return
+			}
+
+			if job == nil {
+				t.Fatal("expected the AddOnTemplate to include the uninstall Job")
+			}
+
+			if _, ok := job.Annotations[addonapiv1alpha1.AddonPreDeleteHookAnnotationKey]; !ok {
+				t.Fatalf("expected the uninstall Job to be a pre-delete hook, got the annotations %v", job.Annotations)
+			}
+
+			if jobArgs := job.Spec.Template.Spec.Containers[0].Args; !reflect.DeepEqual(jobArgs, test.jobArgs) {
+				t.Fatalf("expected the uninstall Job arguments %v, got %v", test.jobArgs, jobArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package addon
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	LivenessProbeAnnotation          = "liveness-probe"
+	ReadinessProbeAnnotation         = "readiness-probe"
+	StartupProbeAnnotation           = "startup-probe"
+	ProbeInitialDelayAnnotation      = "probe-initial-delay-seconds"
+	TerminationGracePeriodAnnotation = "termination-grace-period-seconds"
+)
+
+// ProbesConfig contains the probe configuration values of the controller container for the addon
+// chart. Unset values keep the chart defaults.
+type ProbesConfig struct {
+	Liveness  *ProbeConfig `json:"liveness,omitempty"`
+	Readiness *ProbeConfig `json:"readiness,omitempty"`
+	Startup   *ProbeConfig `json:"startup,omitempty"`
+	// InitialDelaySeconds is the initial delay of the liveness and readiness probes on clusters that
+	// don't support startup probes.
+	InitialDelaySeconds *int32 `json:"initialDelaySeconds,omitempty"`
+}
+
+// ProbeConfig contains the configuration values of a probe for the addon chart.
+type ProbeConfig struct {
+	FailureThreshold *int32 `json:"failureThreshold,omitempty"`
+	PeriodSeconds    *int32 `json:"periodSeconds,omitempty"`
+	TimeoutSeconds   *int32 `json:"timeoutSeconds,omitempty"`
+}
+
+// parseProbeSeconds parses a probe or grace period setting, which must be an integer of at least
+// the minimum.
+func parseProbeSeconds(name string, value string, minimum int64) (int32, error) {
+	parsed, err := strconv.ParseInt(strings.TrimSpace(value), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s value '%s': %w", name, value, err)
+	}
+
+	if parsed < minimum {
+		return 0, fmt.Errorf("failed to parse %s value '%s': it must be at least %d", name, value, minimum)
+	}
+
+	// This is safe because we specified the int32 in ParseInt
+	return int32(parsed), nil
+}
+
+// ParseProbeConfig parses a probe setting, like "failureThreshold=60,periodSeconds=10". The
+// settings that are not listed keep the chart defaults.
+func ParseProbeConfig(value string) (*ProbeConfig, error) {
+	probe := &ProbeConfig{}
+
+	for _, field := range strings.Split(value, ",") {
+		key, fieldValue, found := strings.Cut(strings.TrimSpace(field), "=")
+		if !found {
+			return nil, fmt.Errorf("invalid probe setting '%s', expected a key=value pair", field)
+		}
+
+		var target **int32
+
+		switch key {
+		case "failureThreshold":
+			target = &probe.FailureThreshold
+		case "periodSeconds":
+			target = &probe.PeriodSeconds
+		case "timeoutSeconds":
+			target = &probe.TimeoutSeconds
+		default:
+			return nil, fmt.Errorf("unknown probe setting '%s'", key)
+		}
+
+		parsed, err := parseProbeSeconds(key, fieldValue, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		*target = &parsed
+	}
+
+	return probe, nil
+}
+
+// probes returns the probe values, initializing them if needed.
+func (cv *CommonValues) probes() *ProbesConfig {
+	if cv.Probes == nil {
+		cv.Probes = &ProbesConfig{}
+	}
+
+	return cv.Probes
+}
+
+// SetLivenessProbe sets the liveness probe settings for the addon.
+func (cv *CommonValues) SetLivenessProbe(value string) error {
+	probe, err := ParseProbeConfig(value)
+	if err != nil {
+		return fmt.Errorf("failed to set the liveness probe (falling back to the chart defaults): %w", err)
+	}
+
+	cv.probes().Liveness = probe
+
+	return nil
+}
+
+// SetReadinessProbe sets the readiness probe settings for the addon.
+func (cv *CommonValues) SetReadinessProbe(value string) error {
+	probe, err := ParseProbeConfig(value)
+	if err != nil {
+		return fmt.Errorf("failed to set the readiness probe (falling back to the chart defaults): %w", err)
+	}
+
+	cv.probes().Readiness = probe
+
+	return nil
+}
+
+// SetStartupProbe sets the startup probe settings for the addon.
+func (cv *CommonValues) SetStartupProbe(value string) error {
+	probe, err := ParseProbeConfig(value)
+	if err != nil {
+		return fmt.Errorf("failed to set the startup probe (falling back to the chart defaults): %w", err)
+	}
+
+	cv.probes().Startup = probe
+
+	return nil
+}
+
+// SetProbeInitialDelay sets the initial delay of the liveness and readiness probes for the addon,
+// which applies on clusters that don't support startup probes.
+func (cv *CommonValues) SetProbeInitialDelay(value string) error {
+	delay, err := parseProbeSeconds("probe initial delay", value, 0)
+	if err != nil {
+		return fmt.Errorf("%w (falling back to the chart default)", err)
+	}
+
+	cv.probes().InitialDelaySeconds = &delay
+
+	return nil
+}
+
+// SetTerminationGracePeriod sets the termination grace period of the agent pod for the addon.
+func (cv *CommonValues) SetTerminationGracePeriod(value string) error {
+	gracePeriod, err := parseProbeSeconds("termination grace period", value, 0)
+	if err != nil {
+		return fmt.Errorf("%w (falling back to the chart default)", err)
+	}
+
+	cv.TerminationGracePeriodSeconds = &gracePeriod
+
+	return nil
+}
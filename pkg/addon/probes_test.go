@@ -0,0 +1,108 @@
+package addon
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/utils/ptr"
+)
+
+func TestParseProbeConfig(t *testing.T) {
+	tests := map[string]struct {
+		value    string
+		expected *ProbeConfig
+	}{
+		"all settings": {
+			value: "failureThreshold=60,periodSeconds=10,timeoutSeconds=3",
+			expected: &ProbeConfig{
+				FailureThreshold: ptr.To[int32](60),
+				PeriodSeconds:    ptr.To[int32](10),
+				TimeoutSeconds:   ptr.To[int32](3),
+			},
+		},
+		"single setting": {
+			value:    "periodSeconds=30",
+			expected: &ProbeConfig{PeriodSeconds: ptr.To[int32](30)},
+		},
+		"spaces": {
+			value:    " failureThreshold=6 , timeoutSeconds= 5 ",
+			expected: &ProbeConfig{FailureThreshold: ptr.To[int32](6), TimeoutSeconds: ptr.To[int32](5)},
+		},
+		"last setting wins": {
+			value:    "periodSeconds=10,periodSeconds=20",
+			expected: &ProbeConfig{PeriodSeconds: ptr.To[int32](20)},
+		},
+		"empty":                {value: ""},
+		"zero":                 {value: "periodSeconds=0"},
+		"negative":             {value: "failureThreshold=-1"},
+		"not an integer":       {value: "timeoutSeconds=5s"},
+		"above int32":          {value: "periodSeconds=2147483648"},
+		"unknown setting":      {value: "initialDelaySeconds=10"},
+		"not a key=value pair": {value: "periodSeconds=10,20"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			probe, err := ParseProbeConfig(test.value)
+
+			if test.expected == nil {
+				if err == nil {
+					t.Fatalf("expected %q to be invalid, got %+v", test.value, probe)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(probe, test.expected) {
+				t.Fatalf("expected the probe %+v, got %+v", test.expected, probe)
+			}
+		})
+	}
+}
+
+func TestSetProbeSeconds(t *testing.T) {
+	tests := map[string]struct {
+		value       string
+		gracePeriod *int32
+		delay       *int32
+	}{
+		"positive":       {value: "60", gracePeriod: ptr.To[int32](60), delay: ptr.To[int32](60)},
+		"zero":           {value: "0", gracePeriod: ptr.To[int32](0), delay: ptr.To[int32](0)},
+		"negative":       {value: "-1"},
+		"not an integer": {value: "1m"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			values := &CommonValues{}
+
+			err := values.SetTerminationGracePeriod(test.value)
+			if (err != nil) != (test.gracePeriod == nil) {
+				t.Fatalf("unexpected termination grace period error: %v", err)
+			}
+
+			if !reflect.DeepEqual(values.TerminationGracePeriodSeconds, test.gracePeriod) {
+				t.Fatalf("expected the termination grace period %v, got %v",
+					test.gracePeriod, values.TerminationGracePeriodSeconds)
+			}
+
+			err = values.SetProbeInitialDelay(test.value)
+			if (err != nil) != (test.delay == nil) {
+				t.Fatalf("unexpected probe initial delay error: %v", err)
+			}
+
+			var delay *int32
+			if values.Probes != nil {
+				delay = values.Probes.InitialDelaySeconds
+			}
+
+			if !reflect.DeepEqual(delay, test.delay) {
+				t.Fatalf("expected the probe initial delay %v, got %v", test.delay, delay)
+			}
+		})
+	}
+}
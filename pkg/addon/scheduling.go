@@ -0,0 +1,155 @@
+package addon
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	"sigs.k8s.io/yaml"
+)
+
+// Tolerations modes, for how the AddOnDeploymentConfig tolerations combine with the chart defaults
+const (
+	TolerationsModeReplace = "Replace"
+	TolerationsModeAppend  = "Append"
+)
+
+// SchedulingValues contains pod scheduling values for the addon chart.
+type SchedulingValues struct {
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// Tolerations replace the chart default tolerations when they are set, even to an empty list.
+	Tolerations *[]corev1.Toleration `json:"tolerations,omitempty"`
+	// ExtraTolerations are added to the chart default tolerations.
+	ExtraTolerations          []corev1.Toleration               `json:"extraTolerations,omitempty"`
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+}
+
+// validateTolerations verifies the tolerations, since they are not validated by the
+// AddOnDeploymentConfig API.
+func validateTolerations(tolerations []corev1.Toleration) error {
+	for _, toleration := range tolerations {
+		switch toleration.Operator {
+		case corev1.TolerationOpExists:
+			if toleration.Value != "" {
+				return fmt.Errorf("invalid toleration for key '%s': the value must be empty with the Exists operator",
+					toleration.Key)
+			}
+		case corev1.TolerationOpEqual, "":
+			if toleration.Key == "" {
+				return errors.New("invalid toleration: the key is required unless the operator is Exists")
+			}
+		default:
+			return fmt.Errorf("invalid toleration operator '%s'", toleration.Operator)
+		}
+
+		if !slices.Contains([]corev1.TaintEffect{
+			"", corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute,
+		}, toleration.Effect) {
+			return fmt.Errorf("invalid toleration effect '%s'", toleration.Effect)
+		}
+
+		if toleration.TolerationSeconds != nil && toleration.Effect != corev1.TaintEffectNoExecute {
+			return fmt.Errorf("invalid toleration for key '%s': tolerationSeconds requires the NoExecute effect",
+				toleration.Key)
+		}
+	}
+
+	return nil
+}
+
+// SetAffinity sets the pod affinity of the addon from a JSON or YAML corev1.Affinity.
+func (cv *CommonValues) SetAffinity(value string) error {
+	affinity := &corev1.Affinity{}
+
+	if err := yaml.UnmarshalStrict([]byte(value), affinity); err != nil {
+		return fmt.Errorf("failed to parse the affinity (falling back to the chart default): %w", err)
+	}
+
+	if affinity.NodeAffinity != nil {
+		required := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+		if required != nil && len(required.NodeSelectorTerms) == 0 {
+			return errors.New("invalid affinity (falling back to the chart default): the required node affinity " +
+				"must have at least one node selector term")
+		}
+	}
+
+	cv.Affinity = affinity
+
+	return nil
+}
+
+// SetTopologySpreadConstraints sets the pod topology spread constraints of the addon from a JSON or
+// YAML list of corev1.TopologySpreadConstraint.
+func (cv *CommonValues) SetTopologySpreadConstraints(value string) error {
+	constraints := []corev1.TopologySpreadConstraint{}
+
+	if err := yaml.UnmarshalStrict([]byte(value), &constraints); err != nil {
+		return fmt.Errorf("failed to parse the topology spread constraints: %w", err)
+	}
+
+	for _, constraint := range constraints {
+		if constraint.MaxSkew < 1 {
+			return fmt.Errorf("invalid topology spread constraint for key '%s': maxSkew must be at least 1",
+				constraint.TopologyKey)
+		}
+
+		if constraint.TopologyKey == "" {
+			return errors.New("invalid topology spread constraint: the topologyKey is required")
+		}
+
+		if !slices.Contains([]corev1.UnsatisfiableConstraintAction{
+			corev1.DoNotSchedule, corev1.ScheduleAnyway,
+		}, constraint.WhenUnsatisfiable) {
+			return fmt.Errorf("invalid topology spread constraint for key '%s': whenUnsatisfiable must be %s or %s",
+				constraint.TopologyKey, corev1.DoNotSchedule, corev1.ScheduleAnyway)
+		}
+	}
+
+	cv.TopologySpreadConstraints = constraints
+
+	return nil
+}
+
+// setNodePlacement sets the node selector and tolerations of the addon from the node placement of
+// the AddOnDeploymentConfig. The tolerations replace the chart defaults, unless the tolerationsMode
+// is Append.
+func (cv *CommonValues) setNodePlacement(
+	nodePlacement *addonapiv1alpha1.NodePlacement, tolerationsMode string,
+) error {
+	if tolerationsMode != "" && tolerationsMode != TolerationsModeReplace && tolerationsMode != TolerationsModeAppend {
+		return fmt.Errorf("invalid tolerations mode '%s', expected %s or %s",
+			tolerationsMode, TolerationsModeReplace, TolerationsModeAppend)
+	}
+
+	if nodePlacement == nil {
+		return nil
+	}
+
+	if nodePlacement.NodeSelector != nil {
+		if cv.GlobalValues == nil {
+			cv.GlobalValues = &GlobalValues{}
+		}
+
+		cv.GlobalValues.NodeSelector = nodePlacement.NodeSelector
+	}
+
+	if err := validateTolerations(nodePlacement.Tolerations); err != nil {
+		return fmt.Errorf("%w (falling back to the chart default tolerations)", err)
+	}
+
+	switch {
+	case tolerationsMode == TolerationsModeAppend:
+		cv.ExtraTolerations = nodePlacement.Tolerations
+	case nodePlacement.Tolerations != nil || tolerationsMode == TolerationsModeReplace:
+		tolerations := slices.Clone(nodePlacement.Tolerations)
+		if tolerations == nil {
+			tolerations = []corev1.Toleration{}
+		}
+
+		cv.Tolerations = &tolerations
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package addon
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+)
+
+func TestValidateTolerations(t *testing.T) {
+	tests := map[string]struct {
+		toleration corev1.Toleration
+		valid      bool
+	}{
+		"equal": {
+			toleration: corev1.Toleration{
+				Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "infra",
+				Effect: corev1.TaintEffectNoSchedule,
+			},
+			valid: true,
+		},
+		"default operator": {
+			toleration: corev1.Toleration{Key: "dedicated", Value: "infra"},
+			valid:      true,
+		},
+		"exists without a key": {
+			toleration: corev1.Toleration{Operator: corev1.TolerationOpExists},
+			valid:      true,
+		},
+		"toleration seconds with NoExecute": {
+			toleration: corev1.Toleration{
+				Key: "node.kubernetes.io/unreachable", Operator: corev1.TolerationOpExists,
+				Effect: corev1.TaintEffectNoExecute, TolerationSeconds: ptr.To[int64](300),
+			},
+			valid: true,
+		},
+		"exists with a value": {
+			toleration: corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpExists, Value: "infra"},
+		},
+		"equal without a key": {
+			toleration: corev1.Toleration{Operator: corev1.TolerationOpEqual, Value: "infra"},
+		},
+		"unknown operator": {
+			toleration: corev1.Toleration{Key: "dedicated", Operator: "In"},
+		},
+		"unknown effect": {
+			toleration: corev1.Toleration{Key: "dedicated", Effect: "NoRun"},
+		},
+		"toleration seconds without NoExecute": {
+			toleration: corev1.Toleration{
+				Key: "dedicated", Effect: corev1.TaintEffectNoSchedule, TolerationSeconds: ptr.To[int64](300),
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validateTolerations([]corev1.Toleration{test.toleration})
+			if test.valid && err != nil {
+				t.Fatal(err)
+			}
+
+			if !test.valid && err == nil {
+				t.Fatalf("expected the toleration %+v to be invalid", test.toleration)
+			}
+		})
+	}
+}
+
+func TestSetNodePlacement(t *testing.T) {
+	toleration := corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpExists}
+
+	tests := map[string]struct {
+		nodePlacement    *addonapiv1alpha1.NodePlacement
+		mode             string
+		nodeSelector     map[string]string
+		tolerations      *[]corev1.Toleration
+		extraTolerations []corev1.Toleration
+		invalid          bool
+	}{
+		"no node placement": {},
+		"node selector only": {
+			nodePlacement: &addonapiv1alpha1.NodePlacement{NodeSelector: map[string]string{"infra": "true"}},
+			nodeSelector:  map[string]string{"infra": "true"},
+		},
+		"tolerations replace the defaults": {
+			nodePlacement: &addonapiv1alpha1.NodePlacement{Tolerations: []corev1.Toleration{toleration}},
+			tolerations:   &[]corev1.Toleration{toleration},
+		},
+		"explicit replace mode": {
+			nodePlacement: &addonapiv1alpha1.NodePlacement{Tolerations: []corev1.Toleration{toleration}},
+			mode:          TolerationsModeReplace,
+			tolerations:   &[]corev1.Toleration{toleration},
+		},
+		"replace mode without tolerations removes the defaults": {
+			nodePlacement: &addonapiv1alpha1.NodePlacement{NodeSelector: map[string]string{"infra": "true"}},
+			mode:          TolerationsModeReplace,
+			nodeSelector:  map[string]string{"infra": "true"},
+			tolerations:   &[]corev1.Toleration{},
+		},
+		"append mode": {
+			nodePlacement:    &addonapiv1alpha1.NodePlacement{Tolerations: []corev1.Toleration{toleration}},
+			mode:             TolerationsModeAppend,
+			extraTolerations: []corev1.Toleration{toleration},
+		},
+		"append mode without tolerations keeps the defaults": {
+			nodePlacement: &addonapiv1alpha1.NodePlacement{},
+			mode:          TolerationsModeAppend,
+		},
+		"invalid mode": {
+			nodePlacement: &addonapiv1alpha1.NodePlacement{Tolerations: []corev1.Toleration{toleration}},
+			mode:          "Merge",
+			invalid:       true,
+		},
+		"invalid tolerations keep the defaults": {
+			nodePlacement: &addonapiv1alpha1.NodePlacement{
+				NodeSelector: map[string]string{"infra": "true"},
+				Tolerations:  []corev1.Toleration{{Operator: corev1.TolerationOpEqual}},
+			},
+			nodeSelector: map[string]string{"infra": "true"},
+			invalid:      true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			values := &CommonValues{}
+
+			err := values.setNodePlacement(test.nodePlacement, test.mode)
+			if (err != nil) != test.invalid {
+				t.Fatalf("expected an error: %v, got %v", test.invalid, err)
+			}
+
+			var nodeSelector map[string]string
+			if values.GlobalValues != nil {
+				nodeSelector = values.GlobalValues.NodeSelector
+			}
+
+			if !reflect.DeepEqual(nodeSelector, test.nodeSelector) {
+				t.Fatalf("expected the node selector %v, got %v", test.nodeSelector, nodeSelector)
+			}
+
+			if !reflect.DeepEqual(values.Tolerations, test.tolerations) {
+				t.Fatalf("expected the tolerations %v, got %v", test.tolerations, values.Tolerations)
+			}
+
+			if !reflect.DeepEqual(values.ExtraTolerations, test.extraTolerations) {
+				t.Fatalf("expected the extra tolerations %v, got %v", test.extraTolerations, values.ExtraTolerations)
+			}
+		})
+	}
+}
+
+func TestSetTopologySpreadConstraints(t *testing.T) {
+	tests := map[string]struct {
+		value string
+		valid bool
+	}{
+		"valid": {
+			value: `[{"maxSkew": 1, "topologyKey": "topology.kubernetes.io/zone", ` +
+				`"whenUnsatisfiable": "ScheduleAnyway"}]`,
+			valid: true,
+		},
+		"empty list": {value: "[]", valid: true},
+		"zero maxSkew": {
+			value: `[{"maxSkew": 0, "topologyKey": "zone", "whenUnsatisfiable": "DoNotSchedule"}]`,
+		},
+		"missing topologyKey": {
+			value: `[{"maxSkew": 1, "whenUnsatisfiable": "DoNotSchedule"}]`,
+		},
+		"invalid whenUnsatisfiable": {
+			value: `[{"maxSkew": 1, "topologyKey": "zone", "whenUnsatisfiable": "Never"}]`,
+		},
+		"unknown field": {
+			value: `[{"maxSkew": 1, "topologyKey": "zone", "whenUnsatisfiable": "DoNotSchedule", "skew": 2}]`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			values := &CommonValues{}
+
+			err := values.SetTopologySpreadConstraints(test.value)
+			if test.valid && err != nil {
+				t.Fatal(err)
+			}
+
+			if !test.valid && (err == nil || values.TopologySpreadConstraints != nil) {
+				t.Fatalf("expected %s to be invalid, got %v", test.value, values.TopologySpreadConstraints)
+			}
+		})
+	}
+}
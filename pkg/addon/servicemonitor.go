@@ -0,0 +1,118 @@
+package addon
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	prometheusv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/prometheus/common/model"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	ServiceMonitorNamespaceAnnotation = "prometheus-service-monitor-namespace"
+	ScrapeIntervalAnnotation          = "prometheus-scrape-interval"
+	ServiceMonitorLabelsAnnotation    = "prometheus-service-monitor-labels"
+	RelabelingsAnnotation             = "prometheus-relabelings"
+)
+
+// chartLabels are the labels of the chart resources, which can't be overridden.
+var chartLabels = []string{
+	"app", "chart", "release", "heritage", "addon.open-cluster-management.io/hosted-manifest-location",
+}
+
+// relabelActions are the relabeling actions supported by the Prometheus Operator, in lower case.
+var relabelActions = []string{
+	"replace", "keep", "drop", "hashmod", "labelmap", "labeldrop", "labelkeep", "lowercase", "uppercase",
+	"keepequal", "dropequal",
+}
+
+// serviceMonitor returns the ServiceMonitor values, initializing them if needed.
+func (cv *CommonValues) serviceMonitor() *ServiceMonitor {
+	if cv.prometheus().ServiceMonitor == nil {
+		cv.prometheus().ServiceMonitor = &ServiceMonitor{}
+	}
+
+	return cv.prometheus().ServiceMonitor
+}
+
+// SetServiceMonitorNamespace sets the namespace of the metrics ServiceMonitor for the addon, for
+// example the namespace watched by a user workload Prometheus.
+func (cv *CommonValues) SetServiceMonitorNamespace(value string) error {
+	if errs := validation.IsDNS1123Label(value); len(errs) != 0 {
+		return fmt.Errorf("invalid ServiceMonitor namespace '%s' (falling back to the addon namespace): %s",
+			value, strings.Join(errs, ", "))
+	}
+
+	cv.serviceMonitor().Namespace = &value
+
+	return nil
+}
+
+// SetScrapeInterval sets the scrape interval of the metrics ServiceMonitor for the addon, as a
+// Prometheus duration like "1m".
+func (cv *CommonValues) SetScrapeInterval(value string) error {
+	interval, err := model.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("failed to parse the scrape interval '%s' (falling back to the chart default): %w",
+			value, err)
+	}
+
+	if interval == 0 {
+		return errors.New("invalid scrape interval (falling back to the chart default): it must be positive")
+	}
+
+	cv.serviceMonitor().Interval = prometheusv1.Duration(value)
+
+	return nil
+}
+
+// SetServiceMonitorLabels sets additional labels on the metrics ServiceMonitor for the addon, so that
+// it matches the ServiceMonitor selector of a Prometheus, from a comma separated list of key=value
+// pairs.
+func (cv *CommonValues) SetServiceMonitorLabels(value string) error {
+	serviceMonitorLabels, err := labels.ConvertSelectorToLabelsMap(value)
+	if err != nil {
+		return fmt.Errorf("failed to parse the ServiceMonitor labels '%s': %w", value, err)
+	}
+
+	for key := range serviceMonitorLabels {
+		if slices.Contains(chartLabels, key) {
+			return fmt.Errorf("invalid ServiceMonitor label '%s': it's set by the chart", key)
+		}
+	}
+
+	cv.serviceMonitor().Labels = serviceMonitorLabels
+
+	return nil
+}
+
+// SetRelabelings sets the relabelings of the metrics ServiceMonitor endpoint for the addon, from a
+// JSON or YAML list of Prometheus Operator RelabelConfig.
+func (cv *CommonValues) SetRelabelings(value string) error {
+	relabelings := []prometheusv1.RelabelConfig{}
+
+	if err := yaml.UnmarshalStrict([]byte(value), &relabelings); err != nil {
+		return fmt.Errorf("failed to parse the relabelings: %w", err)
+	}
+
+	for _, relabeling := range relabelings {
+		action := strings.ToLower(relabeling.Action)
+		if action != "" && !slices.Contains(relabelActions, action) {
+			return fmt.Errorf("invalid relabeling action '%s'", relabeling.Action)
+		}
+
+		if _, err := regexp.Compile(relabeling.Regex); err != nil {
+			return fmt.Errorf("invalid relabeling regex '%s': %w", relabeling.Regex, err)
+		}
+	}
+
+	cv.serviceMonitor().Relabelings = relabelings
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package addon
+
+import (
+	"reflect"
+	"testing"
+
+	prometheusv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestSetServiceMonitorNamespaceAndInterval(t *testing.T) {
+	tests := map[string]struct {
+		namespace         string
+		interval          string
+		expectedNamespace *string
+		expectedInterval  prometheusv1.Duration
+	}{
+		"valid": {
+			namespace:         "monitoring",
+			interval:          "1m",
+			expectedNamespace: ptr.To("monitoring"),
+			expectedInterval:  "1m",
+		},
+		"compound interval": {
+			namespace:         "user-workload",
+			interval:          "1m30s",
+			expectedNamespace: ptr.To("user-workload"),
+			expectedInterval:  "1m30s",
+		},
+		"invalid namespace": {namespace: "Monitoring", interval: "30s", expectedInterval: "30s"},
+		"zero interval":     {namespace: "monitoring", interval: "0s", expectedNamespace: ptr.To("monitoring")},
+		"Go duration":       {namespace: "monitoring", interval: "1m0.5s", expectedNamespace: ptr.To("monitoring")},
+		"interval in days": {
+			namespace:         "monitoring",
+			interval:          "1d",
+			expectedNamespace: ptr.To("monitoring"),
+			expectedInterval:  "1d",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			values := &CommonValues{}
+
+			err := values.SetServiceMonitorNamespace(test.namespace)
+			if (err != nil) != (test.expectedNamespace == nil) {
+				t.Fatalf("unexpected namespace error: %v", err)
+			}
+
+			err = values.SetScrapeInterval(test.interval)
+			if (err != nil) != (test.expectedInterval == "") {
+				t.Fatalf("unexpected interval error: %v", err)
+			}
+
+			serviceMonitor := values.serviceMonitor()
+
+			if !reflect.DeepEqual(serviceMonitor.Namespace, test.expectedNamespace) {
+				t.Fatalf("expected the namespace %v, got %v", test.expectedNamespace, serviceMonitor.Namespace)
+			}
+
+			if serviceMonitor.Interval != test.expectedInterval {
+				t.Fatalf("expected the interval %s, got %s", test.expectedInterval, serviceMonitor.Interval)
+			}
+		})
+	}
+}
+
+func TestSetServiceMonitorLabels(t *testing.T) {
+	tests := map[string]struct {
+		value    string
+		expected map[string]string
+	}{
+		"single label": {
+			value:    "prometheus=user-workload",
+			expected: map[string]string{"prometheus": "user-workload"},
+		},
+		"several labels": {
+			value:    "prometheus=user-workload,team=policy",
+			expected: map[string]string{"prometheus": "user-workload", "team": "policy"},
+		},
+		"prefixed key": {
+			value:    "monitoring.example.com/scrape=true",
+			expected: map[string]string{"monitoring.example.com/scrape": "true"},
+		},
+		"chart label":          {value: "team=policy,app=other"},
+		"hosted location":      {value: "addon.open-cluster-management.io/hosted-manifest-location=none"},
+		"not a key=value pair": {value: "prometheus"},
+		"invalid value":        {value: "prometheus=user workload"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			values := &CommonValues{}
+
+			err := values.SetServiceMonitorLabels(test.value)
+
+			if test.expected == nil {
+				if err == nil || values.PrometheusConfig != nil {
+					t.Fatalf("expected %q to be invalid, got %+v", test.value, values.PrometheusConfig)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(values.serviceMonitor().Labels, test.expected) {
+				t.Fatalf("expected the labels %v, got %v", test.expected, values.serviceMonitor().Labels)
+			}
+		})
+	}
+}
+
+func TestSetRelabelings(t *testing.T) {
+	tests := map[string]struct {
+		value    string
+		expected []prometheusv1.RelabelConfig
+	}{
+		"YAML": {
+			value: `
+- sourceLabels: [__meta_kubernetes_pod_node_name]
+  targetLabel: node
+- action: labeldrop
+  regex: pod_template_hash
+`,
+			expected: []prometheusv1.RelabelConfig{
+				{SourceLabels: []prometheusv1.LabelName{"__meta_kubernetes_pod_node_name"}, TargetLabel: "node"},
+				{Action: "labeldrop", Regex: "pod_template_hash"},
+			},
+		},
+		"JSON": {
+			value: `[{"action": "replace", "targetLabel": "cluster", "replacement": "local"}]`,
+			expected: []prometheusv1.RelabelConfig{
+				{Action: "replace", TargetLabel: "cluster", Replacement: ptr.To("local")},
+			},
+		},
+		"upper case action": {
+			value: `[{"action": "Keep", "sourceLabels": [job], "regex": "policy-.*"}]`,
+			expected: []prometheusv1.RelabelConfig{
+				{Action: "Keep", SourceLabels: []prometheusv1.LabelName{"job"}, Regex: "policy-.*"},
+			},
+		},
+		"empty list":     {value: "[]", expected: []prometheusv1.RelabelConfig{}},
+		"unknown action": {value: `[{"action": "rename"}]`},
+		"invalid regex":  {value: `[{"action": "keep", "regex": "policy-("}]`},
+		"unknown field":  {value: `[{"action": "keep", "regexp": "policy-.*"}]`},
+		"not a list":     {value: `{"action": "keep"}`},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			values := &CommonValues{}
+
+			err := values.SetRelabelings(test.value)
+
+			if test.expected == nil {
+				if err == nil || values.PrometheusConfig != nil {
+					t.Fatalf("expected %s to be invalid, got %+v", test.value, values.PrometheusConfig)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(values.serviceMonitor().Relabelings, test.expected) {
+				t.Fatalf("expected the relabelings %+v, got %+v", test.expected, values.serviceMonitor().Relabelings)
+			}
+		})
+	}
+}
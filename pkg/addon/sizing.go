@@ -0,0 +1,295 @@
+package addon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/openshift/library-go/pkg/controller/controllercmd"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+	"open-cluster-management.io/addon-framework/pkg/addonfactory"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// allContainersRegex matches every container in the resourceRequirements chart values.
+const allContainersRegex = "^.+:.+:.+$"
+
+var policyGVR = schema.GroupVersionResource{
+	Group:    "policy.open-cluster-management.io",
+	Version:  "v1",
+	Resource: "policies",
+}
+
+// AutoSizingConfig lists the sizing tiers of each addon.
+type AutoSizingConfig struct {
+	// Addons maps addon names to their sizing tiers, ordered by increasing MaxPolicies.
+	Addons map[string][]SizingTier `json:"addons"`
+}
+
+// SizingTier is the agent sizing for clusters with up to MaxPolicies policy templates.
+type SizingTier struct {
+	// Name identifies the tier in the logs.
+	Name string `json:"name"`
+	// MaxPolicies is the largest number of policy templates in the cluster namespace for the tier.
+	// It may be omitted on the last tier, which also applies to clusters above every other tier.
+	MaxPolicies *int `json:"maxPolicies,omitempty"`
+	// EvaluationConcurrency is the evaluation concurrency of the agent, when set.
+	EvaluationConcurrency uint8 `json:"evaluationConcurrency,omitempty"`
+	// Resources are the resource requirements of the agent containers, when set.
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// ResourceRequirement sets the resources of the containers whose ID matches the regular
+// expression, in the global.resourceRequirements chart values.
+type ResourceRequirement struct {
+	ContainerIDRegex string                      `json:"containerIDRegex"` //nolint:tagliatelle
+	Resources        corev1.ResourceRequirements `json:"resources"`
+}
+
+// LoadAutoSizingConfig reads the auto-sizing configuration from the YAML or JSON file at path.
+func LoadAutoSizingConfig(path string) (*AutoSizingConfig, error) {
+	content, err := os.ReadFile(path) // #nosec G304 -- the path is configured by the administrator
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the auto-sizing configuration: %w", err)
+	}
+
+	config := &AutoSizingConfig{}
+
+	if err := yaml.UnmarshalStrict(content, config); err != nil {
+		return nil, fmt.Errorf("failed to parse the auto-sizing configuration %s: %w", path, err)
+	}
+
+	for addonName, tiers := range config.Addons {
+		for i, tier := range tiers {
+			if tier.MaxPolicies == nil {
+				if i != len(tiers)-1 {
+					return nil, fmt.Errorf("only the last %s sizing tier may omit maxPolicies", addonName)
+				}
+
+				continue
+			}
+
+			if i > 0 && tiers[i-1].MaxPolicies != nil && *tiers[i-1].MaxPolicies >= *tier.MaxPolicies {
+				return nil, fmt.Errorf("the %s sizing tiers must be ordered by increasing maxPolicies", addonName)
+			}
+		}
+	}
+
+	return config, nil
+}
+
+// AgentSizer picks the sizing tier of an addon agent from the number of policy templates in the
+// cluster namespace on the hub, and re-renders the addon when the tier of a cluster changes. The
+// number of policy templates of each namespace is kept up to date from the policy events, so the
+// policies aren't listed again on each event.
+type AgentSizer struct {
+	addonName    string
+	tiers        []SizingTier
+	policySynced cache.InformerSynced
+	manager      addonmanager.AddonManager
+
+	lock sync.Mutex
+	// templates is the number of policy templates of each policy, by namespace and name
+	templates map[string]int
+	// counts is the number of policy templates of each cluster namespace
+	counts map[string]int
+	// rendered is the tier index that was last rendered for each cluster namespace
+	rendered map[string]int
+}
+
+// NewAgentSizer creates an AgentSizer for the addon from the auto-sizing configuration file at path,
+// which is set with the auto-sizing-config flag, and starts watching the policies. It returns nil
+// when auto-sizing isn't configured for the addon.
+func NewAgentSizer(
+	ctx context.Context,
+	mgr addonmanager.AddonManager,
+	controllerContext *controllercmd.ControllerContext,
+	addonName string,
+	path string,
+) (*AgentSizer, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	config, err := LoadAutoSizingConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tiers := config.Addons[addonName]
+	if len(tiers) == 0 {
+		return nil, nil
+	}
+
+	hubInformers, err := GetHubInformers(controllerContext)
+	if err != nil {
+		return nil, err
+	}
+
+	policyInformer := hubInformers.Dynamic.ForResource(policyGVR).Informer()
+
+	sizer := &AgentSizer{
+		addonName: addonName,
+		tiers:     tiers,
+		manager:   mgr,
+		templates: map[string]int{},
+		counts:    map[string]int{},
+		rendered:  map[string]int{},
+	}
+
+	registration, err := policyInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    sizer.onPolicyAdd,
+		UpdateFunc: sizer.onPolicyUpdate,
+		DeleteFunc: sizer.onPolicyDelete,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add the Policy event handler: %w", err)
+	}
+
+	// The counts are complete once the handler received the initial policies
+	sizer.policySynced = registration.HasSynced
+
+	hubInformers.Start(ctx)
+
+	return sizer, nil
+}
+
+// tier returns the index of the sizing tier for the number of policy templates.
+func (s *AgentSizer) tier(count int) int {
+	for i, tier := range s.tiers {
+		if tier.MaxPolicies == nil || count <= *tier.MaxPolicies {
+			return i
+		}
+	}
+
+	return len(s.tiers) - 1
+}
+
+func (s *AgentSizer) onPolicyAdd(obj interface{}) {
+	if policy, ok := obj.(*unstructured.Unstructured); ok {
+		templates, _, _ := unstructured.NestedSlice(policy.Object, "spec", "policy-templates")
+		s.setPolicyTemplates(policy.GetNamespace(), policy.GetName(), len(templates))
+	}
+}
+
+// onPolicyUpdate counts the policy templates again when the spec of the policy changed, which
+// excludes the status updates and resyncs.
+func (s *AgentSizer) onPolicyUpdate(oldObj, newObj interface{}) {
+	oldPolicy, ok := oldObj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	newPolicy, ok := newObj.(*unstructured.Unstructured)
+	if !ok || newPolicy.GetGeneration() != 0 && newPolicy.GetGeneration() == oldPolicy.GetGeneration() {
+		return
+	}
+
+	s.onPolicyAdd(newPolicy)
+}
+
+func (s *AgentSizer) onPolicyDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	if policy, ok := obj.(*unstructured.Unstructured); ok {
+		s.setPolicyTemplates(policy.GetNamespace(), policy.GetName(), -1)
+	}
+}
+
+// setPolicyTemplates updates the number of policy templates of the policy, removing the policy when
+// the number is negative, and re-renders the addon of the cluster namespace of the policy when its
+// sizing tier changed since it was last rendered.
+func (s *AgentSizer) setPolicyTemplates(namespace, name string, templates int) {
+	key := namespace + "/" + name
+
+	s.lock.Lock()
+
+	previous, existed := s.templates[key]
+	if templates < 0 {
+		delete(s.templates, key)
+
+		templates = 0
+	} else {
+		s.templates[key] = templates
+	}
+
+	if existed && previous == templates {
+		s.lock.Unlock()
+
+		return
+	}
+
+	count := s.counts[namespace] - previous + templates
+	if count == 0 {
+		delete(s.counts, namespace)
+	} else {
+		s.counts[namespace] = count
+	}
+
+	rendered, ok := s.rendered[namespace]
+	changed := ok && rendered != s.tier(count)
+
+	s.lock.Unlock()
+
+	if changed {
+		log.V(2).Info("Triggering addon after a sizing tier change",
+			"cluster", namespace, "addon", s.addonName, "policyTemplates", count)
+
+		s.manager.Trigger(namespace, s.addonName)
+	}
+}
+
+// GetValues returns the evaluation concurrency and resource requirements chart values of the
+// sizing tier of the cluster. It should be the first values function so that the annotations and
+// the AddOnDeploymentConfig take precedence. Since lists are replaced when the values are merged,
+// any resource requirements of the AddOnDeploymentConfig replace the tier resources of every
+// container, and the containers they don't match get no resource requirements. A nil AgentSizer returns no values.
+func (s *AgentSizer) GetValues(
+	_ *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn,
+) (addonfactory.Values, error) {
+	if s == nil {
+		return addonfactory.Values{}, nil
+	}
+
+	// Don't size the agent down while the policies are still being listed
+	if !s.policySynced() {
+		return nil, errors.New("the policies are not synced yet for the agent sizing")
+	}
+
+	// The tier is recorded with the count it's picked from, so a policy event can't be missed between them
+	s.lock.Lock()
+	count := s.counts[addon.Namespace]
+	index := s.tier(count)
+	s.rendered[addon.Namespace] = index
+	s.lock.Unlock()
+
+	tier := s.tiers[index]
+
+	log.V(2).Info("Selected the agent sizing tier", "cluster", addon.Namespace, "addon", s.addonName,
+		"tier", tier.Name, "policyTemplates", count)
+
+	values := CommonValues{}
+	values.UserArgs.EvaluationConcurrency = tier.EvaluationConcurrency
+	values.SetClientBurstFromEvaluationConcurrency()
+
+	if tier.Resources != nil {
+		values.GlobalValues = &GlobalValues{
+			ResourceRequirements: []ResourceRequirement{{
+				ContainerIDRegex: allContainersRegex,
+				Resources:        *tier.Resources,
+			}},
+		}
+	}
+
+	return addonfactory.JsonStructToValues(values)
+}
@@ -0,0 +1,409 @@
+package addon
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+	"open-cluster-management.io/addon-framework/pkg/addonfactory"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+)
+
+func TestLoadAutoSizingConfig(t *testing.T) {
+	tests := map[string]struct {
+		content  string
+		expected *AutoSizingConfig
+	}{
+		"tiers": {
+			content: `
+addons:
+  config-policy-controller:
+  - name: small
+    maxPolicies: 50
+    evaluationConcurrency: 1
+  - name: large
+    evaluationConcurrency: 5
+    resources:
+      limits:
+        memory: 2Gi
+`,
+			expected: &AutoSizingConfig{Addons: map[string][]SizingTier{
+				"config-policy-controller": {
+					{Name: "small", MaxPolicies: ptr.To(50), EvaluationConcurrency: 1},
+					{Name: "large", EvaluationConcurrency: 5, Resources: &corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("2Gi")},
+					}},
+				},
+			}},
+		},
+		"JSON": {
+			content: `{"addons": {"governance-policy-framework": [{"name": "all", "evaluationConcurrency": 2}]}}`,
+			expected: &AutoSizingConfig{Addons: map[string][]SizingTier{
+				"governance-policy-framework": {{Name: "all", EvaluationConcurrency: 2}},
+			}},
+		},
+		"unknown field": {
+			content: `
+addons:
+  config-policy-controller:
+  - name: small
+    maxPolicy: 50
+`,
+		},
+		"maxPolicies omitted before the last tier": {
+			content: `
+addons:
+  config-policy-controller:
+  - name: small
+  - name: large
+    maxPolicies: 1000
+`,
+		},
+		"unordered tiers": {
+			content: `
+addons:
+  config-policy-controller:
+  - name: medium
+    maxPolicies: 1000
+  - name: small
+    maxPolicies: 50
+`,
+		},
+		"duplicate maxPolicies": {
+			content: `
+addons:
+  config-policy-controller:
+  - name: small
+    maxPolicies: 50
+  - name: other
+    maxPolicies: 50
+`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "sizing.yaml")
+
+			if err := os.WriteFile(path, []byte(test.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			config, err := LoadAutoSizingConfig(path)
+
+			if test.expected == nil {
+				if err == nil {
+					t.Fatalf("expected the configuration to be invalid, got %+v", config)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(config, test.expected) {
+				t.Fatalf("expected the configuration %+v, got %+v", test.expected, config)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := LoadAutoSizingConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+			t.Fatal("expected an error for a missing file")
+		}
+	})
+}
+
+// newTestPolicy returns a Policy in the namespace with the number of policy templates.
+func newTestPolicy(namespace, name string, templates int) *unstructured.Unstructured {
+	policyTemplates := make([]interface{}, 0, templates)
+	for range templates {
+		policyTemplates = append(policyTemplates, map[string]interface{}{})
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "policy.open-cluster-management.io/v1",
+		"kind":       "Policy",
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+		"spec":       map[string]interface{}{"policy-templates": policyTemplates},
+	}}
+}
+
+// newTestSizer returns an AgentSizer with the small, medium and large tiers of the README, which
+// received the policies.
+func newTestSizer(t *testing.T, synced bool, policies ...*unstructured.Unstructured) *AgentSizer {
+	t.Helper()
+
+	sizer := &AgentSizer{
+		addonName: "config-policy-controller",
+		tiers: []SizingTier{
+			{Name: "small", MaxPolicies: ptr.To(50), EvaluationConcurrency: 1},
+			{Name: "medium", MaxPolicies: ptr.To(1000), EvaluationConcurrency: 2},
+			{Name: "large", EvaluationConcurrency: 5, Resources: &corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("2Gi")},
+			}},
+		},
+		policySynced: func() bool { return synced },
+		manager:      &fakeManager{},
+		templates:    map[string]int{},
+		counts:       map[string]int{},
+		rendered:     map[string]int{},
+	}
+
+	for _, policy := range policies {
+		sizer.onPolicyAdd(policy)
+	}
+
+	return sizer
+}
+
+func TestAgentSizerGetValues(t *testing.T) {
+	tests := map[string]struct {
+		policies    []*unstructured.Unstructured
+		tier        int
+		concurrency uint8
+		resources   bool
+	}{
+		"no policies": {
+			tier:        0,
+			concurrency: 1,
+		},
+		"at the tier maximum": {
+			policies: []*unstructured.Unstructured{
+				newTestPolicy("cluster1", "policy1", 30),
+				newTestPolicy("cluster1", "policy2", 20),
+			},
+			tier:        0,
+			concurrency: 1,
+		},
+		"above the tier maximum": {
+			policies: []*unstructured.Unstructured{
+				newTestPolicy("cluster1", "policy1", 30),
+				newTestPolicy("cluster1", "policy2", 21),
+			},
+			tier:        1,
+			concurrency: 2,
+		},
+		"policies of other clusters": {
+			policies: []*unstructured.Unstructured{
+				newTestPolicy("cluster1", "policy1", 10),
+				newTestPolicy("cluster2", "policy1", 2000),
+			},
+			tier:        0,
+			concurrency: 1,
+		},
+		"last tier without maxPolicies": {
+			policies:    []*unstructured.Unstructured{newTestPolicy("cluster1", "policy1", 1001)},
+			tier:        2,
+			concurrency: 5,
+			resources:   true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			sizer := newTestSizer(t, true, test.policies...)
+
+			addon := &addonapiv1alpha1.ManagedClusterAddOn{}
+			addon.SetName("config-policy-controller")
+			addon.SetNamespace("cluster1")
+
+			values, err := sizer.GetValues(nil, addon)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if sizer.rendered["cluster1"] != test.tier {
+				t.Fatalf("expected the tier %d to be rendered, got %d", test.tier, sizer.rendered["cluster1"])
+			}
+
+			if concurrency, _ := values["evaluationConcurrency"].(float64); uint8(concurrency) != test.concurrency {
+				t.Fatalf("expected the evaluation concurrency %d, got %v", test.concurrency, values)
+			}
+
+			if _, ok := values["global"]; ok != test.resources {
+				t.Fatalf("expected the resource requirements to be set: %v, got %v", test.resources, values)
+			}
+		})
+	}
+}
+
+func TestAgentSizerGetValuesNotSynced(t *testing.T) {
+	addon := &addonapiv1alpha1.ManagedClusterAddOn{}
+	addon.SetName("config-policy-controller")
+	addon.SetNamespace("cluster1")
+
+	if _, err := newTestSizer(t, false).GetValues(nil, addon); err == nil {
+		t.Fatal("expected an error while the policies are not synced")
+	}
+
+	// A nil AgentSizer doesn't size the agent
+	var sizer *AgentSizer
+
+	values, err := sizer.GetValues(nil, addon)
+	if err != nil || len(values) != 0 {
+		t.Fatalf("expected no values without auto-sizing, got %v, %v", values, err)
+	}
+}
+
+// TestAgentSizerPrecedence merges the values in the order of the addon values functions, where the
+// AgentSizer values come first, to check that the AddOnDeploymentConfig takes precedence.
+func TestAgentSizerPrecedence(t *testing.T) {
+	addon := &addonapiv1alpha1.ManagedClusterAddOn{}
+	addon.SetName("config-policy-controller")
+	addon.SetNamespace("cluster1")
+
+	sizerValues, err := newTestSizer(t, true, newTestPolicy("cluster1", "policy1", 2000)).GetValues(nil, addon)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := addonapiv1alpha1.AddOnDeploymentConfig{}
+	config.Spec.CustomizedVariables = []addonapiv1alpha1.CustomizedVariable{
+		{Name: "evaluationConcurrency", Value: "3"},
+	}
+	config.Spec.ResourceRequirements = []addonapiv1alpha1.ContainerResourceRequirements{{
+		ContainerID: "deployments:config-policy-controller:config-policy-controller",
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+		},
+	}}
+
+	resourceValues, err := addonfactory.ToAddOnResourceRequirementsValues(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commonValues := &CommonValues{}
+	if _, err := commonValues.SetCommonValuesFromCustomizedVariables(config); err != nil {
+		t.Fatal(err)
+	}
+
+	variableValues, err := addonfactory.JsonStructToValues(commonValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := addonfactory.MergeValues(sizerValues, addonfactory.MergeValues(resourceValues, variableValues))
+
+	if concurrency, _ := values["evaluationConcurrency"].(float64); concurrency != 3 {
+		t.Fatalf("expected the evaluation concurrency of the AddOnDeploymentConfig, got %v", values)
+	}
+
+	// The lists are replaced when merging, so the tier resources no longer apply to any container
+	global, _ := values["global"].(map[string]interface{})
+	requirements, _ := global["resourceRequirements"].([]interface{})
+
+	if len(requirements) != 1 {
+		t.Fatalf("expected only the resource requirements of the AddOnDeploymentConfig, got %v", requirements)
+	}
+
+	requirement, _ := requirements[0].(map[string]interface{})
+	if requirement["containerIDRegex"] == allContainersRegex {
+		t.Fatalf("expected the resource requirements of the AddOnDeploymentConfig, got %v", requirement)
+	}
+}
+
+func TestAgentSizerPolicyEvents(t *testing.T) {
+	withGeneration := func(policy *unstructured.Unstructured, generation int64) *unstructured.Unstructured {
+		policy.SetGeneration(generation)
+
+		return policy
+	}
+
+	policy1 := withGeneration(newTestPolicy("cluster1", "policy1", 30), 1)
+	policy2 := withGeneration(newTestPolicy("cluster1", "policy2", 20), 1)
+
+	tests := map[string]struct {
+		event     func(sizer *AgentSizer)
+		count     int
+		triggered bool
+	}{
+		"policy added below the tier maximum": {
+			event: func(sizer *AgentSizer) {
+				sizer.onPolicyAdd(newTestPolicy("cluster1", "policy3", 0))
+			},
+			count: 50,
+		},
+		"policy added above the tier maximum": {
+			event: func(sizer *AgentSizer) {
+				sizer.onPolicyAdd(newTestPolicy("cluster1", "policy3", 1))
+			},
+			count:     51,
+			triggered: true,
+		},
+		"policy of another cluster added": {
+			event: func(sizer *AgentSizer) {
+				sizer.onPolicyAdd(newTestPolicy("cluster2", "policy1", 2000))
+			},
+			count: 50,
+		},
+		"policy templates added": {
+			event: func(sizer *AgentSizer) {
+				sizer.onPolicyUpdate(policy1, withGeneration(newTestPolicy("cluster1", "policy1", 31), 2))
+			},
+			count:     51,
+			triggered: true,
+		},
+		"status update": {
+			event: func(sizer *AgentSizer) {
+				sizer.onPolicyUpdate(policy1, withGeneration(newTestPolicy("cluster1", "policy1", 31), 1))
+			},
+			count: 50,
+		},
+		"policy deleted": {
+			event: func(sizer *AgentSizer) {
+				sizer.onPolicyDelete(policy2)
+			},
+			count: 30,
+		},
+		"policy deleted after a missed watch event": {
+			event: func(sizer *AgentSizer) {
+				sizer.onPolicyDelete(cache.DeletedFinalStateUnknown{Key: "cluster1/policy2", Obj: policy2})
+			},
+			count: 30,
+		},
+		"unknown policy deleted": {
+			event: func(sizer *AgentSizer) {
+				sizer.onPolicyDelete(newTestPolicy("cluster1", "policy3", 10))
+			},
+			count: 50,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			sizer := newTestSizer(t, true, policy1, policy2)
+			manager := &fakeManager{}
+			sizer.manager = manager
+
+			addon := &addonapiv1alpha1.ManagedClusterAddOn{}
+			addon.SetName("config-policy-controller")
+			addon.SetNamespace("cluster1")
+
+			// The addon of the cluster was rendered in the small tier
+			if _, err := sizer.GetValues(nil, addon); err != nil {
+				t.Fatal(err)
+			}
+
+			test.event(sizer)
+
+			if count := sizer.counts["cluster1"]; count != test.count {
+				t.Fatalf("expected %d policy templates, got %d", test.count, count)
+			}
+
+			triggered := len(manager.getTriggered()) != 0
+			if triggered != test.triggered {
+				t.Fatalf("expected the addon to be triggered: %v, got %v", test.triggered, manager.getTriggered())
+			}
+		})
+	}
+}
@@ -6,22 +6,24 @@ import (
 	"fmt"
 
 	"github.com/openshift/library-go/pkg/controller/controllercmd"
-	"k8s.io/apimachinery/pkg/runtime"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"open-cluster-management.io/addon-framework/pkg/addonfactory"
 	"open-cluster-management.io/addon-framework/pkg/addonmanager"
 	"open-cluster-management.io/addon-framework/pkg/agent"
 	"open-cluster-management.io/addon-framework/pkg/utils"
 	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	addonv1alpha1client "open-cluster-management.io/api/client/addon/clientset/versioned"
+	addonlistersv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
 	clusterv1client "open-cluster-management.io/api/client/cluster/clientset/versioned"
+	clusterlistersv1 "open-cluster-management.io/api/client/cluster/listers/cluster/v1"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
 
 	policyaddon "open-cluster-management.io/governance-policy-addon-controller/pkg/addon"
 )
 
 const (
-	addonName       = "governance-standalone-hub-templating"
-	cfgpolAddonName = "config-policy-controller"
+	AddonName             = "governance-standalone-hub-templating"
+	configPolicyAddonName = "config-policy-controller"
 )
 
 // FS go:embed
@@ -31,27 +33,127 @@ const (
 //go:embed manifests/managedclusterchart/templates/_helpers.tpl
 var FS embed.FS
 
-var agentPermissionFiles = []string{
-	"manifests/hubpermissions/role.yaml",
-	"manifests/hubpermissions/rolebinding.yaml",
+var (
+	// AddOnMeta describes the addon in the ClusterManagementAddOn created by the controller.
+	AddOnMeta = addonapiv1alpha1.AddOnMeta{
+		DisplayName: "Governance Standalone Hub Templating",
+		Description: "Resolves the hub templates of the policies that are not distributed from the hub.",
+	}
+
+	agentPermissionFiles = []string{
+		"manifests/hubpermissions/role.yaml",
+		"manifests/hubpermissions/rolebinding.yaml",
+	}
+
+	// Dependencies are the addons that determine where the agent is installed. In hosted mode, the
+	// hub kubeconfig Secret must be in the namespace of the hosted config-policy-controller.
+	Dependencies = []policyaddon.AddonDependency{{
+		Consumer: AddonName,
+		Producer: configPolicyAddonName,
+		Changed:  policyaddon.PlacementChanged,
+	}}
+
+	// TemplateSource exports the governance-standalone-hub-templating as an AddOnTemplate.
+	TemplateSource = policyaddon.TemplateSource{
+		AddonName:       AddonName,
+		FS:              FS,
+		PermissionFiles: agentPermissionFiles,
+		UseClusterRole:  true,
+		GetValuesFuncs: func(
+			clusterLister clusterlistersv1.ManagedClusterLister,
+			_ addonlistersv1alpha1.ManagedClusterAddOnLister,
+			deploymentConfigValues addonfactory.GetValuesFunc,
+		) []addonfactory.GetValuesFunc {
+			return getValuesFuncs(clusterLister, deploymentConfigValues)
+		},
+	}
+)
+
+// getAgentInstallNamespace returns a function that gets the agent install namespace for the addon.
+// In hosted mode, it is the install namespace of the config-policy-controller when it is hosted on
+// the same cluster, so that the hub kubeconfig Secret provided by the addon framework can be
+// mounted by the config-policy-controller. The AddOnDeploymentConfig of the addon is resolved with
+// the resolver.
+func getAgentInstallNamespace(
+	addonLister addonlistersv1alpha1.ManagedClusterAddOnLister,
+	resolver *policyaddon.DeploymentConfigResolver,
+	adcGetter utils.AddOnDeploymentConfigGetter,
+) func(*addonapiv1alpha1.ManagedClusterAddOn) (string, error) {
+	fromDeploymentConfig := resolver.AgentInstallNamespace(
+		adcGetter, policyaddon.CommonAgentInstallNamespaceFromDeploymentConfigFunc(adcGetter),
+	)
+
+	return func(addon *addonapiv1alpha1.ManagedClusterAddOn) (string, error) {
+		if addon == nil {
+			return fromDeploymentConfig(addon)
+		}
+
+		hostingClusterName := addon.GetAnnotations()[addonapiv1alpha1.HostingClusterNameAnnotationKey]
+		if hostingClusterName == "" {
+			return fromDeploymentConfig(addon)
+		}
+
+		configPolicyAddon, err := addonLister.ManagedClusterAddOns(addon.Namespace).Get(configPolicyAddonName)
+		if err != nil {
+			if k8serrors.IsNotFound(err) {
+				return fromDeploymentConfig(addon)
+			}
+
+			return "", err
+		}
+
+		if configPolicyAddon.GetAnnotations()[addonapiv1alpha1.HostingClusterNameAnnotationKey] != hostingClusterName {
+			return fromDeploymentConfig(addon)
+		}
+
+		return fromDeploymentConfig(configPolicyAddon)
+	}
 }
 
-func getValues(
-	_ *clusterv1.ManagedCluster,
-	addon *addonapiv1alpha1.ManagedClusterAddOn,
+func getValues(clusterClient clusterlistersv1.ManagedClusterLister) func(*clusterv1.ManagedCluster,
+	*addonapiv1alpha1.ManagedClusterAddOn,
 ) (addonfactory.Values, error) {
-	values := addonfactory.Values{}
+	return func(
+		cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn,
+	) (addonfactory.Values, error) {
+		values := struct {
+			HubGroup            string                           `json:"hubGroup"`
+			Capabilities        *policyaddon.ClusterCapabilities `json:"capabilities,omitempty"`
+			HostingCapabilities *policyaddon.ClusterCapabilities `json:"hostingCapabilities,omitempty"`
+		}{
+			// Inform users of the cluster-specific group they can bind more permissions to
+			HubGroup:            agent.DefaultGroups(addon.Namespace, addon.Name)[0],
+			Capabilities:        policyaddon.GetClusterCapabilities(cluster),
+			HostingCapabilities: policyaddon.GetHostingCapabilities(cluster, addon, clusterClient),
+		}
+
+		return addonfactory.JsonStructToValues(values)
+	}
+}
 
-	// Inform users of the cluster-specific group they can bind more permissions to
-	values["hubGroup"] = agent.DefaultGroups(addon.Namespace, addon.Name)[0]
+// deploymentConfigToValuesFuncs convert the AddOnDeploymentConfig of the addon to values.
+var deploymentConfigToValuesFuncs = []addonfactory.AddOnDeploymentConfigToValuesFunc{
+	addonfactory.ToAddOnNodePlacementValues,
+	addonfactory.ToAddOnCustomizedVariableValues,
+}
 
-	return values, nil
+// getValuesFuncs returns the values functions of the addon in order of precedence, with the
+// AddOnDeploymentConfig values from deploymentConfigValues.
+func getValuesFuncs(
+	clusterLister clusterlistersv1.ManagedClusterLister, deploymentConfigValues addonfactory.GetValuesFunc,
+) []addonfactory.GetValuesFunc {
+	return []addonfactory.GetValuesFunc{
+		policyaddon.TraceValuesFunc("AddOnDeploymentConfig", deploymentConfigValues),
+		policyaddon.TraceValuesFunc("Cluster", getValues(clusterLister)),
+	}
 }
 
-func getAgentAddon(controllerContext *controllercmd.ControllerContext) (agent.AgentAddon, error) {
+func getAgentAddon(
+	ctx context.Context, controllerContext *controllercmd.ControllerContext,
+) (agent.AgentAddon, error) {
 	registrationOption := policyaddon.NewRegistrationOption(
 		controllerContext,
-		addonName,
+		AddonName,
 		agentPermissionFiles,
 		FS,
 		true)
@@ -66,57 +168,45 @@ func getAgentAddon(controllerContext *controllercmd.ControllerContext) (agent.Ag
 		return nil, fmt.Errorf("failed to initialize a managed cluster client: %w", err)
 	}
 
-	return addonfactory.NewAgentAddonFactory(addonName, FS, "manifests/managedclusterchart").
+	hubInformers, err := policyaddon.GetHubInformers(controllerContext)
+	if err != nil {
+		return nil, err
+	}
+
+	// The dependency trigger uses the same informer, so the install namespace sees the changes it
+	// triggers on
+	addonInformer := hubInformers.Addon.Addon().V1alpha1().ManagedClusterAddOns()
+	clusterInformer := hubInformers.Cluster.Cluster().V1().ManagedClusters()
+
+	hubInformers.Start(ctx)
+
+	resolver, err := policyaddon.StartDeploymentConfigResolver(ctx, controllerContext)
+	if err != nil {
+		return nil, err
+	}
+
+	adcGetter := utils.NewAddOnDeploymentConfigGetter(addonClient)
+
+	return addonfactory.NewAgentAddonFactory(AddonName, FS, "manifests/managedclusterchart").
 		WithConfigGVRs(utils.AddOnDeploymentConfigGVR).
-		WithGetValuesFuncs(
-			addonfactory.GetAddOnDeploymentConfigValues(
-				utils.NewAddOnDeploymentConfigGetter(addonClient),
-				addonfactory.ToAddOnNodePlacementValues,
-				addonfactory.ToAddOnCustomizedVariableValues,
-			),
-			getValues).
+		WithGetValuesFuncs(getValuesFuncs(clusterInformer.Lister(),
+			resolver.GetValues(adcGetter, deploymentConfigToValuesFuncs...),
+		)...).
 		WithManagedClusterClient(clusterClient).
 		WithAgentRegistrationOption(registrationOption).
 		WithAgentInstallNamespace(
-			policyaddon.
-				CommonAgentInstallNamespaceFromDeploymentConfigFunc(utils.NewAddOnDeploymentConfigGetter(addonClient)),
+			getAgentInstallNamespace(addonInformer.Lister(), resolver, adcGetter),
 		).
 		WithAgentHostedModeEnabledOption().
 		BuildHelmAgentAddon()
 }
 
-type StandaloneAgentAddon struct {
-	agent.AgentAddon
-	manager addonmanager.AddonManager
-}
-
-func (sa *StandaloneAgentAddon) Manifests(
-	cluster *clusterv1.ManagedCluster,
-	addon *addonapiv1alpha1.ManagedClusterAddOn,
-) ([]runtime.Object, error) {
-	// config-policy addon needs to update itself whenever this addon is created/updated/deleted
-	sa.manager.Trigger(cluster.Name, cfgpolAddonName)
-
-	return sa.AgentAddon.Manifests(cluster, addon)
-}
-
 func GetAndAddAgent(
-	_ context.Context, mgr addonmanager.AddonManager, controllerContext *controllercmd.ControllerContext,
+	ctx context.Context,
+	mgr addonmanager.AddonManager,
+	controllerContext *controllercmd.ControllerContext,
+	options policyaddon.AgentOptions,
 ) error {
-	agentAddon, err := getAgentAddon(controllerContext)
-	if err != nil {
-		return fmt.Errorf("failed getting the %v agent addon: %w", addonName, err)
-	}
-
-	standaloneAgentAddon := &StandaloneAgentAddon{
-		AgentAddon: agentAddon,
-		manager:    mgr,
-	}
-
-	err = mgr.AddAgent(standaloneAgentAddon)
-	if err != nil {
-		return fmt.Errorf("failed adding the %v agent addon to the manager: %w", addonName, err)
-	}
-
-	return nil
+	// The agent has no resources outside of its install namespace, so it doesn't need a cleanup Job
+	return policyaddon.GetAndAddAgent(ctx, mgr, AddonName, controllerContext, options, getAgentAddon, nil)
 }
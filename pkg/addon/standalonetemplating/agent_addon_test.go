@@ -0,0 +1,134 @@
+package standalonetemplating
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+	addonlistersv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
+)
+
+// newTestAddon returns a ManagedClusterAddOn in cluster1, hosted on the hosting cluster when it's
+// set, with the install namespace and the AddOnDeploymentConfig when they are set.
+func newTestAddon(
+	t *testing.T,
+	name string,
+	hostingCluster string,
+	installNamespace string,
+	config *addonapiv1alpha1.AddOnDeploymentConfig,
+) *addonapiv1alpha1.ManagedClusterAddOn {
+	t.Helper()
+
+	addon := &addonapiv1alpha1.ManagedClusterAddOn{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "cluster1"},
+	}
+
+	if hostingCluster != "" {
+		addon.Annotations = map[string]string{addonapiv1alpha1.HostingClusterNameAnnotationKey: hostingCluster}
+	}
+
+	//nolint:staticcheck
+	addon.Spec.InstallNamespace = installNamespace
+
+	if config != nil {
+		specHash, err := utils.GetAddOnDeploymentConfigSpecHash(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addon.Status.ConfigReferences = []addonapiv1alpha1.ConfigReference{{
+			ConfigGroupResource: addonapiv1alpha1.ConfigGroupResource{
+				Group: utils.AddOnDeploymentConfigGVR.Group, Resource: utils.AddOnDeploymentConfigGVR.Resource,
+			},
+			DesiredConfig: &addonapiv1alpha1.ConfigSpecHash{
+				ConfigReferent: addonapiv1alpha1.ConfigReferent{Namespace: config.Namespace, Name: config.Name},
+				SpecHash:       specHash,
+			},
+		}}
+	}
+
+	return addon
+}
+
+func TestGetAgentInstallNamespace(t *testing.T) {
+	config := &addonapiv1alpha1.AddOnDeploymentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "agents", Namespace: "open-cluster-management"},
+		Spec:       addonapiv1alpha1.AddOnDeploymentConfigSpec{AgentInstallNamespace: "policy-agents"},
+	}
+
+	tests := map[string]struct {
+		addon             *addonapiv1alpha1.ManagedClusterAddOn
+		configPolicyAddon *addonapiv1alpha1.ManagedClusterAddOn
+		expected          string
+	}{
+		"no addon": {},
+		"AddOnDeploymentConfig": {
+			addon:    newTestAddon(t, AddonName, "", "", config),
+			expected: "policy-agents",
+		},
+		"default": {
+			addon: newTestAddon(t, AddonName, "", "", nil),
+		},
+		"not hosted with a hosted config-policy-controller": {
+			addon:             newTestAddon(t, AddonName, "", "", config),
+			configPolicyAddon: newTestAddon(t, configPolicyAddonName, "hosting1", "klusterlet-cluster1", nil),
+			expected:          "policy-agents",
+		},
+		"hosted without config-policy-controller": {
+			addon:    newTestAddon(t, AddonName, "hosting1", "templating-cluster1", nil),
+			expected: "templating-cluster1",
+		},
+		"hosted with config-policy-controller on the same cluster": {
+			addon:             newTestAddon(t, AddonName, "hosting1", "templating-cluster1", nil),
+			configPolicyAddon: newTestAddon(t, configPolicyAddonName, "hosting1", "klusterlet-cluster1", nil),
+			expected:          "klusterlet-cluster1",
+		},
+		"hosted with the AddOnDeploymentConfig of config-policy-controller": {
+			addon:             newTestAddon(t, AddonName, "hosting1", "", nil),
+			configPolicyAddon: newTestAddon(t, configPolicyAddonName, "hosting1", "", config),
+			expected:          "policy-agents",
+		},
+		"hosted with config-policy-controller on another cluster": {
+			addon:             newTestAddon(t, AddonName, "hosting1", "templating-cluster1", nil),
+			configPolicyAddon: newTestAddon(t, configPolicyAddonName, "hosting2", "klusterlet-cluster1", nil),
+			expected:          "templating-cluster1",
+		},
+		"hosted with config-policy-controller not hosted": {
+			addon:             newTestAddon(t, AddonName, "hosting1", "templating-cluster1", nil),
+			configPolicyAddon: newTestAddon(t, configPolicyAddonName, "", "", config),
+			expected:          "templating-cluster1",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+				cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+			})
+
+			if test.configPolicyAddon != nil {
+				if err := indexer.Add(test.configPolicyAddon); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			getNamespace := getAgentInstallNamespace(
+				addonlistersv1alpha1.NewManagedClusterAddOnLister(indexer),
+				nil,
+				utils.NewAddOnDeploymentConfigGetter(fakeaddon.NewSimpleClientset(config)),
+			)
+
+			namespace, err := getNamespace(test.addon)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if namespace != test.expected {
+				t.Fatalf("expected the install namespace %q, got %q", test.expected, namespace)
+			}
+		})
+	}
+}
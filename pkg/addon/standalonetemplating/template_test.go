@@ -0,0 +1,67 @@
+package standalonetemplating
+
+import (
+	"encoding/json"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"open-cluster-management.io/addon-framework/pkg/addonfactory"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+
+	policyaddon "open-cluster-management.io/governance-policy-addon-controller/pkg/addon"
+)
+
+func TestExportAddOnTemplate(t *testing.T) {
+	objects, err := policyaddon.ExportAddOnTemplate(TemplateSource, "v1.30.0", addonfactory.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var template *addonapiv1alpha1.AddOnTemplate
+
+	var binding *rbacv1.ClusterRoleBinding
+
+	for _, obj := range objects {
+		switch typed := obj.(type) {
+		case *addonapiv1alpha1.AddOnTemplate:
+			template = typed
+		case *rbacv1.ClusterRoleBinding:
+			binding = typed
+		}
+	}
+
+	if template == nil {
+		t.Fatal("expected an AddOnTemplate to be exported")
+	}
+
+	// The hub permissions are bound to the group of the entire addon, so they are not per cluster
+	if binding == nil || binding.Namespace != "" || len(binding.Subjects) != 1 ||
+		binding.Subjects[0].Name != "system:open-cluster-management:addon:governance-standalone-hub-templating" {
+		t.Fatalf("expected the ClusterRoleBinding of the addon group, got %+v", binding)
+	}
+
+	if hubPermissions := template.Spec.Registration[0].KubeClient.HubPermissions; len(hubPermissions) != 0 {
+		t.Fatalf("expected no hub permissions bound per cluster, got %+v", hubPermissions)
+	}
+
+	manifests := template.Spec.AgentSpec.Workload.Manifests
+	if len(manifests) != 1 {
+		t.Fatalf("expected only the info Secret to be deployed, got %d manifests", len(manifests))
+	}
+
+	secret := &corev1.Secret{}
+	if err := json.Unmarshal(manifests[0].Raw, secret); err != nil {
+		t.Fatal(err)
+	}
+
+	if secret.Kind != "Secret" || secret.Namespace != "{{INSTALL_NAMESPACE}}" {
+		t.Fatalf("expected the Secret in the install namespace variable, got %s %s", secret.Kind, secret.Namespace)
+	}
+
+	expectedGroup := "system:open-cluster-management:cluster:{{CLUSTER_NAME}}:addon:" + AddonName
+	if len(secret.Data) != 0 || secret.StringData["hub.group"] != expectedGroup {
+		t.Fatalf("expected the hub group %s in the string data, got %v and %v",
+			expectedGroup, secret.StringData, secret.Data)
+	}
+}
@@ -0,0 +1,97 @@
+package addon
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	addonv1alpha1client "open-cluster-management.io/api/client/addon/clientset/versioned"
+	"open-cluster-management.io/sdk-go/pkg/patcher"
+)
+
+// AddonStatusUpdater reports policy addon specific conditions on the ManagedClusterAddOn status.
+type AddonStatusUpdater struct {
+	client addonv1alpha1client.Interface
+}
+
+// NewAddonStatusUpdater creates an AddonStatusUpdater from the hub kubeconfig.
+func NewAddonStatusUpdater(kubeConfig *rest.Config) (*AddonStatusUpdater, error) {
+	addonClient, err := addonv1alpha1client.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve addon client: %w", err)
+	}
+
+	return &AddonStatusUpdater{client: addonClient}, nil
+}
+
+// SetCondition sets the condition on the ManagedClusterAddOn status. The status is only patched
+// when the condition changed.
+func (u *AddonStatusUpdater) SetCondition(
+	ctx context.Context, addon *addonapiv1alpha1.ManagedClusterAddOn, condition metav1.Condition,
+) error {
+	newStatus := addon.Status.DeepCopy()
+	meta.SetStatusCondition(&newStatus.Conditions, condition)
+
+	return u.patchStatus(ctx, addon, newStatus)
+}
+
+// AddonConditions are the conditions to set and remove on a ManagedClusterAddOn status.
+type AddonConditions struct {
+	set    []metav1.Condition
+	remove []string
+}
+
+// Set adds the condition to the conditions to set.
+func (c *AddonConditions) Set(condition metav1.Condition) {
+	c.set = append(c.set, condition)
+}
+
+// Remove adds the condition type to the conditions to remove.
+func (c *AddonConditions) Remove(conditionType string) {
+	c.remove = append(c.remove, conditionType)
+}
+
+// UpdateConditions sets and removes the conditions on the ManagedClusterAddOn status in a single
+// patch. The status is only patched when the conditions changed.
+func (u *AddonStatusUpdater) UpdateConditions(
+	ctx context.Context, addon *addonapiv1alpha1.ManagedClusterAddOn, conditions *AddonConditions,
+) error {
+	newStatus := addon.Status.DeepCopy()
+
+	for _, condition := range conditions.set {
+		meta.SetStatusCondition(&newStatus.Conditions, condition)
+	}
+
+	for _, conditionType := range conditions.remove {
+		meta.RemoveStatusCondition(&newStatus.Conditions, conditionType)
+	}
+
+	return u.patchStatus(ctx, addon, newStatus)
+}
+
+func (u *AddonStatusUpdater) patchStatus(
+	ctx context.Context,
+	addon *addonapiv1alpha1.ManagedClusterAddOn,
+	newStatus *addonapiv1alpha1.ManagedClusterAddOnStatus,
+) error {
+	addonPatcher := patcher.NewPatcher[
+		*addonapiv1alpha1.ManagedClusterAddOn,
+		addonapiv1alpha1.ManagedClusterAddOnSpec,
+		addonapiv1alpha1.ManagedClusterAddOnStatus,
+	](u.client.AddonV1alpha1().ManagedClusterAddOns(addon.Namespace))
+
+	ctx, span := startSpan(ctx, "PatchStatus", addon.Namespace, addon)
+
+	_, err := addonPatcher.PatchStatus(ctx, addon, *newStatus, addon.Status)
+
+	endSpan(span, err)
+
+	if err != nil {
+		return fmt.Errorf("failed to update the status of addon %s/%s: %w", addon.Namespace, addon.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package addon
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+)
+
+func TestUpdateConditions(t *testing.T) {
+	addon := &addonapiv1alpha1.ManagedClusterAddOn{
+		ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller", Namespace: "cluster1"},
+		Status: addonapiv1alpha1.ManagedClusterAddOnStatus{Conditions: []metav1.Condition{{
+			Type: ImageVerifiedCondition, Status: metav1.ConditionTrue, Reason: "Verified",
+		}}},
+	}
+
+	addonClient := fakeaddon.NewSimpleClientset(addon)
+	updater := &AddonStatusUpdater{client: addonClient}
+
+	conditions := &AddonConditions{}
+	conditions.Set(metav1.Condition{
+		Type: AgentVersionSkewCondition, Status: metav1.ConditionFalse, Reason: skewReasonCompatible,
+	})
+	conditions.Set(metav1.Condition{
+		Type: HostedNamespaceAvailableCondition, Status: metav1.ConditionTrue, Reason: namespaceReasonAvailable,
+	})
+	conditions.Remove(ImageVerifiedCondition)
+
+	if err := updater.UpdateConditions(context.TODO(), addon, conditions); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(addonClient.Actions()) != 1 {
+		t.Fatalf("expected the conditions to be patched at once, got the actions %v", addonClient.Actions())
+	}
+
+	updated, err := addonClient.AddonV1alpha1().ManagedClusterAddOns("cluster1").Get(
+		context.TODO(), addon.Name, metav1.GetOptions{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, conditionType := range []string{AgentVersionSkewCondition, HostedNamespaceAvailableCondition} {
+		if meta.FindStatusCondition(updated.Status.Conditions, conditionType) == nil {
+			t.Fatalf("expected the %s condition to be set", conditionType)
+		}
+	}
+
+	if meta.FindStatusCondition(updated.Status.Conditions, ImageVerifiedCondition) != nil {
+		t.Fatalf("expected the %s condition to be removed", ImageVerifiedCondition)
+	}
+
+	addonClient.ClearActions()
+
+	if err := updater.UpdateConditions(context.TODO(), updated, conditions); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(addonClient.Actions()) != 0 {
+		t.Fatalf("expected unchanged conditions to not be patched, got the actions %v", addonClient.Actions())
+	}
+}
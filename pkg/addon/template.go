@@ -0,0 +1,314 @@
+package addon
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/openshift/library-go/pkg/assets"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/tools/cache"
+	"open-cluster-management.io/addon-framework/pkg/addonfactory"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	addonlistersv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
+	clusterlistersv1 "open-cluster-management.io/api/client/cluster/listers/cluster/v1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	workv1 "open-cluster-management.io/api/work/v1"
+)
+
+const (
+	// templateClusterName is the name of the managed cluster the chart is rendered for when it is
+	// exported, which is replaced with the CLUSTER_NAME variable of the AddOnTemplate.
+	templateClusterName = "addon-template-cluster-name"
+	// templateClusterNameVariable and templateInstallNamespaceVariable are the built-in variables of
+	// the AddOnTemplate, set to the managed cluster name and the install namespace of the addon.
+	templateClusterNameVariable      = "{{CLUSTER_NAME}}"
+	templateInstallNamespaceVariable = "{{INSTALL_NAMESPACE}}"
+)
+
+var (
+	// templateVariables are the rendered values replaced with the variables of the AddOnTemplate.
+	templateVariables = map[string]string{
+		templateClusterName:                       templateClusterNameVariable,
+		addonfactory.AddonDefaultInstallNamespace: templateInstallNamespaceVariable,
+	}
+	// templateToken matches the words of the string values that may be one of the templateVariables,
+	// so that a value is only replaced when it isn't part of a longer name.
+	templateToken = regexp.MustCompile(`[a-zA-Z0-9_-]+`)
+)
+
+// TemplateSource is what an addon provides to be exported as an AddOnTemplate.
+type TemplateSource struct {
+	AddonName string
+	// FS holds the chart of the agent in manifests/managedclusterchart, and the PermissionFiles.
+	FS              embed.FS
+	PermissionFiles []string
+	// UseClusterRole is whether the hub permissions are bound to the group of the entire addon,
+	// like in NewRegistrationOption.
+	UseClusterRole bool
+	// UninstallHook builds the cleanup Job added to the template as a pre-delete hook, when the addon
+	// needs one.
+	UninstallHook *UninstallHook
+	// GetValuesFuncs returns the values functions of the addon in the order the controller uses, with
+	// deploymentConfigValues in place of the AddOnDeploymentConfig values.
+	GetValuesFuncs func(
+		clusterLister clusterlistersv1.ManagedClusterLister,
+		addonLister addonlistersv1alpha1.ManagedClusterAddOnLister,
+		deploymentConfigValues addonfactory.GetValuesFunc,
+	) []addonfactory.GetValuesFunc
+}
+
+// ExportAddOnTemplate renders the addon for a managed cluster of the Kubernetes version, with no
+// labels or claims, and returns the hub objects that deploy it without the controller: the hub
+// permissions that are not bound per cluster, the AddOnTemplate, and a ClusterManagementAddOn using
+// it as the default config. The values are used as the AddOnDeploymentConfig values. The cluster
+// name and install namespace are replaced with the variables of the AddOnTemplate, so Secret data
+// is exported as stringData.
+//
+// The uninstall Job is added as a pre-delete hook, but what the controller only decides when
+// deploying the agent, such as the image trust policy, is not part of the template.
+func ExportAddOnTemplate(
+	source TemplateSource, kubeVersion string, values addonfactory.Values,
+) ([]runtime.Object, error) {
+	hubObjects, hubPermissions, err := exportHubPermissions(source)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster := &clusterv1.ManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: templateClusterName},
+		Status: clusterv1.ManagedClusterStatus{
+			Version: clusterv1.ManagedClusterVersion{Kubernetes: kubeVersion},
+		},
+	}
+	addon := &addonapiv1alpha1.ManagedClusterAddOn{
+		ObjectMeta: metav1.ObjectMeta{Name: source.AddonName, Namespace: templateClusterName},
+	}
+
+	clusterIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	addonIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+	})
+
+	if err := clusterIndexer.Add(cluster); err != nil {
+		return nil, err
+	}
+
+	if err := addonIndexer.Add(addon); err != nil {
+		return nil, err
+	}
+
+	deploymentConfigValues := func(*clusterv1.ManagedCluster, *addonapiv1alpha1.ManagedClusterAddOn,
+	) (addonfactory.Values, error) {
+		return values, nil
+	}
+
+	agentAddon, err := addonfactory.NewAgentAddonFactory(source.AddonName, source.FS, "manifests/managedclusterchart").
+		WithGetValuesFuncs(source.GetValuesFuncs(
+			clusterlistersv1.NewManagedClusterLister(clusterIndexer),
+			addonlistersv1alpha1.NewManagedClusterAddOnLister(addonIndexer),
+			deploymentConfigValues,
+		)...).
+		// The registration sets the name of the hub kubeconfig Secret, which is the same for templates
+		WithAgentRegistrationOption(&agent.RegistrationOption{
+			CSRConfigurations: agent.KubeClientSignerConfigurations(source.AddonName, source.AddonName),
+		}).
+		WithScheme(Scheme).
+		BuildHelmAgentAddon()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the %s agent addon: %w", source.AddonName, err)
+	}
+
+	objects, err := agentAddon.Manifests(cluster, addon)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render the %s agent: %w", source.AddonName, err)
+	}
+
+	// The addon manager runs the annotated Job before removing the agent, like with the controller
+	if source.UninstallHook != nil {
+		if job := source.UninstallHook.BuildUninstallJob(cluster, addon, objects); job != nil {
+			objects = append(objects, job)
+		}
+	}
+
+	manifests := make([]workv1.Manifest, 0, len(objects))
+
+	for _, obj := range objects {
+		manifest, err := templateManifest(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		manifests = append(manifests, manifest)
+	}
+
+	template := &addonapiv1alpha1.AddOnTemplate{
+		TypeMeta:   metav1.TypeMeta{APIVersion: addonapiv1alpha1.GroupVersion.String(), Kind: "AddOnTemplate"},
+		ObjectMeta: metav1.ObjectMeta{Name: source.AddonName},
+		Spec: addonapiv1alpha1.AddOnTemplateSpec{
+			AddonName: source.AddonName,
+			AgentSpec: workv1.ManifestWorkSpec{Workload: workv1.ManifestsTemplate{Manifests: manifests}},
+			Registration: []addonapiv1alpha1.RegistrationSpec{{
+				Type:       addonapiv1alpha1.RegistrationTypeKubeClient,
+				KubeClient: &addonapiv1alpha1.KubeClientRegistrationConfig{HubPermissions: hubPermissions},
+			}},
+		},
+	}
+
+	lifecycleKey := addonapiv1alpha1.AddonLifecycleAnnotationKey
+
+	cma := &addonapiv1alpha1.ClusterManagementAddOn{
+		TypeMeta: metav1.TypeMeta{APIVersion: addonapiv1alpha1.GroupVersion.String(), Kind: "ClusterManagementAddOn"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        source.AddonName,
+			Annotations: map[string]string{lifecycleKey: addonapiv1alpha1.AddonLifecycleAddonManagerAnnotationValue},
+		},
+		Spec: addonapiv1alpha1.ClusterManagementAddOnSpec{
+			SupportedConfigs: []addonapiv1alpha1.ConfigMeta{
+				{
+					ConfigGroupResource: addonapiv1alpha1.ConfigGroupResource{
+						Group: addonapiv1alpha1.GroupName, Resource: "addontemplates",
+					},
+					DefaultConfig: &addonapiv1alpha1.ConfigReferent{Name: template.Name},
+				},
+				{
+					ConfigGroupResource: addonapiv1alpha1.ConfigGroupResource{
+						Group: addonapiv1alpha1.GroupName, Resource: "addondeploymentconfigs",
+					},
+				},
+			},
+			InstallStrategy: addonapiv1alpha1.InstallStrategy{Type: addonapiv1alpha1.AddonInstallStrategyManual},
+		},
+	}
+
+	return append(hubObjects, template, cma), nil
+}
+
+// exportHubPermissions returns the hub objects of the permission files of the addon, except for the
+// RoleBindings in the managed cluster namespace, which are returned as the hub permissions of the
+// AddOnTemplate.
+func exportHubPermissions(
+	source TemplateSource,
+) ([]runtime.Object, []addonapiv1alpha1.HubPermissionConfig, error) {
+	groupIdx := 0 // 0 is a cluster-specific group
+
+	if source.UseClusterRole {
+		groupIdx = 1 // 1 is a group for the entire addon
+	}
+
+	config := struct {
+		ClusterName string
+		Group       string
+	}{
+		ClusterName: templateClusterName,
+		Group:       agent.DefaultGroups(templateClusterName, source.AddonName)[groupIdx],
+	}
+
+	decoder := serializer.NewCodecFactory(Scheme).UniversalDeserializer()
+	hubObjects := []runtime.Object{}
+	hubPermissions := []addonapiv1alpha1.HubPermissionConfig{}
+
+	for _, file := range source.PermissionFiles {
+		template, err := source.FS.ReadFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		obj, _, err := decoder.Decode(assets.MustCreateAssetFromTemplate(file, template, config).Data, nil, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode the hub permissions in %s: %w", file, err)
+		}
+
+		switch permission := obj.(type) {
+		case *rbacv1.RoleBinding:
+			if permission.RoleRef.Kind != "ClusterRole" {
+				return nil, nil, fmt.Errorf("the RoleBinding in %s must refer to a ClusterRole", file)
+			}
+
+			hubPermissions = append(hubPermissions, addonapiv1alpha1.HubPermissionConfig{
+				Type: addonapiv1alpha1.HubPermissionsBindingCurrentCluster,
+				CurrentCluster: &addonapiv1alpha1.CurrentClusterBindingConfig{
+					ClusterRoleName: permission.RoleRef.Name,
+				},
+			})
+		case *rbacv1.ClusterRoleBinding:
+			// The binding is cluster-scoped, even if the file sets a namespace
+			permission.Namespace = ""
+			hubObjects = append(hubObjects, permission)
+		default:
+			hubObjects = append(hubObjects, obj)
+		}
+	}
+
+	return hubObjects, hubPermissions, nil
+}
+
+// templateManifest returns the rendered object as a manifest of the AddOnTemplate, with the cluster
+// name and install namespace replaced with the variables of the AddOnTemplate. They are replaced in
+// the string values of the object, like its namespace or the arguments of the agent, and not in the
+// keys, or where they are only part of a longer name.
+func templateManifest(obj runtime.Object) (workv1.Manifest, error) {
+	if secret, ok := obj.(*corev1.Secret); ok {
+		secret = secret.DeepCopy()
+
+		// The variables are not substituted in the base64 encoded data
+		for key, value := range secret.Data {
+			if !utf8.Valid(value) {
+				continue
+			}
+
+			if secret.StringData == nil {
+				secret.StringData = map[string]string{}
+			}
+
+			secret.StringData[key] = string(value)
+			delete(secret.Data, key)
+		}
+
+		obj = secret
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return workv1.Manifest{}, err
+	}
+
+	raw, err := json.Marshal(substituteTemplateVariables(content))
+	if err != nil {
+		return workv1.Manifest{}, err
+	}
+
+	return workv1.Manifest{RawExtension: runtime.RawExtension{Raw: raw}}, nil
+}
+
+// substituteTemplateVariables replaces the templateVariables in the string values of the unstructured
+// content.
+func substituteTemplateVariables(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, item := range typed {
+			typed[key] = substituteTemplateVariables(item)
+		}
+	case []interface{}:
+		for i, item := range typed {
+			typed[i] = substituteTemplateVariables(item)
+		}
+	case string:
+		return templateToken.ReplaceAllStringFunc(typed, func(token string) string {
+			if variable, ok := templateVariables[token]; ok {
+				return variable
+			}
+
+			return token
+		})
+	}
+
+	return value
+}
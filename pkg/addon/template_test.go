@@ -0,0 +1,92 @@
+package addon
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestTemplateManifest(t *testing.T) {
+	tests := map[string]struct {
+		obj      runtime.Object
+		expected map[string]interface{}
+	}{
+		"namespace and values": {
+			obj: &corev1.ConfigMap{
+				TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "config-policy-controller",
+					Namespace: "open-cluster-management-agent-addon",
+				},
+				Data: map[string]string{
+					"namespace":                   "open-cluster-management-agent-addon",
+					"argument":                    "--cluster-name=addon-template-cluster-name",
+					"host":                        "metrics.open-cluster-management-agent-addon.svc",
+					"group":                       "system:cluster:addon-template-cluster-name:addon",
+					"longer name":                 "open-cluster-management-agent-addon-logging",
+					"prefixed name":               "my-open-cluster-management-agent-addon",
+					"addon-template-cluster-name": "kept",
+				},
+			},
+			expected: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata": map[string]interface{}{
+					"name":      "config-policy-controller",
+					"namespace": "{{INSTALL_NAMESPACE}}",
+				},
+				"data": map[string]interface{}{
+					"namespace":                   "{{INSTALL_NAMESPACE}}",
+					"argument":                    "--cluster-name={{CLUSTER_NAME}}",
+					"host":                        "metrics.{{INSTALL_NAMESPACE}}.svc",
+					"group":                       "system:cluster:{{CLUSTER_NAME}}:addon",
+					"longer name":                 "open-cluster-management-agent-addon-logging",
+					"prefixed name":               "my-open-cluster-management-agent-addon",
+					"addon-template-cluster-name": "kept",
+				},
+			},
+		},
+		"Secret data": {
+			obj: &corev1.Secret{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+				ObjectMeta: metav1.ObjectMeta{Name: "info", Namespace: "open-cluster-management-agent-addon"},
+				Data: map[string][]byte{
+					"cluster": []byte("addon-template-cluster-name"),
+					"binary":  {0xff, 0xfe},
+				},
+			},
+			expected: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Secret",
+				"metadata": map[string]interface{}{
+					"name":      "info",
+					"namespace": "{{INSTALL_NAMESPACE}}",
+				},
+				"data":       map[string]interface{}{"binary": "//4="},
+				"stringData": map[string]interface{}{"cluster": "{{CLUSTER_NAME}}"},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			manifest, err := templateManifest(test.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			content := map[string]interface{}{}
+			if err := json.Unmarshal(manifest.Raw, &content); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(content, test.expected) {
+				t.Fatalf("expected the manifest %v, got %v", test.expected, content)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package addon
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+	"open-cluster-management.io/addon-framework/pkg/addonfactory"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+const tracerName = "open-cluster-management.io/governance-policy-addon-controller"
+
+// TracingConfig configures the OpenTelemetry tracing of the controller, which is also passed to the
+// agents as the standard OTEL environment variables.
+type TracingConfig struct {
+	// Endpoint is the URL of the OTLP gRPC endpoint, like http://otel-collector:4317. Tracing is
+	// disabled when it's empty.
+	Endpoint string
+	// SamplingRatio is the ratio of the traces that are sampled, from 0 to 1.
+	SamplingRatio float64
+}
+
+// TracingValues contains the tracing configuration values for the addon chart.
+type TracingValues struct {
+	Endpoint      string `json:"endpoint,omitempty"`
+	SamplingRatio string `json:"samplingRatio,omitempty"`
+}
+
+var (
+	// tracingConfig is the tracing configuration of the controller, once it is set up.
+	tracingConfig TracingConfig
+	// renderContexts holds the tracing context of the addons being rendered by their namespace and
+	// name, so that the values functions called by the addonfactory are traced in the Render span.
+	renderContexts sync.Map
+)
+
+// BindFlags adds the tracing flags to the flag set.
+func (c *TracingConfig) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Endpoint, "otlp-endpoint", "",
+		"The URL of the OTLP gRPC endpoint to export traces to, like http://otel-collector:4317. "+
+			"Tracing is disabled when it's empty. The agents are configured with the same endpoint.")
+	fs.Float64Var(&c.SamplingRatio, "tracing-sampling-ratio", 1,
+		"The ratio of the traces that are sampled, from 0 to 1.")
+}
+
+// SetupTracing exports the traces of the controller to the configured OTLP endpoint, and passes the
+// configuration down to the agent charts. It returns a function flushing the traces on shutdown.
+func SetupTracing(
+	ctx context.Context, config TracingConfig, serviceVersion string,
+) (func(context.Context) error, error) {
+	if config.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	if config.SamplingRatio < 0 || config.SamplingRatio > 1 {
+		return nil, fmt.Errorf("invalid tracing sampling ratio %v, it must be from 0 to 1", config.SamplingRatio)
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpointURL(config.Endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the OTLP trace exporter: %w", err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(
+			semconv.ServiceName("governance-policy-addon-controller"),
+			semconv.ServiceVersion(serviceVersion),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SamplingRatio))),
+	)
+
+	otel.SetTracerProvider(provider)
+
+	tracingConfig = config
+
+	return provider.Shutdown, nil
+}
+
+// getTracingValues returns the tracing values for the agent charts, or nil when tracing is disabled.
+func getTracingValues() *TracingValues {
+	if tracingConfig.Endpoint == "" {
+		return nil
+	}
+
+	return &TracingValues{
+		Endpoint:      tracingConfig.Endpoint,
+		SamplingRatio: strconv.FormatFloat(tracingConfig.SamplingRatio, 'f', -1, 64),
+	}
+}
+
+// startSpan starts a span with the cluster and addon attributes.
+func startSpan(
+	ctx context.Context, name string, clusterName string, addon *addonapiv1alpha1.ManagedClusterAddOn,
+) (context.Context, trace.Span) {
+	attributes := []attribute.KeyValue{attribute.String("cluster", clusterName)}
+	if addon != nil {
+		attributes = append(attributes, attribute.String("addon", addon.Name))
+	}
+
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// endSpan records the error, if any, on the span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// renderKey returns the key of the addon in the renderContexts.
+func renderKey(addon *addonapiv1alpha1.ManagedClusterAddOn) string {
+	return addon.Namespace + "/" + addon.Name
+}
+
+// renderContext returns the tracing context of the addon being rendered, or a background context.
+func renderContext(addon *addonapiv1alpha1.ManagedClusterAddOn) context.Context {
+	if ctx, ok := renderContexts.Load(renderKey(addon)); ok {
+		if ctx, ok := ctx.(context.Context); ok {
+			return ctx
+		}
+	}
+
+	return context.Background()
+}
+
+// TraceValuesFunc wraps the values function in a span, which is a child of the Render span of the
+// addon.
+func TraceValuesFunc(name string, getValues addonfactory.GetValuesFunc) addonfactory.GetValuesFunc {
+	return func(
+		cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn,
+	) (addonfactory.Values, error) {
+		_, span := startSpan(renderContext(addon), "values/"+name, cluster.Name, addon)
+
+		values, err := getValues(cluster, addon)
+
+		endSpan(span, err)
+
+		return values, err
+	}
+}
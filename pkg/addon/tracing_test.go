@@ -0,0 +1,171 @@
+package addon
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"open-cluster-management.io/addon-framework/pkg/addonfactory"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+func TestSetupTracingConfig(t *testing.T) {
+	tests := map[string]struct {
+		config TracingConfig
+		valid  bool
+	}{
+		"disabled":                {config: TracingConfig{SamplingRatio: 5}, valid: true},
+		"negative sampling ratio": {config: TracingConfig{Endpoint: "http://otel-collector:4317", SamplingRatio: -0.1}},
+		"sampling ratio above 1":  {config: TracingConfig{Endpoint: "http://otel-collector:4317", SamplingRatio: 1.5}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			shutdown, err := SetupTracing(context.TODO(), test.config, "test")
+
+			if !test.valid {
+				if err == nil {
+					t.Fatalf("expected the configuration %+v to be invalid", test.config)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := shutdown(context.TODO()); err != nil {
+				t.Fatal(err)
+			}
+
+			// Disabled tracing isn't passed to the agents
+			if values := getTracingValues(); values != nil {
+				t.Fatalf("expected no tracing values, got %+v", values)
+			}
+		})
+	}
+}
+
+func TestGetTracingValues(t *testing.T) {
+	previous := tracingConfig
+
+	t.Cleanup(func() { tracingConfig = previous })
+
+	tests := map[string]struct {
+		config   TracingConfig
+		expected *TracingValues
+	}{
+		"disabled": {config: TracingConfig{SamplingRatio: 1}},
+		"all traces": {
+			config:   TracingConfig{Endpoint: "http://otel-collector:4317", SamplingRatio: 1},
+			expected: &TracingValues{Endpoint: "http://otel-collector:4317", SamplingRatio: "1"},
+		},
+		"some traces": {
+			config:   TracingConfig{Endpoint: "http://otel-collector:4317", SamplingRatio: 0.05},
+			expected: &TracingValues{Endpoint: "http://otel-collector:4317", SamplingRatio: "0.05"},
+		},
+		"no traces": {
+			config:   TracingConfig{Endpoint: "http://otel-collector:4317"},
+			expected: &TracingValues{Endpoint: "http://otel-collector:4317", SamplingRatio: "0"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tracingConfig = test.config
+
+			if values := getTracingValues(); !reflect.DeepEqual(values, test.expected) {
+				t.Fatalf("expected the tracing values %+v, got %+v", test.expected, values)
+			}
+		})
+	}
+}
+
+func TestTraceValuesFunc(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	cluster := &clusterv1.ManagedCluster{}
+	cluster.SetName("cluster1")
+
+	addon := &addonapiv1alpha1.ManagedClusterAddOn{}
+	addon.SetName("config-policy-controller")
+	addon.SetNamespace("cluster1")
+
+	tests := map[string]struct {
+		err       error
+		rendering bool
+	}{
+		"values":                 {rendering: true},
+		"error":                  {err: errors.New("invalid values"), rendering: true},
+		"outside of a rendering": {},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var renderSpanID string
+
+			if test.rendering {
+				renderCtx, renderSpan := startSpan(context.TODO(), "Render", cluster.Name, addon)
+				renderSpanID = renderSpan.SpanContext().SpanID().String()
+
+				renderContexts.Store(renderKey(addon), renderCtx)
+
+				defer func() {
+					renderContexts.Delete(renderKey(addon))
+					renderSpan.End()
+				}()
+			}
+
+			getValues := TraceValuesFunc("Test", func(
+				*clusterv1.ManagedCluster, *addonapiv1alpha1.ManagedClusterAddOn,
+			) (addonfactory.Values, error) {
+				return addonfactory.Values{"logLevel": 2}, test.err
+			})
+
+			values, err := getValues(cluster, addon)
+			if !errors.Is(err, test.err) || values["logLevel"] != 2 {
+				t.Fatalf("expected the values and error of the wrapped function, got %v, %v", values, err)
+			}
+
+			spans := recorder.Ended()
+			span := spans[len(spans)-1]
+
+			if span.Name() != "values/Test" {
+				t.Fatalf("expected the values/Test span, got %s", span.Name())
+			}
+
+			if parentID := span.Parent().SpanID(); parentID.IsValid() != test.rendering ||
+				(test.rendering && parentID.String() != renderSpanID) {
+				t.Fatalf("expected the span to be a child of the Render span: %v", test.rendering)
+			}
+
+			expectedAttributes := []attribute.KeyValue{
+				attribute.String("cluster", "cluster1"), attribute.String("addon", "config-policy-controller"),
+			}
+			if !reflect.DeepEqual(span.Attributes(), expectedAttributes) {
+				t.Fatalf("expected the attributes %v, got %v", expectedAttributes, span.Attributes())
+			}
+
+			expectedStatus := codes.Unset
+			if test.err != nil {
+				expectedStatus = codes.Error
+			}
+
+			if span.Status().Code != expectedStatus {
+				t.Fatalf("expected the status %v, got %v", expectedStatus, span.Status())
+			}
+		})
+	}
+}
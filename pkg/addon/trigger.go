@@ -0,0 +1,170 @@
+package addon
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/openshift/library-go/pkg/controller/controllercmd"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	addonlistersv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+var (
+	// clusterValuesLabels are the ManagedCluster labels that the addon values are built from.
+	clusterValuesLabels = []string{"vendor", "openshiftVersion-major", "local-cluster", ArchitectureLabel}
+	// clusterValuesClaims are the ManagedCluster claims that the addon values are built from.
+	clusterValuesClaims = []string{
+		ProductClaim, PlatformClaim, KubeVersionClaim, ArchitectureClaim, FIPSClaim, OLMClaim, CertManagerClaim,
+	}
+)
+
+// ClusterValuesChanged returns whether any of the ManagedCluster labels, claims, annotations, or
+// the Kubernetes version that the addon values depend on differ between the two versions of the
+// cluster.
+func ClusterValuesChanged(oldCluster, newCluster *clusterv1.ManagedCluster) bool {
+	if oldCluster.Status.Version.Kubernetes != newCluster.Status.Version.Kubernetes {
+		return true
+	}
+
+	for _, label := range clusterValuesLabels {
+		if oldCluster.GetLabels()[label] != newCluster.GetLabels()[label] {
+			return true
+		}
+	}
+
+	for _, claim := range clusterValuesClaims {
+		if getClusterClaim(oldCluster, claim) != getClusterClaim(newCluster, claim) {
+			return true
+		}
+	}
+
+	return !equality.Semantic.DeepEqual(oldCluster.GetAnnotations(), newCluster.GetAnnotations())
+}
+
+// getClusterClaim returns the value of the named claim on the cluster, or an empty string if the
+// claim is not reported.
+func getClusterClaim(cluster *clusterv1.ManagedCluster, name string) string {
+	for _, cc := range cluster.Status.ClusterClaims {
+		if cc.Name == name {
+			return cc.Value
+		}
+	}
+
+	return ""
+}
+
+// ClusterChangeTrigger re-renders the policy addons when a ManagedCluster they depend on changes,
+// including hosted addons whose hosting cluster changed.
+type ClusterChangeTrigger struct {
+	manager     addonmanager.AddonManager
+	addonLister addonlistersv1alpha1.ManagedClusterAddOnLister
+	addonNames  []string
+}
+
+// NewClusterChangeTrigger creates a trigger for the given addons.
+func NewClusterChangeTrigger(
+	manager addonmanager.AddonManager,
+	addonLister addonlistersv1alpha1.ManagedClusterAddOnLister,
+	addonNames ...string,
+) *ClusterChangeTrigger {
+	return &ClusterChangeTrigger{
+		manager:     manager,
+		addonLister: addonLister,
+		addonNames:  addonNames,
+	}
+}
+
+// OnUpdate triggers the addons deployed to or hosted on the cluster when the values relevant
+// ManagedCluster fields changed. It satisfies the UpdateFunc of a cache.ResourceEventHandlerFuncs.
+func (t *ClusterChangeTrigger) OnUpdate(oldObj, newObj interface{}) {
+	oldCluster, ok := oldObj.(*clusterv1.ManagedCluster)
+	if !ok {
+		return
+	}
+
+	newCluster, ok := newObj.(*clusterv1.ManagedCluster)
+	if !ok {
+		return
+	}
+
+	if !ClusterValuesChanged(oldCluster, newCluster) {
+		return
+	}
+
+	for _, key := range t.addonsForCluster(newCluster.Name) {
+		log.V(2).Info("Triggering addon after ManagedCluster change",
+			"cluster", key.clusterName, "addon", key.addonName, "changedCluster", newCluster.Name)
+
+		t.manager.Trigger(key.clusterName, key.addonName)
+	}
+}
+
+type addonKey struct {
+	clusterName string
+	addonName   string
+}
+
+// addonsForCluster returns the addons that are deployed to the cluster, along with any hosted
+// addons that are hosted on the cluster.
+func (t *ClusterChangeTrigger) addonsForCluster(clusterName string) []addonKey {
+	keys := make([]addonKey, 0, len(t.addonNames))
+
+	for _, addonName := range t.addonNames {
+		keys = append(keys, addonKey{clusterName: clusterName, addonName: addonName})
+	}
+
+	addons, err := t.addonLister.List(labels.Everything())
+	if err != nil {
+		log.Error(err, "Failed to list the ManagedClusterAddOns hosted on the cluster", "cluster", clusterName)
+
+		return keys
+	}
+
+	for _, addon := range addons {
+		if !slices.Contains(t.addonNames, addon.Name) || addon.Namespace == clusterName {
+			continue
+		}
+
+		if addon.GetAnnotations()[addonapiv1alpha1.HostingClusterNameAnnotationKey] == clusterName {
+			keys = append(keys, addonKey{clusterName: addon.Namespace, addonName: addon.Name})
+		}
+	}
+
+	return keys
+}
+
+// StartClusterChangeTrigger registers a ClusterChangeTrigger for the given addons on the manager,
+// using the shared hub informers.
+func StartClusterChangeTrigger(
+	ctx context.Context,
+	mgr addonmanager.AddonManager,
+	controllerContext *controllercmd.ControllerContext,
+	addonNames ...string,
+) error {
+	hubInformers, err := GetHubInformers(controllerContext)
+	if err != nil {
+		return err
+	}
+
+	addonInformer := hubInformers.Addon.Addon().V1alpha1().ManagedClusterAddOns()
+	clusterInformer := hubInformers.Cluster.Cluster().V1().ManagedClusters()
+
+	trigger := NewClusterChangeTrigger(mgr, addonInformer.Lister(), addonNames...)
+
+	_, err = clusterInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: trigger.OnUpdate,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add the ManagedCluster event handler: %w", err)
+	}
+
+	hubInformers.Start(ctx)
+
+	return nil
+}
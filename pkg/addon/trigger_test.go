@@ -0,0 +1,248 @@
+package addon
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	addoninformers "open-cluster-management.io/api/client/addon/informers/externalversions"
+	addonlistersv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
+	clusterv1informers "open-cluster-management.io/api/client/cluster/informers/externalversions"
+	workclientset "open-cluster-management.io/api/client/work/clientset/versioned"
+	workv1informers "open-cluster-management.io/api/client/work/informers/externalversions/work/v1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+// fakeManager records the addons triggered on it.
+type fakeManager struct {
+	lock      sync.Mutex
+	triggered []string
+	onTrigger func(clusterName, addonName string)
+}
+
+func (m *fakeManager) AddAgent(agent.AgentAddon) error {
+	return nil
+}
+
+func (m *fakeManager) Trigger(clusterName, addonName string) {
+	if m.onTrigger != nil {
+		m.onTrigger(clusterName, addonName)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.triggered = append(m.triggered, clusterName+"/"+addonName)
+}
+
+func (m *fakeManager) StartWithInformers(
+	context.Context,
+	workclientset.Interface,
+	workv1informers.ManifestWorkInformer,
+	kubeinformers.SharedInformerFactory,
+	addoninformers.SharedInformerFactory,
+	clusterv1informers.SharedInformerFactory,
+	dynamicinformer.DynamicSharedInformerFactory,
+) error {
+	return nil
+}
+
+func (m *fakeManager) Start(context.Context) error {
+	return nil
+}
+
+func (m *fakeManager) getTriggered() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return slices.Clone(m.triggered)
+}
+
+// newTestCluster returns a ManagedCluster with the values inputs of an OpenShift cluster.
+func newTestCluster() *clusterv1.ManagedCluster {
+	cluster := &clusterv1.ManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster1",
+			Labels: map[string]string{
+				"vendor": "OpenShift", "openshiftVersion-major": "4", "local-cluster": "false",
+				ArchitectureLabel: "amd64", "other": "label",
+			},
+			Annotations: map[string]string{"annotation": "value"},
+		},
+	}
+
+	cluster.Status.Version.Kubernetes = "v1.30.0"
+
+	for _, claim := range clusterValuesClaims {
+		cluster.Status.ClusterClaims = append(cluster.Status.ClusterClaims,
+			clusterv1.ManagedClusterClaim{Name: claim, Value: "value"})
+	}
+
+	cluster.Status.ClusterClaims = append(cluster.Status.ClusterClaims,
+		clusterv1.ManagedClusterClaim{Name: "other.open-cluster-management.io", Value: "value"})
+
+	return cluster
+}
+
+func TestClusterValuesChanged(t *testing.T) {
+	tests := map[string]struct {
+		update  func(cluster *clusterv1.ManagedCluster)
+		changed bool
+	}{
+		"no change": {
+			update: func(*clusterv1.ManagedCluster) {},
+		},
+		"other label": {
+			update: func(cluster *clusterv1.ManagedCluster) { cluster.Labels["other"] = "changed" },
+		},
+		"other claim": {
+			update: func(cluster *clusterv1.ManagedCluster) {
+				cluster.Status.ClusterClaims[len(cluster.Status.ClusterClaims)-1].Value = "changed"
+			},
+		},
+		"other status": {
+			update: func(cluster *clusterv1.ManagedCluster) {
+				cluster.Status.Allocatable = clusterv1.ResourceList{}
+				cluster.Status.Conditions = []metav1.Condition{{Type: "ManagedClusterConditionAvailable"}}
+			},
+		},
+		"Kubernetes version": {
+			update:  func(cluster *clusterv1.ManagedCluster) { cluster.Status.Version.Kubernetes = "v1.31.0" },
+			changed: true,
+		},
+		"annotation changed": {
+			update:  func(cluster *clusterv1.ManagedCluster) { cluster.Annotations["annotation"] = "changed" },
+			changed: true,
+		},
+		"annotation added": {
+			update:  func(cluster *clusterv1.ManagedCluster) { cluster.Annotations["added"] = "value" },
+			changed: true,
+		},
+	}
+
+	for _, label := range clusterValuesLabels {
+		tests["label "+label+" changed"] = struct {
+			update  func(cluster *clusterv1.ManagedCluster)
+			changed bool
+		}{
+			update:  func(cluster *clusterv1.ManagedCluster) { cluster.Labels[label] = "changed" },
+			changed: true,
+		}
+
+		tests["label "+label+" removed"] = struct {
+			update  func(cluster *clusterv1.ManagedCluster)
+			changed bool
+		}{
+			update:  func(cluster *clusterv1.ManagedCluster) { delete(cluster.Labels, label) },
+			changed: true,
+		}
+	}
+
+	for i, claim := range clusterValuesClaims {
+		tests["claim "+claim+" changed"] = struct {
+			update  func(cluster *clusterv1.ManagedCluster)
+			changed bool
+		}{
+			update:  func(cluster *clusterv1.ManagedCluster) { cluster.Status.ClusterClaims[i].Value = "changed" },
+			changed: true,
+		}
+
+		tests["claim "+claim+" removed"] = struct {
+			update  func(cluster *clusterv1.ManagedCluster)
+			changed bool
+		}{
+			update: func(cluster *clusterv1.ManagedCluster) {
+				cluster.Status.ClusterClaims = slices.Delete(cluster.Status.ClusterClaims, i, i+1)
+			},
+			changed: true,
+		}
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			oldCluster := newTestCluster()
+			newCluster := oldCluster.DeepCopy()
+			test.update(newCluster)
+
+			if changed := ClusterValuesChanged(oldCluster, newCluster); changed != test.changed {
+				t.Fatalf("expected the values inputs to be changed: %v, got %v", test.changed, changed)
+			}
+		})
+	}
+}
+
+func TestClusterChangeTriggerOnUpdate(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+	})
+
+	for _, addon := range []*addonapiv1alpha1.ManagedClusterAddOn{
+		newHostedAddon("cluster2", "cluster1", "namespace", 0),
+		newHostedAddon("cluster3", "other-hosting", "namespace", 0),
+		{ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller", Namespace: "cluster1"}},
+		{ObjectMeta: metav1.ObjectMeta{
+			Name:        "other-addon",
+			Namespace:   "cluster4",
+			Annotations: map[string]string{addonapiv1alpha1.HostingClusterNameAnnotationKey: "cluster1"},
+		}},
+	} {
+		if err := indexer.Add(addon); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := map[string]struct {
+		update    func(cluster *clusterv1.ManagedCluster)
+		oldObj    interface{}
+		triggered []string
+	}{
+		"values inputs changed": {
+			update: func(cluster *clusterv1.ManagedCluster) { cluster.Labels["vendor"] = "EKS" },
+			triggered: []string{
+				"cluster1/config-policy-controller",
+				"cluster1/governance-policy-framework",
+				"cluster2/config-policy-controller",
+			},
+		},
+		"values inputs unchanged": {
+			update: func(cluster *clusterv1.ManagedCluster) { cluster.Labels["other"] = "changed" },
+		},
+		"not a ManagedCluster": {
+			update: func(cluster *clusterv1.ManagedCluster) { cluster.Labels["vendor"] = "EKS" },
+			oldObj: cache.DeletedFinalStateUnknown{},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			manager := &fakeManager{}
+			trigger := NewClusterChangeTrigger(manager, addonlistersv1alpha1.NewManagedClusterAddOnLister(indexer),
+				"config-policy-controller", "governance-policy-framework")
+
+			oldCluster := newTestCluster()
+			newCluster := oldCluster.DeepCopy()
+			test.update(newCluster)
+
+			oldObj := test.oldObj
+			if oldObj == nil {
+				oldObj = oldCluster
+			}
+
+			trigger.OnUpdate(oldObj, newCluster)
+
+			triggered := manager.getTriggered()
+			slices.Sort(triggered)
+
+			if !slices.Equal(triggered, test.triggered) {
+				t.Fatalf("expected the addons %v to be triggered, got %v", test.triggered, triggered)
+			}
+		})
+	}
+}
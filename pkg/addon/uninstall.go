@@ -0,0 +1,628 @@
+package addon
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/openshift/library-go/pkg/controller/controllercmd"
+	batchv1 "k8s.io/api/batch/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/tools/cache"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	addonv1alpha1client "open-cluster-management.io/api/client/addon/clientset/versioned"
+	addonlistersv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
+	workv1client "open-cluster-management.io/api/client/work/clientset/versioned"
+	workinformers "open-cluster-management.io/api/client/work/informers/externalversions"
+	worklistersv1 "open-cluster-management.io/api/client/work/listers/work/v1"
+	workv1 "open-cluster-management.io/api/work/v1"
+	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
+)
+
+const (
+	// UninstallTimeoutAnnotation overrides the default uninstall timeout for an addon, as a Go
+	// duration like "15m".
+	UninstallTimeoutAnnotation = "policy-addon-uninstall-timeout"
+	// ForceUninstallAnnotation set to "true" removes the addon without waiting for the cleanup.
+	ForceUninstallAnnotation = "policy-addon-force-uninstall"
+
+	// UninstallCondition is the ManagedClusterAddOn condition reporting the uninstall progress.
+	UninstallCondition = "PolicyAddonUninstalling"
+
+	// Uninstall phases, reported as the reason of the UninstallCondition
+	UninstallPhaseWaitingForCleanup = "WaitingForCleanup"
+	UninstallPhaseCleanupPending    = "CleanupPodPending"
+	UninstallPhaseCleanupRunning    = "CleanupPodRunning"
+	UninstallPhaseCleanupFailed     = "CleanupPodFailed"
+	UninstallPhaseCleanupCompleted  = "CleanupCompleted"
+	UninstallPhaseTimedOut          = "UninstallTimedOut"
+	UninstallPhaseForceRemoved      = "ForceRemoved"
+
+	// DefaultUninstallTimeout is the default of the uninstall-timeout flag of the controller.
+	DefaultUninstallTimeout = 10 * time.Minute
+
+	// cleanupStatusLabel labels the ManifestWorks reporting the status of the cleanup Jobs.
+	cleanupStatusLabel = "policy.open-cluster-management.io/cleanup-status"
+
+	// Status feedback names of the cleanup status ManifestWork
+	jobFailedFeedback       = "JobFailed"
+	jobFailedReasonFeedback = "JobFailedReason"
+	jobActiveFeedback       = "Active"
+	jobReadyFeedback        = "Ready"
+	jobFailedPodsFeedback   = "Failed"
+)
+
+// preDeleteFinalizers are the finalizers the addon framework sets while the cleanup hook runs.
+var preDeleteFinalizers = []string{
+	addonapiv1alpha1.AddonPreDeleteHookFinalizer,
+	addonapiv1alpha1.AddonHostingPreDeleteHookFinalizer,
+	addonapiv1alpha1.AddonDeprecatedPreDeleteHookFinalizer,
+	addonapiv1alpha1.AddonDeprecatedHostingPreDeleteHookFinalizer,
+}
+
+// UninstallTracker reports the progress of the pre-delete cleanup of policy addons, based on the
+// status feedback of the cleanup Job or pod in the hook ManifestWork, and enforces the uninstall
+// timeout. Since the addon framework only requests whether a cleanup Job completed, the tracker
+// requests the rest of the Job status with a separate ManifestWork.
+type UninstallTracker struct {
+	addonClient    addonv1alpha1client.Interface
+	workClient     workv1client.Interface
+	addonLister    addonlistersv1alpha1.ManagedClusterAddOnLister
+	workLister     worklistersv1.ManifestWorkLister
+	statusUpdater  *AddonStatusUpdater
+	hooks          map[string]*UninstallHook
+	defaultTimeout time.Duration
+	now            func() time.Time
+}
+
+// UninstallProgress is the uninstall phase of an addon being deleted.
+type UninstallProgress struct {
+	Phase   string
+	Message string
+}
+
+// hookWorkKey returns the namespace and name of the pre-delete hook ManifestWork of the addon.
+func hookWorkKey(addon *addonapiv1alpha1.ManagedClusterAddOn) (string, string) {
+	hostingClusterName := addon.GetAnnotations()[addonapiv1alpha1.HostingClusterNameAnnotationKey]
+	if hostingClusterName != "" {
+		return hostingClusterName, constants.PreDeleteHookHostingWorkName(addon.Namespace, addon.Name)
+	}
+
+	return addon.Namespace, constants.PreDeleteHookWorkName(addon.Name)
+}
+
+// hookFeedback returns the named status feedback value of the first resource of the given type in
+// the ManifestWork, or nil when it's not reported.
+func hookFeedback(work *workv1.ManifestWork, resource string, name string) *workv1.FieldValue {
+	if work == nil {
+		return nil
+	}
+
+	for _, manifest := range work.Status.ResourceStatus.Manifests {
+		if manifest.ResourceMeta.Resource != resource {
+			continue
+		}
+
+		for _, value := range manifest.StatusFeedbacks.Values {
+			if value.Name == name {
+				return &value.Value
+			}
+		}
+	}
+
+	return nil
+}
+
+// hookFeedbackString returns the named string status feedback value, or "".
+func hookFeedbackString(work *workv1.ManifestWork, resource string, name string) string {
+	if value := hookFeedback(work, resource, name); value != nil && value.String != nil {
+		return *value.String
+	}
+
+	return ""
+}
+
+// hookFeedbackInteger returns the named integer status feedback value, or -1.
+func hookFeedbackInteger(work *workv1.ManifestWork, resource string, name string) int64 {
+	if value := hookFeedback(work, resource, name); value != nil && value.Integer != nil {
+		return *value.Integer
+	}
+
+	return -1
+}
+
+// cleanupJob returns the identifier of the cleanup Job in the pre-delete hook ManifestWork, or nil
+// when the hook doesn't run a Job.
+func cleanupJob(work *workv1.ManifestWork) *workv1.ResourceIdentifier {
+	for _, config := range work.Spec.ManifestConfigs {
+		if config.ResourceIdentifier.Resource == "jobs" {
+			return &config.ResourceIdentifier
+		}
+	}
+
+	return nil
+}
+
+// cleanupStatusWorkName returns the name of the ManifestWork reporting the status of the cleanup Job
+// of the addon. It doesn't start with the hook ManifestWork name, since the addon framework manages
+// the works whose names start with it.
+func cleanupStatusWorkName(addon *addonapiv1alpha1.ManagedClusterAddOn) string {
+	if addon.GetAnnotations()[addonapiv1alpha1.HostingClusterNameAnnotationKey] != "" {
+		return "policy-addon-" + addon.Name + "-cleanup-status-" + addon.Namespace
+	}
+
+	return "policy-addon-" + addon.Name + "-cleanup-status"
+}
+
+// buildCleanupStatusWork returns a ReadOnly ManifestWork requesting the cleanup Job status that the
+// addon framework doesn't request in the hook ManifestWork: the Failed condition, and the active,
+// ready, and failed pod counts. Since it's ReadOnly, deleting it doesn't delete the Job.
+func buildCleanupStatusWork(
+	addon *addonapiv1alpha1.ManagedClusterAddOn, namespace string, job *workv1.ResourceIdentifier,
+) (*workv1.ManifestWork, error) {
+	manifest := &unstructured.Unstructured{}
+	manifest.SetAPIVersion(batchv1.SchemeGroupVersion.String())
+	manifest.SetKind("Job")
+	manifest.SetName(job.Name)
+	manifest.SetNamespace(job.Namespace)
+
+	raw, err := manifest.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	work := &workv1.ManifestWork{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cleanupStatusWorkName(addon),
+			Namespace: namespace,
+			Labels: map[string]string{
+				addonapiv1alpha1.AddonLabelKey:          addon.Name,
+				addonapiv1alpha1.AddonNamespaceLabelKey: addon.Namespace,
+				cleanupStatusLabel:                      "",
+			},
+		},
+		Spec: workv1.ManifestWorkSpec{
+			Workload: workv1.ManifestsTemplate{
+				Manifests: []workv1.Manifest{{RawExtension: runtime.RawExtension{Raw: raw}}},
+			},
+			ManifestConfigs: []workv1.ManifestConfigOption{{
+				ResourceIdentifier: *job,
+				UpdateStrategy:     &workv1.UpdateStrategy{Type: workv1.UpdateStrategyTypeReadOnly},
+				FeedbackRules: []workv1.FeedbackRule{{
+					Type: workv1.JSONPathsType,
+					JsonPaths: []workv1.JsonPath{
+						{Name: jobFailedFeedback, Path: `.status.conditions[?(@.type=="Failed")].status`},
+						{Name: jobFailedReasonFeedback, Path: `.status.conditions[?(@.type=="Failed")].reason`},
+						{Name: jobActiveFeedback, Path: ".status.active"},
+						{Name: jobReadyFeedback, Path: ".status.ready"},
+						{Name: jobFailedPodsFeedback, Path: ".status.failed"},
+					},
+				}},
+			}},
+		},
+	}
+
+	// The owner reference only applies in the addon namespace, so hosted addons delete it explicitly
+	if namespace == addon.Namespace {
+		work.OwnerReferences = []metav1.OwnerReference{
+			*metav1.NewControllerRef(addon, addonapiv1alpha1.SchemeGroupVersion.WithKind("ManagedClusterAddOn")),
+		}
+	}
+
+	return work, nil
+}
+
+// GetUninstallProgress determines the uninstall phase from the pre-delete hook ManifestWork, which
+// is nil when it wasn't created yet, and the ManifestWork reporting the cleanup Job status, which is
+// nil when the hook runs a pod or the status isn't reported yet.
+func GetUninstallProgress(work *workv1.ManifestWork, statusWork *workv1.ManifestWork) UninstallProgress {
+	if work == nil {
+		return UninstallProgress{
+			Phase:   UninstallPhaseWaitingForCleanup,
+			Message: "Waiting for the cleanup ManifestWork to be created",
+		}
+	}
+
+	if !meta.IsStatusConditionTrue(work.Status.Conditions, workv1.WorkApplied) {
+		message := fmt.Sprintf("Waiting for the cleanup ManifestWork %s to be applied on the cluster", work.Name)
+
+		if applied := meta.FindStatusCondition(work.Status.Conditions, workv1.WorkApplied); applied != nil &&
+			applied.Message != "" {
+			message += ": " + applied.Message
+		}
+
+		return UninstallProgress{Phase: UninstallPhaseWaitingForCleanup, Message: message}
+	}
+
+	if cleanupJob(work) != nil {
+		return getJobProgress(work, statusWork)
+	}
+
+	switch phase := hookFeedbackString(work, "pods", "PodPhase"); phase {
+	case "Succeeded":
+		return UninstallProgress{
+			Phase:   UninstallPhaseCleanupCompleted,
+			Message: "The cleanup pod completed",
+		}
+	case "Failed":
+		return UninstallProgress{
+			Phase: UninstallPhaseCleanupFailed,
+			Message: "The cleanup pod failed, check its logs on the cluster, or set the " + ForceUninstallAnnotation +
+				" annotation to \"true\" to remove the addon without the cleanup",
+		}
+	case "Running":
+		return UninstallProgress{
+			Phase:   UninstallPhaseCleanupRunning,
+			Message: "The cleanup pod is removing the policy resources from the cluster",
+		}
+	case "Pending":
+		return UninstallProgress{
+			Phase:   UninstallPhaseCleanupPending,
+			Message: "The cleanup pod is pending, for example while it's scheduled or its image is pulled",
+		}
+	default:
+		return UninstallProgress{
+			Phase:   UninstallPhaseWaitingForCleanup,
+			Message: "Waiting for the cleanup pod status to be reported",
+		}
+	}
+}
+
+// getJobProgress determines the uninstall phase of a cleanup Job from the well-known Job status in
+// the hook ManifestWork and the additional status in the cleanup status ManifestWork.
+func getJobProgress(work *workv1.ManifestWork, statusWork *workv1.ManifestWork) UninstallProgress {
+	if hookFeedbackString(work, "jobs", "JobComplete") == "True" {
+		return UninstallProgress{
+			Phase:   UninstallPhaseCleanupCompleted,
+			Message: "The cleanup job completed",
+		}
+	}
+
+	if hookFeedbackString(statusWork, "jobs", jobFailedFeedback) == "True" {
+		message := "The cleanup job failed"
+
+		if reason := hookFeedbackString(statusWork, "jobs", jobFailedReasonFeedback); reason != "" {
+			message += " (" + reason + ")"
+		}
+
+		return UninstallProgress{
+			Phase: UninstallPhaseCleanupFailed,
+			Message: message + ", check the logs of its pods on the cluster, or set the " + ForceUninstallAnnotation +
+				" annotation to \"true\" to remove the addon without the cleanup",
+		}
+	}
+
+	message := "The cleanup job is removing the policy resources from the cluster"
+
+	if failed := hookFeedbackInteger(statusWork, "jobs", jobFailedPodsFeedback); failed > 0 {
+		message += fmt.Sprintf(", after %d failed pods", failed)
+	}
+
+	// Clusters that don't report the ready pods of Jobs are only reported as running
+	if hookFeedbackInteger(statusWork, "jobs", jobActiveFeedback) > 0 &&
+		hookFeedbackInteger(statusWork, "jobs", jobReadyFeedback) == 0 {
+		return UninstallProgress{
+			Phase: UninstallPhaseCleanupPending,
+			Message: "The cleanup job pod isn't running, for example while it's scheduled, its image is pulled, " +
+				"or it's restarted after an error; check its pods on the cluster",
+		}
+	}
+
+	return UninstallProgress{Phase: UninstallPhaseCleanupRunning, Message: message}
+}
+
+// uninstallTimeout returns the uninstall timeout of the addon, from its annotation or the default.
+func (t *UninstallTracker) uninstallTimeout(addon *addonapiv1alpha1.ManagedClusterAddOn) time.Duration {
+	if value, ok := addon.GetAnnotations()[UninstallTimeoutAnnotation]; ok {
+		timeout, err := time.ParseDuration(value)
+		if err == nil && timeout > 0 {
+			return timeout
+		}
+
+		log.Info(fmt.Sprintf(AnnotationParseErrorFmt, UninstallTimeoutAnnotation, value, addon.Name, t.defaultTimeout))
+	}
+
+	return t.defaultTimeout
+}
+
+// sync reports the uninstall progress of the addon key, removing the pre-delete finalizers when the
+// uninstall is forced.
+func (t *UninstallTracker) sync(ctx context.Context, syncCtx factory.SyncContext, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil
+	}
+
+	hook, ok := t.hooks[name]
+	if !ok {
+		return nil
+	}
+
+	addon, err := t.addonLister.ManagedClusterAddOns(namespace).Get(name)
+	if k8serrors.IsNotFound(err) {
+		return t.deleteCleanupStatusWorks(ctx, namespace, name)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if addon.DeletionTimestamp.IsZero() || !slices.ContainsFunc(addon.Finalizers, func(f string) bool {
+		return slices.Contains(preDeleteFinalizers, f)
+	}) {
+		return t.deleteCleanupStatusWorks(ctx, namespace, name)
+	}
+
+	if strings.EqualFold(addon.GetAnnotations()[ForceUninstallAnnotation], "true") {
+		return t.forceRemove(ctx, addon, hook)
+	}
+
+	workNamespace, workName := hookWorkKey(addon)
+
+	work, err := t.workLister.ManifestWorks(workNamespace).Get(workName)
+	if err != nil {
+		if !k8serrors.IsNotFound(err) {
+			return err
+		}
+
+		work = nil
+	}
+
+	var statusWork *workv1.ManifestWork
+
+	if work != nil {
+		statusWork, err = t.cleanupStatusWork(ctx, addon, work)
+		if err != nil {
+			return err
+		}
+	}
+
+	progress := GetUninstallProgress(work, statusWork)
+	elapsed := t.now().Sub(addon.DeletionTimestamp.Time)
+	timeout := t.uninstallTimeout(addon)
+
+	condition := metav1.Condition{
+		Type:    UninstallCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  progress.Phase,
+		Message: fmt.Sprintf("%s (%s elapsed)", progress.Message, elapsed.Truncate(time.Second)),
+	}
+
+	switch {
+	case progress.Phase == UninstallPhaseCleanupCompleted:
+		condition.Status = metav1.ConditionFalse
+	case elapsed >= timeout:
+		condition.Reason = UninstallPhaseTimedOut
+		condition.Message = fmt.Sprintf("The uninstall did not complete within %s: %s. To remove the addon "+
+			"without waiting for the cleanup, set the %s annotation to \"true\"; %s", timeout, progress.Message,
+			ForceUninstallAnnotation, hook.leftovers())
+	default:
+		// Check again once the timeout is reached, in case the cleanup status doesn't change
+		syncCtx.Queue().AddAfter(key, timeout-elapsed)
+	}
+
+	if meta.IsStatusConditionPresentAndEqual(addon.Status.Conditions, UninstallCondition, condition.Status) &&
+		meta.FindStatusCondition(addon.Status.Conditions, UninstallCondition).Reason == condition.Reason {
+		// Only update the elapsed time in the message when the phase changes
+		return nil
+	}
+
+	log.Info("Policy addon uninstall progress", "cluster", addon.Namespace, "addon", addon.Name,
+		"phase", condition.Reason)
+
+	return t.statusUpdater.SetCondition(ctx, addon, condition)
+}
+
+// cleanupStatusWork returns the ManifestWork reporting the status of the cleanup Job in the hook
+// ManifestWork, creating it when it doesn't exist. It returns nil when the hook doesn't run a Job or
+// the ManifestWork was just created.
+func (t *UninstallTracker) cleanupStatusWork(
+	ctx context.Context, addon *addonapiv1alpha1.ManagedClusterAddOn, hookWork *workv1.ManifestWork,
+) (*workv1.ManifestWork, error) {
+	job := cleanupJob(hookWork)
+	if job == nil {
+		return nil, nil
+	}
+
+	statusWork, err := t.workLister.ManifestWorks(hookWork.Namespace).Get(cleanupStatusWorkName(addon))
+	if err == nil || !k8serrors.IsNotFound(err) {
+		return statusWork, err
+	}
+
+	required, err := buildCleanupStatusWork(addon, hookWork.Namespace, job)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = t.workClient.WorkV1().ManifestWorks(required.Namespace).Create(ctx, required, metav1.CreateOptions{})
+	if err != nil && !k8serrors.IsAlreadyExists(err) {
+		return nil, fmt.Errorf("failed to create the cleanup status ManifestWork %s: %w", required.Name, err)
+	}
+
+	return nil, nil
+}
+
+// deleteCleanupStatusWorks deletes the ManifestWorks reporting the cleanup Job status of the addon
+// once it's no longer being uninstalled.
+func (t *UninstallTracker) deleteCleanupStatusWorks(ctx context.Context, namespace string, name string) error {
+	selector := labels.SelectorFromSet(labels.Set{
+		addonapiv1alpha1.AddonLabelKey:          name,
+		addonapiv1alpha1.AddonNamespaceLabelKey: namespace,
+		cleanupStatusLabel:                      "",
+	})
+
+	works, err := t.workLister.List(selector)
+	if err != nil {
+		return err
+	}
+
+	for _, work := range works {
+		err := t.workClient.WorkV1().ManifestWorks(work.Namespace).Delete(ctx, work.Name, metav1.DeleteOptions{})
+		if err := ignoreNotFound(err); err != nil {
+			return fmt.Errorf("failed to delete the cleanup status ManifestWork %s: %w", work.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// forceRemove removes the pre-delete finalizers from the addon so it's deleted without waiting for
+// the cleanup.
+func (t *UninstallTracker) forceRemove(
+	ctx context.Context, addon *addonapiv1alpha1.ManagedClusterAddOn, hook *UninstallHook,
+) error {
+	log.Info("Forcing the removal of the policy addon, the cleanup may not have completed",
+		"cluster", addon.Namespace, "addon", addon.Name)
+
+	if err := t.statusUpdater.SetCondition(ctx, addon, metav1.Condition{
+		Type:   UninstallCondition,
+		Status: metav1.ConditionFalse,
+		Reason: UninstallPhaseForceRemoved,
+		Message: "The addon was removed without waiting for the cleanup because of the " + ForceUninstallAnnotation +
+			" annotation; " + hook.leftovers(),
+	}); err != nil {
+		return err
+	}
+
+	updated, err := t.addonClient.AddonV1alpha1().ManagedClusterAddOns(addon.Namespace).Get(
+		ctx, addon.Name, metav1.GetOptions{},
+	)
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+
+	updated.Finalizers = slices.DeleteFunc(updated.Finalizers, func(f string) bool {
+		return slices.Contains(preDeleteFinalizers, f)
+	})
+
+	_, err = t.addonClient.AddonV1alpha1().ManagedClusterAddOns(addon.Namespace).Update(
+		ctx, updated, metav1.UpdateOptions{},
+	)
+
+	return ignoreNotFound(err)
+}
+
+func ignoreNotFound(err error) error {
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+
+	return err
+}
+
+// StartUninstallTracker starts a controller reporting the uninstall progress of the addons with the
+// given hooks, using informers on the ManagedClusterAddOns and their pre-delete hook ManifestWorks.
+// The uninstall times out after defaultTimeout, unless the addon overrides it.
+func StartUninstallTracker(
+	ctx context.Context,
+	controllerContext *controllercmd.ControllerContext,
+	defaultTimeout time.Duration,
+	hooks ...*UninstallHook,
+) error {
+	if defaultTimeout <= 0 {
+		return fmt.Errorf("invalid uninstall timeout %s, it must be positive", defaultTimeout)
+	}
+
+	addonClient, err := addonv1alpha1client.NewForConfig(controllerContext.KubeConfig)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve addon client: %w", err)
+	}
+
+	workClient, err := workv1client.NewForConfig(controllerContext.KubeConfig)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve work client: %w", err)
+	}
+
+	statusUpdater, err := NewAddonStatusUpdater(controllerContext.KubeConfig)
+	if err != nil {
+		return err
+	}
+
+	hooksByAddon := make(map[string]*UninstallHook, len(hooks))
+	addonNames := make([]string, 0, len(hooks))
+
+	for _, hook := range hooks {
+		hooksByAddon[hook.AddonName] = hook
+		addonNames = append(addonNames, hook.AddonName)
+	}
+
+	addonNameRequirement, err := labels.NewRequirement(
+		addonapiv1alpha1.AddonLabelKey, selection.In, addonNames,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to build the ManifestWork label selector: %w", err)
+	}
+
+	hubInformers, err := GetHubInformers(controllerContext)
+	if err != nil {
+		return err
+	}
+
+	addonInformer := hubInformers.Addon.Addon().V1alpha1().ManagedClusterAddOns()
+	workInformer := workinformers.NewSharedInformerFactoryWithOptions(workClient, 10*time.Minute,
+		workinformers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = labels.NewSelector().Add(*addonNameRequirement).String()
+		}),
+	).Work().V1().ManifestWorks()
+
+	tracker := &UninstallTracker{
+		addonClient:    addonClient,
+		workClient:     workClient,
+		addonLister:    addonInformer.Lister(),
+		workLister:     workInformer.Lister(),
+		statusUpdater:  statusUpdater,
+		hooks:          hooksByAddon,
+		defaultTimeout: defaultTimeout,
+		now:            time.Now,
+	}
+
+	controller := factory.New().
+		WithFilteredEventsInformersQueueKeysFunc(
+			func(obj runtime.Object) []string {
+				key, _ := cache.MetaNamespaceKeyFunc(obj)
+
+				return []string{key}
+			},
+			func(obj interface{}) bool {
+				accessor, err := meta.Accessor(obj)
+
+				return err == nil && slices.Contains(addonNames, accessor.GetName())
+			},
+			addonInformer.Informer(),
+		).
+		WithInformersQueueKeysFunc(
+			func(obj runtime.Object) []string {
+				accessor, err := meta.Accessor(obj)
+				if err != nil {
+					return nil
+				}
+
+				// Hosted hook works are in the hosting cluster namespace and label the addon namespace
+				addonNamespace := accessor.GetLabels()[addonapiv1alpha1.AddonNamespaceLabelKey]
+				if addonNamespace == "" {
+					addonNamespace = accessor.GetNamespace()
+				}
+
+				return []string{addonNamespace + "/" + accessor.GetLabels()[addonapiv1alpha1.AddonLabelKey]}
+			},
+			workInformer.Informer(),
+		).
+		WithSync(tracker.sync).
+		ToController("policy-addon-uninstall-tracker")
+
+	hubInformers.Start(ctx)
+
+	go workInformer.Informer().Run(ctx.Done())
+	go controller.Run(ctx, 1)
+
+	return nil
+}
@@ -0,0 +1,519 @@
+package addon
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+	addonlistersv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
+	fakework "open-cluster-management.io/api/client/work/clientset/versioned/fake"
+	worklistersv1 "open-cluster-management.io/api/client/work/listers/work/v1"
+	workv1 "open-cluster-management.io/api/work/v1"
+	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
+)
+
+func stringFeedback(name string, value string) workv1.FeedbackValue {
+	return workv1.FeedbackValue{Name: name, Value: workv1.FieldValue{Type: workv1.String, String: &value}}
+}
+
+func integerFeedback(name string, value int64) workv1.FeedbackValue {
+	return workv1.FeedbackValue{Name: name, Value: workv1.FieldValue{Type: workv1.Integer, Integer: &value}}
+}
+
+// newHookWork returns an applied ManifestWork in the cluster1 namespace running the cleanup as the
+// resource, "jobs" or "pods", with the status feedback of that resource.
+func newHookWork(name string, resource string, feedback ...workv1.FeedbackValue) *workv1.ManifestWork {
+	work := &workv1.ManifestWork{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "cluster1",
+			Labels: map[string]string{
+				addonapiv1alpha1.AddonLabelKey: "config-policy-controller",
+			},
+		},
+		Spec: workv1.ManifestWorkSpec{
+			ManifestConfigs: []workv1.ManifestConfigOption{{
+				ResourceIdentifier: workv1.ResourceIdentifier{
+					Resource: resource, Name: "config-policy-controller-uninstall", Namespace: "agent",
+				},
+			}},
+		},
+		Status: workv1.ManifestWorkStatus{
+			Conditions: []metav1.Condition{{Type: workv1.WorkApplied, Status: metav1.ConditionTrue}},
+			ResourceStatus: workv1.ManifestResourceStatus{Manifests: []workv1.ManifestCondition{{
+				ResourceMeta:    workv1.ManifestResourceMeta{Resource: resource},
+				StatusFeedbacks: workv1.StatusFeedbackResult{Values: feedback},
+			}}},
+		},
+	}
+
+	if resource == "jobs" {
+		work.Spec.ManifestConfigs[0].ResourceIdentifier.Group = "batch"
+	}
+
+	return work
+}
+
+func newDeletingAddon(annotations map[string]string) *addonapiv1alpha1.ManagedClusterAddOn {
+	return &addonapiv1alpha1.ManagedClusterAddOn{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "config-policy-controller",
+			Namespace:         "cluster1",
+			UID:               "addon-uid",
+			Annotations:       annotations,
+			DeletionTimestamp: &metav1.Time{Time: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)},
+			Finalizers:        []string{addonapiv1alpha1.AddonPreDeleteHookFinalizer},
+		},
+	}
+}
+
+// newTestTracker returns an UninstallTracker of the config-policy-controller addon whose listers
+// contain the objects.
+func newTestTracker(
+	t *testing.T, now time.Time, objects ...runtime.Object,
+) (*UninstallTracker, *fakeaddon.Clientset, *fakework.Clientset) {
+	t.Helper()
+
+	addonIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+	})
+	workIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+	})
+
+	var addonObjects, workObjects []runtime.Object
+
+	for _, obj := range objects {
+		indexer := workIndexer
+
+		if _, ok := obj.(*addonapiv1alpha1.ManagedClusterAddOn); ok {
+			indexer = addonIndexer
+			addonObjects = append(addonObjects, obj)
+		} else {
+			workObjects = append(workObjects, obj)
+		}
+
+		if err := indexer.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	addonClient := fakeaddon.NewSimpleClientset(addonObjects...)
+	workClient := fakework.NewSimpleClientset(workObjects...)
+
+	tracker := &UninstallTracker{
+		addonClient:   addonClient,
+		workClient:    workClient,
+		addonLister:   addonlistersv1alpha1.NewManagedClusterAddOnLister(addonIndexer),
+		workLister:    worklistersv1.NewManifestWorkLister(workIndexer),
+		statusUpdater: &AddonStatusUpdater{client: addonClient},
+		hooks: map[string]*UninstallHook{
+			"config-policy-controller": {AddonName: "config-policy-controller"},
+		},
+		defaultTimeout: DefaultUninstallTimeout,
+		now:            func() time.Time { return now },
+	}
+
+	return tracker, addonClient, workClient
+}
+
+func TestGetUninstallProgressJob(t *testing.T) {
+	tests := map[string]struct {
+		hookFeedback   []workv1.FeedbackValue
+		statusFeedback []workv1.FeedbackValue
+		phase          string
+		message        string
+	}{
+		"completed": {
+			hookFeedback: []workv1.FeedbackValue{stringFeedback("JobComplete", "True")},
+			phase:        UninstallPhaseCleanupCompleted,
+		},
+		"failed after its retries": {
+			statusFeedback: []workv1.FeedbackValue{
+				stringFeedback(jobFailedFeedback, "True"),
+				stringFeedback(jobFailedReasonFeedback, "BackoffLimitExceeded"),
+				integerFeedback(jobFailedPodsFeedback, 7),
+			},
+			phase:   UninstallPhaseCleanupFailed,
+			message: "The cleanup job failed (BackoffLimitExceeded)",
+		},
+		"pod not running": {
+			statusFeedback: []workv1.FeedbackValue{
+				integerFeedback(jobActiveFeedback, 1), integerFeedback(jobReadyFeedback, 0),
+			},
+			phase: UninstallPhaseCleanupPending,
+		},
+		"pod running": {
+			statusFeedback: []workv1.FeedbackValue{
+				integerFeedback(jobActiveFeedback, 1), integerFeedback(jobReadyFeedback, 1),
+			},
+			phase: UninstallPhaseCleanupRunning,
+		},
+		"pod running after failures": {
+			statusFeedback: []workv1.FeedbackValue{
+				integerFeedback(jobActiveFeedback, 1), integerFeedback(jobReadyFeedback, 1),
+				integerFeedback(jobFailedPodsFeedback, 2),
+			},
+			phase:   UninstallPhaseCleanupRunning,
+			message: "after 2 failed pods",
+		},
+		"ready pods not reported": {
+			statusFeedback: []workv1.FeedbackValue{integerFeedback(jobActiveFeedback, 1)},
+			phase:          UninstallPhaseCleanupRunning,
+		},
+		"job status not reported": {
+			phase: UninstallPhaseCleanupRunning,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			work := newHookWork(constants.PreDeleteHookWorkName("config-policy-controller"), "jobs",
+				test.hookFeedback...)
+
+			var statusWork *workv1.ManifestWork
+			if test.statusFeedback != nil {
+				statusWork = newHookWork("policy-addon-config-policy-controller-cleanup-status", "jobs",
+					test.statusFeedback...)
+			}
+
+			progress := GetUninstallProgress(work, statusWork)
+
+			if progress.Phase != test.phase {
+				t.Fatalf("expected the phase %s, got %s: %s", test.phase, progress.Phase, progress.Message)
+			}
+
+			if !strings.Contains(progress.Message, test.message) {
+				t.Fatalf("expected the message to contain %q, got %q", test.message, progress.Message)
+			}
+		})
+	}
+}
+
+func TestBuildCleanupStatusWork(t *testing.T) {
+	job := &workv1.ResourceIdentifier{
+		Group: "batch", Resource: "jobs", Name: "config-policy-controller-uninstall", Namespace: "agent",
+	}
+
+	tests := map[string]struct {
+		hostingCluster string
+		namespace      string
+		name           string
+		owned          bool
+	}{
+		"default mode": {
+			namespace: "cluster1",
+			name:      "policy-addon-config-policy-controller-cleanup-status",
+			owned:     true,
+		},
+		"hosted mode": {
+			hostingCluster: "hosting",
+			namespace:      "hosting",
+			name:           "policy-addon-config-policy-controller-cleanup-status-cluster1",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			addon := newDeletingAddon(nil)
+			if test.hostingCluster != "" {
+				addon.Annotations = map[string]string{
+					addonapiv1alpha1.HostingClusterNameAnnotationKey: test.hostingCluster,
+				}
+			}
+
+			work, err := buildCleanupStatusWork(addon, test.namespace, job)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if work.Name != test.name || work.Namespace != test.namespace {
+				t.Fatalf("expected the ManifestWork %s/%s, got %s/%s", test.namespace, test.name,
+					work.Namespace, work.Name)
+			}
+
+			// The addon framework manages the works that start with the hook work name
+			_, hookWorkName := hookWorkKey(addon)
+			if strings.HasPrefix(work.Name, hookWorkName) {
+				t.Fatalf("expected the name %s to not start with the hook work name %s", work.Name, hookWorkName)
+			}
+
+			owned := len(work.OwnerReferences) == 1 && work.OwnerReferences[0].UID == addon.UID
+			if owned != test.owned {
+				t.Fatalf("expected the addon owner reference to be %v, got %v", test.owned, work.OwnerReferences)
+			}
+
+			config := work.Spec.ManifestConfigs[0]
+			if config.ResourceIdentifier != *job || config.UpdateStrategy.Type != workv1.UpdateStrategyTypeReadOnly {
+				t.Fatalf("expected the Job to be read only, got %+v", config)
+			}
+
+			manifest := string(work.Spec.Workload.Manifests[0].Raw)
+			if !strings.Contains(manifest, `"name":"config-policy-controller-uninstall"`) {
+				t.Fatalf("expected the manifest to identify the Job, got %s", manifest)
+			}
+		})
+	}
+}
+
+func TestUninstallTrackerCleanupStatusWork(t *testing.T) {
+	addon := newDeletingAddon(nil)
+	hookWork := newHookWork(constants.PreDeleteHookWorkName(addon.Name), "jobs")
+	now := addon.DeletionTimestamp.Add(time.Minute)
+	key := addon.Namespace + "/" + addon.Name
+
+	tracker, addonClient, workClient := newTestTracker(t, now, addon, hookWork)
+
+	if err := tracker.sync(context.TODO(), factory.NewSyncContext("test"), key); err != nil {
+		t.Fatal(err)
+	}
+
+	statusWork, err := workClient.WorkV1().ManifestWorks("cluster1").Get(
+		context.TODO(), cleanupStatusWorkName(addon), metav1.GetOptions{},
+	)
+	if err != nil {
+		t.Fatalf("expected the cleanup status ManifestWork to be created: %v", err)
+	}
+
+	updated, err := addonClient.AddonV1alpha1().ManagedClusterAddOns("cluster1").Get(
+		context.TODO(), addon.Name, metav1.GetOptions{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if condition := meta.FindStatusCondition(updated.Status.Conditions, UninstallCondition); condition == nil ||
+		condition.Reason != UninstallPhaseCleanupRunning {
+		t.Fatalf("expected the cleanup to be running, got %+v", condition)
+	}
+
+	// Once the addon is removed, the cleanup status ManifestWork is deleted
+	tracker, _, workClient = newTestTracker(t, now, hookWork, statusWork)
+
+	if err := tracker.sync(context.TODO(), factory.NewSyncContext("test"), key); err != nil {
+		t.Fatal(err)
+	}
+
+	works, err := workClient.WorkV1().ManifestWorks("cluster1").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(works.Items) != 1 || works.Items[0].Name != hookWork.Name {
+		t.Fatalf("expected only the hook ManifestWork to be left, got %d ManifestWorks", len(works.Items))
+	}
+}
+
+func TestGetUninstallProgress(t *testing.T) {
+	notApplied := newHookWork(constants.PreDeleteHookWorkName("config-policy-controller"), "pods")
+	notApplied.Status.Conditions = []metav1.Condition{{
+		Type: workv1.WorkApplied, Status: metav1.ConditionFalse, Message: "the namespace is terminating",
+	}}
+
+	tests := map[string]struct {
+		work    *workv1.ManifestWork
+		phase   string
+		message string
+	}{
+		"hook work not created": {
+			phase: UninstallPhaseWaitingForCleanup,
+		},
+		"hook work not applied": {
+			work:    notApplied,
+			phase:   UninstallPhaseWaitingForCleanup,
+			message: "the namespace is terminating",
+		},
+		"pod status not reported": {
+			work:  newHookWork("hook", "pods"),
+			phase: UninstallPhaseWaitingForCleanup,
+		},
+		"pod pending": {
+			work:  newHookWork("hook", "pods", stringFeedback("PodPhase", "Pending")),
+			phase: UninstallPhaseCleanupPending,
+		},
+		"pod running": {
+			work:  newHookWork("hook", "pods", stringFeedback("PodPhase", "Running")),
+			phase: UninstallPhaseCleanupRunning,
+		},
+		"pod failed": {
+			work:    newHookWork("hook", "pods", stringFeedback("PodPhase", "Failed")),
+			phase:   UninstallPhaseCleanupFailed,
+			message: ForceUninstallAnnotation,
+		},
+		"pod succeeded": {
+			work:  newHookWork("hook", "pods", stringFeedback("PodPhase", "Succeeded")),
+			phase: UninstallPhaseCleanupCompleted,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			progress := GetUninstallProgress(test.work, nil)
+
+			if progress.Phase != test.phase {
+				t.Fatalf("expected the phase %s, got %s: %s", test.phase, progress.Phase, progress.Message)
+			}
+
+			if !strings.Contains(progress.Message, test.message) {
+				t.Fatalf("expected the message to contain %q, got %q", test.message, progress.Message)
+			}
+		})
+	}
+}
+
+func TestUninstallTrackerSync(t *testing.T) {
+	running := []workv1.FeedbackValue{stringFeedback("PodPhase", "Running")}
+
+	tests := map[string]struct {
+		annotations map[string]string
+		notDeleting bool
+		feedback    []workv1.FeedbackValue
+		noHookWork  bool
+		elapsed     time.Duration
+		condition   *metav1.Condition
+		reason      string
+		status      metav1.ConditionStatus
+		removed     bool
+		patched     bool
+	}{
+		"waiting for the hook work": {
+			noHookWork: true,
+			elapsed:    time.Minute,
+			reason:     UninstallPhaseWaitingForCleanup,
+			status:     metav1.ConditionTrue,
+			patched:    true,
+		},
+		"cleanup running": {
+			feedback: running,
+			elapsed:  time.Minute,
+			reason:   UninstallPhaseCleanupRunning,
+			status:   metav1.ConditionTrue,
+			patched:  true,
+		},
+		"cleanup completed": {
+			feedback: []workv1.FeedbackValue{stringFeedback("PodPhase", "Succeeded")},
+			elapsed:  time.Minute,
+			reason:   UninstallPhaseCleanupCompleted,
+			status:   metav1.ConditionFalse,
+			patched:  true,
+		},
+		"completed after the timeout": {
+			feedback: []workv1.FeedbackValue{stringFeedback("PodPhase", "Succeeded")},
+			elapsed:  time.Hour,
+			reason:   UninstallPhaseCleanupCompleted,
+			status:   metav1.ConditionFalse,
+			patched:  true,
+		},
+		"timed out": {
+			feedback: running,
+			elapsed:  DefaultUninstallTimeout,
+			reason:   UninstallPhaseTimedOut,
+			status:   metav1.ConditionTrue,
+			patched:  true,
+		},
+		"timeout annotation": {
+			annotations: map[string]string{UninstallTimeoutAnnotation: "30m"},
+			feedback:    running,
+			elapsed:     20 * time.Minute,
+			reason:      UninstallPhaseCleanupRunning,
+			status:      metav1.ConditionTrue,
+			patched:     true,
+		},
+		"invalid timeout annotation": {
+			annotations: map[string]string{UninstallTimeoutAnnotation: "soon"},
+			feedback:    running,
+			elapsed:     20 * time.Minute,
+			reason:      UninstallPhaseTimedOut,
+			status:      metav1.ConditionTrue,
+			patched:     true,
+		},
+		"phase unchanged": {
+			feedback: running,
+			elapsed:  2 * time.Minute,
+			condition: &metav1.Condition{
+				Type: UninstallCondition, Status: metav1.ConditionTrue, Reason: UninstallPhaseCleanupRunning,
+			},
+			reason: UninstallPhaseCleanupRunning,
+			status: metav1.ConditionTrue,
+		},
+		"forced": {
+			annotations: map[string]string{ForceUninstallAnnotation: "true"},
+			feedback:    running,
+			elapsed:     time.Minute,
+			reason:      UninstallPhaseForceRemoved,
+			status:      metav1.ConditionFalse,
+			removed:     true,
+			patched:     true,
+		},
+		"not deleting": {
+			annotations: map[string]string{ForceUninstallAnnotation: "true"},
+			notDeleting: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			addon := newDeletingAddon(test.annotations)
+			now := addon.DeletionTimestamp.Add(test.elapsed)
+
+			if test.notDeleting {
+				addon.DeletionTimestamp = nil
+			}
+
+			if test.condition != nil {
+				addon.Status.Conditions = []metav1.Condition{*test.condition}
+			}
+
+			objects := []runtime.Object{addon}
+			if !test.noHookWork {
+				objects = append(objects, newHookWork(constants.PreDeleteHookWorkName(addon.Name), "pods",
+					test.feedback...))
+			}
+
+			tracker, addonClient, _ := newTestTracker(t, now, objects...)
+
+			err := tracker.sync(context.TODO(), factory.NewSyncContext("test"), addon.Namespace+"/"+addon.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if patched := len(addonClient.Actions()) > 0; patched != test.patched {
+				t.Fatalf("expected the addon to be patched: %v, got the actions %v", test.patched,
+					addonClient.Actions())
+			}
+
+			updated, err := addonClient.AddonV1alpha1().ManagedClusterAddOns("cluster1").Get(
+				context.TODO(), addon.Name, metav1.GetOptions{},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			condition := meta.FindStatusCondition(updated.Status.Conditions, UninstallCondition)
+
+			if test.reason == "" {
+				if condition != nil {
+					t.Fatalf("expected no uninstall condition, got %+v", condition)
+				}
+
+				return
+			}
+
+			if condition == nil || condition.Reason != test.reason || condition.Status != test.status {
+				t.Fatalf("expected the %s reason with the status %s, got %+v", test.reason, test.status, condition)
+			}
+
+			if removed := len(updated.Finalizers) == 0; removed != test.removed {
+				t.Fatalf("expected the finalizers to be removed: %v, got %v", test.removed, updated.Finalizers)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package addon
+
+import (
+	"slices"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+// proxyEnvVars are the agent environment variables that are always passed to the cleanup job.
+var proxyEnvVars = []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"}
+
+// UninstallHook declares the cleanup an addon agent needs on the cluster before it's removed. The
+// cleanup runs the `trigger-uninstall` command of the agent in a pre-delete Job, which is built from
+// the rendered agent Deployment so that it's scheduled, configured, and sized like the agent.
+type UninstallHook struct {
+	// AddonName is the name of the addon the hook belongs to.
+	AddonName string
+	// Container is the name of the agent container in the Deployment.
+	Container string
+	// Namespaces returns the namespaces of the policies that the cleanup must clear, with the
+	// primary policy namespace first. The cleanup is skipped when it returns no namespaces.
+	Namespaces func(
+		cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn, agent *appsv1.Deployment,
+	) []string
+	// Finalizers are the finalizers that the agent sets on the policies in those namespaces and
+	// removes during the cleanup. They are reported when the uninstall is forced or times out, since
+	// they may then need to be removed by hand.
+	Finalizers []string
+	// LogFlags are the logging flags of the agent, like "v", that are also passed to the cleanup with
+	// the values of the agent. They are read from the agent arguments, or from its logging ConfigMap
+	// when the agent reads its logging settings from it.
+	LogFlags []string
+	// InheritEnv are the names of the agent environment variables, in addition to the proxy
+	// settings, that are also passed to the cleanup.
+	InheritEnv []string
+}
+
+// leftovers describes what may be left on the cluster when the cleanup doesn't complete.
+func (h *UninstallHook) leftovers() string {
+	if len(h.Finalizers) == 0 {
+		return "policy resources may be left on the cluster"
+	}
+
+	return "policy resources may be left on the cluster, and the " + strings.Join(h.Finalizers, ", ") +
+		" finalizers may need to be removed from them by hand"
+}
+
+// podSpecOf returns the pod spec of the workload objects rendered by the addons, or nil.
+func podSpecOf(obj runtime.Object) *corev1.PodSpec {
+	switch typed := obj.(type) {
+	case *appsv1.Deployment:
+		return &typed.Spec.Template.Spec
+	case *batchv1.Job:
+		return &typed.Spec.Template.Spec
+	case *corev1.Pod:
+		return &typed.Spec
+	default:
+		return nil
+	}
+}
+
+// findAgentDeployment returns the rendered Deployment with the agent container, or nil.
+func findAgentDeployment(objects []runtime.Object, container string) (*appsv1.Deployment, *corev1.Container) {
+	for _, obj := range objects {
+		deployment, ok := obj.(*appsv1.Deployment)
+		if !ok {
+			continue
+		}
+
+		for i := range deployment.Spec.Template.Spec.Containers {
+			if deployment.Spec.Template.Spec.Containers[i].Name == container {
+				return deployment, &deployment.Spec.Template.Spec.Containers[i]
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// BuildUninstallJob returns the pre-delete cleanup Job for the rendered agent objects, or nil when
+// the hook doesn't apply to the cluster or the agent Deployment isn't rendered.
+func (h *UninstallHook) BuildUninstallJob(
+	cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1alpha1.ManagedClusterAddOn,
+	objects []runtime.Object,
+) *batchv1.Job {
+	deployment, agentContainer := findAgentDeployment(objects, h.Container)
+	if deployment == nil || len(agentContainer.Command) == 0 {
+		return nil
+	}
+
+	// Copy the agent settings so the Job doesn't share them with the Deployment
+	agent := agentContainer.DeepCopy()
+	agentPodSpec := deployment.Spec.Template.Spec.DeepCopy()
+
+	namespaces := h.Namespaces(cluster, addon, deployment)
+	if len(namespaces) == 0 {
+		return nil
+	}
+
+	args := []string{
+		"trigger-uninstall",
+		"--deployment-name=" + deployment.Name,
+		"--deployment-namespace=" + deployment.Namespace,
+		"--policy-namespace=" + namespaces[0],
+	}
+
+	for _, namespace := range namespaces[1:] {
+		args = append(args, "--additional-namespace="+namespace)
+	}
+
+	logArgs := append(slices.Clone(agent.Args), loggingConfigArgs(agent, agentPodSpec, objects)...)
+
+	for _, arg := range logArgs {
+		if slices.ContainsFunc(h.LogFlags, func(flag string) bool { return strings.HasPrefix(arg, "--"+flag+"=") }) {
+			args = append(args, arg)
+		}
+	}
+
+	env := []corev1.EnvVar{}
+
+	for _, envVar := range agent.Env {
+		if slices.Contains(proxyEnvVars, envVar.Name) || slices.Contains(h.InheritEnv, envVar.Name) {
+			env = append(env, envVar)
+		}
+	}
+
+	name := deployment.Name + "-uninstall"
+
+	labels := map[string]string{}
+	for key, value := range deployment.Labels {
+		labels[key] = value
+	}
+
+	labels["app"] = name
+
+	backoffLimit := int32(6)
+	terminationGracePeriod := int64(0)
+
+	return &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: batchv1.SchemeGroupVersion.String(),
+			Kind:       "Job",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: deployment.Namespace,
+			Labels:    labels,
+			Annotations: map[string]string{
+				addonapiv1alpha1.AddonPreDeleteHookAnnotationKey: "",
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"app": name},
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy:                 corev1.RestartPolicyOnFailure,
+					TerminationGracePeriodSeconds: &terminationGracePeriod,
+					ServiceAccountName:            agentPodSpec.ServiceAccountName,
+					DeprecatedServiceAccount:      agentPodSpec.DeprecatedServiceAccount,
+					ImagePullSecrets:              agentPodSpec.ImagePullSecrets,
+					NodeSelector:                  agentPodSpec.NodeSelector,
+					Tolerations:                   agentPodSpec.Tolerations,
+					Affinity:                      agentPodSpec.Affinity,
+					SecurityContext:               agentPodSpec.SecurityContext,
+					Containers: []corev1.Container{{
+						Name:            agent.Name + "-uninstall",
+						Image:           agent.Image,
+						ImagePullPolicy: agent.ImagePullPolicy,
+						Command:         agent.Command[:1],
+						Args:            args,
+						Env:             env,
+						Resources:       agent.Resources,
+						SecurityContext: agent.SecurityContext,
+					}},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,313 @@
+package addon
+
+import (
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+// testNamespaces returns a Namespaces function of an UninstallHook that returns the namespaces.
+func testNamespaces(
+	namespaces ...string,
+) func(*clusterv1.ManagedCluster, *addonapiv1alpha1.ManagedClusterAddOn, *appsv1.Deployment) []string {
+	return func(*clusterv1.ManagedCluster, *addonapiv1alpha1.ManagedClusterAddOn, *appsv1.Deployment) []string {
+		return namespaces
+	}
+}
+
+// newTestAgentDeployment returns a config-policy-controller Deployment with the scheduling, security,
+// resources, and environment settings of an agent.
+func newTestAgentDeployment() *appsv1.Deployment {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "config-policy-controller",
+			Namespace: "agent",
+			Labels:    map[string]string{"app": "config-policy-controller", "addon": "config-policy-controller"},
+		},
+	}
+
+	runAsNonRoot := true
+	deployment.Spec.Template.Spec = corev1.PodSpec{
+		ServiceAccountName: "config-policy-controller-sa",
+		ImagePullSecrets:   []corev1.LocalObjectReference{{Name: "pull-secret"}},
+		NodeSelector:       map[string]string{"node-role.kubernetes.io/infra": ""},
+		Tolerations: []corev1.Toleration{{
+			Key:      "node-role.kubernetes.io/infra",
+			Operator: corev1.TolerationOpExists,
+			Effect:   corev1.TaintEffectNoSchedule,
+		}},
+		Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+					MatchExpressions: []corev1.NodeSelectorRequirement{{
+						Key: "kubernetes.io/arch", Operator: corev1.NodeSelectorOpIn, Values: []string{"amd64"},
+					}},
+				}},
+			},
+		}},
+		SecurityContext: &corev1.PodSecurityContext{RunAsNonRoot: &runAsNonRoot},
+		Containers: []corev1.Container{{
+			Name:            "config-policy-controller",
+			Image:           "quay.io/open-cluster-management/config-policy-controller:latest",
+			ImagePullPolicy: corev1.PullIfNotPresent,
+			Command:         []string{"config-policy-controller", "controller"},
+			Args:            []string{"--enable-lease=true", "--v=2"},
+			Env: []corev1.EnvVar{
+				{Name: "HTTP_PROXY", Value: "http://proxy:3128"},
+				{Name: "HTTPS_PROXY", Value: "https://proxy:3129"},
+				{Name: "NO_PROXY", Value: ".cluster.local"},
+				{Name: "WATCH_NAMESPACE", Value: "cluster1"},
+				{Name: "OTHER", Value: "value"},
+			},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("25m"),
+					corev1.ResourceMemory: resource.MustParse("64Mi"),
+				},
+			},
+			SecurityContext: &corev1.SecurityContext{ReadOnlyRootFilesystem: &runAsNonRoot},
+		}},
+	}
+
+	return deployment
+}
+
+func TestBuildUninstallJob(t *testing.T) {
+	agentPodSpec := newTestAgentDeployment().Spec.Template.Spec
+	agent := agentPodSpec.Containers[0]
+
+	tests := map[string]struct {
+		hook    UninstallHook
+		objects []runtime.Object
+		// args are the arguments expected after the Deployment and policy namespace arguments, and
+		// env is the expected environment. They are ignored when no Job is expected.
+		args      []string
+		env       []string
+		noJob     bool
+		leftovers string
+	}{
+		"agent settings": {
+			hook:      UninstallHook{Namespaces: testNamespaces("cluster1")},
+			objects:   []runtime.Object{newTestAgentDeployment()},
+			env:       []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"},
+			leftovers: "policy resources may be left on the cluster",
+		},
+		"inherited environment and log flags": {
+			hook: UninstallHook{
+				Namespaces: testNamespaces("cluster1"),
+				LogFlags:   []string{"v"},
+				InheritEnv: []string{"WATCH_NAMESPACE"},
+			},
+			objects:   []runtime.Object{newTestAgentDeployment()},
+			args:      []string{"--v=2"},
+			env:       []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "WATCH_NAMESPACE"},
+			leftovers: "policy resources may be left on the cluster",
+		},
+		"additional namespaces and finalizers": {
+			hook: UninstallHook{
+				Namespaces: testNamespaces("cluster1", "policies", "gatekeeper"),
+				Finalizers: []string{"finalizer.one", "finalizer.two"},
+			},
+			objects: []runtime.Object{newTestAgentDeployment()},
+			args:    []string{"--additional-namespace=policies", "--additional-namespace=gatekeeper"},
+			env:     []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"},
+			leftovers: "policy resources may be left on the cluster, and the finalizer.one, finalizer.two " +
+				"finalizers may need to be removed from them by hand",
+		},
+		"no namespaces": {
+			hook:    UninstallHook{Namespaces: testNamespaces()},
+			objects: []runtime.Object{newTestAgentDeployment()},
+			noJob:   true,
+		},
+		"no agent Deployment": {
+			hook: UninstallHook{Namespaces: testNamespaces("cluster1")},
+			objects: []runtime.Object{
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller"}},
+			},
+			noJob: true,
+		},
+		"no agent container": {
+			hook: UninstallHook{Namespaces: testNamespaces("cluster1")},
+			objects: func() []runtime.Object {
+				deployment := newTestAgentDeployment()
+				deployment.Spec.Template.Spec.Containers[0].Name = "other"
+
+				return []runtime.Object{deployment}
+			}(),
+			noJob: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			hook := test.hook
+			hook.AddonName = "config-policy-controller"
+			hook.Container = "config-policy-controller"
+
+			job := hook.BuildUninstallJob(
+				newManagedCluster("cluster1", nil, nil),
+				&addonapiv1alpha1.ManagedClusterAddOn{ObjectMeta: metav1.ObjectMeta{Name: hook.AddonName}},
+				test.objects,
+			)
+
+			if test.noJob {
+				if job != nil {
+					t.Fatalf("expected no cleanup Job, got %+v", job)
+				}
+
+				return
+			}
+
+			if job == nil {
+				t.Fatal("expected the cleanup Job to be built")
+			}
+
+			if leftovers := hook.leftovers(); leftovers != test.leftovers {
+				t.Fatalf("expected the leftovers '%s', got '%s'", test.leftovers, leftovers)
+			}
+
+			if job.Name != "config-policy-controller-uninstall" || job.Namespace != "agent" {
+				t.Fatalf("expected the Job agent/config-policy-controller-uninstall, got %s/%s",
+					job.Namespace, job.Name)
+			}
+
+			if _, ok := job.Annotations[addonapiv1alpha1.AddonPreDeleteHookAnnotationKey]; !ok {
+				t.Fatalf("expected the Job to be a pre-delete hook, got the annotations %v", job.Annotations)
+			}
+
+			podSpec := job.Spec.Template.Spec
+
+			if podSpec.ServiceAccountName != agentPodSpec.ServiceAccountName ||
+				!reflect.DeepEqual(podSpec.ImagePullSecrets, agentPodSpec.ImagePullSecrets) ||
+				!reflect.DeepEqual(podSpec.NodeSelector, agentPodSpec.NodeSelector) ||
+				!reflect.DeepEqual(podSpec.Tolerations, agentPodSpec.Tolerations) ||
+				!reflect.DeepEqual(podSpec.Affinity, agentPodSpec.Affinity) ||
+				!reflect.DeepEqual(podSpec.SecurityContext, agentPodSpec.SecurityContext) {
+				t.Fatalf("expected the pod settings of the agent, got %+v", podSpec)
+			}
+
+			container := podSpec.Containers[0]
+
+			if container.Image != agent.Image || container.ImagePullPolicy != agent.ImagePullPolicy ||
+				!reflect.DeepEqual(container.Command, agent.Command[:1]) ||
+				!reflect.DeepEqual(container.Resources, agent.Resources) ||
+				!reflect.DeepEqual(container.SecurityContext, agent.SecurityContext) {
+				t.Fatalf("expected the container settings of the agent, got %+v", container)
+			}
+
+			args := append([]string{
+				"trigger-uninstall",
+				"--deployment-name=config-policy-controller",
+				"--deployment-namespace=agent",
+				"--policy-namespace=cluster1",
+			}, test.args...)
+
+			if !reflect.DeepEqual(container.Args, args) {
+				t.Fatalf("expected the arguments %v, got %v", args, container.Args)
+			}
+
+			env := make([]string, 0, len(container.Env))
+			for _, envVar := range container.Env {
+				env = append(env, envVar.Name)
+			}
+
+			if !reflect.DeepEqual(env, test.env) {
+				t.Fatalf("expected the environment variables %v, got %v", test.env, env)
+			}
+
+			// The Job must not share the settings of the rendered Deployment
+			deployment, _ := findAgentDeployment(test.objects, hook.Container)
+			deployment.Spec.Template.Spec.NodeSelector["changed"] = "true"
+			deployment.Spec.Template.Spec.Containers[0].Env[0].Value = "changed"
+
+			if _, ok := podSpec.NodeSelector["changed"]; ok || container.Env[0].Value == "changed" {
+				t.Fatal("expected the Job not to share the settings of the Deployment")
+			}
+		})
+	}
+}
+
+func TestBuildUninstallJobLogFlags(t *testing.T) {
+	hook := &UninstallHook{
+		AddonName:  "config-policy-controller",
+		Container:  "config-policy-controller",
+		Namespaces: testNamespaces("cluster1"),
+		LogFlags:   []string{"v"},
+	}
+
+	loggingConfigMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller-logging", Namespace: "agent"},
+		Data:       map[string]string{"log-encoder": "console", "log-level": "info", "v": "3"},
+	}
+
+	tests := map[string]struct {
+		args     []string
+		mounted  bool
+		expected []string
+	}{
+		"arguments": {
+			args:     []string{"controller", "--log-level=info", "--v=2", "--verbose=true"},
+			expected: []string{"--v=2"},
+		},
+		"logging ConfigMap": {
+			args:     []string{"controller", "--log-config-dir=/var/run/logging-config"},
+			mounted:  true,
+			expected: []string{"--v=3"},
+		},
+		"no logging settings": {
+			args: []string{"controller"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			deployment := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "config-policy-controller", Namespace: "agent"},
+			}
+			deployment.Spec.Template.Spec.Containers = []corev1.Container{{
+				Name:    "config-policy-controller",
+				Command: []string{"config-policy-controller"},
+				Args:    test.args,
+			}}
+
+			if test.mounted {
+				deployment.Spec.Template.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{{
+					Name: "logging-config", MountPath: "/var/run/logging-config",
+				}}
+				deployment.Spec.Template.Spec.Volumes = []corev1.Volume{{
+					Name: "logging-config",
+					VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: loggingConfigMap.Name},
+					}},
+				}}
+			}
+
+			job := hook.BuildUninstallJob(
+				newManagedCluster("cluster1", nil, nil),
+				&addonapiv1alpha1.ManagedClusterAddOn{ObjectMeta: metav1.ObjectMeta{Name: hook.AddonName}},
+				[]runtime.Object{deployment, loggingConfigMap},
+			)
+			if job == nil {
+				t.Fatal("expected the cleanup Job to be built")
+			}
+
+			expected := append([]string{
+				"trigger-uninstall",
+				"--deployment-name=config-policy-controller",
+				"--deployment-namespace=agent",
+				"--policy-namespace=cluster1",
+			}, test.expected...)
+
+			if args := job.Spec.Template.Spec.Containers[0].Args; !reflect.DeepEqual(args, expected) {
+				t.Fatalf("expected the arguments %v, got %v", expected, args)
+			}
+		})
+	}
+}
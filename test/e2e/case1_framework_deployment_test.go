@@ -526,17 +526,6 @@ var _ = Describe("Test framework deployment", func() {
 				"policy.open-cluster-management.io/sync-policies-on-multicluster-hub=true",
 			)
 
-			// This is a hack to trigger a reconcile.
-			Kubectl(
-				"-n",
-				cluster.clusterName,
-				"annotate",
-				"ManagedClusterAddOn",
-				case1ManagedClusterAddOnName,
-				"trigger-reconcile="+time.Now().Format(time.RFC3339),
-				"--overwrite",
-			)
-
 			By(logPrefix + "verifying that the spec sync is not disabled")
 
 			Eventually(func(g Gomega) {
@@ -137,6 +137,93 @@ var _ = Describe("Test config-policy-controller deployment", func() {
 			}
 		})
 
+	It("should migrate the config-policy-controller to a new install namespace without downtime",
+		func(ctx SpecContext) {
+			cluster := managedClusterList[0]
+			logPrefix := cluster.clusterType + " " + cluster.clusterName + ": "
+
+			getMigrationCondition := func(g Gomega) map[string]interface{} {
+				addon := GetWithTimeout(ctx, clientDynamic, gvrManagedClusterAddOn,
+					case2ManagedClusterAddOnName, cluster.clusterName, true, 30)
+
+				return getAddonCondition(addon, "InstallNamespaceMigration")
+			}
+
+			By(logPrefix + "deploying the default config-policy-controller managedclusteraddon")
+			Kubectl("apply", "-n", cluster.clusterName, "-f", case2ManagedClusterAddOnCR)
+			verifyConfigPolicyDeployment(ctx, logPrefix, cluster.clusterClient, cluster.clusterName, addonNamespace, 0)
+
+			By(logPrefix + "changing the install namespace in the AddOnDeploymentConfig")
+			Kubectl("apply", "-f", addOnDeploymentConfigWithAgentInstallNs)
+			DeferCleanup(func() {
+				By("Delete the AddOnDeploymentConfig")
+				Kubectl("delete", "-f", addOnDeploymentConfigWithAgentInstallNs)
+			})
+
+			Kubectl("apply", "-f", case2CMAAddonWithInstallNs)
+
+			By(logPrefix + "verifying the previous agent is kept while the migration is in progress")
+			Eventually(func(g Gomega) {
+				condition := getMigrationCondition(g)
+				g.Expect(condition).To(HaveKeyWithValue("status", "True"))
+				g.Expect(condition).To(HaveKeyWithValue("reason", "MigrationInProgress"))
+			}, 60, 1).Should(Succeed())
+
+			deploy := GetWithTimeout(
+				ctx, cluster.clusterClient, gvrDeployment, case2DeploymentName, agentInstallNs, true, 60,
+			)
+			Expect(deploy).NotTo(BeNil())
+
+			deploy = GetWithTimeout(
+				ctx, cluster.clusterClient, gvrDeployment, case2DeploymentName, addonNamespace, true, 30,
+			)
+			Expect(deploy).NotTo(BeNil())
+
+			By(logPrefix + "verifying the previous agent is stopped once the new agent holds the lease")
+			Eventually(func(g Gomega) {
+				g.Expect(getMigrationCondition(g)).To(
+					HaveKeyWithValue("message", ContainSubstring("the previous agent is stopped")))
+
+				previous, err := cluster.clusterClient.Resource(gvrDeployment).Namespace(addonNamespace).Get(
+					ctx, case2DeploymentName, metav1.GetOptions{},
+				)
+				g.Expect(err).ToNot(HaveOccurred())
+
+				replicas, _, _ := unstructured.NestedInt64(previous.Object, "spec", "replicas")
+				g.Expect(replicas).To(BeZero())
+
+				pods, err := cluster.clusterClient.Resource(gvrPod).Namespace(addonNamespace).List(
+					ctx, metav1.ListOptions{LabelSelector: case2PodSelector},
+				)
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(pods.Items).To(BeEmpty())
+			}, 180, 5).Should(Succeed())
+
+			By(logPrefix + "verifying the previous agent is removed once the new agent is healthy")
+			Eventually(func(g Gomega) {
+				condition := getMigrationCondition(g)
+				g.Expect(condition).To(HaveKeyWithValue("status", "False"))
+				g.Expect(condition).To(HaveKeyWithValue("reason", "MigrationCompleted"))
+			}, 300, 5).Should(Succeed())
+
+			deploy = GetWithTimeout(
+				ctx, cluster.clusterClient, gvrDeployment, case2DeploymentName, addonNamespace, false, 120,
+			)
+			Expect(deploy).To(BeNil())
+
+			deploy = GetWithTimeout(
+				ctx, cluster.clusterClient, gvrDeployment, case2DeploymentName, agentInstallNs, true, 30,
+			)
+			Expect(deploy).NotTo(BeNil())
+
+			By(logPrefix + "deleting the managedclusteraddon")
+			Kubectl("delete", "-n", cluster.clusterName, "-f", case2ManagedClusterAddOnCR, "--timeout=180s")
+			deploy = GetWithTimeout(
+				ctx, cluster.clusterClient, gvrDeployment, case2DeploymentName, agentInstallNs, false, 180,
+			)
+			Expect(deploy).To(BeNil())
+		})
+
 	It("should create the default config-policy-controller deployment on the managed cluster", func(ctx SpecContext) {
 		for i, cluster := range managedClusterList {
 			logPrefix := cluster.clusterType + " " + cluster.clusterName + ": "
@@ -494,9 +581,10 @@ var _ = Describe("Test config-policy-controller deployment", func() {
 					evaluationConcurrencyAnnotation,
 				)
 
-				By(fmt.Sprintf("%s annotating the managedclusteraddon with the %s annotation",
+				By(fmt.Sprintf("%s annotating the managedclusteraddon with the %s and %s annotations",
 					logPrefix,
-					prometheusEnabledAnnotation))
+					prometheusEnabledAnnotation,
+					prometheusScrapeIntervalAnnotation))
 				Kubectl(
 					"annotate",
 					"-n",
@@ -504,6 +592,7 @@ var _ = Describe("Test config-policy-controller deployment", func() {
 					"-f",
 					case2ManagedClusterAddOnCR,
 					prometheusEnabledAnnotation,
+					prometheusScrapeIntervalAnnotation,
 				)
 
 				By(logPrefix + "annotating the managedclusteraddon with the " + clientQPSAnnotation + " annotation")
@@ -564,6 +653,7 @@ var _ = Describe("Test config-policy-controller deployment", func() {
 					endpoints, _, _ := unstructured.NestedSlice(sm.Object, "spec", "endpoints")
 					g.Expect(endpoints).ToNot(BeEmpty())
 					g.Expect(endpoints[0].(map[string]interface{})["scheme"].(string)).To(Equal("http"))
+					g.Expect(endpoints[0].(map[string]interface{})["interval"].(string)).To(Equal("1m"))
 				}, 60, 3).Should(Succeed())
 
 				By(logPrefix + "verifying that the metrics Service exists")
@@ -662,6 +752,211 @@ var _ = Describe("Test config-policy-controller deployment", func() {
 			Kubectl("delete", "-f", addOnDeploymentConfigWithCustomVarsCR, "--timeout=15s")
 		})
 
+	It("should re-render the config-policy-controller deployment when the ManagedCluster labels change",
+		func(ctx SpecContext) {
+			for _, cluster := range managedClusterList[1:] {
+				logPrefix := cluster.clusterType + " " + cluster.clusterName + ": "
+				By(logPrefix + "deploying the default config-policy-controller managedclusteraddon")
+				Kubectl("apply", "-n", cluster.clusterName, "-f", case2ManagedClusterAddOnCR)
+
+				getArgs := func(g Gomega) []string {
+					deploy := GetWithTimeout(
+						ctx, cluster.clusterClient, gvrDeployment, case2DeploymentName, addonNamespace, true, 30,
+					)
+					containers, _, _ := unstructured.NestedSlice(
+						deploy.Object, "spec", "template", "spec", "containers",
+					)
+					g.Expect(containers).Should(HaveLen(1))
+
+					cont, ok := containers[0].(map[string]any)
+					g.Expect(ok).To(BeTrue())
+
+					args, _, _ := unstructured.NestedStringSlice(cont, "args")
+
+					return args
+				}
+
+				By(logPrefix + "verifying OperatorPolicy is disabled on a non-OpenShift cluster")
+				Eventually(getArgs, 60, 1).ShouldNot(ContainElement("--enable-operator-policy=true"))
+
+				By(logPrefix + "labeling the ManagedCluster with openshiftVersion-major=4")
+				Kubectl("label", "ManagedCluster", cluster.clusterName, "openshiftVersion-major=4")
+				DeferCleanup(Kubectl, "label", "ManagedCluster", cluster.clusterName, "openshiftVersion-major-")
+
+				By(logPrefix + "verifying OperatorPolicy is enabled without touching the ManagedClusterAddOn")
+				Eventually(getArgs, 60, 1).Should(ContainElements(
+					"--enable-operator-policy=true",
+					"--operator-policy-default-namespace=openshift-operators",
+				))
+
+				By(logPrefix + "removing the openshiftVersion-major label from the ManagedCluster")
+				Kubectl("label", "ManagedCluster", cluster.clusterName, "openshiftVersion-major-")
+
+				By(logPrefix + "verifying OperatorPolicy is disabled again")
+				Eventually(getArgs, 60, 1).ShouldNot(ContainElement("--enable-operator-policy=true"))
+
+				By(logPrefix + "deleting the managedclusteraddon")
+				Kubectl("delete", "-n", cluster.clusterName, "-f", case2ManagedClusterAddOnCR, "--timeout=180s")
+				deploy := GetWithTimeout(
+					ctx, cluster.clusterClient, gvrDeployment, case2DeploymentName, addonNamespace, false, 30,
+				)
+				Expect(deploy).To(BeNil())
+			}
+		})
+
+	It("should refuse hosted config-policy-controllers of different clusters in the same namespace",
+		Label("hosted-mode"),
+		func(ctx SpecContext) {
+			hubClusterConfig := managedClusterList[0]
+			hubClient := hubClusterConfig.clusterClient
+			installNamespace := "hosted-shared"
+
+			// The hub is also a managed cluster, so both addons can be hosted on it
+			first := managedClusterList[1]
+			second := hubClusterConfig
+
+			getNamespaceCondition := func(g Gomega, clusterName string) map[string]interface{} {
+				addon := GetWithTimeout(
+					ctx, clientDynamic, gvrManagedClusterAddOn, case2ManagedClusterAddOnName, clusterName, true, 30,
+				)
+				condition := getAddonCondition(addon, "HostedNamespaceAvailable")
+				g.Expect(condition).NotTo(BeNil())
+
+				return condition
+			}
+
+			setupClusterSecretForHostedMode(
+				ctx, "", hubClient, "config-policy-controller-managed-kubeconfig",
+				string(first.kubeconfig), installNamespace)
+
+			installAddonInHostedMode(
+				ctx, first.clusterName+": ", hubClient, case2ManagedClusterAddOnName,
+				first.clusterName, hubClusterConfig.clusterName, installNamespace, nil)
+
+			By("verifying the namespace is available for the first addon")
+			Eventually(func(g Gomega) {
+				condition := getNamespaceCondition(g, first.clusterName)
+				g.Expect(condition).To(HaveKeyWithValue("status", "True"))
+				g.Expect(condition).To(HaveKeyWithValue("reason", "NamespaceAvailable"))
+			}, 60, 1).Should(Succeed())
+
+			deploy := GetWithTimeout(ctx, hubClient, gvrDeployment, case2DeploymentName, installNamespace, true, 60)
+			Expect(deploy).NotTo(BeNil())
+
+			installAddonInHostedMode(
+				ctx, second.clusterName+": ", hubClient, case2ManagedClusterAddOnName,
+				second.clusterName, hubClusterConfig.clusterName, installNamespace, nil)
+
+			By("verifying the conflict is reported on both addons")
+			Eventually(func(g Gomega) {
+				condition := getNamespaceCondition(g, second.clusterName)
+				g.Expect(condition).To(HaveKeyWithValue("status", "False"))
+				g.Expect(condition).To(HaveKeyWithValue("reason", "NamespaceConflict"))
+				g.Expect(condition).To(HaveKeyWithValue("message", ContainSubstring(first.clusterName)))
+			}, 60, 1).Should(Succeed())
+
+			Eventually(func(g Gomega) {
+				condition := getNamespaceCondition(g, first.clusterName)
+				g.Expect(condition).To(HaveKeyWithValue("status", "True"))
+				g.Expect(condition).To(HaveKeyWithValue("reason", "NamespaceContended"))
+				g.Expect(condition).To(HaveKeyWithValue("message", ContainSubstring(second.clusterName)))
+			}, 60, 1).Should(Succeed())
+
+			By("verifying the first deployment is kept for the first cluster")
+			Consistently(func(g Gomega) {
+				deploy := GetWithTimeout(
+					ctx, hubClient, gvrDeployment, case2DeploymentName, installNamespace, true, 30,
+				)
+				containers, _, _ := unstructured.NestedSlice(deploy.Object, "spec", "template", "spec", "containers")
+				g.Expect(containers).To(HaveLen(1))
+				g.Expect(containers[0]).To(HaveKeyWithValue(
+					"args", ContainElement("--cluster-name="+first.clusterName),
+				))
+			}, 15, 3).Should(Succeed())
+
+			By("removing the first addon")
+			deleteCtx, deleteCancel := context.WithTimeout(ctx, 15*time.Second)
+			defer deleteCancel()
+
+			err := clientDynamic.Resource(gvrManagedClusterAddOn).Namespace(first.clusterName).Delete(
+				deleteCtx, case2ManagedClusterAddOnName, metav1.DeleteOptions{},
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			By("verifying the namespace becomes available for the second addon")
+			Eventually(func(g Gomega) {
+				condition := getNamespaceCondition(g, second.clusterName)
+				g.Expect(condition).To(HaveKeyWithValue("status", "True"))
+				g.Expect(condition).To(HaveKeyWithValue("reason", "NamespaceAvailable"))
+			}, 180, 1).Should(Succeed())
+
+			By("removing the second addon and the install namespace")
+			err = clientDynamic.Resource(gvrManagedClusterAddOn).Namespace(second.clusterName).Delete(
+				deleteCtx, case2ManagedClusterAddOnName, metav1.DeleteOptions{},
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			deploy = GetWithTimeout(ctx, hubClient, gvrDeployment, case2DeploymentName, installNamespace, false, 180)
+			Expect(deploy).To(BeNil())
+
+			Kubectl("delete", "namespace", installNamespace, "--ignore-not-found", "--timeout=60s",
+				fmt.Sprintf("--kubeconfig=%s1_e2e", kubeconfigFilename))
+		})
+
+	It("should refuse to deploy a config-policy-controller image older than the supported version",
+		func(ctx SpecContext) {
+			cluster := managedClusterList[0]
+			logPrefix := cluster.clusterType + " " + cluster.clusterName + ": "
+
+			By(logPrefix + "deploying the default config-policy-controller managedclusteraddon")
+			Kubectl("apply", "-n", cluster.clusterName, "-f", case2ManagedClusterAddOnCR)
+			deploy := GetWithTimeout(
+				ctx, cluster.clusterClient, gvrDeployment, case2DeploymentName, addonNamespace, true, 30,
+			)
+			Expect(deploy).NotTo(BeNil())
+
+			By(logPrefix + "verifying the agent is reported as compatible")
+			Eventually(func(g Gomega) {
+				addon := GetWithTimeout(
+					ctx, clientDynamic, gvrManagedClusterAddOn, case2DeploymentName, cluster.clusterName, true, 30,
+				)
+				condition := getAddonCondition(addon, "AgentVersionSkew")
+				g.Expect(condition).To(HaveKeyWithValue("status", "False"))
+			}, 60, 1).Should(Succeed())
+
+			By(logPrefix + "pinning an unsupported config-policy-controller image")
+			Kubectl("annotate", "-n", cluster.clusterName, "-f", case2ManagedClusterAddOnCR, "--overwrite",
+				`addon.open-cluster-management.io/values={"global":{"imageOverrides":`+
+					`{"config_policy_controller":"quay.io/open-cluster-management/config-policy-controller:v0.11.0"}}}`)
+
+			By(logPrefix + "verifying the version skew is reported")
+			Eventually(func(g Gomega) {
+				addon := GetWithTimeout(
+					ctx, clientDynamic, gvrManagedClusterAddOn, case2DeploymentName, cluster.clusterName, true, 30,
+				)
+				condition := getAddonCondition(addon, "AgentVersionSkew")
+				g.Expect(condition).To(HaveKeyWithValue("status", "True"))
+				g.Expect(condition).To(HaveKeyWithValue("reason", "UnsupportedAgentVersion"))
+			}, 60, 1).Should(Succeed())
+
+			By(logPrefix + "verifying the deployment still uses the previous image")
+			Consistently(func(g Gomega) {
+				deploy := GetWithTimeout(
+					ctx, cluster.clusterClient, gvrDeployment, case2DeploymentName, addonNamespace, true, 30,
+				)
+				containers, _, _ := unstructured.NestedSlice(deploy.Object, "spec", "template", "spec", "containers")
+				g.Expect(containers).To(HaveLen(1))
+				g.Expect(containers[0]).ToNot(HaveKeyWithValue("image", ContainSubstring("v0.11.0")))
+			}, 15, 3).Should(Succeed())
+
+			By(logPrefix + "deleting the managedclusteraddon")
+			Kubectl("delete", "-n", cluster.clusterName, "-f", case2ManagedClusterAddOnCR, "--timeout=180s")
+			deploy = GetWithTimeout(
+				ctx, cluster.clusterClient, gvrDeployment, case2DeploymentName, addonNamespace, false, 30,
+			)
+			Expect(deploy).To(BeNil())
+		})
+
 	It("should create a config-policy-controller deployment with metrics monitoring on OpenShift clusters",
 		func(ctx SpecContext) {
 			Expect(managedClusterList).ToNot(BeEmpty())
@@ -3,8 +3,13 @@
 package e2e
 
 import (
+	"context"
+	"encoding/base64"
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
@@ -12,6 +17,7 @@ const (
 	case3ManagedClusterAddOnCR           string = "../resources/standalonetemplating_addon_cr.yaml"
 	case3ClusterManagementAddOnDefaultCR string = "../resources/standalonetemplating_clustermanagementaddon.yaml"
 	case3SecretName                      string = "governance-standalone-hub-templating-info"
+	case3ManagedClusterAddOnName         string = "governance-standalone-hub-templating"
 )
 
 var _ = Describe("Test config-policy-controller deployment with standalone templating", Serial, func() {
@@ -81,5 +87,122 @@ var _ = Describe("Test config-policy-controller deployment with standalone templ
 				)
 				Expect(secret).NotTo(BeNil())
 			}
+
+			By("Verifying hub templating is disabled when the standalone-templating addon is deleted")
+			for _, cluster := range managedClusterList {
+				logPrefix := cluster.clusterType + " " + cluster.clusterName + ": "
+				By(logPrefix + "deleting the governance-standalone-hub-templating managedclusteraddon")
+				Kubectl("delete", "-n", cluster.clusterName, "-f", case3ManagedClusterAddOnCR, "--timeout=180s")
+
+				By(logPrefix + "verifying the standalone-hub-templates arg is removed")
+				Eventually(func(g Gomega) []string {
+					deploy := GetWithTimeout(
+						ctx, cluster.clusterClient, gvrDeployment, case2DeploymentName, addonNamespace, true, 30,
+					)
+					containers, _, _ := unstructured.NestedSlice(
+						deploy.Object, "spec", "template", "spec", "containers",
+					)
+					g.Expect(containers).Should(HaveLen(1))
+
+					cont, ok := containers[0].(map[string]any)
+					g.Expect(ok).To(BeTrue())
+
+					args, _, _ := unstructured.NestedStringSlice(cont, "args")
+
+					return args
+				}, 60, 1).ShouldNot(ContainElement(ContainSubstring("standalone-hub-templates")))
+			}
+		})
+
+	It("should place the standalone-templating outputs with the hosted config-policy-controller",
+		Label("hosted-mode"),
+		func(ctx SpecContext) {
+			for _, cluster := range managedClusterList[1:] {
+				Expect(cluster.clusterType).To(Equal("managed"))
+
+				hubClusterConfig := managedClusterList[0]
+				hubClient := hubClusterConfig.clusterClient
+				installNamespace := cluster.clusterName + "-hosted"
+				logPrefix := cluster.clusterType + " " + cluster.clusterName + ": "
+
+				setupClusterSecretForHostedMode(
+					ctx, logPrefix, hubClient, "config-policy-controller-managed-kubeconfig",
+					string(cluster.kubeconfig), installNamespace)
+
+				installAddonInHostedMode(
+					ctx, logPrefix, hubClient, case2ManagedClusterAddOnName,
+					cluster.clusterName, hubClusterConfig.clusterName, installNamespace, nil)
+
+				// The standalone-templating addon follows the config-policy-controller install namespace
+				installAddonInHostedMode(
+					ctx, logPrefix, hubClient, case3ManagedClusterAddOnName,
+					cluster.clusterName, hubClusterConfig.clusterName, cluster.clusterName+"-standalone", nil)
+
+				By(logPrefix + "verifying the standalone-templating addon is installed in " + installNamespace)
+				Eventually(func(g Gomega) string {
+					addon := GetWithTimeout(
+						ctx, clientDynamic, gvrManagedClusterAddOn, case3ManagedClusterAddOnName,
+						cluster.clusterName, true, 30,
+					)
+					namespace, _, _ := unstructured.NestedString(addon.Object, "status", "namespace")
+
+					return namespace
+				}, 60, 1).Should(Equal(installNamespace))
+
+				By(logPrefix + "verifying the " + case3SecretName + " secret was created on the hosting cluster")
+				secret := GetWithTimeout(ctx, hubClient, gvrSecret, case3SecretName, installNamespace, true, 60)
+				Expect(secret).NotTo(BeNil())
+
+				By(logPrefix + "verifying the hub group is the group of the managed cluster")
+				hubGroup, _, _ := unstructured.NestedString(secret.Object, "data", "hub.group")
+				Expect(base64.StdEncoding.DecodeString(hubGroup)).To(BeEquivalentTo(
+					"system:open-cluster-management:cluster:" + cluster.clusterName +
+						":addon:" + case3ManagedClusterAddOnName,
+				))
+
+				By(logPrefix + "verifying the hosted config-policy-controller mounts the hub kubeconfig secret")
+				Eventually(func(g Gomega) {
+					deploy := GetWithTimeout(
+						ctx, hubClient, gvrDeployment, case2DeploymentName, installNamespace, true, 30,
+					)
+					containers, _, _ := unstructured.NestedSlice(
+						deploy.Object, "spec", "template", "spec", "containers",
+					)
+					g.Expect(containers).Should(HaveLen(1))
+
+					cont, ok := containers[0].(map[string]any)
+					g.Expect(ok).To(BeTrue())
+
+					args, _, _ := unstructured.NestedStringSlice(cont, "args")
+					g.Expect(args).To(ContainElement(ContainSubstring("standalone-hub-templates")))
+
+					volumes, _, _ := unstructured.NestedSlice(deploy.Object, "spec", "template", "spec", "volumes")
+					g.Expect(volumes).To(ContainElement(HaveKeyWithValue("secret", HaveKeyWithValue(
+						"secretName", case3ManagedClusterAddOnName+"-hub-kubeconfig",
+					))))
+				}, 60, 1).Should(Succeed())
+
+				By(logPrefix + "verifying the standalone-templating agent is not deployed on the managed cluster")
+				secret = GetWithTimeout(
+					ctx, cluster.clusterClient, gvrSecret, case3SecretName, addonNamespace, false, 30,
+				)
+				Expect(secret).To(BeNil())
+
+				deleteCtx, deleteCancel := context.WithTimeout(ctx, 15*time.Second)
+				defer deleteCancel()
+
+				By(logPrefix + "removing the ManagedClusterAddOns")
+				for _, addonName := range []string{case3ManagedClusterAddOnName, case2ManagedClusterAddOnName} {
+					err := clientDynamic.Resource(gvrManagedClusterAddOn).Namespace(cluster.clusterName).Delete(
+						deleteCtx, addonName, metav1.DeleteOptions{},
+					)
+					Expect(err).ToNot(HaveOccurred())
+				}
+
+				deploy := GetWithTimeout(
+					ctx, hubClient, gvrDeployment, case2DeploymentName, installNamespace, false, 180,
+				)
+				Expect(deploy).To(BeNil())
+			}
 		})
 })
@@ -28,6 +28,7 @@ const (
 	evaluationConcurrencyAnnotation              string = "policy-evaluation-concurrency=5"
 	clientQPSAnnotation                          string = "client-qps=50"
 	prometheusEnabledAnnotation                  string = "prometheus-metrics-enabled=true"
+	prometheusScrapeIntervalAnnotation           string = "prometheus-scrape-interval=1m"
 	opPolicyEnabledAnnotation                    string = "operator-policy-disabled=false"
 	agentInstallNs                               string = "test-install-ns"
 	addOnDeploymentConfigCR                      string = "../resources/addondeploymentconfig.yaml"
@@ -191,6 +191,23 @@ func getAddonStatus(addon *unstructured.Unstructured) bool {
 	return false
 }
 
+// getAddonCondition returns the condition of the given type from the addon status, or nil if it
+// isn't set.
+func getAddonCondition(addon *unstructured.Unstructured, conditionType string) map[string]interface{} {
+	conditions, _, err := unstructured.NestedSlice(addon.Object, "status", "conditions")
+	if err != nil {
+		panic(err)
+	}
+
+	for _, item := range conditions {
+		if condition, ok := item.(map[string]interface{}); ok && condition["type"] == conditionType {
+			return condition
+		}
+	}
+
+	return nil
+}
+
 func debugCollection(podSelector string) {
 	namespaceSuffix := []string{""}
 	deploymentNamespaces := []string{addonNamespace, agentInstallNs}
@@ -0,0 +1,227 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package integration
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/library-go/pkg/controller/controllercmd"
+	"github.com/openshift/library-go/pkg/operator/events"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/clock"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	addonv1alpha1client "open-cluster-management.io/api/client/addon/clientset/versioned"
+	addoninformers "open-cluster-management.io/api/client/addon/informers/externalversions"
+	clusterv1client "open-cluster-management.io/api/client/cluster/clientset/versioned"
+	clusterv1informers "open-cluster-management.io/api/client/cluster/informers/externalversions"
+	workclientset "open-cluster-management.io/api/client/work/clientset/versioned"
+	workv1informers "open-cluster-management.io/api/client/work/informers/externalversions/work/v1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+
+	policyaddon "open-cluster-management.io/governance-policy-addon-controller/pkg/addon"
+	"open-cluster-management.io/governance-policy-addon-controller/pkg/addon/configpolicy"
+	"open-cluster-management.io/governance-policy-addon-controller/pkg/addon/policyframework"
+	"open-cluster-management.io/governance-policy-addon-controller/pkg/addon/standalonetemplating"
+)
+
+const (
+	configPolicyAddonName         = "config-policy-controller"
+	policyFrameworkAddonName      = "governance-policy-framework"
+	standaloneTemplatingAddonName = "governance-standalone-hub-templating"
+	kubeVersion                   = "v1.30.0"
+)
+
+var (
+	update = flag.Bool("update", false, "update the golden files with the rendered manifests")
+
+	kubeClient    kubernetes.Interface
+	addonClient   addonv1alpha1client.Interface
+	clusterClient clusterv1client.Interface
+	addonManager  *fakeAddonManager
+)
+
+func TestIntegration(t *testing.T) {
+	// The API server binaries are downloaded by the integration-test make target
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is not set to the envtest binaries, run the tests with 'make integration-test'")
+	}
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "governance policy addon controller integration Suite")
+}
+
+var _ = BeforeSuite(func() {
+	// The agent images are pinned so that the rendered manifests don't depend on the environment
+	for envVar, image := range map[string]string{
+		"CONFIG_POLICY_CONTROLLER_IMAGE": "quay.io/open-cluster-management/config-policy-controller:latest",
+		"GOVERNANCE_POLICY_FRAMEWORK_ADDON_IMAGE": "quay.io/open-cluster-management/" +
+			"governance-policy-framework-addon:latest",
+	} {
+		Expect(os.Setenv(envVar, image)).To(Succeed())
+	}
+
+	apiDir, err := exec.Command("go", "list", "-m", "-f", "{{.Dir}}", "open-cluster-management.io/api").Output()
+	Expect(err).ToNot(HaveOccurred())
+
+	crdDir := strings.TrimSpace(string(apiDir))
+
+	By("Starting the API server")
+	testEnv := &envtest.Environment{
+		CRDDirectoryPaths: []string{
+			filepath.Join(crdDir, "addon", "v1alpha1"),
+			filepath.Join(crdDir, "cluster", "v1"),
+			filepath.Join(crdDir, "cluster", "v1beta1"),
+			filepath.Join(crdDir, "work", "v1"),
+		},
+		ErrorIfCRDPathMissing: true,
+	}
+
+	cfg, err := testEnv.Start()
+	Expect(err).ToNot(HaveOccurred())
+
+	DeferCleanup(testEnv.Stop)
+
+	kubeClient = kubernetes.NewForConfigOrDie(cfg)
+	addonClient = addonv1alpha1client.NewForConfigOrDie(cfg)
+	clusterClient = clusterv1client.NewForConfigOrDie(cfg)
+
+	// The informers of the agents run until the end of the suite
+	ctx, cancel := context.WithCancel(context.Background())
+	DeferCleanup(cancel)
+
+	controllerContext := &controllercmd.ControllerContext{
+		KubeConfig:    cfg,
+		EventRecorder: events.NewInMemoryRecorder("policy-addon-integration", clock.RealClock{}),
+	}
+
+	By("Adding the agents to the addon manager")
+	addonManager = &fakeAddonManager{agents: map[string]agent.AgentAddon{}}
+
+	getAndAddAgents := []func(
+		context.Context, addonmanager.AddonManager, *controllercmd.ControllerContext, policyaddon.AgentOptions,
+	) error{
+		policyframework.GetAndAddAgent,
+		configpolicy.GetAndAddAgent,
+		standalonetemplating.GetAndAddAgent,
+	}
+
+	for _, getAndAddAgent := range getAndAddAgents {
+		Expect(getAndAddAgent(ctx, addonManager, controllerContext, policyaddon.AgentOptions{})).To(Succeed())
+	}
+})
+
+// fakeAddonManager keeps the agents added to it, so that they are rendered by the tests instead of
+// being deployed with ManifestWorks.
+type fakeAddonManager struct {
+	agents map[string]agent.AgentAddon
+}
+
+func (m *fakeAddonManager) AddAgent(agentAddon agent.AgentAddon) error {
+	m.agents[agentAddon.GetAgentAddonOptions().AddonName] = agentAddon
+
+	return nil
+}
+
+func (m *fakeAddonManager) Trigger(string, string) {}
+
+func (m *fakeAddonManager) StartWithInformers(
+	context.Context,
+	workclientset.Interface,
+	workv1informers.ManifestWorkInformer,
+	kubeinformers.SharedInformerFactory,
+	addoninformers.SharedInformerFactory,
+	clusterv1informers.SharedInformerFactory,
+	dynamicinformer.DynamicSharedInformerFactory,
+) error {
+	return nil
+}
+
+func (m *fakeAddonManager) Start(context.Context) error {
+	return nil
+}
+
+// createCluster creates the ManagedCluster and its namespace on the hub. Each test uses its own
+// cluster, so that the addons of other tests don't change what is rendered.
+func createCluster(ctx context.Context, name string) *clusterv1.ManagedCluster {
+	_, err := kubeClient.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+	}, metav1.CreateOptions{})
+	Expect(err).ToNot(HaveOccurred())
+
+	cluster, err := clusterClient.ClusterV1().ManagedClusters().Create(ctx, &clusterv1.ManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       clusterv1.ManagedClusterSpec{HubAcceptsClient: true},
+	}, metav1.CreateOptions{})
+	Expect(err).ToNot(HaveOccurred())
+
+	cluster.Status.Version.Kubernetes = kubeVersion
+
+	cluster, err = clusterClient.ClusterV1().ManagedClusters().UpdateStatus(ctx, cluster, metav1.UpdateOptions{})
+	Expect(err).ToNot(HaveOccurred())
+
+	return cluster
+}
+
+// render returns the manifests of the addon of the cluster, as the addon manager would deploy them.
+func render(
+	ctx context.Context, cluster *clusterv1.ManagedCluster, addonName string,
+) ([]runtime.Object, error) {
+	addon, err := addonClient.AddonV1alpha1().ManagedClusterAddOns(cluster.Name).Get(
+		ctx, addonName, metav1.GetOptions{},
+	)
+	Expect(err).ToNot(HaveOccurred())
+
+	return addonManager.agents[addonName].Manifests(cluster, addon)
+}
+
+// createAddon creates the ManagedClusterAddOn of the cluster with the annotations and configs.
+func createAddon(
+	ctx context.Context,
+	clusterName string,
+	addonName string,
+	annotations map[string]string,
+	configs ...addonapiv1alpha1.AddOnConfig,
+) {
+	_, err := addonClient.AddonV1alpha1().ManagedClusterAddOns(clusterName).Create(ctx,
+		&addonapiv1alpha1.ManagedClusterAddOn{
+			ObjectMeta: metav1.ObjectMeta{Name: addonName, Namespace: clusterName, Annotations: annotations},
+			Spec:       addonapiv1alpha1.ManagedClusterAddOnSpec{Configs: configs},
+		}, metav1.CreateOptions{})
+	Expect(err).ToNot(HaveOccurred())
+}
+
+// createDeploymentConfig creates an AddOnDeploymentConfig in the namespace and returns the config
+// referencing it.
+func createDeploymentConfig(
+	ctx context.Context, namespace string, spec addonapiv1alpha1.AddOnDeploymentConfigSpec,
+) addonapiv1alpha1.AddOnConfig {
+	config, err := addonClient.AddonV1alpha1().AddOnDeploymentConfigs(namespace).Create(ctx,
+		&addonapiv1alpha1.AddOnDeploymentConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "deployment-config", Namespace: namespace},
+			Spec:       spec,
+		}, metav1.CreateOptions{})
+	Expect(err).ToNot(HaveOccurred())
+
+	return addonapiv1alpha1.AddOnConfig{
+		ConfigGroupResource: addonapiv1alpha1.ConfigGroupResource{
+			Group: "addon.open-cluster-management.io", Resource: "addondeploymentconfigs",
+		},
+		ConfigReferent: addonapiv1alpha1.ConfigReferent{Name: config.Name, Namespace: config.Namespace},
+	}
+}
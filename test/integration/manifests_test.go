@@ -0,0 +1,209 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package integration
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	"sigs.k8s.io/yaml"
+)
+
+var _ = Describe("Rendering the addon manifests", func() {
+	DescribeTable("renders the default manifests in the golden file",
+		func(ctx SpecContext, addonName string, clusterName string) {
+			cluster := createCluster(ctx, clusterName)
+			createAddon(ctx, clusterName, addonName, nil)
+
+			objects, err := render(ctx, cluster, addonName)
+			Expect(err).ToNot(HaveOccurred())
+
+			expectGolden(filepath.Join("testdata", clusterName+".yaml"), objects)
+		},
+		Entry("config-policy-controller", configPolicyAddonName, "config-policy-defaults"),
+		Entry("governance-policy-framework", policyFrameworkAddonName, "policy-framework-defaults"),
+		Entry("governance-standalone-hub-templating", standaloneTemplatingAddonName, "standalone-templating-defaults"),
+	)
+
+	DescribeTable("renders the settings of the addon",
+		func(
+			ctx SpecContext,
+			addonName string,
+			clusterName string,
+			annotations map[string]string,
+			deploymentConfig *addonapiv1alpha1.AddOnDeploymentConfigSpec,
+			expected expectedManifests,
+		) {
+			cluster := createCluster(ctx, clusterName)
+
+			var configs []addonapiv1alpha1.AddOnConfig
+
+			if deploymentConfig != nil {
+				configs = append(configs, createDeploymentConfig(ctx, clusterName, *deploymentConfig))
+			}
+
+			createAddon(ctx, clusterName, addonName, annotations, configs...)
+
+			objects, err := render(ctx, cluster, addonName)
+			Expect(err).ToNot(HaveOccurred())
+
+			args := []string{}
+			kinds := []string{}
+
+			for _, obj := range objects {
+				kinds = append(kinds, obj.GetObjectKind().GroupVersionKind().Kind)
+
+				if deployment, ok := obj.(*appsv1.Deployment); ok {
+					for _, container := range deployment.Spec.Template.Spec.Containers {
+						args = append(args, container.Args...)
+					}
+				}
+
+				if expected.namespace == "" {
+					continue
+				}
+
+				accessor, err := meta.Accessor(obj)
+				Expect(err).ToNot(HaveOccurred())
+
+				if accessor.GetNamespace() != "" {
+					Expect(accessor.GetNamespace()).To(Equal(expected.namespace))
+				}
+			}
+
+			Expect(args).To(ContainElements(expected.args))
+			Expect(kinds).To(ContainElements(expected.kinds))
+
+			for _, kind := range expected.missingKinds {
+				Expect(kinds).ToNot(ContainElement(kind))
+			}
+		},
+		Entry("config-policy-controller with the values from annotations",
+			configPolicyAddonName, "config-policy-annotations", map[string]string{
+				"log-level":                     "4",
+				"policy-evaluation-concurrency": "3",
+				"prometheus-metrics-enabled":    "true",
+			}, nil, expectedManifests{
+				args: []string{
+					"--log-level=4", "--v=2", "--evaluation-concurrency=3", "--metrics-bind-address=0.0.0.0:8383",
+				},
+				kinds: []string{"Service", "ServiceMonitor"},
+			},
+		),
+		Entry("config-policy-controller with the values from customized variables",
+			configPolicyAddonName, "config-policy-customized-variables", nil,
+			&addonapiv1alpha1.AddOnDeploymentConfigSpec{
+				CustomizedVariables: []addonapiv1alpha1.CustomizedVariable{
+					{Name: "logLevel", Value: "2"},
+					{Name: "evaluationConcurrency", Value: "5"},
+				},
+			}, expectedManifests{
+				args:         []string{"--log-level=2", "--evaluation-concurrency=5"},
+				missingKinds: []string{"ServiceMonitor"},
+			},
+		),
+		Entry("governance-policy-framework with the values from annotations",
+			policyFrameworkAddonName, "policy-framework-annotations", map[string]string{
+				"log-level":                     "4",
+				"policy-evaluation-concurrency": "3",
+				"addon.open-cluster-management.io/on-multicluster-hub": "true",
+			}, nil, expectedManifests{
+				args:         []string{"--log-level=4", "--evaluation-concurrency=3", "--on-multicluster-hub=true"},
+				missingKinds: []string{"Job"},
+			},
+		),
+		Entry("governance-policy-framework with the values from customized variables",
+			policyFrameworkAddonName, "policy-framework-customized-variables", nil,
+			&addonapiv1alpha1.AddOnDeploymentConfigSpec{
+				CustomizedVariables: []addonapiv1alpha1.CustomizedVariable{
+					{Name: "logLevel", Value: "2"},
+					{Name: "clientQPS", Value: "50"},
+				},
+			}, expectedManifests{
+				args:  []string{"--log-level=2", "--client-max-qps=50"},
+				kinds: []string{"Job"},
+			},
+		),
+		Entry("governance-standalone-hub-templating with the install namespace of the AddOnDeploymentConfig",
+			standaloneTemplatingAddonName, "standalone-templating-install-namespace", nil,
+			&addonapiv1alpha1.AddOnDeploymentConfigSpec{AgentInstallNamespace: "policy-hub-templating"},
+			expectedManifests{kinds: []string{"Secret"}, namespace: "policy-hub-templating"},
+		),
+	)
+})
+
+// expectedManifests are the key fields of the rendered manifests of an addon with some settings,
+// while the golden files hold the manifests rendered with the defaults.
+type expectedManifests struct {
+	// args are some of the arguments of the containers of the agent Deployment
+	args []string
+	// kinds are some of the kinds of the objects
+	kinds []string
+	// missingKinds are kinds that no object has
+	missingKinds []string
+	// namespace is the namespace of all the namespaced objects, when it's set
+	namespace string
+}
+
+// expectGolden compares the objects with the golden file, or writes them to the golden file when
+// the tests are run with the -update flag. The objects of each kind are sorted by namespace and
+// name, since only the order of the kinds is stable when the charts are rendered.
+func expectGolden(path string, objects []runtime.Object) {
+	kinds := []schema.GroupVersionKind{}
+	objectsByKind := map[schema.GroupVersionKind][]runtime.Object{}
+
+	for _, obj := range objects {
+		gvk := obj.GetObjectKind().GroupVersionKind()
+		if _, ok := objectsByKind[gvk]; !ok {
+			kinds = append(kinds, gvk)
+		}
+
+		objectsByKind[gvk] = append(objectsByKind[gvk], obj)
+	}
+
+	sortKey := func(obj runtime.Object) string {
+		accessor, err := meta.Accessor(obj)
+		Expect(err).ToNot(HaveOccurred())
+
+		return accessor.GetNamespace() + "/" + accessor.GetName()
+	}
+
+	objects = []runtime.Object{}
+
+	for _, gvk := range kinds {
+		slices.SortFunc(objectsByKind[gvk], func(a, b runtime.Object) int {
+			return strings.Compare(sortKey(a), sortKey(b))
+		})
+
+		objects = append(objects, objectsByKind[gvk]...)
+	}
+
+	rendered := []byte{}
+
+	for _, obj := range objects {
+		content, err := yaml.Marshal(obj)
+		Expect(err).ToNot(HaveOccurred())
+
+		rendered = append(rendered, "---\n"...)
+		rendered = append(rendered, content...)
+	}
+
+	if *update {
+		Expect(os.WriteFile(path, rendered, 0o600)).To(Succeed())
+
+		return
+	}
+
+	golden, err := os.ReadFile(path) // #nosec G304 -- the golden files are in the repository
+	Expect(err).ToNot(HaveOccurred(), "run the tests with -update to create the golden file")
+	Expect(string(rendered)).To(Equal(string(golden)), "run the tests with -update to update the golden file")
+}
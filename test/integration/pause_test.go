@@ -0,0 +1,41 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package integration
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	policyaddon "open-cluster-management.io/governance-policy-addon-controller/pkg/addon"
+)
+
+var _ = Describe("Pausing the addons", func() {
+	DescribeTable("doesn't render the addon while it's paused",
+		func(ctx SpecContext, addonName string, clusterName string) {
+			cluster := createCluster(ctx, clusterName)
+			createAddon(ctx, clusterName, addonName, map[string]string{policyaddon.PolicyAddonPauseAnnotation: "true"})
+
+			_, err := render(ctx, cluster, addonName)
+			Expect(err).To(MatchError(ContainSubstring("paused due to the policy-addon-pause annotation")))
+
+			By("Setting the pause annotation to another value")
+			addons := addonClient.AddonV1alpha1().ManagedClusterAddOns(clusterName)
+
+			addon, err := addons.Get(ctx, addonName, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+
+			addon.Annotations[policyaddon.PolicyAddonPauseAnnotation] = "false"
+
+			_, err = addons.Update(ctx, addon, metav1.UpdateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+
+			objects, err := render(ctx, cluster, addonName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(objects).ToNot(BeEmpty())
+		},
+		Entry("config-policy-controller", configPolicyAddonName, "config-policy-paused"),
+		Entry("governance-policy-framework", policyFrameworkAddonName, "policy-framework-paused"),
+		Entry("governance-standalone-hub-templating", standaloneTemplatingAddonName, "standalone-templating-paused"),
+	)
+})
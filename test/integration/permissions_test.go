@@ -0,0 +1,95 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package integration
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+)
+
+var _ = Describe("Applying the hub permissions of the addons", func() {
+	DescribeTable("binds the hub ClusterRole to the group of the agent",
+		func(ctx SpecContext, addonName string, clusterName string, roleName string, bindsEntireAddon bool) {
+			cluster := createCluster(ctx, clusterName)
+			createAddon(ctx, clusterName, addonName, nil)
+
+			addon, err := addonClient.AddonV1alpha1().ManagedClusterAddOns(clusterName).Get(
+				ctx, addonName, metav1.GetOptions{},
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			permissionConfig := addonManager.agents[addonName].GetAgentAddonOptions().Registration.PermissionConfig
+			Expect(permissionConfig(cluster, addon)).To(Succeed())
+
+			role, err := kubeClient.RbacV1().ClusterRoles().Get(ctx, roleName, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(role.Rules).ToNot(BeEmpty())
+
+			// The permissions of the standalone hub templating addon are for all the clusters
+			groups := agent.DefaultGroups(clusterName, addonName)
+			expectedSubjects := []rbacv1.Subject{{APIGroup: rbacv1.GroupName, Kind: rbacv1.GroupKind, Name: groups[0]}}
+
+			if bindsEntireAddon {
+				expectedSubjects[0].Name = groups[1]
+			}
+
+			getBinding := func() (rbacv1.RoleRef, []rbacv1.Subject) {
+				if bindsEntireAddon {
+					binding, err := kubeClient.RbacV1().ClusterRoleBindings().Get(ctx, roleName, metav1.GetOptions{})
+					Expect(err).ToNot(HaveOccurred())
+
+					return binding.RoleRef, binding.Subjects
+				}
+
+				binding, err := kubeClient.RbacV1().RoleBindings(clusterName).Get(ctx, roleName, metav1.GetOptions{})
+				Expect(err).ToNot(HaveOccurred())
+
+				return binding.RoleRef, binding.Subjects
+			}
+
+			roleRef, subjects := getBinding()
+			Expect(roleRef.Kind).To(Equal("ClusterRole"))
+			Expect(roleRef.Name).To(Equal(roleName))
+			Expect(subjects).To(Equal(expectedSubjects))
+
+			By("Reverting the changes to the binding when the permissions are applied again")
+			if bindsEntireAddon {
+				binding, err := kubeClient.RbacV1().ClusterRoleBindings().Get(ctx, roleName, metav1.GetOptions{})
+				Expect(err).ToNot(HaveOccurred())
+
+				binding.Subjects[0].Name = "system:authenticated"
+
+				_, err = kubeClient.RbacV1().ClusterRoleBindings().Update(ctx, binding, metav1.UpdateOptions{})
+				Expect(err).ToNot(HaveOccurred())
+			} else {
+				binding, err := kubeClient.RbacV1().RoleBindings(clusterName).Get(ctx, roleName, metav1.GetOptions{})
+				Expect(err).ToNot(HaveOccurred())
+
+				binding.Subjects[0].Name = "system:authenticated"
+
+				_, err = kubeClient.RbacV1().RoleBindings(clusterName).Update(ctx, binding, metav1.UpdateOptions{})
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			Expect(permissionConfig(cluster, addon)).To(Succeed())
+
+			_, subjects = getBinding()
+			Expect(subjects).To(Equal(expectedSubjects))
+		},
+		Entry("config-policy-controller",
+			configPolicyAddonName, "config-policy-permissions",
+			"open-cluster-management:config-policy-controller-hub", false,
+		),
+		Entry("governance-policy-framework",
+			policyFrameworkAddonName, "policy-framework-permissions",
+			"open-cluster-management:policy-framework-hub", false,
+		),
+		Entry("governance-standalone-hub-templating",
+			standaloneTemplatingAddonName, "standalone-templating-permissions",
+			"open-cluster-management:governance-standalone-hub-templating", true,
+		),
+	)
+})